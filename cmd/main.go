@@ -2,15 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/hirano00o/disclaude/internal/api"
 	"github.com/hirano00o/disclaude/internal/bot"
 	"github.com/hirano00o/disclaude/internal/config"
+	"github.com/hirano00o/disclaude/internal/dashboard"
 	"github.com/hirano00o/disclaude/internal/db"
+	"github.com/hirano00o/disclaude/internal/health"
+	"github.com/hirano00o/disclaude/internal/metrics"
 
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
 
@@ -20,6 +28,20 @@ func main() {
 		logrus.WithError(err).Debug("No .env file found")
 	}
 
+	// サブコマンドの実行
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			logrus.WithError(err).Fatal("Failed to run migrate command")
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "token" {
+		if err := runToken(os.Args[2:]); err != nil {
+			logrus.WithError(err).Fatal("Failed to run token command")
+		}
+		return
+	}
+
 	// 設定の読み込み
 	cfg, err := config.Load()
 	if err != nil {
@@ -30,6 +52,25 @@ func main() {
 	logrus.SetLevel(logrus.InfoLevel)
 	logrus.SetFormatter(&logrus.JSONFormatter{})
 
+	// ヘルスチェックとHTTPサーバーの起動
+	// マイグレーション中もliveness/readinessを返せるよう、最初に起動する
+	checker := health.NewChecker()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", checker.LivenessHandler())
+	mux.Handle("/readyz", checker.ReadinessHandler())
+	httpServer := &http.Server{
+		Addr:    cfg.Server.Addr,
+		Handler: mux,
+	}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.WithError(err).Error("HTTP server stopped unexpectedly")
+		}
+	}()
+	logrus.WithField("addr", cfg.Server.Addr).Info("HTTP server started")
+
 	// データベース接続の初期化
 	dbConfig := db.DatabaseConfig{
 		Host:     cfg.Database.Host,
@@ -43,17 +84,35 @@ func main() {
 		logrus.WithError(err).Fatal("Failed to connect to database")
 	}
 	defer database.Close()
+	checker.AddReadinessCheck("database", database.PingContext)
 
 	// マイグレーションの実行
 	if err := db.Migrate(database); err != nil {
 		logrus.WithError(err).Fatal("Failed to run database migrations")
 	}
 
+	// メトリクスの登録
+	prometheus.MustRegister(metrics.NewStateCollector(database, cfg.Kubernetes.MaxSandboxes))
+
 	// Discord Botの初期化
 	discordBot, err := bot.New(cfg, database)
 	if err != nil {
 		logrus.WithError(err).Fatal("Failed to create Discord bot")
 	}
+	checker.AddReadinessCheck("kubernetes", discordBot.CheckKubernetes)
+
+	// 管理APIの登録（HTTPサーバーは起動済みのため、Botの作成後に追加する）
+	mux.Handle("/api/", api.NewServer(database, discordBot.PermissionService(), discordBot.SessionManager(), discordBot.AuditLogger()).Handler())
+
+	// Webダッシュボードの登録（Discord OAuth2の設定がある場合のみ）
+	if cfg.Dashboard.Enabled() {
+		dashboardServer := dashboard.NewServer(cfg.Dashboard, database, discordBot.PermissionService(), discordBot.SessionManager(), discordBot)
+		dashboardServer.SetDefaultGuild(cfg.Discord.GuildID)
+		dashboardHandler := dashboardServer.Handler()
+		mux.Handle("/dashboard", dashboardHandler)
+		mux.Handle("/dashboard/", dashboardHandler)
+		logrus.WithField("url", cfg.Dashboard.URL).Info("Dashboard enabled")
+	}
 
 	// Botの開始
 	ctx, cancel := context.WithCancel(context.Background())
@@ -63,6 +122,10 @@ func main() {
 		logrus.WithError(err).Fatal("Failed to start Discord bot")
 	}
 
+	// ゲートウェイ接続後はDiscordの切断をlivenessの失敗として扱う
+	checker.AddLivenessCheck("discord", discordBot.CheckDiscord)
+	checker.SetReady(true)
+
 	logrus.Info("Discord Claude bot started successfully")
 
 	// シグナルハンドリング
@@ -70,9 +133,19 @@ func main() {
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 	<-sc
 
-	// グレースフルシャットダウン
+	// グレースフルシャットダウン（ドレイン中はreadinessをfalseにする）
 	logrus.Info("Shutting down Discord Claude bot...")
+	checker.SetReady(false)
 	cancel()
-	discordBot.Stop()
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer drainCancel()
+	discordBot.Stop(drainCtx)
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logrus.WithError(err).Error("Failed to shut down HTTP server")
+	}
 	logrus.Info("Discord Claude bot stopped")
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/hirano00o/disclaude/internal/config"
+	"github.com/hirano00o/disclaude/internal/db"
+)
+
+// migrateUsage は migrate サブコマンドの使い方
+const migrateUsage = `Usage: disclaude migrate <command>
+
+Commands:
+  status      マイグレーションの適用状況を表示する
+  up          未適用のマイグレーションをすべて適用する
+  down [n]    適用済みのマイグレーションを新しい順にn件（デフォルト1件）ロールバックする`
+
+// runMigrate は migrate サブコマンドを実行する
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n\n%s", migrateUsage)
+	}
+
+	steps := 1
+	switch args[0] {
+	case "status", "up":
+		if len(args) > 1 {
+			return fmt.Errorf("too many arguments\n\n%s", migrateUsage)
+		}
+	case "down":
+		if len(args) > 2 {
+			return fmt.Errorf("too many arguments\n\n%s", migrateUsage)
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+			steps = n
+		}
+	default:
+		return fmt.Errorf("unknown migrate command: %s\n\n%s", args[0], migrateUsage)
+	}
+
+	cfg, err := config.LoadDatabase()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	database, err := db.NewConnection(db.DatabaseConfig{
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		User:     cfg.User,
+		Password: cfg.Password,
+		Database: cfg.Database,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "status":
+		statuses, err := db.GetMigrationStatus(ctx, database)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Time.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(os.Stdout, "%04d  %-30s  %s\n", status.Version, status.Name, appliedAt)
+		}
+	case "up":
+		applied, err := db.MigrateUp(ctx, database)
+		for _, migration := range applied {
+			fmt.Fprintf(os.Stdout, "applied     %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(os.Stdout, "no pending migrations")
+		}
+	case "down":
+		rolledBack, err := db.MigrateDown(ctx, database, steps)
+		for _, migration := range rolledBack {
+			fmt.Fprintf(os.Stdout, "rolled back %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(rolledBack) == 0 {
+			fmt.Fprintln(os.Stdout, "no applied migrations")
+		}
+	}
+
+	return nil
+}
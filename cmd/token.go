@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/hirano00o/disclaude/internal/auth"
+	"github.com/hirano00o/disclaude/internal/config"
+	"github.com/hirano00o/disclaude/internal/db"
+)
+
+// tokenUsage は token サブコマンドの使い方
+const tokenUsage = `Usage: disclaude token <command>
+
+Commands:
+  create <discord-id> <name> [guild-id]  ユーザーの管理API用アクセストークンを発行する（トークンは一度だけ表示される）
+                                         複数のサーバーに登録されているユーザーは guild-id でサーバーを指定する
+  list                                   発行済みのアクセストークンを表示する
+  revoke <id>                            アクセストークンを失効させる`
+
+// runToken は token サブコマンドを実行する
+func runToken(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing token command\n\n%s", tokenUsage)
+	}
+
+	tokenID := 0
+	switch args[0] {
+	case "create":
+		if len(args) != 3 && len(args) != 4 {
+			return fmt.Errorf("create requires <discord-id> and <name>\n\n%s", tokenUsage)
+		}
+	case "list":
+		if len(args) > 1 {
+			return fmt.Errorf("too many arguments\n\n%s", tokenUsage)
+		}
+	case "revoke":
+		if len(args) != 2 {
+			return fmt.Errorf("revoke requires <id>\n\n%s", tokenUsage)
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid token id: %s", args[1])
+		}
+		tokenID = n
+	default:
+		return fmt.Errorf("unknown token command: %s\n\n%s", args[0], tokenUsage)
+	}
+
+	cfg, err := config.LoadDatabase()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	database, err := db.NewConnection(db.DatabaseConfig{
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		User:     cfg.User,
+		Password: cfg.Password,
+		Database: cfg.Database,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer database.Close()
+
+	switch args[0] {
+	case "create":
+		var user *db.User
+		if len(args) == 4 {
+			user, err = database.GetUserByDiscordID(args[3], args[1])
+		} else {
+			user, err = auth.FindHomeUser(database, "", args[1])
+		}
+		if errors.Is(err, auth.ErrAmbiguousGuild) {
+			return fmt.Errorf("user %s is registered in multiple guilds, specify [guild-id]\n\n%s", args[1], tokenUsage)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		if user == nil {
+			return fmt.Errorf("user not found: %s", args[1])
+		}
+		token, tokenHash, err := auth.GenerateAPIToken()
+		if err != nil {
+			return err
+		}
+		created, err := database.CreateAPIToken(user.ID, args[2], tokenHash)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stdout, "created token %d for %s\n", created.ID, user.Username)
+		fmt.Fprintln(os.Stdout, token)
+	case "list":
+		tokens, err := database.ListAPITokens()
+		if err != nil {
+			return err
+		}
+
+		for _, token := range tokens {
+			lastUsedAt := "never"
+			if token.LastUsedAt.Valid {
+				lastUsedAt = token.LastUsedAt.Time.Format("2006-01-02 15:04:05")
+			}
+			status := "active"
+			if token.IsRevoked() {
+				status = "revoked"
+			}
+			fmt.Fprintf(os.Stdout, "%4d  user=%-6d  %-20s  %-8s  last used: %s\n", token.ID, token.UserID, token.Name, status, lastUsedAt)
+		}
+		if len(tokens) == 0 {
+			fmt.Fprintln(os.Stdout, "no tokens")
+		}
+	case "revoke":
+		if err := database.RevokeAPIToken(tokenID); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "revoked token %d\n", tokenID)
+	}
+
+	return nil
+}
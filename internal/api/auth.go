@@ -0,0 +1,63 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hirano00o/disclaude/internal/auth"
+	"github.com/hirano00o/disclaude/internal/db"
+
+	"github.com/sirupsen/logrus"
+)
+
+// authenticatedHandler は認証済みのユーザーを受け取るハンドラー
+type authenticatedHandler func(w http.ResponseWriter, r *http.Request, actor *db.User)
+
+// authenticated はBearerトークンを検証し、トークンの発行先ユーザーがcapabilityを持つ場合のみハンドラーに渡す
+// ロールはリクエストごとに確認するため、権限を失ったユーザーのトークンは即座に使えなくなる
+func (s *Server) authenticated(capability auth.Capability, next authenticatedHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="disclaude"`)
+			writeError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+
+		apiToken, err := s.db.GetAPITokenByHash(auth.HashAPIToken(token))
+		if err != nil {
+			writeInternalError(w, err, "Failed to get api token")
+			return
+		}
+		if apiToken == nil || apiToken.IsRevoked() {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="disclaude", error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+
+		actor, err := s.db.GetUserByID(apiToken.UserID)
+		if err != nil {
+			writeInternalError(w, err, "Failed to get token owner")
+			return
+		}
+		if actor == nil {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		if err := s.permService.Authorize(actor, capability, nil); err != nil {
+			if !auth.IsPermissionDenied(err) {
+				writeInternalError(w, err, "Failed to check permission")
+				return
+			}
+			writeError(w, http.StatusForbidden, fmt.Sprintf("%s capability is required", capability))
+			return
+		}
+
+		if err := s.db.TouchAPIToken(apiToken.ID); err != nil {
+			logrus.WithError(err).WithField("token_id", apiToken.ID).Warn("Failed to update api token last used time")
+		}
+
+		next(w, r, actor)
+	})
+}
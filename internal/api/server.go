@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/hirano00o/disclaude/internal/auth"
+	"github.com/hirano00o/disclaude/internal/db"
+
+	"github.com/sirupsen/logrus"
+)
+
+// openAPISpec は管理APIのOpenAPI仕様
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+const (
+	// defaultListLimit は一覧取得で件数が指定されなかった場合の件数
+	defaultListLimit = 50
+	// maxListLimit は一覧取得で指定できる最大件数
+	maxListLimit = 500
+)
+
+// SessionTerminator はセッションの強制終了を行うインターフェース
+// bot.SessionManager が実装する（ユーザーの削除時のセッションの終了にも使用する）
+type SessionTerminator interface {
+	ForceTerminateSession(ctx context.Context, sessionID int, actor *db.User, reason string) error
+	auth.UserSessionTerminator
+}
+
+// Server は管理用のREST APIサーバー
+// すべてのエンドポイント（OpenAPI仕様を除く）はアクセストークンによる認証と、エンドポイントごとの権限を必要とする
+type Server struct {
+	db          db.Store
+	permService *auth.PermissionService
+	userService *auth.UserService
+	sessions    SessionTerminator
+}
+
+// errorResponse はエラー時のレスポンス
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewServer は新しいServerを作成する
+// permServiceとauditはBotと共有し、権限の判定とユーザー管理操作の記録に使用する
+func NewServer(database db.Store, permService *auth.PermissionService, sessions SessionTerminator, audit *auth.AuditLogger) *Server {
+	userService := auth.NewUserService(database, permService)
+	userService.SetAuditLogger(audit)
+	userService.SetSessionTerminator(sessions)
+
+	return &Server{
+		db:          database,
+		permService: permService,
+		userService: userService,
+		sessions:    sessions,
+	}
+}
+
+// Handler は /api/v1 以下のルーティングを行うハンドラーを返す
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/v1/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(openAPISpec)
+	})
+
+	mux.Handle("GET /api/v1/users", s.authenticated(auth.CapabilityManageUsers, s.handleListUsers))
+	mux.Handle("POST /api/v1/users", s.authenticated(auth.CapabilityManageUsers, s.handleAddUser))
+	mux.Handle("GET /api/v1/users/{discordID}", s.authenticated(auth.CapabilityManageUsers, s.handleGetUser))
+	mux.Handle("DELETE /api/v1/users/{discordID}", s.authenticated(auth.CapabilityManageUsers, s.handleRemoveUser))
+	mux.Handle("POST /api/v1/users/{discordID}/promote", s.authenticated(auth.CapabilityManageUsers, s.handlePromoteUser))
+	mux.Handle("POST /api/v1/users/{discordID}/demote", s.authenticated(auth.CapabilityManageUsers, s.handleDemoteUser))
+
+	mux.Handle("GET /api/v1/sessions", s.authenticated(auth.CapabilityViewAllSessions, s.handleListSessions))
+	mux.Handle("GET /api/v1/sessions/{sessionID}", s.authenticated(auth.CapabilityViewAllSessions, s.handleGetSession))
+	mux.Handle("POST /api/v1/sessions/{sessionID}/terminate", s.authenticated(auth.CapabilityManageSessions, s.handleTerminateSession))
+	mux.Handle("GET /api/v1/sessions/{sessionID}/transcript", s.authenticated(auth.CapabilityViewAllSessions, s.handleGetTranscript))
+
+	mux.Handle("GET /api/v1/capacity", s.authenticated(auth.CapabilityViewAllSessions, s.handleGetCapacity))
+
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not found")
+	})
+
+	return mux
+}
+
+// writeJSON はJSONレスポンスを書き込む
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logrus.WithError(err).Error("Failed to write API response")
+	}
+}
+
+// writeError はエラーレスポンスを書き込む
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
+
+// writeInternalError は内部エラーをログに記録し、詳細を含まないエラーレスポンスを書き込む
+func writeInternalError(w http.ResponseWriter, err error, message string) {
+	logrus.WithError(err).Error(message)
+	writeError(w, http.StatusInternalServerError, "internal server error")
+}
+
+// parseLimit はクエリパラメーターlimitを解析する
+func parseLimit(r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultListLimit, true
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxListLimit {
+		return 0, false
+	}
+	return limit, true
+}
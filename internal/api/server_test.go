@@ -0,0 +1,241 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hirano00o/disclaude/internal/auth"
+	"github.com/hirano00o/disclaude/internal/db"
+)
+
+// fakeTerminator はテスト用のSessionTerminator
+type fakeTerminator struct {
+	db      db.Store
+	reasons map[int]string
+}
+
+func (f *fakeTerminator) ForceTerminateSession(ctx context.Context, sessionID int, actor *db.User, reason string) error {
+	f.reasons[sessionID] = reason
+	return f.db.UpdateSessionStatus(sessionID, "terminated")
+}
+
+func (f *fakeTerminator) TerminateUserSessions(ctx context.Context, user, actor *db.User, reason string) (int, error) {
+	sessions, err := f.db.ListSessions("active", 0)
+	if err != nil {
+		return 0, err
+	}
+
+	terminated := 0
+	for _, session := range sessions {
+		if session.OwnerUserID() != user.ID {
+			continue
+		}
+		if err := f.ForceTerminateSession(ctx, session.ID, actor, reason); err != nil {
+			return terminated, err
+		}
+		terminated++
+	}
+	return terminated, nil
+}
+
+// testEnv はテスト用のAPIサーバーと依存関係
+type testEnv struct {
+	db         *db.MemoryStore
+	terminator *fakeTerminator
+	server     *Server
+	handler    http.Handler
+	owner      *db.User
+	token      string
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	store := db.NewMemoryStore(10)
+	owner, err := store.CreateUser("", "100000000000000001", "owner", "owner")
+	if err != nil {
+		t.Fatalf("Failed to create owner: %v", err)
+	}
+
+	terminator := &fakeTerminator{db: store, reasons: make(map[int]string)}
+	server := NewServer(store, auth.NewPermissionService(store, auth.Limits{}), terminator, auth.NewAuditLogger(store))
+	env := &testEnv{
+		db:         store,
+		terminator: terminator,
+		server:     server,
+		handler:    server.Handler(),
+		owner:      owner,
+	}
+	env.token = env.issueToken(t, owner)
+	return env
+}
+
+// issueToken はユーザーのアクセストークンを発行する
+func (e *testEnv) issueToken(t *testing.T, user *db.User) string {
+	t.Helper()
+
+	token, tokenHash, err := auth.GenerateAPIToken()
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if _, err := e.db.CreateAPIToken(user.ID, "test", tokenHash); err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	return token
+}
+
+// do はオーナーのトークンでリクエストを送信する
+func (e *testEnv) do(t *testing.T, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	return e.doWithToken(t, e.token, method, path, body)
+}
+
+func (e *testEnv) doWithToken(t *testing.T, token, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Failed to encode request body: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// decode はレスポンスボディをデコードする
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+		t.Fatalf("Failed to decode response %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+// expectStatus はステータスコードを検証する
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("Expected status %d, got %d: %s", want, rec.Code, rec.Body.String())
+	}
+}
+
+// TestAuthentication はアクセストークンの検証のテスト
+func TestAuthentication(t *testing.T) {
+	env := newTestEnv(t)
+
+	// トークンなし
+	rec := env.doWithToken(t, "", http.MethodGet, "/api/v1/users", nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+	if rec.Header().Get("WWW-Authenticate") == "" {
+		t.Error("Expected WWW-Authenticate header")
+	}
+
+	// 未登録のトークン
+	rec = env.doWithToken(t, "dcl_unknown", http.MethodGet, "/api/v1/users", nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	// 有効なトークンは最終使用日時が更新される
+	rec = env.do(t, http.MethodGet, "/api/v1/users", nil)
+	expectStatus(t, rec, http.StatusOK)
+	stored, err := env.db.GetAPITokenByHash(auth.HashAPIToken(env.token))
+	if err != nil {
+		t.Fatalf("Failed to get token: %v", err)
+	}
+	if !stored.LastUsedAt.Valid {
+		t.Error("Expected last_used_at to be set")
+	}
+
+	// 失効したトークン
+	if err := env.db.RevokeAPIToken(stored.ID); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	rec = env.do(t, http.MethodGet, "/api/v1/users", nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
+
+// TestAuthenticationRequiresCapability はエンドポイントに必要な権限を持たないトークンが拒否されることのテスト
+func TestAuthenticationRequiresCapability(t *testing.T) {
+	env := newTestEnv(t)
+
+	user, err := env.db.CreateUser("", "100000000000000002", "alice", "user")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	token := env.issueToken(t, user)
+
+	rec := env.doWithToken(t, token, http.MethodGet, "/api/v1/users", nil)
+	expectStatus(t, rec, http.StatusForbidden)
+
+	// セッションの閲覧のみ可能なロールでは、ユーザー管理のエンドポイントは使用できない
+	if _, err := env.db.CreateRole("", "operator", "", []string{"view_all_sessions"}); err != nil {
+		t.Fatalf("Failed to create role: %v", err)
+	}
+	if err := env.db.UpdateUserRole("", user.DiscordID, "operator"); err != nil {
+		t.Fatalf("Failed to assign role: %v", err)
+	}
+	rec = env.doWithToken(t, token, http.MethodGet, "/api/v1/sessions", nil)
+	expectStatus(t, rec, http.StatusOK)
+	rec = env.doWithToken(t, token, http.MethodGet, "/api/v1/users", nil)
+	expectStatus(t, rec, http.StatusForbidden)
+
+	// 昇格後は使用できる
+	if err := env.db.UpdateUserRole("", user.DiscordID, "owner"); err != nil {
+		t.Fatalf("Failed to promote user: %v", err)
+	}
+	rec = env.doWithToken(t, token, http.MethodGet, "/api/v1/users", nil)
+	expectStatus(t, rec, http.StatusOK)
+}
+
+// TestOpenAPISpec はOpenAPI仕様が認証なしで取得でき、全エンドポイントを含むことのテスト
+func TestOpenAPISpec(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.doWithToken(t, "", http.MethodGet, "/api/v1/openapi.yaml", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	spec := rec.Body.String()
+	for _, path := range []string{
+		"/users:",
+		"/users/{discordID}:",
+		"/users/{discordID}/promote:",
+		"/users/{discordID}/demote:",
+		"/sessions:",
+		"/sessions/{sessionID}:",
+		"/sessions/{sessionID}/terminate:",
+		"/sessions/{sessionID}/transcript:",
+		"/capacity:",
+	} {
+		if !strings.Contains(spec, fmt.Sprintf("\n  %s\n", path)) {
+			t.Errorf("Expected OpenAPI spec to document %s", path)
+		}
+	}
+}
+
+// TestUnknownRoute は未定義のパスがJSONの404を返すことのテスト
+func TestUnknownRoute(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.do(t, http.MethodGet, "/api/v1/unknown", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+	if body := decode[errorResponse](t, rec); body.Error != "not found" {
+		t.Errorf("Expected error 'not found', got %q", body.Error)
+	}
+}
@@ -0,0 +1,329 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/db"
+
+	"github.com/sirupsen/logrus"
+)
+
+// validSessionStatuses は一覧取得で指定できるセッションの状態
+var validSessionStatuses = map[string]bool{"active": true, "inactive": true, "terminated": true, "failed": true}
+
+// sessionResponse はセッション情報のレスポンス
+type sessionResponse struct {
+	ID              int        `json:"id"`
+	UserID          *int       `json:"user_id"` // 所有者が削除された場合はnull
+	Owner           string     `json:"owner,omitempty"`
+	ThreadID        string     `json:"thread_id"`
+	SandboxName     string     `json:"sandbox_name"`
+	Status          string     `json:"status"`
+	CreatedAt       time.Time  `json:"created_at"`
+	TerminatedAt    *time.Time `json:"terminated_at,omitempty"`
+	DurationSeconds int64      `json:"duration_seconds"`
+}
+
+// sandboxResponse はサンドボックス情報のレスポンス
+type sandboxResponse struct {
+	PodName     string `json:"pod_name"`
+	Namespace   string `json:"namespace"`
+	CPULimit    string `json:"cpu_limit"`
+	MemoryLimit string `json:"memory_limit"`
+	Status      string `json:"status"`
+}
+
+// usageResponse は使用量のレスポンス
+type usageResponse struct {
+	Turns        int     `json:"turns"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+}
+
+// sessionDetailResponse はセッション詳細のレスポンス
+type sessionDetailResponse struct {
+	sessionResponse
+	Sandbox *sandboxResponse `json:"sandbox,omitempty"`
+	Usage   usageResponse    `json:"usage"`
+}
+
+// terminateSessionRequest はセッション強制終了のリクエスト
+type terminateSessionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// messageResponse は会話履歴の1件分のレスポンス
+type messageResponse struct {
+	ID        int       `json:"id"`
+	Role      string    `json:"role"`
+	Author    string    `json:"author,omitempty"`
+	Content   string    `json:"content"`
+	ExitCode  *int64    `json:"exit_code,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// transcriptResponse は会話履歴のレスポンス
+type transcriptResponse struct {
+	SessionID int               `json:"session_id"`
+	Messages  []messageResponse `json:"messages"`
+}
+
+// capacityResponse はサンドボックスの使用状況のレスポンス
+type capacityResponse struct {
+	Current        int `json:"current"`
+	Max            int `json:"max"`
+	Remaining      int `json:"remaining"`
+	ActiveSessions int `json:"active_sessions"`
+}
+
+// userNames はリクエスト中に取得したユーザー名のキャッシュ
+type userNames struct {
+	db    db.UserStore
+	names map[int]string
+}
+
+// get はユーザーIDに対応するユーザー名を返す（削除済みの場合は空文字）
+func (u *userNames) get(userID int) string {
+	if name, ok := u.names[userID]; ok {
+		return name
+	}
+
+	name := ""
+	if user, err := u.db.GetUserByID(userID); err != nil {
+		logrus.WithError(err).WithField("user_id", userID).Error("Failed to get user")
+	} else if user != nil {
+		name = user.Username
+	}
+	u.names[userID] = name
+	return name
+}
+
+// newSessionResponse はセッションをレスポンスの形式に変換する
+func newSessionResponse(session *db.Session, owner string) sessionResponse {
+	response := sessionResponse{
+		ID:          session.ID,
+		Owner:       owner,
+		ThreadID:    session.ThreadID,
+		SandboxName: session.SandboxName,
+		Status:      session.Status,
+		CreatedAt:   session.CreatedAt,
+	}
+
+	if session.HasOwner() {
+		userID := session.OwnerUserID()
+		response.UserID = &userID
+	}
+
+	end := time.Now()
+	if session.TerminatedAt.Valid {
+		response.TerminatedAt = &session.TerminatedAt.Time
+		end = session.TerminatedAt.Time
+	}
+	response.DurationSeconds = int64(end.Sub(session.CreatedAt).Seconds())
+
+	return response
+}
+
+// handleListSessions は GET /api/v1/sessions を処理する
+// トークンの所有者と同じギルドのユーザーのセッションのみを返す
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request, actor *db.User) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !validSessionStatuses[status] {
+		writeError(w, http.StatusBadRequest, "invalid status")
+		return
+	}
+	limit, ok := parseLimit(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxListLimit))
+		return
+	}
+
+	sessions, err := s.db.ListSessionsByGuild(actor.GuildID.String, status, limit)
+	if err != nil {
+		writeInternalError(w, err, "Failed to list sessions")
+		return
+	}
+
+	names := &userNames{db: s.db, names: make(map[int]string)}
+	response := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, newSessionResponse(session, names.get(session.OwnerUserID())))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleGetSession は GET /api/v1/sessions/{sessionID} を処理する
+func (s *Server) handleGetSession(w http.ResponseWriter, r *http.Request, actor *db.User) {
+	session, ok := s.lookupSession(w, actor, r.PathValue("sessionID"))
+	if !ok {
+		return
+	}
+
+	names := &userNames{db: s.db, names: make(map[int]string)}
+	response := sessionDetailResponse{sessionResponse: newSessionResponse(session, names.get(session.OwnerUserID()))}
+
+	sandbox, err := s.db.GetSandboxByPodName(session.SandboxName)
+	if err != nil {
+		writeInternalError(w, err, "Failed to get sandbox")
+		return
+	}
+	if sandbox != nil && sandbox.SessionID == session.ID {
+		response.Sandbox = &sandboxResponse{
+			PodName:     sandbox.PodName,
+			Namespace:   sandbox.Namespace,
+			CPULimit:    sandbox.CPULimit,
+			MemoryLimit: sandbox.MemoryLimit,
+			Status:      sandbox.Status,
+		}
+	}
+
+	usage, err := s.db.GetSessionUsage(session.ID)
+	if err != nil {
+		writeInternalError(w, err, "Failed to get session usage")
+		return
+	}
+	response.Usage = usageResponse{
+		Turns:        usage.Turns,
+		InputTokens:  usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+		CostUSD:      usage.CostUSD,
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleTerminateSession は POST /api/v1/sessions/{sessionID}/terminate を処理する
+func (s *Server) handleTerminateSession(w http.ResponseWriter, r *http.Request, actor *db.User) {
+	var request terminateSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	session, ok := s.lookupSession(w, actor, r.PathValue("sessionID"))
+	if !ok {
+		return
+	}
+	if !session.IsActive() {
+		writeError(w, http.StatusConflict, "session is not active")
+		return
+	}
+
+	reason := request.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("terminated via admin API by %s", actor.Username)
+	}
+
+	if err := s.sessions.ForceTerminateSession(r.Context(), session.ID, actor, reason); err != nil {
+		writeInternalError(w, err, "Failed to terminate session")
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"requester_id": actor.ID,
+		"session_id":   session.ID,
+		"reason":       reason,
+	}).Info("Session terminated via admin API")
+
+	updated, ok := s.lookupSession(w, actor, strconv.Itoa(session.ID))
+	if !ok {
+		return
+	}
+
+	names := &userNames{db: s.db, names: make(map[int]string)}
+	writeJSON(w, http.StatusOK, newSessionResponse(updated, names.get(updated.OwnerUserID())))
+}
+
+// handleGetTranscript は GET /api/v1/sessions/{sessionID}/transcript を処理する
+func (s *Server) handleGetTranscript(w http.ResponseWriter, r *http.Request, actor *db.User) {
+	session, ok := s.lookupSession(w, actor, r.PathValue("sessionID"))
+	if !ok {
+		return
+	}
+
+	messages, err := s.db.GetMessagesBySessionID(session.ID)
+	if err != nil {
+		writeInternalError(w, err, "Failed to get messages")
+		return
+	}
+
+	names := &userNames{db: s.db, names: make(map[int]string)}
+	response := transcriptResponse{
+		SessionID: session.ID,
+		Messages:  make([]messageResponse, 0, len(messages)),
+	}
+	for _, message := range messages {
+		m := messageResponse{
+			ID:        message.ID,
+			Role:      message.Role,
+			Content:   message.Content,
+			CreatedAt: message.CreatedAt,
+		}
+		if message.UserID.Valid {
+			m.Author = names.get(int(message.UserID.Int64))
+		}
+		if message.ExitCode.Valid {
+			exitCode := message.ExitCode.Int64
+			m.ExitCode = &exitCode
+		}
+		response.Messages = append(response.Messages, m)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleGetCapacity は GET /api/v1/capacity を処理する
+func (s *Server) handleGetCapacity(w http.ResponseWriter, r *http.Request, actor *db.User) {
+	usage, err := s.db.GetSandboxUsage()
+	if err != nil {
+		writeInternalError(w, err, "Failed to get sandbox usage")
+		return
+	}
+
+	activeSessions, err := s.db.CountActiveSessions()
+	if err != nil {
+		writeInternalError(w, err, "Failed to count active sessions")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, capacityResponse{
+		Current:        usage.CurrentCount,
+		Max:            usage.MaxCount,
+		Remaining:      usage.RemainingCapacity(),
+		ActiveSessions: activeSessions,
+	})
+}
+
+// lookupSession はIDでセッションを取得し、見つからない場合はエラーレスポンスを書き込む
+// actorと異なるギルドのセッションは見つからないものとして扱う
+func (s *Server) lookupSession(w http.ResponseWriter, actor *db.User, value string) (*db.Session, bool) {
+	sessionID, err := strconv.Atoi(value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid session id")
+		return nil, false
+	}
+
+	session, err := s.db.GetSessionByID(sessionID)
+	if err != nil {
+		writeInternalError(w, err, "Failed to get session")
+		return nil, false
+	}
+	if session == nil {
+		writeError(w, http.StatusNotFound, "session not found")
+		return nil, false
+	}
+
+	if !session.InGuild(actor.GuildID.String) {
+		writeError(w, http.StatusNotFound, "session not found")
+		return nil, false
+	}
+	return session, true
+}
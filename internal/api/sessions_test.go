@@ -0,0 +1,199 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/hirano00o/disclaude/internal/db"
+)
+
+// createSession はテスト用のセッションとサンドボックスを作成する
+func createSession(t *testing.T, env *testEnv, threadID string) *db.Session {
+	t.Helper()
+
+	session, err := env.db.CreateSession(env.owner.ID, threadID, "claude-"+threadID)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if _, err := env.db.CreateSandbox(session.ID, session.SandboxName, "disclaude"); err != nil {
+		t.Fatalf("Failed to create sandbox: %v", err)
+	}
+	return session
+}
+
+// TestSessionEndpoints はセッションの一覧・詳細取得のテスト
+func TestSessionEndpoints(t *testing.T) {
+	env := newTestEnv(t)
+	first := createSession(t, env, "thread-1")
+	second := createSession(t, env, "thread-2")
+	if err := env.db.UpdateSessionStatus(first.ID, "terminated"); err != nil {
+		t.Fatalf("Failed to update session: %v", err)
+	}
+
+	// 一覧は新しい順
+	rec := env.do(t, http.MethodGet, "/api/v1/sessions", nil)
+	expectStatus(t, rec, http.StatusOK)
+	sessions := decode[[]sessionResponse](t, rec)
+	if len(sessions) != 2 || sessions[0].ID != second.ID {
+		t.Fatalf("Unexpected sessions: %+v", sessions)
+	}
+	if sessions[0].Owner != env.owner.Username {
+		t.Errorf("Expected owner %s, got %s", env.owner.Username, sessions[0].Owner)
+	}
+	if sessions[1].TerminatedAt == nil {
+		t.Error("Expected terminated_at for terminated session")
+	}
+
+	// 状態による絞り込み
+	rec = env.do(t, http.MethodGet, "/api/v1/sessions?status=active", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if sessions := decode[[]sessionResponse](t, rec); len(sessions) != 1 || sessions[0].ID != second.ID {
+		t.Errorf("Unexpected active sessions: %+v", sessions)
+	}
+	rec = env.do(t, http.MethodGet, "/api/v1/sessions?status=unknown", nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = env.do(t, http.MethodGet, "/api/v1/sessions?limit=0", nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	// 詳細
+	rec = env.do(t, http.MethodGet, "/api/v1/sessions/"+strconv.Itoa(second.ID), nil)
+	expectStatus(t, rec, http.StatusOK)
+	detail := decode[sessionDetailResponse](t, rec)
+	if detail.Sandbox == nil || detail.Sandbox.PodName != second.SandboxName {
+		t.Errorf("Unexpected sandbox: %+v", detail.Sandbox)
+	}
+
+	rec = env.do(t, http.MethodGet, "/api/v1/sessions/999", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+	rec = env.do(t, http.MethodGet, "/api/v1/sessions/abc", nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+// TestTerminateSession はセッションの強制終了のテスト
+func TestTerminateSession(t *testing.T) {
+	env := newTestEnv(t)
+	session := createSession(t, env, "thread-1")
+	path := "/api/v1/sessions/" + strconv.Itoa(session.ID) + "/terminate"
+
+	// 理由を指定しない場合はデフォルトの理由が使われる
+	rec := env.do(t, http.MethodPost, path, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if response := decode[sessionResponse](t, rec); response.Status != "terminated" {
+		t.Errorf("Expected status terminated, got %s", response.Status)
+	}
+	if reason := env.terminator.reasons[session.ID]; reason != "terminated via admin API by owner" {
+		t.Errorf("Unexpected reason: %q", reason)
+	}
+
+	// 終了済みのセッション
+	rec = env.do(t, http.MethodPost, path, terminateSessionRequest{Reason: "again"})
+	expectStatus(t, rec, http.StatusConflict)
+
+	// 理由の指定
+	other := createSession(t, env, "thread-2")
+	rec = env.do(t, http.MethodPost, "/api/v1/sessions/"+strconv.Itoa(other.ID)+"/terminate", terminateSessionRequest{Reason: "maintenance"})
+	expectStatus(t, rec, http.StatusOK)
+	if reason := env.terminator.reasons[other.ID]; reason != "maintenance" {
+		t.Errorf("Expected reason maintenance, got %q", reason)
+	}
+
+	rec = env.do(t, http.MethodPost, "/api/v1/sessions/999/terminate", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+// TestDeletedUserSession は所有者が削除されたセッションの取得のテスト
+func TestDeletedUserSession(t *testing.T) {
+	env := newTestEnv(t)
+
+	alice, err := env.db.CreateUser("", "100000000000000002", "alice", "user")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	session, err := env.db.CreateSession(alice.ID, "thread-1", "claude-thread-1")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if _, err := env.db.CreateMessage(&db.Message{SessionID: session.ID, UserID: sql.NullInt64{Int64: int64(alice.ID), Valid: true}, Role: "user", Content: "ls"}); err != nil {
+		t.Fatalf("Failed to create message: %v", err)
+	}
+	if err := env.db.DeleteUser("", alice.DiscordID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+
+	// 所有者を削除してもセッションと会話履歴は同じギルドで取得できる
+	path := "/api/v1/sessions/" + strconv.Itoa(session.ID)
+	rec := env.do(t, http.MethodGet, path, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if detail := decode[sessionDetailResponse](t, rec); detail.UserID != nil || detail.Owner != "" {
+		t.Errorf("Expected session without owner, got %+v", detail.sessionResponse)
+	}
+
+	rec = env.do(t, http.MethodGet, path+"/transcript", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if transcript := decode[transcriptResponse](t, rec); len(transcript.Messages) != 1 || transcript.Messages[0].Content != "ls" {
+		t.Errorf("Expected transcript to be kept, got %+v", transcript.Messages)
+	}
+
+	rec = env.do(t, http.MethodGet, "/api/v1/sessions", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if sessions := decode[[]sessionResponse](t, rec); len(sessions) != 1 || sessions[0].ID != session.ID {
+		t.Errorf("Expected session without owner to be listed, got %+v", sessions)
+	}
+
+	// 他のギルドからは取得できない
+	if _, err := env.db.UpsertGuild("guild-b", ""); err != nil {
+		t.Fatalf("Failed to upsert guild: %v", err)
+	}
+	other, err := env.db.CreateUser("guild-b", "100000000000000003", "other", "owner")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	rec = env.doWithToken(t, env.issueToken(t, other), http.MethodGet, path+"/transcript", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+// TestGetTranscript は会話履歴の取得のテスト
+func TestGetTranscript(t *testing.T) {
+	env := newTestEnv(t)
+	session := createSession(t, env, "thread-1")
+
+	for _, message := range []*db.Message{
+		{SessionID: session.ID, UserID: sql.NullInt64{Int64: int64(env.owner.ID), Valid: true}, Role: "user", Content: "ls"},
+		{SessionID: session.ID, Role: "tool_result", Content: "README.md", ExitCode: sql.NullInt64{Int64: 0, Valid: true}},
+	} {
+		if _, err := env.db.CreateMessage(message); err != nil {
+			t.Fatalf("Failed to create message: %v", err)
+		}
+	}
+
+	rec := env.do(t, http.MethodGet, "/api/v1/sessions/"+strconv.Itoa(session.ID)+"/transcript", nil)
+	expectStatus(t, rec, http.StatusOK)
+	transcript := decode[transcriptResponse](t, rec)
+	if len(transcript.Messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(transcript.Messages))
+	}
+	if transcript.Messages[0].Author != env.owner.Username {
+		t.Errorf("Expected author %s, got %q", env.owner.Username, transcript.Messages[0].Author)
+	}
+	if exitCode := transcript.Messages[1].ExitCode; exitCode == nil || *exitCode != 0 {
+		t.Errorf("Expected exit code 0, got %v", exitCode)
+	}
+}
+
+// TestGetCapacity はサンドボックスの使用状況の取得のテスト
+func TestGetCapacity(t *testing.T) {
+	env := newTestEnv(t)
+	createSession(t, env, "thread-1")
+	if err := env.db.IncrementSandboxUsage(); err != nil {
+		t.Fatalf("Failed to increment usage: %v", err)
+	}
+
+	rec := env.do(t, http.MethodGet, "/api/v1/capacity", nil)
+	expectStatus(t, rec, http.StatusOK)
+	capacity := decode[capacityResponse](t, rec)
+	if capacity.Current != 1 || capacity.Max != 10 || capacity.Remaining != 9 || capacity.ActiveSessions != 1 {
+		t.Errorf("Unexpected capacity: %+v", capacity)
+	}
+}
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/auth"
+	"github.com/hirano00o/disclaude/internal/db"
+
+	"github.com/sirupsen/logrus"
+)
+
+// userResponse はユーザー情報のレスポンス
+type userResponse struct {
+	ID        int        `json:"id"`
+	DiscordID string     `json:"discord_id"`
+	Username  string     `json:"username"`
+	Role      string     `json:"role"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Disabled  bool       `json:"disabled"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// addUserRequest はユーザー追加のリクエスト
+type addUserRequest struct {
+	DiscordID string     `json:"discord_id"`
+	Username  string     `json:"username"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// newUserResponse はユーザーをレスポンスの形式に変換する
+func newUserResponse(user *db.User) userResponse {
+	response := userResponse{
+		ID:        user.ID,
+		DiscordID: user.DiscordID,
+		Username:  user.Username,
+		Role:      user.Role,
+		Disabled:  user.Disabled,
+		CreatedAt: user.CreatedAt,
+	}
+	if user.ExpiresAt.Valid {
+		expiresAt := user.ExpiresAt.Time
+		response.ExpiresAt = &expiresAt
+	}
+	return response
+}
+
+// isValidDiscordID はDiscordのユーザーID（snowflake形式）として妥当かチェックする
+func isValidDiscordID(discordID string) bool {
+	if len(discordID) < 15 || len(discordID) > 20 {
+		return false
+	}
+	for _, c := range discordID {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// handleListUsers は GET /api/v1/users を処理する
+// トークンの所有者と同じギルドのユーザーのみを返す
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request, actor *db.User) {
+	users, err := s.db.ListUsers()
+	if err != nil {
+		writeInternalError(w, err, "Failed to list users")
+		return
+	}
+
+	response := make([]userResponse, 0, len(users))
+	for _, user := range users {
+		if !user.InGuild(actor.GuildID.String) {
+			continue
+		}
+		response = append(response, newUserResponse(user))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleGetUser は GET /api/v1/users/{discordID} を処理する
+func (s *Server) handleGetUser(w http.ResponseWriter, r *http.Request, actor *db.User) {
+	user, ok := s.lookupUser(w, actor, r.PathValue("discordID"))
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+// handleAddUser は POST /api/v1/users を処理する
+func (s *Server) handleAddUser(w http.ResponseWriter, r *http.Request, actor *db.User) {
+	var request addUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !isValidDiscordID(request.DiscordID) {
+		writeError(w, http.StatusBadRequest, "invalid discord_id")
+		return
+	}
+	if request.Username == "" {
+		writeError(w, http.StatusBadRequest, "username is required")
+		return
+	}
+
+	expiresAt := sql.NullTime{}
+	if request.ExpiresAt != nil {
+		if !request.ExpiresAt.After(time.Now()) {
+			writeError(w, http.StatusBadRequest, "expires_at must be in the future")
+			return
+		}
+		expiresAt = sql.NullTime{Time: *request.ExpiresAt, Valid: true}
+	}
+
+	existing, err := s.db.GetUserByDiscordID(actor.GuildID.String, request.DiscordID)
+	if err != nil {
+		writeInternalError(w, err, "Failed to check existing user")
+		return
+	}
+	// アクセス期限が切れた・無効化されたユーザーは再度追加できる
+	if existing != nil && !existing.AccessEnded(time.Now()) {
+		writeError(w, http.StatusConflict, "user already exists")
+		return
+	}
+
+	user, err := s.userService.AddUser(actor.GuildID.String, actor.DiscordID, request.DiscordID, request.Username, expiresAt)
+	if err != nil {
+		writeUserServiceError(w, err, "Failed to add user")
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"requester_id": actor.ID,
+		"target_id":    user.ID,
+		"target_role":  "user",
+	}).Info("User added via admin API")
+
+	writeJSON(w, http.StatusCreated, newUserResponse(user))
+}
+
+// handleRemoveUser は DELETE /api/v1/users/{discordID} を処理する
+func (s *Server) handleRemoveUser(w http.ResponseWriter, r *http.Request, actor *db.User) {
+	user, ok := s.lookupUser(w, actor, r.PathValue("discordID"))
+	if !ok {
+		return
+	}
+	if user.ID == actor.ID {
+		writeError(w, http.StatusBadRequest, auth.ErrRemoveSelf.Error())
+		return
+	}
+
+	// 失敗した場合はユーザーが残るため、同じリクエストを再実行すると残りのセッションの終了から続けられる
+	terminated, err := s.userService.RemoveUser(r.Context(), actor.GuildID.String, actor.DiscordID, user.DiscordID)
+	if err != nil {
+		writeUserServiceError(w, err, "Failed to remove user")
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"requester_id":        actor.ID,
+		"target_id":           user.ID,
+		"terminated_sessions": terminated,
+	}).Info("User removed via admin API")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePromoteUser は POST /api/v1/users/{discordID}/promote を処理する
+func (s *Server) handlePromoteUser(w http.ResponseWriter, r *http.Request, actor *db.User) {
+	user, ok := s.lookupUser(w, actor, r.PathValue("discordID"))
+	if !ok {
+		return
+	}
+	if user.IsOwner() {
+		writeError(w, http.StatusConflict, "user is already an owner")
+		return
+	}
+
+	if err := s.userService.PromoteToOwner(actor.GuildID.String, actor.DiscordID, user.DiscordID); err != nil {
+		writeUserServiceError(w, err, "Failed to promote user")
+		return
+	}
+	user.Role = "owner"
+
+	logrus.WithFields(logrus.Fields{
+		"requester_id": actor.ID,
+		"target_id":    user.ID,
+		"target_role":  "owner",
+	}).Info("User promoted via admin API")
+
+	writeJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+// handleDemoteUser は POST /api/v1/users/{discordID}/demote を処理する
+func (s *Server) handleDemoteUser(w http.ResponseWriter, r *http.Request, actor *db.User) {
+	user, ok := s.lookupUser(w, actor, r.PathValue("discordID"))
+	if !ok {
+		return
+	}
+	if user.ID == actor.ID {
+		writeError(w, http.StatusBadRequest, auth.ErrDemoteSelf.Error())
+		return
+	}
+	if !user.IsOwner() {
+		writeError(w, http.StatusConflict, "user is not an owner")
+		return
+	}
+
+	if err := s.userService.DemoteFromOwner(actor.GuildID.String, actor.DiscordID, user.DiscordID); err != nil {
+		writeUserServiceError(w, err, "Failed to demote user")
+		return
+	}
+	user.Role = "user"
+
+	logrus.WithFields(logrus.Fields{
+		"requester_id": actor.ID,
+		"target_id":    user.ID,
+		"target_role":  "user",
+	}).Info("User demoted via admin API")
+
+	writeJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+// writeUserServiceError はユーザー管理の操作のエラーを対応するステータスのレスポンスとして書き込む
+// 権限の不足は403、自分自身への操作は400、それ以外は500とする
+func writeUserServiceError(w http.ResponseWriter, err error, message string) {
+	var permErr *auth.PermissionError
+	switch {
+	case errors.As(err, &permErr):
+		writeError(w, http.StatusForbidden, fmt.Sprintf("%s capability is required", permErr.Capability))
+	case errors.Is(err, auth.ErrRemoveSelf), errors.Is(err, auth.ErrDemoteSelf):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeInternalError(w, err, message)
+	}
+}
+
+// lookupUser はactorと同じギルドのユーザーをDiscord IDで取得し、見つからない場合はエラーレスポンスを書き込む
+func (s *Server) lookupUser(w http.ResponseWriter, actor *db.User, discordID string) (*db.User, bool) {
+	user, err := s.db.GetUserByDiscordID(actor.GuildID.String, discordID)
+	if err != nil {
+		writeInternalError(w, err, "Failed to get user")
+		return nil, false
+	}
+	if user == nil {
+		writeError(w, http.StatusNotFound, "user not found")
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hirano00o/disclaude/internal/auth"
+)
+
+// TestUserEndpoints はユーザー管理APIのテスト
+func TestUserEndpoints(t *testing.T) {
+	env := newTestEnv(t)
+	const aliceID = "100000000000000002"
+
+	// 追加
+	rec := env.do(t, http.MethodPost, "/api/v1/users", addUserRequest{DiscordID: aliceID, Username: "alice"})
+	expectStatus(t, rec, http.StatusCreated)
+	if user := decode[userResponse](t, rec); user.DiscordID != aliceID || user.Role != "user" {
+		t.Errorf("Unexpected user: %+v", user)
+	}
+
+	// 重複
+	rec = env.do(t, http.MethodPost, "/api/v1/users", addUserRequest{DiscordID: aliceID, Username: "alice"})
+	expectStatus(t, rec, http.StatusConflict)
+
+	// 不正なID
+	rec = env.do(t, http.MethodPost, "/api/v1/users", addUserRequest{DiscordID: "abc", Username: "bob"})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	// 一覧
+	rec = env.do(t, http.MethodGet, "/api/v1/users", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if users := decode[[]userResponse](t, rec); len(users) != 2 {
+		t.Errorf("Expected 2 users, got %d", len(users))
+	}
+
+	// 取得
+	rec = env.do(t, http.MethodGet, "/api/v1/users/"+aliceID, nil)
+	expectStatus(t, rec, http.StatusOK)
+	rec = env.do(t, http.MethodGet, "/api/v1/users/100000000000000099", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	// 昇格
+	rec = env.do(t, http.MethodPost, "/api/v1/users/"+aliceID+"/promote", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if user := decode[userResponse](t, rec); user.Role != "owner" {
+		t.Errorf("Expected role owner, got %s", user.Role)
+	}
+	rec = env.do(t, http.MethodPost, "/api/v1/users/"+aliceID+"/promote", nil)
+	expectStatus(t, rec, http.StatusConflict)
+
+	// 降格
+	rec = env.do(t, http.MethodPost, "/api/v1/users/"+aliceID+"/demote", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if user := decode[userResponse](t, rec); user.Role != "user" {
+		t.Errorf("Expected role user, got %s", user.Role)
+	}
+	rec = env.do(t, http.MethodPost, "/api/v1/users/"+env.owner.DiscordID+"/demote", nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	// 削除（アクティブなセッションは削除前に終了する）
+	alice, _ := env.db.GetUserByDiscordID("", aliceID)
+	session, err := env.db.CreateSession(alice.ID, "thread-alice", "sandbox-alice")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	rec = env.do(t, http.MethodDelete, "/api/v1/users/"+env.owner.DiscordID, nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = env.do(t, http.MethodDelete, "/api/v1/users/"+aliceID, nil)
+	expectStatus(t, rec, http.StatusNoContent)
+
+	if reason := env.terminator.reasons[session.ID]; reason == "" {
+		t.Error("Expected alice's session to be terminated before removal")
+	}
+
+	user, err := env.db.GetUserByDiscordID("", aliceID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if user != nil {
+		t.Error("Expected user to be removed")
+	}
+
+	// 成功した操作はトークンの所有者を実行者として監査ログに記録される
+	events, err := env.db.ListAuditEvents("", aliceID, 0)
+	if err != nil {
+		t.Fatalf("Failed to list audit events: %v", err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("Expected 4 audit events, got %d", len(events))
+	}
+	for _, event := range events {
+		if event.ActorDiscordID != env.owner.DiscordID {
+			t.Errorf("Expected owner as actor, got %+v", event)
+		}
+	}
+}
+
+// TestUserEndpointsGuild はトークンの所有者と異なるギルドのユーザー・セッションが見えないことのテスト
+func TestUserEndpointsGuild(t *testing.T) {
+	env := newTestEnv(t)
+	const partnerID = "100000000000000003"
+
+	_, _ = env.db.UpsertGuild("guild1", "guild1")
+	_, _ = env.db.UpsertGuild("partner", "partner")
+	_ = env.db.AssignUserToGuild(env.owner.DiscordID, "guild1")
+	partner, _ := env.db.CreateUser("partner", partnerID, "partner", "user")
+	session, _ := env.db.CreateSession(partner.ID, "thread-partner", "sandbox-partner")
+
+	rec := env.do(t, http.MethodGet, "/api/v1/users", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if users := decode[[]userResponse](t, rec); len(users) != 1 || users[0].DiscordID != env.owner.DiscordID {
+		t.Errorf("Expected only users of the same guild, got %+v", users)
+	}
+
+	rec = env.do(t, http.MethodGet, "/api/v1/users/"+partnerID, nil)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	// 他のギルドに登録されたDiscordユーザーも、このギルドのユーザーとして別に追加できる
+	rec = env.do(t, http.MethodPost, "/api/v1/users", addUserRequest{DiscordID: partnerID, Username: "partner"})
+	expectStatus(t, rec, http.StatusCreated)
+	if added, _ := env.db.GetUserByDiscordID("guild1", partnerID); added == nil || added.ID == partner.ID {
+		t.Errorf("Expected a separate user in guild1, got %+v", added)
+	}
+	if other, _ := env.db.GetUserByDiscordID("partner", partnerID); other == nil || other.ID != partner.ID {
+		t.Errorf("Expected the partner guild user to be unchanged, got %+v", other)
+	}
+
+	rec = env.do(t, http.MethodGet, "/api/v1/sessions", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if sessions := decode[[]sessionResponse](t, rec); len(sessions) != 0 {
+		t.Errorf("Expected sessions of another guild to be hidden, got %+v", sessions)
+	}
+	rec = env.do(t, http.MethodPost, fmt.Sprintf("/api/v1/sessions/%d/terminate", session.ID), nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+// TestWriteUserServiceError はユーザー管理の操作のエラーとステータスの対応のテスト
+func TestWriteUserServiceError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{name: "permission denied", err: auth.ErrSessionViewOnly, status: http.StatusForbidden},
+		{name: "remove self", err: auth.ErrRemoveSelf, status: http.StatusBadRequest},
+		{name: "demote self", err: auth.ErrDemoteSelf, status: http.StatusBadRequest},
+		{name: "wrapped remove self", err: fmt.Errorf("failed: %w", auth.ErrRemoveSelf), status: http.StatusBadRequest},
+		{name: "internal", err: errors.New("connection refused"), status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeUserServiceError(rec, tt.err, "Failed to manage user")
+			expectStatus(t, rec, tt.status)
+			if tt.status == http.StatusInternalServerError {
+				if body := decode[errorResponse](t, rec); body.Error != "internal server error" {
+					t.Errorf("Expected internal error details to be hidden, got %q", body.Error)
+				}
+			}
+		})
+	}
+}
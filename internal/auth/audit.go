@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/hirano00o/disclaude/internal/db"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 監査ログに記録する操作の種類
+const (
+	AuditUserRegister     = "user_register"
+	AuditUserAdd          = "user_add"
+	AuditUserRemove       = "user_remove"
+	AuditUserPromote      = "user_promote"
+	AuditUserDemote       = "user_demote"
+	AuditUserRoleSync     = "user_role_sync"
+	AuditUserExpire       = "user_expire"
+	AuditUserRoleAssign   = "user_role_assign"
+	AuditRoleCreate       = "role_create"
+	AuditRoleUpdate       = "role_update"
+	AuditRoleDelete       = "role_delete"
+	AuditRoleBind         = "role_bind"
+	AuditRoleUnbind       = "role_unbind"
+	AuditSessionStart     = "session_start"
+	AuditSessionClose     = "session_close"
+	AuditSessionTerminate = "session_terminate"
+	AuditSessionInvite    = "session_invite"
+)
+
+// AuditLogger は特権操作・セッション操作を監査ログに記録する
+// nilの場合は何も記録しない
+type AuditLogger struct {
+	db     db.AuditStore
+	mirror func(event *db.AuditEvent)
+}
+
+// NewAuditLogger は新しいAuditLoggerを作成する
+func NewAuditLogger(database db.AuditStore) *AuditLogger {
+	return &AuditLogger{
+		db: database,
+	}
+}
+
+// SetMirror は記録した監査ログを転送する関数を設定する（Discordの管理チャンネルへの投稿など）
+func (l *AuditLogger) SetMirror(mirror func(event *db.AuditEvent)) {
+	l.mirror = mirror
+}
+
+// Record は監査ログを記録する
+// 記録の失敗で操作自体を失敗させないよう、エラーはログに出力するのみとする
+func (l *AuditLogger) Record(event *db.AuditEvent) {
+	if l == nil {
+		return
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"action":    event.Action,
+		"actor_id":  event.ActorDiscordID,
+		"target_id": event.TargetDiscordID.String,
+	})
+
+	created, err := l.db.CreateAuditEvent(event)
+	if err != nil {
+		logger.WithError(err).Error("Failed to record audit event")
+		return
+	}
+
+	logger.Info("Audit event recorded")
+
+	if l.mirror != nil {
+		l.mirror(created)
+	}
+}
+
+// RecordUserChange はユーザーの追加・削除・ロール変更を記録する
+// 追加時のbeforeRoleと削除時のafterRoleは空文字列とする
+func (l *AuditLogger) RecordUserChange(action string, actor, target *db.User, beforeRole, afterRole string) {
+	l.Record(&db.AuditEvent{
+		ActorDiscordID:  actor.DiscordID,
+		ActorUsername:   actor.Username,
+		Action:          action,
+		GuildID:         eventGuildID(actor, target),
+		TargetDiscordID: nullString(target.DiscordID),
+		TargetUsername:  nullString(target.Username),
+		BeforeRole:      nullString(beforeRole),
+		AfterRole:       nullString(afterRole),
+	})
+}
+
+// RecordSession はセッションの開始・終了を記録する
+// ownerはセッションの所有者で、削除済みの場合はnilを渡す
+func (l *AuditLogger) RecordSession(action string, actor, owner *db.User, session *db.Session, detail string) {
+	event := &db.AuditEvent{
+		ActorDiscordID: actor.DiscordID,
+		ActorUsername:  actor.Username,
+		Action:         action,
+		GuildID:        eventGuildID(actor, owner),
+		SessionID:      sql.NullInt64{Int64: int64(session.ID), Valid: true},
+		ThreadID:       nullString(session.ThreadID),
+		Detail:         detail,
+	}
+	if owner != nil {
+		event.TargetDiscordID = nullString(owner.DiscordID)
+		event.TargetUsername = nullString(owner.Username)
+	}
+
+	l.Record(event)
+}
+
+// RecordSessionInvite はセッションへのユーザーの招待を記録する
+func (l *AuditLogger) RecordSessionInvite(actor, member *db.User, session *db.Session, role string) {
+	l.Record(&db.AuditEvent{
+		ActorDiscordID:  actor.DiscordID,
+		ActorUsername:   actor.Username,
+		Action:          AuditSessionInvite,
+		GuildID:         eventGuildID(actor, member),
+		TargetDiscordID: nullString(member.DiscordID),
+		TargetUsername:  nullString(member.Username),
+		SessionID:       sql.NullInt64{Int64: int64(session.ID), Valid: true},
+		ThreadID:        nullString(session.ThreadID),
+		Detail:          "招待ロール: " + role,
+	})
+}
+
+// RecordRoleBinding はギルドロールの対応の登録・削除を記録する
+// 登録時は対応付けたロールをafterRole、削除時は削除前のロールをbeforeRoleとする
+func (l *AuditLogger) RecordRoleBinding(action string, actor *db.User, discordRoleID, beforeRole, afterRole string) {
+	l.Record(&db.AuditEvent{
+		ActorDiscordID: actor.DiscordID,
+		ActorUsername:  actor.Username,
+		Action:         action,
+		GuildID:        actor.GuildID,
+		BeforeRole:     nullString(beforeRole),
+		AfterRole:      nullString(afterRole),
+		Detail:         "Discordロール " + discordRoleID,
+	})
+}
+
+// RecordRoleDefinition はロールの作成・ケイパビリティの変更・削除を記録する
+// capabilitiesは操作後のケイパビリティ（削除時は削除前のもの）とする
+func (l *AuditLogger) RecordRoleDefinition(action string, actor *db.User, role string, capabilities []string) {
+	l.Record(&db.AuditEvent{
+		ActorDiscordID: actor.DiscordID,
+		ActorUsername:  actor.Username,
+		Action:         action,
+		GuildID:        actor.GuildID,
+		Detail:         fmt.Sprintf("ロール %s: %s", role, strings.Join(capabilities, ", ")),
+	})
+}
+
+// eventGuildID は監査ログを記録するギルドとして、最初にギルドに属しているユーザーのギルドを返す
+// 実行者がギルドに属さない場合（ギルド導入前のユーザーなど）は対象のユーザーのギルドで記録する
+func eventGuildID(users ...*db.User) sql.NullString {
+	for _, user := range users {
+		if user != nil && user.GuildID.Valid {
+			return user.GuildID
+		}
+	}
+	return sql.NullString{}
+}
+
+// nullString は空文字列をNULLとして扱うsql.NullStringを返す
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/hirano00o/disclaude/internal/db"
+)
+
+// TestUserServiceAudit はユーザー管理操作が監査ログに記録されることのテスト
+func TestUserServiceAudit(t *testing.T) {
+	store := db.NewMemoryStore(3)
+	audit := NewAuditLogger(store)
+	service := NewUserService(store, NewPermissionService(store, Limits{}))
+	service.SetAuditLogger(audit)
+
+	var mirrored []string
+	audit.SetMirror(func(event *db.AuditEvent) {
+		mirrored = append(mirrored, event.Action)
+	})
+
+	_, _ = service.InitializeUser("owner123", "owner", "", true)
+	_, _ = service.AddUser("", "owner123", "user123", "testuser", sql.NullTime{})
+	_ = service.PromoteToOwner("", "owner123", "user123")
+	_ = service.DemoteFromOwner("", "owner123", "user123")
+	_, _ = service.RemoveUser(context.Background(), "", "owner123", "user123")
+
+	// 失敗した操作は記録しない
+	_, _ = service.RemoveUser(context.Background(), "", "owner123", "user123")
+
+	events, err := store.ListAuditEvents("", "user123", 0)
+	if err != nil {
+		t.Fatalf("Failed to list audit events: %v", err)
+	}
+
+	expected := []struct {
+		action     string
+		beforeRole string
+		afterRole  string
+	}{
+		{AuditUserRemove, "user", ""},
+		{AuditUserDemote, "owner", "user"},
+		{AuditUserPromote, "user", "owner"},
+		{AuditUserAdd, "", "user"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d audit events, got %d", len(expected), len(events))
+	}
+	for i, want := range expected {
+		event := events[i]
+		if event.Action != want.action || event.BeforeRole.String != want.beforeRole || event.AfterRole.String != want.afterRole {
+			t.Errorf("Unexpected audit event %d: %+v", i, event)
+		}
+		if event.ActorDiscordID != "owner123" || event.TargetUsername.String != "testuser" {
+			t.Errorf("Unexpected actor or target in audit event %d: %+v", i, event)
+		}
+	}
+
+	if len(mirrored) != 5 || mirrored[0] != AuditUserRegister {
+		t.Errorf("Expected all audit events to be mirrored, got %v", mirrored)
+	}
+}
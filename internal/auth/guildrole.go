@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// guildRoleCacheTTL はギルドロールから解決したロールをキャッシュする期間
+// Discordでロールを変更してから反映されるまでの最大の遅延になる
+const guildRoleCacheTTL = 5 * time.Minute
+
+// MemberRoleResolver はDiscordのギルドメンバーが持つロールIDを取得する
+// bot.Bot が実装する（ギルドのメンバーでない場合は空のスライスを返す）
+type MemberRoleResolver interface {
+	MemberRoleIDs(guildID, discordID string) ([]string, error)
+}
+
+// guildRoleCache はギルドロールから解決したBotのロールのキャッシュ
+type guildRoleCache struct {
+	mu      sync.Mutex
+	entries map[guildRoleCacheKey]guildRoleCacheEntry
+}
+
+// guildRoleCacheKey はギルドとユーザーの組み合わせごとのキャッシュのキー
+type guildRoleCacheKey struct {
+	guildID   string
+	discordID string
+}
+
+// guildRoleCacheEntry はユーザーごとのキャッシュ
+type guildRoleCacheEntry struct {
+	role      string
+	expiresAt time.Time
+}
+
+// SetMemberRoleResolver はギルドロールの取得に使うMemberRoleResolverを設定し、ロール連携を有効にする
+func (s *PermissionService) SetMemberRoleResolver(resolver MemberRoleResolver) {
+	s.roleResolver = resolver
+}
+
+// ResolveGuildRole はguildIDのギルドでユーザーが持つギルドロールに対応するBotのロールを返す
+// 複数のロールに対応がある場合は最も多くのケイパビリティを持つロールを返し、対応がない場合やロール連携が無効な場合は空文字列を返す
+func (s *PermissionService) ResolveGuildRole(guildID, discordID string) (string, error) {
+	if s.roleResolver == nil || guildID == "" {
+		return "", nil
+	}
+
+	key := guildRoleCacheKey{guildID: guildID, discordID: discordID}
+	s.roleCache.mu.Lock()
+	entry, ok := s.roleCache.entries[key]
+	s.roleCache.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.role, nil
+	}
+
+	roleIDs, err := s.roleResolver.MemberRoleIDs(guildID, discordID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get member roles: %w", err)
+	}
+
+	bindings, err := s.db.ListRoleBindings()
+	if err != nil {
+		return "", fmt.Errorf("failed to list role bindings: %w", err)
+	}
+
+	roles, err := s.db.ListRoles()
+	if err != nil {
+		return "", fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	capabilityCounts := make(map[string]int, len(roles))
+	for _, role := range roles {
+		capabilityCounts[role.Name] = len(role.Capabilities)
+	}
+
+	memberRoles := make(map[string]bool, len(roleIDs))
+	for _, roleID := range roleIDs {
+		memberRoles[roleID] = true
+	}
+
+	// 対応するロールのうち、最も多くのケイパビリティを持つもの（同数の場合は先に連携したもの）を採用する
+	role := ""
+	for _, binding := range bindings {
+		if binding.GuildID.String != guildID || !memberRoles[binding.DiscordRoleID] {
+			continue
+		}
+		if role == "" || capabilityCounts[binding.Role] > capabilityCounts[role] {
+			role = binding.Role
+		}
+	}
+
+	s.roleCache.mu.Lock()
+	if s.roleCache.entries == nil {
+		s.roleCache.entries = make(map[guildRoleCacheKey]guildRoleCacheEntry)
+	}
+	s.roleCache.entries[key] = guildRoleCacheEntry{role: role, expiresAt: time.Now().Add(guildRoleCacheTTL)}
+	s.roleCache.mu.Unlock()
+
+	return role, nil
+}
+
+// InvalidateGuildRoleCache はギルドロールから解決したロールのキャッシュを破棄する
+// ロールの対応を変更したときに呼び出す
+func (s *PermissionService) InvalidateGuildRoleCache() {
+	s.roleCache.mu.Lock()
+	defer s.roleCache.mu.Unlock()
+
+	s.roleCache.entries = nil
+}
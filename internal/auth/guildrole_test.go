@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hirano00o/disclaude/internal/db"
+)
+
+// fakeRoleResolver はテスト用のMemberRoleResolver
+type fakeRoleResolver struct {
+	roles map[string][]string
+	calls int
+	err   error
+}
+
+func (f *fakeRoleResolver) MemberRoleIDs(guildID, discordID string) ([]string, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.roles[guildID+"/"+discordID], nil
+}
+
+// testGuildID はテストで使用するギルドID
+const testGuildID = "guild1"
+
+// TestPermissionServiceGuildRole はギルドロールからのロールの解決のテスト
+func TestPermissionServiceGuildRole(t *testing.T) {
+	store := db.NewMemoryStore(3)
+	service := NewPermissionService(store, Limits{})
+	resolver := &fakeRoleResolver{roles: map[string][]string{
+		"guild1/engineer123": {"role-engineering"},
+		"guild1/platform123": {"role-engineering", "role-platform"},
+		"guild1/reviewer123": {"role-engineering", "role-reviewer"},
+		"guild1/pinned123":   {"role-platform"},
+		"guild1/outsider123": {"role-sales"},
+		"guild2/engineer123": {"role-engineering", "role-other"},
+	}}
+	service.SetMemberRoleResolver(resolver)
+
+	_, _ = store.UpsertGuild(testGuildID, "guild1")
+	_, _ = store.UpsertGuild("guild2", "guild2")
+	_, _ = store.CreateRole(testGuildID, "reviewer", "", []string{"view_usage", "view_audit"})
+	_, _ = store.UpsertRoleBinding(testGuildID, "role-engineering", "user")
+	_, _ = store.UpsertRoleBinding(testGuildID, "role-platform", "owner")
+	_, _ = store.UpsertRoleBinding(testGuildID, "role-reviewer", "reviewer")
+	_, _ = store.UpsertRoleBinding("guild2", "role-other", "owner")
+
+	// 複数のロールに対応がある場合は最も多くのケイパビリティを持つロールになる
+	tests := []struct {
+		discordID string
+		expected  string
+	}{
+		{"engineer123", "user"},
+		{"platform123", "owner"},
+		{"reviewer123", "reviewer"},
+		{"outsider123", ""},
+		{"unknown123", ""},
+	}
+	for _, tt := range tests {
+		role, err := service.ResolveGuildRole(testGuildID, tt.discordID)
+		if err != nil {
+			t.Fatalf("Failed to resolve guild role for %s: %v", tt.discordID, err)
+		}
+		if role != tt.expected {
+			t.Errorf("Expected role %q for %s, got %q", tt.expected, tt.discordID, role)
+		}
+	}
+
+	// 他のギルドの対応は適用されない
+	if role, err := service.ResolveGuildRole("guild2", "engineer123"); err != nil || role != "owner" {
+		t.Errorf("Expected owner in guild2, got %q, %v", role, err)
+	}
+	if role, _ := service.ResolveGuildRole(testGuildID, "engineer123"); role != "user" {
+		t.Errorf("Expected guild2 binding not to apply in guild1, got %q", role)
+	}
+
+	// 明示的に登録されたユーザーはギルドロールより優先される
+	pinned, _ := store.CreateUser("", "pinned123", "pinned", "user")
+	if role, err := service.UserRole(pinned); err != nil || role.Name != "user" {
+		t.Errorf("Expected pinned role 'user', got %+v, %v", role, err)
+	}
+
+	// 解決結果はキャッシュされる
+	calls := resolver.calls
+	if _, err := service.ResolveGuildRole(testGuildID, "engineer123"); err != nil {
+		t.Fatalf("Failed to resolve guild role: %v", err)
+	}
+	if resolver.calls != calls {
+		t.Errorf("Expected cached guild role, got %d additional calls", resolver.calls-calls)
+	}
+
+	// 対応の変更後はキャッシュを破棄して再解決する
+	_, _ = store.UpsertRoleBinding(testGuildID, "role-engineering", "owner")
+	service.InvalidateGuildRoleCache()
+	if role, _ := service.ResolveGuildRole(testGuildID, "engineer123"); role != "owner" {
+		t.Errorf("Expected owner after rebinding, got %q", role)
+	}
+
+	// Discordに問い合わせできない場合は最後に同期したロールを使う
+	synced, _ := store.CreateUser(testGuildID, "synced123", "synced", "user")
+	_ = store.SetUserRoleSource(testGuildID, "synced123", "guild_role")
+	synced.RoleSource = "guild_role"
+	resolver.err = fmt.Errorf("discord unavailable")
+	if role, err := service.UserRole(synced); err != nil || role == nil || role.Name != "user" {
+		t.Errorf("Expected last synced role, got %+v, %v", role, err)
+	}
+	if _, err := service.ResolveGuildRole(testGuildID, "new123"); err == nil {
+		t.Error("Expected error for unsynced user when discord is unavailable")
+	}
+}
+
+// TestUserServiceSyncGuildRoleUser はギルドロールによるユーザーの登録・更新のテスト
+func TestUserServiceSyncGuildRoleUser(t *testing.T) {
+	store := db.NewMemoryStore(3)
+	service := NewUserService(store, NewPermissionService(store, Limits{}))
+	service.SetAuditLogger(NewAuditLogger(store))
+	_, _ = store.UpsertGuild(testGuildID, "guild1")
+	_, _ = store.UpsertGuild("guild2", "guild2")
+
+	// 対応するロールがない場合は登録しない
+	if user, err := service.SyncGuildRoleUser(testGuildID, "alice123", "alice", ""); err != nil || user != nil {
+		t.Fatalf("Expected no user without bound role, got %+v, %v", user, err)
+	}
+
+	user, err := service.SyncGuildRoleUser(testGuildID, "alice123", "alice", "user")
+	if err != nil {
+		t.Fatalf("Failed to sync user: %v", err)
+	}
+	if user.Role != "user" || !user.IsGuildRoleUser() || !user.InGuild(testGuildID) {
+		t.Errorf("Expected guild role user in guild1, got %+v", user)
+	}
+
+	// 他のギルドでは別のユーザーとして登録され、ロールは互いに影響しない
+	if other, err := service.SyncGuildRoleUser("guild2", "alice123", "alice", "owner"); err != nil || other.Role != "owner" || !other.InGuild("guild2") || other.ID == user.ID {
+		t.Errorf("Expected separate owner in guild2, got %+v, %v", other, err)
+	}
+	if stored, _ := store.GetUserByDiscordID(testGuildID, "alice123"); stored.Role != "user" {
+		t.Errorf("Expected role in guild1 not to follow another guild, got %+v", stored)
+	}
+
+	user, err = service.SyncGuildRoleUser(testGuildID, "alice123", "alice", "owner")
+	if err != nil {
+		t.Fatalf("Failed to sync user: %v", err)
+	}
+	if stored, _ := store.GetUserByDiscordID(testGuildID, "alice123"); user.Role != "owner" || stored.Role != "owner" {
+		t.Errorf("Expected role to follow guild role, got %+v", stored)
+	}
+
+	// オーナーによる明示的な変更は以降の同期で上書きされない
+	_, _ = service.InitializeUser("owner123", "owner", testGuildID, true)
+	if err := service.DemoteFromOwner(testGuildID, "owner123", "alice123"); err != nil {
+		t.Fatalf("Failed to demote user: %v", err)
+	}
+	user, err = service.SyncGuildRoleUser(testGuildID, "alice123", "alice", "owner")
+	if err != nil {
+		t.Fatalf("Failed to sync user: %v", err)
+	}
+	if user.Role != "user" || user.IsGuildRoleUser() {
+		t.Errorf("Expected pinned user role, got %+v", user)
+	}
+
+	events, _ := store.ListAuditEvents(testGuildID, "alice123", 0)
+	if len(events) != 3 || events[2].Action != AuditUserRoleSync || events[1].BeforeRole.String != "user" || events[0].Action != AuditUserDemote {
+		t.Errorf("Unexpected audit events: %+v", events)
+	}
+}
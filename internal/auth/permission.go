@@ -1,163 +1,232 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/hirano00o/disclaude/internal/db"
+
+	"github.com/sirupsen/logrus"
 )
 
+// PermissionDatabase は権限・利用上限の判定で必要なデータベース操作のインターフェース
+type PermissionDatabase interface {
+	db.UserStore
+	db.SessionStore
+	db.UsageStore
+	db.RoleBindingStore
+	db.RoleStore
+	db.SessionMemberStore
+	db.GuildStore
+}
+
 // PermissionService は権限管理を行うサービス
 type PermissionService struct {
-	db *db.DB
+	db            PermissionDatabase
+	defaultLimits Limits
+	roleResolver  MemberRoleResolver
+	roleCache     guildRoleCache
+	reservations  sessionReservations
 }
 
 // NewPermissionService は新しいPermissionServiceを作成する
-func NewPermissionService(database *db.DB) *PermissionService {
+func NewPermissionService(database PermissionDatabase, defaultLimits Limits) *PermissionService {
 	return &PermissionService{
-		db: database,
+		db:            database,
+		defaultLimits: defaultLimits,
 	}
 }
 
-// Permission は権限レベルを表す列挙型
-type Permission int
+// AccessExpiryFormat はユーザーのアクセス期限の表示形式
+const AccessExpiryFormat = "2006-01-02 15:04"
+
+// Capability はロールに割り当てる操作の権限を表す
+type Capability string
 
 const (
-	// PermissionNone は権限なし
-	PermissionNone Permission = iota
-	// PermissionUser は一般ユーザー権限
-	PermissionUser
-	// PermissionOwner はオーナー権限
-	PermissionOwner
+	// CapabilityCreateSandbox はセッションを開始し、自分のセッションを操作する権限
+	CapabilityCreateSandbox Capability = "create_sandbox"
+	// CapabilityViewAllSessions は全ユーザーのアクティブなセッションを一覧する権限
+	CapabilityViewAllSessions Capability = "view_all_sessions"
+	// CapabilityManageSessions は他のユーザーのセッションを操作・強制終了する権限
+	CapabilityManageSessions Capability = "manage_sessions"
+	// CapabilityManageUsers はユーザーの追加・削除・ロールの割り当てを行う権限
+	CapabilityManageUsers Capability = "manage_users"
+	// CapabilityManageConfig は利用上限・ロールの定義・ロール連携を変更する権限
+	CapabilityManageConfig Capability = "manage_config"
+	// CapabilityViewUsage は全ユーザーの使用量を確認する権限
+	CapabilityViewUsage Capability = "view_usage"
+	// CapabilityViewAudit は監査ログを確認する権限
+	CapabilityViewAudit Capability = "view_audit"
 )
 
-// GetUserPermission はユーザーの権限レベルを取得する
-func (s *PermissionService) GetUserPermission(discordID string) (Permission, error) {
-	user, err := s.db.GetUserByDiscordID(discordID)
-	if err != nil {
-		return PermissionNone, fmt.Errorf("failed to get user: %w", err)
-	}
+// Capabilities は定義されているすべてのケイパビリティ（組み込みのownerロールが持つもの）
+var Capabilities = []Capability{
+	CapabilityCreateSandbox,
+	CapabilityViewAllSessions,
+	CapabilityManageSessions,
+	CapabilityManageUsers,
+	CapabilityManageConfig,
+	CapabilityViewUsage,
+	CapabilityViewAudit,
+}
 
-	if user == nil {
-		return PermissionNone, nil
-	}
+// capabilityLabels は権限が不足している場合のメッセージに表示する操作の名前
+var capabilityLabels = map[Capability]string{
+	CapabilityCreateSandbox:   "サンドボックス操作",
+	CapabilityViewAllSessions: "セッション一覧の確認",
+	CapabilityManageSessions:  "セッション管理",
+	CapabilityManageUsers:     "ユーザー管理操作",
+	CapabilityManageConfig:    "設定の変更",
+	CapabilityViewUsage:       "使用量の確認",
+	CapabilityViewAudit:       "監査ログの確認",
+}
 
-	switch user.Role {
-	case "owner":
-		return PermissionOwner, nil
-	case "user":
-		return PermissionUser, nil
-	default:
-		return PermissionNone, nil
-	}
+// IsValidCapability は定義されているケイパビリティかチェックする
+func IsValidCapability(capability string) bool {
+	_, ok := capabilityLabels[Capability(capability)]
+	return ok
 }
 
-// CanCreateSandbox はサンドボックスを作成できるかチェックする
-func (s *PermissionService) CanCreateSandbox(discordID string) (bool, error) {
-	permission, err := s.GetUserPermission(discordID)
-	if err != nil {
-		return false, err
-	}
+// Resource は権限判定の対象となる、所有者を持つリソース（*db.Session など）
+// 所有者が削除された場合もギルドで判定できるよう、リソースが属するギルドを返す
+type Resource interface {
+	OwnerUserID() int
+	OwnerGuildID() string
+}
 
-	return permission >= PermissionUser, nil
+// Authorizer は操作の権限を判定するインターフェース（PermissionServiceが実装する）
+type Authorizer interface {
+	Authorize(actor *db.User, capability Capability, resource Resource) error
 }
 
-// CanManageUsers はユーザー管理ができるかチェックする
-func (s *PermissionService) CanManageUsers(discordID string) (bool, error) {
-	permission, err := s.GetUserPermission(discordID)
-	if err != nil {
-		return false, err
-	}
+// PermissionError は権限が不足していることを表すエラー
+// メッセージはそのままユーザーに表示できる
+type PermissionError struct {
+	Capability Capability
+	message    string
+}
 
-	return permission >= PermissionOwner, nil
+// Error はエラーメッセージを返す
+func (e *PermissionError) Error() string {
+	return e.message
 }
 
-// CanDeleteSandbox はサンドボックスを削除できるかチェックする
-func (s *PermissionService) CanDeleteSandbox(discordID string, sessionUserID int) (bool, error) {
-	permission, err := s.GetUserPermission(discordID)
-	if err != nil {
-		return false, err
+// ErrSessionViewOnly は閲覧者として招待されたユーザーがClaude Codeと会話しようとした場合のエラー
+var ErrSessionViewOnly = &PermissionError{
+	Capability: CapabilityCreateSandbox,
+	message:    "このセッションには閲覧者（viewer）として招待されているため、Claude Codeにメッセージを送信できません",
+}
+
+// IsPermissionDenied はエラーが権限の不足によるものかチェックする
+func IsPermissionDenied(err error) bool {
+	var permErr *PermissionError
+	return errors.As(err, &permErr)
+}
+
+// Authorize はユーザーが操作の権限を持つかチェックし、持たない場合は *PermissionError を返す
+// resourceが他のユーザーの所有するリソースの場合は、capabilityの代わりに CapabilityManageSessions を必要とする
+// resourceがnilの場合は所有者に関係なくcapabilityのみで判定する
+func (s *PermissionService) Authorize(actor *db.User, capability Capability, resource Resource) error {
+	if actor == nil {
+		return &PermissionError{Capability: capability, message: "ユーザーが登録されていません"}
 	}
 
-	// オーナーは全てのサンドボックスを削除可能
-	if permission >= PermissionOwner {
-		return true, nil
+	// 無効化されたユーザーやアクセス期限を過ぎたユーザーはロールに関係なくすべての操作を拒否する
+	if now := time.Now(); actor.AccessEnded(now) {
+		return &PermissionError{Capability: capability, message: accessEndedMessage(actor, now)}
 	}
 
-	// 一般ユーザーは自分のサンドボックスのみ削除可能
-	if permission >= PermissionUser {
-		user, err := s.db.GetUserByDiscordID(discordID)
-		if err != nil {
-			return false, fmt.Errorf("failed to get user: %w", err)
+	message := fmt.Sprintf("%sには `%s` 権限が必要です", capabilityLabels[capability], capability)
+	if resource != nil && resource.OwnerUserID() != actor.ID {
+		// 他のギルドのリソースは権限に関係なく操作できない
+		// 所有者が削除されたリソースは、他のユーザーのリソースと同様に manage_sessions 権限で操作できる
+		if resource.OwnerGuildID() != actor.GuildID.String {
+			return &PermissionError{Capability: CapabilityManageSessions, message: "他のサーバーのユーザーのセッションは操作できません"}
 		}
 
-		if user != nil && user.ID == sessionUserID {
-			return true, nil
-		}
+		message = fmt.Sprintf("他のユーザーのセッションの操作には `%s` 権限が必要です", CapabilityManageSessions)
+		capability = CapabilityManageSessions
 	}
 
-	return false, nil
-}
-
-// RequirePermission は必要な権限レベルをチェックし、不足している場合はエラーを返す
-func (s *PermissionService) RequirePermission(discordID string, requiredPermission Permission) error {
-	permission, err := s.GetUserPermission(discordID)
+	role, err := s.UserRole(actor)
 	if err != nil {
-		return fmt.Errorf("failed to get user permission: %w", err)
+		return fmt.Errorf("failed to get user role: %w", err)
 	}
 
-	if permission < requiredPermission {
-		switch requiredPermission {
-		case PermissionUser:
-			return fmt.Errorf("ユーザー権限が必要です")
-		case PermissionOwner:
-			return fmt.Errorf("オーナー権限が必要です")
-		default:
-			return fmt.Errorf("十分な権限がありません")
-		}
+	if role == nil || !role.HasCapability(string(capability)) {
+		return &PermissionError{Capability: capability, message: message}
 	}
 
 	return nil
 }
 
-// IsOwner はユーザーがオーナーかチェックする
-func (s *PermissionService) IsOwner(discordID string) (bool, error) {
-	permission, err := s.GetUserPermission(discordID)
-	if err != nil {
-		return false, err
+// AuthorizeSession はセッションの操作を許可するかチェックし、許可しない場合は *PermissionError を返す
+// 所有者と manage_sessions 権限を持つユーザーに加えて、memberRole以上のロールで招待されたユーザーを許可する
+// memberRoleが空文字列の場合は招待されたユーザーを許可しない（セッションの終了など）
+func (s *PermissionService) AuthorizeSession(actor *db.User, session *db.Session, memberRole string) error {
+	err := s.Authorize(actor, CapabilityCreateSandbox, session)
+	if err == nil || !IsPermissionDenied(err) || actor == nil || memberRole == "" {
+		return err
 	}
 
-	return permission == PermissionOwner, nil
-}
+	// 無効化されたユーザーやアクセス期限を過ぎたユーザーは、招待されていても操作できない
+	if actor.AccessEnded(time.Now()) {
+		return err
+	}
 
-// IsUser はユーザーが一般ユーザー以上の権限を持っているかチェックする
-func (s *PermissionService) IsUser(discordID string) (bool, error) {
-	permission, err := s.GetUserPermission(discordID)
-	if err != nil {
-		return false, err
+	member, memberErr := s.db.GetSessionMember(session.ID, actor.ID)
+	if memberErr != nil {
+		return fmt.Errorf("failed to get session member: %w", memberErr)
 	}
 
-	return permission >= PermissionUser, nil
+	if member == nil {
+		return err
+	}
+
+	if memberRole == db.SessionMemberCollaborator && !member.CanPrompt() {
+		return ErrSessionViewOnly
+	}
+
+	return nil
 }
 
-// ValidateUserAction はユーザーの行動が権限的に許可されているかチェックする
-func (s *PermissionService) ValidateUserAction(discordID string, action string) error {
-	permission, err := s.GetUserPermission(discordID)
-	if err != nil {
-		return fmt.Errorf("failed to get user permission: %w", err)
+// accessEndedMessage はアクセスできなくなったユーザーに表示するメッセージを返す
+func accessEndedMessage(actor *db.User, now time.Time) string {
+	if actor.ExpiresAt.Valid && !now.Before(actor.ExpiresAt.Time) {
+		return fmt.Sprintf("アクセス期限（%s）が切れています。引き続き利用するには `manage_users` 権限を持つユーザーに再度追加してもらってください", actor.ExpiresAt.Time.Format(AccessExpiryFormat))
 	}
+	return "このユーザーは無効化されています"
+}
 
-	switch action {
-	case "create_sandbox", "close_sandbox":
-		if permission < PermissionUser {
-			return fmt.Errorf("サンドボックス操作にはユーザー権限が必要です")
-		}
-	case "add_user", "add_owner", "delete_user", "delete_owner":
-		if permission < PermissionOwner {
-			return fmt.Errorf("ユーザー管理操作にはオーナー権限が必要です")
+// UserRole はユーザーに適用されるロールをケイパビリティとともに取得する（ロールがない場合はnil）
+// 明示的に登録されたユーザーはデータベースのロール、それ以外はDiscordのギルドロールの対応から解決する
+// 無効化されたユーザーやアクセス期限を過ぎたユーザーはロールを持たないものとして扱う
+func (s *PermissionService) UserRole(actor *db.User) (*db.Role, error) {
+	if actor.AccessEnded(time.Now()) {
+		return nil, nil
+	}
+
+	roleName := actor.Role
+	if actor.IsGuildRoleUser() && actor.GuildID.Valid && s.roleResolver != nil {
+		resolved, err := s.ResolveGuildRole(actor.GuildID.String, actor.DiscordID)
+		if err != nil {
+			// Discordに問い合わせできない場合は、最後に同期したロールで判定する
+			logrus.WithError(err).WithField("discord_id", actor.DiscordID).Warn("Failed to resolve guild role, using last synced role")
+		} else {
+			roleName = resolved
 		}
-	default:
-		return fmt.Errorf("不明な操作: %s", action)
 	}
 
-	return nil
+	if roleName == "" {
+		return nil, nil
+	}
+
+	role, err := s.db.GetRoleByName(actor.GuildID.String, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	return role, nil
 }
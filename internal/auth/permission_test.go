@@ -0,0 +1,309 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/db"
+)
+
+// TestPermissionServiceAuthorize はケイパビリティによる権限判定のテスト
+func TestPermissionServiceAuthorize(t *testing.T) {
+	store := db.NewMemoryStore(3)
+	service := NewPermissionService(store, Limits{})
+
+	_, _ = store.CreateRole("", "reviewer", "使用量の確認のみ", []string{"view_usage"})
+	owner, _ := store.CreateUser("", "owner123", "owner", "owner")
+	alice, _ := store.CreateUser("", "alice123", "alice", "user")
+	bob, _ := store.CreateUser("", "bob123", "bob", "user")
+	reviewer, _ := store.CreateUser("", "reviewer123", "reviewer", "reviewer")
+	session, _ := store.CreateSession(alice.ID, "thread1", "sandbox1")
+
+	tests := []struct {
+		name       string
+		actor      *db.User
+		capability Capability
+		resource   Resource
+		expected   bool
+	}{
+		{"owner can operate any session", owner, CapabilityCreateSandbox, session, true},
+		{"user can operate own session", alice, CapabilityCreateSandbox, session, true},
+		{"user cannot operate other's session", bob, CapabilityCreateSandbox, session, false},
+		{"user cannot manage users", alice, CapabilityManageUsers, nil, false},
+		{"custom role has its capabilities", reviewer, CapabilityViewUsage, nil, true},
+		{"custom role lacks other capabilities", reviewer, CapabilityCreateSandbox, nil, false},
+		{"unregistered user is denied", nil, CapabilityCreateSandbox, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.Authorize(tt.actor, tt.capability, tt.resource)
+			if tt.expected && err != nil {
+				t.Errorf("Expected to be allowed, got %v", err)
+			}
+			if !tt.expected && !IsPermissionDenied(err) {
+				t.Errorf("Expected permission error, got %v", err)
+			}
+		})
+	}
+
+	// アクセス期限を過ぎたユーザーや無効化されたユーザーはすべての操作を拒否される
+	_ = store.SetUserAccess("", alice.DiscordID, sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}, false)
+	expired, _ := store.GetUserByDiscordID("", alice.DiscordID)
+	if err := service.Authorize(expired, CapabilityCreateSandbox, session); !IsPermissionDenied(err) {
+		t.Errorf("Expected expired user to be denied, got %v", err)
+	}
+	if role, _ := service.UserRole(expired); role != nil {
+		t.Errorf("Expected expired user to have no role, got %+v", role)
+	}
+	_ = store.SetUserAccess("", owner.DiscordID, sql.NullTime{}, true)
+	disabled, _ := store.GetUserByDiscordID("", owner.DiscordID)
+	if err := service.Authorize(disabled, CapabilityManageUsers, nil); !IsPermissionDenied(err) {
+		t.Errorf("Expected disabled owner to be denied, got %v", err)
+	}
+
+	// ロールのケイパビリティの変更はすぐに反映される
+	if err := store.SetRoleCapabilities("", "reviewer", []string{"view_usage", "create_sandbox"}); err != nil {
+		t.Fatalf("Failed to set role capabilities: %v", err)
+	}
+	if err := service.Authorize(reviewer, CapabilityCreateSandbox, nil); err != nil {
+		t.Errorf("Expected updated capabilities to apply, got %v", err)
+	}
+}
+
+// TestPermissionServiceAuthorizeSession はセッションに招待されたユーザーの権限判定のテスト
+func TestPermissionServiceAuthorizeSession(t *testing.T) {
+	store := db.NewMemoryStore(3)
+	service := NewPermissionService(store, Limits{})
+
+	alice, _ := store.CreateUser("", "alice123", "alice", "user")
+	bob, _ := store.CreateUser("", "bob123", "bob", "user")
+	carol, _ := store.CreateUser("", "carol123", "carol", "user")
+	dave, _ := store.CreateUser("", "dave123", "dave", "user")
+	session, _ := store.CreateSession(alice.ID, "thread1", "sandbox1")
+	_, _ = store.UpsertSessionMember(session.ID, bob.ID, db.SessionMemberViewer, alice.ID)
+	_, _ = store.UpsertSessionMember(session.ID, carol.ID, db.SessionMemberCollaborator, alice.ID)
+
+	tests := []struct {
+		name       string
+		actor      *db.User
+		memberRole string
+		expected   bool
+	}{
+		{"owner can close", alice, "", true},
+		{"viewer can read", bob, db.SessionMemberViewer, true},
+		{"viewer cannot prompt", bob, db.SessionMemberCollaborator, false},
+		{"collaborator can prompt", carol, db.SessionMemberCollaborator, true},
+		{"collaborator cannot close", carol, "", false},
+		{"uninvited user cannot read", dave, db.SessionMemberViewer, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.AuthorizeSession(tt.actor, session, tt.memberRole)
+			if tt.expected && err != nil {
+				t.Errorf("Expected to be allowed, got %v", err)
+			}
+			if !tt.expected && !IsPermissionDenied(err) {
+				t.Errorf("Expected permission error, got %v", err)
+			}
+		})
+	}
+
+	// アクセス期限を過ぎた・無効化された招待ユーザーは会話も閲覧もできない
+	_ = store.SetUserAccess("", carol.DiscordID, sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}, false)
+	expired, _ := store.GetUserByDiscordID("", carol.DiscordID)
+	for _, memberRole := range []string{db.SessionMemberCollaborator, db.SessionMemberViewer} {
+		if err := service.AuthorizeSession(expired, session, memberRole); !IsPermissionDenied(err) {
+			t.Errorf("Expected expired collaborator to be denied as %s, got %v", memberRole, err)
+		}
+	}
+	_ = store.SetUserAccess("", bob.DiscordID, sql.NullTime{}, true)
+	disabled, _ := store.GetUserByDiscordID("", bob.DiscordID)
+	if err := service.AuthorizeSession(disabled, session, db.SessionMemberViewer); !IsPermissionDenied(err) {
+		t.Errorf("Expected disabled viewer to be denied, got %v", err)
+	}
+}
+
+// TestPermissionServiceSessionQuota は同時セッション数の上限のテスト
+func TestPermissionServiceSessionQuota(t *testing.T) {
+	store := db.NewMemoryStore(3)
+	service := NewPermissionService(store, Limits{MaxSessions: 1})
+
+	user, _ := store.CreateUser("", "user123", "user", "user")
+
+	release, err := service.ReserveSession(user.ID)
+	if err != nil {
+		t.Fatalf("Expected first session to be allowed, got %v", err)
+	}
+
+	// 確保中の枠も上限に含める
+	if _, err := service.ReserveSession(user.ID); err == nil {
+		t.Error("Expected a concurrent session to be rejected while the first is being created")
+	}
+
+	if _, err := store.CreateSession(user.ID, "thread1", "sandbox1"); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	release()
+	release()
+
+	if _, err := service.ReserveSession(user.ID); err == nil {
+		t.Error("Expected second session to be rejected, got nil")
+	}
+
+	// 個別設定で上限を緩和できる
+	err = store.UpsertUserLimits(&db.UserLimits{
+		UserID:      user.ID,
+		MaxSessions: sql.NullInt64{Int64: 2, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to upsert user limits: %v", err)
+	}
+
+	if _, err := service.ReserveSession(user.ID); err != nil {
+		t.Errorf("Expected override to allow a second session, got %v", err)
+	}
+}
+
+// TestPermissionServiceReserveSessionConcurrent は同時に開始されたセッションがギルドの上限を超えないことのテスト
+func TestPermissionServiceReserveSessionConcurrent(t *testing.T) {
+	store := db.NewMemoryStore(3)
+	service := NewPermissionService(store, Limits{})
+
+	guild, _ := store.UpsertGuild("guild1", "guild1")
+	guild.MaxSandboxes = sql.NullInt64{Int64: 2, Valid: true}
+	_ = store.UpdateGuildSettings(guild)
+
+	var users []*db.User
+	for i := 0; i < 5; i++ {
+		user, _ := store.CreateUser("guild1", fmt.Sprintf("user%d", i), fmt.Sprintf("user%d", i), "user")
+		users = append(users, user)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for _, user := range users {
+		wg.Add(1)
+		go func(user *db.User) {
+			defer wg.Done()
+			if _, err := service.ReserveSession(user.ID); err == nil {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}(user)
+	}
+	wg.Wait()
+
+	if allowed != 2 {
+		t.Errorf("Expected 2 sessions to be reserved within the guild limit, got %d", allowed)
+	}
+}
+
+// TestPermissionServiceValidateTurn は予算と最大セッション時間のテスト
+func TestPermissionServiceValidateTurn(t *testing.T) {
+	store := db.NewMemoryStore(3)
+	service := NewPermissionService(store, Limits{DailyCostUSD: 1})
+
+	user, _ := store.CreateUser("", "user123", "user", "user")
+	session, _ := store.CreateSession(user.ID, "thread1", "sandbox1")
+
+	if err := service.ValidateTurn(user, session); err != nil {
+		t.Fatalf("Expected turn within budget to be allowed, got %v", err)
+	}
+
+	_, err := store.CreateClaudeTurn(&db.ClaudeTurn{
+		SessionID:  sql.NullInt64{Int64: int64(session.ID), Valid: true},
+		UserID:     sql.NullInt64{Int64: int64(user.ID), Valid: true},
+		CostUSD:    1.5,
+		ExitStatus: "success",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create claude turn: %v", err)
+	}
+
+	if err := service.ValidateTurn(user, session); err == nil {
+		t.Error("Expected turn over daily budget to be rejected, got nil")
+	}
+
+	// 最大セッション時間の超過
+	service = NewPermissionService(store, Limits{MaxSessionDuration: time.Hour})
+	session.CreatedAt = time.Now().Add(-2 * time.Hour)
+	if err := service.ValidateTurn(user, session); err == nil {
+		t.Error("Expected turn after max session duration to be rejected, got nil")
+	}
+
+	// 延長したセッションは延長分だけ利用できる
+	session.ExtensionMinutes = 90
+	if err := service.ValidateTurn(user, session); err != nil {
+		t.Errorf("Expected extended session to be allowed, got %v", err)
+	}
+	session.ExtensionMinutes = 0
+
+	if err := service.ValidateTurn(nil, session); err == nil {
+		t.Error("Expected turn from unknown user to be rejected, got nil")
+	}
+}
+
+// TestPermissionServiceGuild はギルドごとの権限・利用上限・サンドボックス数のテスト
+func TestPermissionServiceGuild(t *testing.T) {
+	store := db.NewMemoryStore(3)
+	service := NewPermissionService(store, Limits{MaxSessions: 3, DailyCostUSD: 10})
+
+	_, _ = store.UpsertGuild("guild1", "guild1")
+	_, _ = store.UpsertGuild("guild2", "guild2")
+	owner, _ := store.CreateUser("guild1", "owner123", "owner", "owner")
+	alice, _ := store.CreateUser("guild2", "alice123", "alice", "user")
+	bob, _ := store.CreateUser("guild2", "bob123", "bob", "user")
+
+	// 他のギルドのユーザーのセッションはオーナーでも操作できない
+	session, _ := store.CreateSession(alice.ID, "thread1", "sandbox1")
+	if err := service.Authorize(owner, CapabilityCreateSandbox, session); !IsPermissionDenied(err) {
+		t.Errorf("Expected owner of another guild to be denied, got %v", err)
+	}
+
+	// 所有者が削除されたセッションは、同じギルドで manage_sessions 権限を持つユーザーのみ操作できる
+	orphaned := &db.Session{ID: 999, GuildID: sql.NullString{String: "guild2", Valid: true}}
+	if err := service.Authorize(owner, CapabilityCreateSandbox, orphaned); !IsPermissionDenied(err) {
+		t.Errorf("Expected owner of another guild to be denied for orphaned session, got %v", err)
+	}
+	if err := service.Authorize(bob, CapabilityCreateSandbox, orphaned); !IsPermissionDenied(err) {
+		t.Errorf("Expected user without manage_sessions to be denied for orphaned session, got %v", err)
+	}
+	guildOwner, _ := store.CreateUser("guild2", "owner456", "owner2", "owner")
+	if err := service.Authorize(guildOwner, CapabilityCreateSandbox, orphaned); err != nil {
+		t.Errorf("Expected owner of the guild to be allowed for orphaned session, got %v", err)
+	}
+
+	// ギルドの設定はデフォルト値より、ユーザー個別の設定はギルドの設定より優先される
+	guild, _ := store.GetGuild("guild2")
+	guild.MaxSessions = sql.NullInt64{Int64: 5, Valid: true}
+	guild.DailyCostUSD = sql.NullFloat64{Float64: 20, Valid: true}
+	guild.MaxSandboxes = sql.NullInt64{Int64: 1, Valid: true}
+	_ = store.UpdateGuildSettings(guild)
+	_ = store.UpsertUserLimits(&db.UserLimits{UserID: alice.ID, DailyCostUSD: sql.NullFloat64{Float64: 1, Valid: true}})
+
+	limits, err := service.GetEffectiveLimits(alice.ID)
+	if err != nil {
+		t.Fatalf("Failed to get effective limits: %v", err)
+	}
+	if limits.MaxSessions != 5 || limits.DailyCostUSD != 1 {
+		t.Errorf("Expected guild and user overrides, got %+v", limits)
+	}
+	if limits, _ := service.GetEffectiveLimits(owner.ID); limits.MaxSessions != 3 || limits.DailyCostUSD != 10 {
+		t.Errorf("Expected defaults for another guild, got %+v", limits)
+	}
+
+	// ギルドのサンドボックス数の上限は同じギルドのユーザーで共有する
+	if _, err := service.ReserveSession(bob.ID); err == nil {
+		t.Error("Expected guild sandbox limit to reject bob")
+	}
+	if _, err := service.ReserveSession(owner.ID); err != nil {
+		t.Errorf("Expected another guild not to share the limit, got %v", err)
+	}
+}
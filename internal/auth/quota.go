@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/db"
+)
+
+// Limits はユーザーに適用される利用上限（0は無制限）
+type Limits struct {
+	DailyCostUSD       float64
+	MonthlyCostUSD     float64
+	DailyTokens        int64
+	MonthlyTokens      int64
+	MaxSessions        int
+	MaxSessionDuration time.Duration
+}
+
+// GetEffectiveLimits はデフォルト値、ユーザーが属するギルドの設定、ユーザー個別の上書き設定を順に合成した利用上限を返す
+func (s *PermissionService) GetEffectiveLimits(userID int) (*Limits, error) {
+	limits := s.defaultLimits
+
+	guild, err := s.userGuild(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if guild != nil {
+		limits.apply(guild.DailyCostUSD, guild.MonthlyCostUSD, guild.DailyTokens, guild.MonthlyTokens, guild.MaxSessions, guild.MaxSessionMinutes)
+	}
+
+	overrides, err := s.db.GetUserLimits(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user limits: %w", err)
+	}
+
+	if overrides != nil {
+		limits.apply(overrides.DailyCostUSD, overrides.MonthlyCostUSD, overrides.DailyTokens, overrides.MonthlyTokens, overrides.MaxSessions, overrides.MaxSessionMinutes)
+	}
+
+	return &limits, nil
+}
+
+// apply は設定されている（Validな）値で利用上限を上書きする
+func (l *Limits) apply(dailyCost, monthlyCost sql.NullFloat64, dailyTokens, monthlyTokens, maxSessions, maxSessionMinutes sql.NullInt64) {
+	if dailyCost.Valid {
+		l.DailyCostUSD = dailyCost.Float64
+	}
+	if monthlyCost.Valid {
+		l.MonthlyCostUSD = monthlyCost.Float64
+	}
+	if dailyTokens.Valid {
+		l.DailyTokens = dailyTokens.Int64
+	}
+	if monthlyTokens.Valid {
+		l.MonthlyTokens = monthlyTokens.Int64
+	}
+	if maxSessions.Valid {
+		l.MaxSessions = int(maxSessions.Int64)
+	}
+	if maxSessionMinutes.Valid {
+		l.MaxSessionDuration = time.Duration(maxSessionMinutes.Int64) * time.Minute
+	}
+}
+
+// userGuild はユーザーが属するギルドの設定を取得する（ギルドに属さない場合はnil）
+func (s *PermissionService) userGuild(userID int) (*db.Guild, error) {
+	user, err := s.db.GetUserByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if user == nil || !user.GuildID.Valid {
+		return nil, nil
+	}
+
+	guild, err := s.db.GetGuild(user.GuildID.String)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild: %w", err)
+	}
+
+	return guild, nil
+}
+
+// CheckBudget はユーザーが日次・月次の予算内かチェックする
+func (s *PermissionService) CheckBudget(userID int) error {
+	limits, err := s.GetEffectiveLimits(userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	if limits.DailyCostUSD > 0 || limits.DailyTokens > 0 {
+		startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		usage, err := s.db.GetUsageByUserID(userID, startOfDay)
+		if err != nil {
+			return fmt.Errorf("failed to get daily usage: %w", err)
+		}
+
+		if limits.DailyCostUSD > 0 && usage.CostUSD >= limits.DailyCostUSD {
+			return fmt.Errorf("本日の利用額の上限（$%.2f）に達しています（使用済み: $%.2f）", limits.DailyCostUSD, usage.CostUSD)
+		}
+		if limits.DailyTokens > 0 && usage.TotalTokens() >= limits.DailyTokens {
+			return fmt.Errorf("本日のトークン数の上限（%d）に達しています（使用済み: %d）", limits.DailyTokens, usage.TotalTokens())
+		}
+	}
+
+	if limits.MonthlyCostUSD > 0 || limits.MonthlyTokens > 0 {
+		startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		usage, err := s.db.GetUsageByUserID(userID, startOfMonth)
+		if err != nil {
+			return fmt.Errorf("failed to get monthly usage: %w", err)
+		}
+
+		if limits.MonthlyCostUSD > 0 && usage.CostUSD >= limits.MonthlyCostUSD {
+			return fmt.Errorf("今月の利用額の上限（$%.2f）に達しています（使用済み: $%.2f）", limits.MonthlyCostUSD, usage.CostUSD)
+		}
+		if limits.MonthlyTokens > 0 && usage.TotalTokens() >= limits.MonthlyTokens {
+			return fmt.Errorf("今月のトークン数の上限（%d）に達しています（使用済み: %d）", limits.MonthlyTokens, usage.TotalTokens())
+		}
+	}
+
+	return nil
+}
+
+// sessionReservations はセッションの作成中に確保したセッション数の枠
+// 上限の確認からセッションがアクティブとして記録されるまでの間の枠を、ユーザーとギルドごとに数える
+type sessionReservations struct {
+	mu     sync.Mutex
+	users  map[int]int
+	guilds map[string]int
+}
+
+// ReserveSession はユーザーが新しいセッションを開始できるかチェックし、同時セッション数とギルドのサンドボックス数の枠を確保する
+// 同時に開始されたセッションが上限を超えないよう、作成中のセッションも上限に含めて確認する
+// 返される関数で確保を解除する（セッションがアクティブとして記録された後は記録から数える）
+func (s *PermissionService) ReserveSession(userID int) (func(), error) {
+	s.reservations.mu.Lock()
+	defer s.reservations.mu.Unlock()
+
+	limits, err := s.GetEffectiveLimits(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if limits.MaxSessions > 0 {
+		count, err := s.db.CountActiveSessionsByUserID(userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count active sessions: %w", err)
+		}
+
+		if count+s.reservations.users[userID] >= limits.MaxSessions {
+			return nil, fmt.Errorf("同時に利用できるセッション数の上限（%d）に達しています。既存のセッションを `/claude close` で終了してください", limits.MaxSessions)
+		}
+	}
+
+	guild, err := s.userGuild(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	guildID := ""
+	if guild != nil && guild.MaxSandboxes.Valid && guild.MaxSandboxes.Int64 > 0 {
+		count, err := s.db.CountActiveSessionsByGuild(guild.GuildID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count active sessions in guild: %w", err)
+		}
+
+		if int64(count+s.reservations.guilds[guild.GuildID]) >= guild.MaxSandboxes.Int64 {
+			return nil, fmt.Errorf("このサーバーで同時に利用できるサンドボックス数の上限（%d）に達しています。しばらく待ってから再度お試しください", guild.MaxSandboxes.Int64)
+		}
+		guildID = guild.GuildID
+	}
+
+	if err := s.CheckBudget(userID); err != nil {
+		return nil, err
+	}
+
+	if s.reservations.users == nil {
+		s.reservations.users = make(map[int]int)
+		s.reservations.guilds = make(map[string]int)
+	}
+	s.reservations.users[userID]++
+	if guildID != "" {
+		s.reservations.guilds[guildID]++
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.reservations.mu.Lock()
+			defer s.reservations.mu.Unlock()
+			s.reservations.users[userID]--
+			if s.reservations.users[userID] == 0 {
+				delete(s.reservations.users, userID)
+			}
+			if guildID != "" {
+				s.reservations.guilds[guildID]--
+				if s.reservations.guilds[guildID] == 0 {
+					delete(s.reservations.guilds, guildID)
+				}
+			}
+		})
+	}, nil
+}
+
+// ValidateTurn はセッション内でClaude Codeに問い合わせできるかチェックする
+// 問い合わせたユーザーの予算と、セッション所有者の最大セッション時間を確認する
+func (s *PermissionService) ValidateTurn(user *db.User, session *db.Session) error {
+	if user == nil {
+		return fmt.Errorf("ユーザーが登録されていません")
+	}
+
+	deadline, limited, err := s.SessionDeadline(session)
+	if err != nil {
+		return err
+	}
+
+	if limited && !time.Now().Before(deadline) {
+		return fmt.Errorf("セッションの最大利用時間（%s）を超えました。`/claude close` で終了し、新しいセッションを開始してください", deadline.Sub(session.CreatedAt))
+	}
+
+	return s.CheckBudget(user.ID)
+}
+
+// SessionDeadline はセッションの利用期限を返す（最大セッション時間が無制限の場合はfalse）
+// 期限は所有者の最大セッション時間にセッションごとの延長分を加えたもの
+func (s *PermissionService) SessionDeadline(session *db.Session) (time.Time, bool, error) {
+	limits, err := s.GetEffectiveLimits(session.OwnerUserID())
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	if limits.MaxSessionDuration <= 0 {
+		return time.Time{}, false, nil
+	}
+
+	maxDuration := limits.MaxSessionDuration + time.Duration(session.ExtensionMinutes)*time.Minute
+	return session.CreatedAt.Add(maxDuration), true, nil
+}
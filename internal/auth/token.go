@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// apiTokenPrefix は管理APIのアクセストークンの接頭辞（漏洩時に検出しやすくする）
+const apiTokenPrefix = "dcl_"
+
+// GenerateAPIToken は管理APIのアクセストークンを生成し、トークンとそのハッシュを返す
+// トークン本体は発行時に一度だけ表示し、データベースにはハッシュのみを保存する
+func GenerateAPIToken() (token, tokenHash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate api token: %w", err)
+	}
+
+	token = apiTokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashAPIToken(token), nil
+}
+
+// HashAPIToken はアクセストークンのSHA-256ハッシュを16進文字列で返す
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
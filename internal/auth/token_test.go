@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestGenerateAPIToken はアクセストークンの生成とハッシュのテスト
+func TestGenerateAPIToken(t *testing.T) {
+	token, tokenHash, err := GenerateAPIToken()
+	if err != nil {
+		t.Fatalf("Failed to generate api token: %v", err)
+	}
+
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		t.Errorf("Expected token to start with %q, got %q", apiTokenPrefix, token)
+	}
+	if tokenHash != HashAPIToken(token) || len(tokenHash) != 64 {
+		t.Errorf("Expected SHA-256 hex hash of the token, got %q", tokenHash)
+	}
+	if strings.Contains(tokenHash, token) {
+		t.Error("Hash must not contain the token")
+	}
+
+	other, _, err := GenerateAPIToken()
+	if err != nil {
+		t.Fatalf("Failed to generate api token: %v", err)
+	}
+	if other == token {
+		t.Error("Expected tokens to be unique")
+	}
+}
@@ -1,36 +1,83 @@
 package auth
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/hirano00o/disclaude/internal/db"
 )
 
 // UserDatabase はユーザー管理で必要なデータベース操作のインターフェース
 type UserDatabase interface {
-	GetUserByDiscordID(discordID string) (*db.User, error)
-	CreateUser(discordID, username, role string) (*db.User, error)
-	UpdateUserRole(discordID, role string) error
-	DeleteUser(discordID string) error
+	GetUserByDiscordID(guildID, discordID string) (*db.User, error)
+	CreateUser(guildID, discordID, username, role string) (*db.User, error)
+	UpdateUserRole(guildID, discordID, role string) error
+	SetUserRoleSource(guildID, discordID, source string) error
+	SetUserAccess(guildID, discordID string, expiresAt sql.NullTime, disabled bool) error
+	DeleteUser(guildID, discordID string) error
+	GetRoleByName(guildID, name string) (*db.Role, error)
+}
+
+// HomeUserDatabase はギルドを特定できない操作でユーザーを探すためのデータベース操作のインターフェース
+type HomeUserDatabase interface {
+	GetUserByDiscordID(guildID, discordID string) (*db.User, error)
+	ListUsersByDiscordID(discordID string) ([]*db.User, error)
+}
+
+// DeletedUserName は所有者が削除されたセッションの所有者として表示する名前
+const DeletedUserName = "（削除されたユーザー）"
+
+// ErrAmbiguousGuild はギルドを特定できない操作で、ユーザーが複数のギルドに登録されている場合のエラー
+var ErrAmbiguousGuild = errors.New("user is registered in multiple guilds")
+
+// ErrRemoveSelf は要求者が自分自身を削除しようとした場合のエラー
+var ErrRemoveSelf = errors.New("cannot remove yourself")
+
+// ErrDemoteSelf は要求者が自分自身を降格しようとした場合のエラー
+var ErrDemoteSelf = errors.New("cannot demote yourself")
+
+// UserSessionTerminator はユーザーのセッションをサンドボックスとともに終了する
+// bot.SessionManager が実装する
+type UserSessionTerminator interface {
+	TerminateUserSessions(ctx context.Context, user, actor *db.User, reason string) (int, error)
 }
 
 // UserService はユーザー認証・管理を行うサービス
 type UserService struct {
-	db UserDatabase
+	db       UserDatabase
+	authz    Authorizer
+	audit    *AuditLogger
+	sessions UserSessionTerminator
 }
 
 // NewUserService は新しいUserServiceを作成する
-func NewUserService(database UserDatabase) *UserService {
+// authzはユーザー管理操作の権限（CapabilityManageUsers）の判定に使用する
+func NewUserService(database UserDatabase, authz Authorizer) *UserService {
 	return &UserService{
-		db: database,
+		db:    database,
+		authz: authz,
 	}
 }
 
+// SetAuditLogger はユーザーの追加・削除・ロール変更を記録するAuditLoggerを設定する
+func (s *UserService) SetAuditLogger(audit *AuditLogger) {
+	s.audit = audit
+}
+
+// SetSessionTerminator はユーザーの削除時にセッションを終了するUserSessionTerminatorを設定する
+// 設定しない場合、削除されたユーザーのサンドボックスは削除されない
+func (s *UserService) SetSessionTerminator(sessions UserSessionTerminator) {
+	s.sessions = sessions
+}
+
 // InitializeUser は初回ユーザーの初期化を行う
-// 初回ユーザーがオーナー確認を行い、オーナーまたは一般ユーザーとして登録される
-func (s *UserService) InitializeUser(discordID, username string, isOwner bool) (*db.User, error) {
+// 初回ユーザーがオーナー確認を行い、guildIDのギルドのオーナーまたは一般ユーザーとして登録される（空文字列の場合はギルドに属さない）
+func (s *UserService) InitializeUser(discordID, username, guildID string, isOwner bool) (*db.User, error) {
 	// 既存ユーザーチェック
-	existingUser, err := s.db.GetUserByDiscordID(discordID)
+	existingUser, err := s.db.GetUserByDiscordID(guildID, discordID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check existing user: %w", err)
 	}
@@ -46,17 +93,19 @@ func (s *UserService) InitializeUser(discordID, username string, isOwner bool) (
 	}
 
 	// ユーザー作成
-	user, err := s.db.CreateUser(discordID, username, role)
+	user, err := s.createUser(discordID, username, role, guildID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+		return nil, err
 	}
 
+	s.audit.RecordUserChange(AuditUserRegister, user, user, "", role)
+
 	return user, nil
 }
 
-// GetUser はDiscord IDでユーザーを取得する
-func (s *UserService) GetUser(discordID string) (*db.User, error) {
-	user, err := s.db.GetUserByDiscordID(discordID)
+// GetUser はguildIDのギルドに登録されたユーザーをDiscord IDで取得する（空文字列の場合はギルドに属さないユーザー）
+func (s *UserService) GetUser(guildID, discordID string) (*db.User, error) {
+	user, err := s.db.GetUserByDiscordID(guildID, discordID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -64,9 +113,9 @@ func (s *UserService) GetUser(discordID string) (*db.User, error) {
 	return user, nil
 }
 
-// IsUserExists はユーザーが存在するかチェックする
-func (s *UserService) IsUserExists(discordID string) (bool, error) {
-	user, err := s.GetUser(discordID)
+// IsUserExists はguildIDのギルドにユーザーが存在するかチェックする
+func (s *UserService) IsUserExists(guildID, discordID string) (bool, error) {
+	user, err := s.GetUser(guildID, discordID)
 	if err != nil {
 		return false, err
 	}
@@ -74,10 +123,12 @@ func (s *UserService) IsUserExists(discordID string) (bool, error) {
 	return user != nil, nil
 }
 
-// AddUser は新しいユーザーを追加する（オーナーのみ実行可能）
-func (s *UserService) AddUser(requesterDiscordID, targetDiscordID, targetUsername string) (*db.User, error) {
+// AddUser はguildIDのギルドに新しいユーザーを追加する（manage_users 権限が必要）
+// expiresAtを指定した場合は期限を過ぎるとアクセスできなくなる（NULLの場合は無期限）
+// アクセス期限が切れた・無効化されたユーザーは、指定した期限で再度有効にする
+func (s *UserService) AddUser(guildID, requesterDiscordID, targetDiscordID, targetUsername string, expiresAt sql.NullTime) (*db.User, error) {
 	// 要求者の権限チェック
-	requester, err := s.GetUser(requesterDiscordID)
+	requester, err := s.GetUser(guildID, requesterDiscordID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get requester: %w", err)
 	}
@@ -86,33 +137,62 @@ func (s *UserService) AddUser(requesterDiscordID, targetDiscordID, targetUsernam
 		return nil, fmt.Errorf("requester not found")
 	}
 
-	if !requester.IsOwner() {
-		return nil, fmt.Errorf("insufficient permissions: only owners can add users")
+	if err := s.authz.Authorize(requester, CapabilityManageUsers, nil); err != nil {
+		return nil, err
 	}
 
 	// 対象ユーザーの重複チェック
-	existingUser, err := s.GetUser(targetDiscordID)
+	existingUser, err := s.GetUser(guildID, targetDiscordID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check existing target user: %w", err)
 	}
 
+	// ロール連携で登録されたユーザーは、明示的な登録に切り替える
+	if existingUser != nil && existingUser.IsGuildRoleUser() {
+		if err := s.pinUserRole(guildID, targetDiscordID, "user"); err != nil {
+			return nil, err
+		}
+		if err := s.db.SetUserAccess(guildID, targetDiscordID, expiresAt, false); err != nil {
+			return nil, fmt.Errorf("failed to set user access: %w", err)
+		}
+		s.audit.RecordUserChange(AuditUserAdd, requester, existingUser, existingUser.Role, "user")
+		return s.GetUser(guildID, targetDiscordID)
+	}
+
+	if existingUser != nil && existingUser.AccessEnded(time.Now()) {
+		if err := s.db.SetUserAccess(guildID, targetDiscordID, expiresAt, false); err != nil {
+			return nil, fmt.Errorf("failed to set user access: %w", err)
+		}
+		s.audit.RecordUserChange(AuditUserAdd, requester, existingUser, "", existingUser.Role)
+		return s.GetUser(guildID, targetDiscordID)
+	}
+
 	if existingUser != nil {
 		return nil, fmt.Errorf("user already exists")
 	}
 
 	// ユーザー作成
-	user, err := s.db.CreateUser(targetDiscordID, targetUsername, "user")
+	user, err := s.createUser(targetDiscordID, targetUsername, "user", guildID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+		return nil, err
 	}
 
+	if expiresAt.Valid {
+		if err := s.db.SetUserAccess(guildID, targetDiscordID, expiresAt, false); err != nil {
+			return nil, fmt.Errorf("failed to set user access: %w", err)
+		}
+		user.ExpiresAt = expiresAt
+	}
+
+	s.audit.RecordUserChange(AuditUserAdd, requester, user, "", user.Role)
+
 	return user, nil
 }
 
-// PromoteToOwner はユーザーをオーナーに昇格させる（オーナーのみ実行可能）
-func (s *UserService) PromoteToOwner(requesterDiscordID, targetDiscordID string) error {
+// PromoteToOwner はguildIDのギルドのユーザーをオーナーに昇格させる（manage_users 権限が必要）
+func (s *UserService) PromoteToOwner(guildID, requesterDiscordID, targetDiscordID string) error {
 	// 要求者の権限チェック
-	requester, err := s.GetUser(requesterDiscordID)
+	requester, err := s.GetUser(guildID, requesterDiscordID)
 	if err != nil {
 		return fmt.Errorf("failed to get requester: %w", err)
 	}
@@ -121,12 +201,12 @@ func (s *UserService) PromoteToOwner(requesterDiscordID, targetDiscordID string)
 		return fmt.Errorf("requester not found")
 	}
 
-	if !requester.IsOwner() {
-		return fmt.Errorf("insufficient permissions: only owners can promote users")
+	if err := s.authz.Authorize(requester, CapabilityManageUsers, nil); err != nil {
+		return err
 	}
 
 	// 対象ユーザーの存在チェック
-	targetUser, err := s.GetUser(targetDiscordID)
+	targetUser, err := s.GetUser(guildID, targetDiscordID)
 	if err != nil {
 		return fmt.Errorf("failed to get target user: %w", err)
 	}
@@ -140,17 +220,20 @@ func (s *UserService) PromoteToOwner(requesterDiscordID, targetDiscordID string)
 	}
 
 	// ロール更新
-	if err := s.db.UpdateUserRole(targetDiscordID, "owner"); err != nil {
+	beforeRole := targetUser.Role
+	if err := s.pinUserRole(guildID, targetDiscordID, "owner"); err != nil {
 		return fmt.Errorf("failed to promote user to owner: %w", err)
 	}
 
+	s.audit.RecordUserChange(AuditUserPromote, requester, targetUser, beforeRole, "owner")
+
 	return nil
 }
 
-// DemoteFromOwner はオーナーを一般ユーザーに降格させる（オーナーのみ実行可能、自分自身は不可）
-func (s *UserService) DemoteFromOwner(requesterDiscordID, targetDiscordID string) error {
+// DemoteFromOwner はguildIDのギルドのオーナーを一般ユーザーに降格させる（manage_users 権限が必要、自分自身は不可）
+func (s *UserService) DemoteFromOwner(guildID, requesterDiscordID, targetDiscordID string) error {
 	// 要求者の権限チェック
-	requester, err := s.GetUser(requesterDiscordID)
+	requester, err := s.GetUser(guildID, requesterDiscordID)
 	if err != nil {
 		return fmt.Errorf("failed to get requester: %w", err)
 	}
@@ -159,17 +242,17 @@ func (s *UserService) DemoteFromOwner(requesterDiscordID, targetDiscordID string
 		return fmt.Errorf("requester not found")
 	}
 
-	if !requester.IsOwner() {
-		return fmt.Errorf("insufficient permissions: only owners can demote users")
+	if err := s.authz.Authorize(requester, CapabilityManageUsers, nil); err != nil {
+		return err
 	}
 
 	// 自分自身の降格防止
 	if requesterDiscordID == targetDiscordID {
-		return fmt.Errorf("cannot demote yourself")
+		return ErrDemoteSelf
 	}
 
 	// 対象ユーザーの存在チェック
-	targetUser, err := s.GetUser(targetDiscordID)
+	targetUser, err := s.GetUser(guildID, targetDiscordID)
 	if err != nil {
 		return fmt.Errorf("failed to get target user: %w", err)
 	}
@@ -183,36 +266,96 @@ func (s *UserService) DemoteFromOwner(requesterDiscordID, targetDiscordID string
 	}
 
 	// ロール更新
-	if err := s.db.UpdateUserRole(targetDiscordID, "user"); err != nil {
+	if err := s.pinUserRole(guildID, targetDiscordID, "user"); err != nil {
 		return fmt.Errorf("failed to demote user from owner: %w", err)
 	}
 
+	s.audit.RecordUserChange(AuditUserDemote, requester, targetUser, "owner", "user")
+
 	return nil
 }
 
-// RemoveUser はユーザーを削除する（オーナーのみ実行可能、自分自身は不可）
-func (s *UserService) RemoveUser(requesterDiscordID, targetDiscordID string) error {
+// RemoveUser はguildIDのギルドのユーザーを削除し、終了したセッションの数を返す（manage_users 権限が必要）
+// 先にユーザーを無効化してからセッションをサンドボックスとともに終了し、すべて終了できた場合のみユーザーを削除する
+// 途中で失敗した場合はユーザーを残してエラーを返すため、再実行すると残りの処理を続けられる
+func (s *UserService) RemoveUser(ctx context.Context, guildID, requesterDiscordID, targetDiscordID string) (int, error) {
 	// 要求者の権限チェック
-	requester, err := s.GetUser(requesterDiscordID)
+	requester, err := s.GetUser(guildID, requesterDiscordID)
 	if err != nil {
-		return fmt.Errorf("failed to get requester: %w", err)
+		return 0, fmt.Errorf("failed to get requester: %w", err)
 	}
 
 	if requester == nil {
-		return fmt.Errorf("requester not found")
+		return 0, fmt.Errorf("requester not found")
 	}
 
-	if !requester.IsOwner() {
-		return fmt.Errorf("insufficient permissions: only owners can remove users")
+	if err := s.authz.Authorize(requester, CapabilityManageUsers, nil); err != nil {
+		return 0, err
 	}
 
 	// 自分自身の削除防止
 	if requesterDiscordID == targetDiscordID {
-		return fmt.Errorf("cannot remove yourself")
+		return 0, ErrRemoveSelf
 	}
 
 	// 対象ユーザーの存在チェック
-	targetUser, err := s.GetUser(targetDiscordID)
+	targetUser, err := s.GetUser(guildID, targetDiscordID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get target user: %w", err)
+	}
+
+	if targetUser == nil {
+		return 0, fmt.Errorf("target user not found")
+	}
+
+	// 削除中に新しいセッションを作成されないよう先に無効化する（再実行時は無効化済みのユーザーに対して続きから処理する）
+	if err := s.db.SetUserAccess(guildID, targetDiscordID, targetUser.ExpiresAt, true); err != nil {
+		return 0, fmt.Errorf("failed to disable user: %w", err)
+	}
+
+	// セッションの終了（削除後はセッションが所有者なしで残るため、サンドボックスが動き続けないよう先に終了する）
+	terminated := 0
+	if s.sessions != nil {
+		terminated, err = s.sessions.TerminateUserSessions(ctx, targetUser, requester, "ユーザーの削除")
+		if err != nil {
+			return terminated, fmt.Errorf("failed to terminate user sessions: %w", err)
+		}
+	}
+
+	// ユーザー削除
+	if err := s.db.DeleteUser(guildID, targetDiscordID); err != nil {
+		return terminated, fmt.Errorf("failed to remove user: %w", err)
+	}
+
+	s.audit.RecordUserChange(AuditUserRemove, requester, targetUser, targetUser.Role, "")
+
+	return terminated, nil
+}
+
+// AssignRole はguildIDのギルドのユーザーにロールを割り当てる（manage_users 権限が必要、自分自身は不可）
+// 割り当てたロールはロール連携より優先される
+func (s *UserService) AssignRole(guildID, requesterDiscordID, targetDiscordID, role string) error {
+	// 要求者の権限チェック
+	requester, err := s.GetUser(guildID, requesterDiscordID)
+	if err != nil {
+		return fmt.Errorf("failed to get requester: %w", err)
+	}
+
+	if requester == nil {
+		return fmt.Errorf("requester not found")
+	}
+
+	if err := s.authz.Authorize(requester, CapabilityManageUsers, nil); err != nil {
+		return err
+	}
+
+	// 自分自身のロール変更防止
+	if requesterDiscordID == targetDiscordID {
+		return fmt.Errorf("cannot change your own role")
+	}
+
+	// 対象ユーザーとロールの存在チェック
+	targetUser, err := s.GetUser(guildID, targetDiscordID)
 	if err != nil {
 		return fmt.Errorf("failed to get target user: %w", err)
 	}
@@ -221,10 +364,117 @@ func (s *UserService) RemoveUser(requesterDiscordID, targetDiscordID string) err
 		return fmt.Errorf("target user not found")
 	}
 
-	// ユーザー削除
-	if err := s.db.DeleteUser(targetDiscordID); err != nil {
-		return fmt.Errorf("failed to remove user: %w", err)
+	definition, err := s.db.GetRoleByName(guildID, role)
+	if err != nil {
+		return fmt.Errorf("failed to get role: %w", err)
+	}
+
+	if definition == nil {
+		return fmt.Errorf("role %s not found", role)
+	}
+
+	if targetUser.Role == role && !targetUser.IsGuildRoleUser() {
+		return fmt.Errorf("user already has role %s", role)
+	}
+
+	// ロール更新
+	beforeRole := targetUser.Role
+	if err := s.pinUserRole(guildID, targetDiscordID, role); err != nil {
+		return fmt.Errorf("failed to assign role: %w", err)
+	}
+
+	s.audit.RecordUserChange(AuditUserRoleAssign, requester, targetUser, beforeRole, role)
+
+	return nil
+}
+
+// SyncGuildRoleUser はDiscordのギルドロールから解決したロールをユーザーに反映する
+// 未登録の場合はguildIDのギルドのロール連携のユーザーとして登録し、明示的に登録されたユーザーと他のギルドのユーザーは変更しない
+// roleが空の場合は登録せず、既存のユーザーをそのまま返す（権限はPermissionServiceの判定でなくなる）
+func (s *UserService) SyncGuildRoleUser(guildID, discordID, username, role string) (*db.User, error) {
+	user, err := s.GetUser(guildID, discordID)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == "" || (user != nil && !user.IsGuildRoleUser()) {
+		return user, nil
+	}
+
+	if user == nil {
+		user, err = s.createUser(discordID, username, role, guildID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.db.SetUserRoleSource(guildID, discordID, "guild_role"); err != nil {
+			return nil, fmt.Errorf("failed to set user role source: %w", err)
+		}
+		user.RoleSource = "guild_role"
+
+		s.audit.RecordUserChange(AuditUserRoleSync, user, user, "", role)
+		return user, nil
+	}
+
+	if user.Role != role {
+		if err := s.db.UpdateUserRole(guildID, discordID, role); err != nil {
+			return nil, fmt.Errorf("failed to update user role: %w", err)
+		}
+
+		s.audit.RecordUserChange(AuditUserRoleSync, user, user, user.Role, role)
+		user.Role = role
+	}
+
+	return user, nil
+}
+
+// createUser はguildIDのギルドにユーザーを作成する（空文字列の場合はギルドに属さない）
+func (s *UserService) createUser(discordID, username, role, guildID string) (*db.User, error) {
+	user, err := s.db.CreateUser(guildID, discordID, username, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return user, nil
+}
+
+// pinUserRole はguildIDのギルドのユーザーのロールを更新し、ロール連携より優先される明示的な登録にする
+func (s *UserService) pinUserRole(guildID, discordID, role string) error {
+	if err := s.db.UpdateUserRole(guildID, discordID, role); err != nil {
+		return err
+	}
+
+	if err := s.db.SetUserRoleSource(guildID, discordID, "manual"); err != nil {
+		return fmt.Errorf("failed to set user role source: %w", err)
 	}
 
 	return nil
 }
+
+// FindHomeUser はギルドを特定できない操作（DM、ダッシュボード、CLI）で扱うユーザーを返す
+// defaultGuildIDのギルドに登録されている場合はそのユーザー、登録されているギルドが1つだけの場合はそのユーザーを返す
+// 登録されていない場合はnil、複数のギルドに登録されていて特定できない場合は ErrAmbiguousGuild を返す
+func FindHomeUser(database HomeUserDatabase, defaultGuildID, discordID string) (*db.User, error) {
+	if defaultGuildID != "" {
+		user, err := database.GetUserByDiscordID(defaultGuildID, discordID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		if user != nil {
+			return user, nil
+		}
+	}
+
+	users, err := database.ListUsersByDiscordID(discordID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	switch len(users) {
+	case 0:
+		return nil, nil
+	case 1:
+		return users[0], nil
+	default:
+		return nil, ErrAmbiguousGuild
+	}
+}
@@ -1,8 +1,12 @@
 package auth
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/hirano00o/disclaude/internal/db"
 )
@@ -12,10 +16,10 @@ func TestUserServiceInitializeUser(t *testing.T) {
 	mockDB := &MockDB{
 		users: make(map[string]*db.User),
 	}
-	service := NewUserService(mockDB)
+	service := NewUserService(mockDB, ownerAuthorizer{})
 
 	// 新規ユーザーのオーナー初期化
-	user, err := service.InitializeUser("123456789", "testowner", true)
+	user, err := service.InitializeUser("123456789", "testowner", "", true)
 	if err != nil {
 		t.Fatalf("Failed to initialize user as owner: %v", err)
 	}
@@ -25,7 +29,7 @@ func TestUserServiceInitializeUser(t *testing.T) {
 	}
 
 	// 既存ユーザーの場合
-	existingUser, err := service.InitializeUser("123456789", "testowner", false)
+	existingUser, err := service.InitializeUser("123456789", "testowner", "", false)
 	if err != nil {
 		t.Fatalf("Failed to get existing user: %v", err)
 	}
@@ -40,13 +44,13 @@ func TestUserServiceAddUser(t *testing.T) {
 	mockDB := &MockDB{
 		users: make(map[string]*db.User),
 	}
-	service := NewUserService(mockDB)
+	service := NewUserService(mockDB, ownerAuthorizer{})
 
 	// オーナーを作成
-	_, _ = service.InitializeUser("owner123", "owner", true)
+	_, _ = service.InitializeUser("owner123", "owner", "", true)
 
 	// 一般ユーザーを追加
-	user, err := service.AddUser("owner123", "user123", "testuser")
+	user, err := service.AddUser("", "owner123", "user123", "testuser", sql.NullTime{})
 	if err != nil {
 		t.Fatalf("Failed to add user: %v", err)
 	}
@@ -56,16 +60,38 @@ func TestUserServiceAddUser(t *testing.T) {
 	}
 
 	// 一般ユーザーが他のユーザーを追加しようとする（失敗すべき）
-	_, err = service.AddUser("user123", "user456", "anotheruser")
+	_, err = service.AddUser("", "user123", "user456", "anotheruser", sql.NullTime{})
 	if err == nil {
 		t.Error("Expected error when non-owner tries to add user")
 	}
 
 	// 存在しないユーザーが追加しようとする（失敗すべき）
-	_, err = service.AddUser("nonexistent", "user789", "someuser")
+	_, err = service.AddUser("", "nonexistent", "user789", "someuser", sql.NullTime{})
 	if err == nil {
 		t.Error("Expected error when non-existent user tries to add user")
 	}
+	// 期限付きで追加したユーザーは、期限切れ後に再度追加すると新しい期限で有効になる
+	expiresAt := sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}
+	contractor, err := service.AddUser("", "owner123", "contractor123", "contractor", expiresAt)
+	if err != nil {
+		t.Fatalf("Failed to add user with expiry: %v", err)
+	}
+	if !contractor.AccessEnded(time.Now()) {
+		t.Errorf("Expected contractor's access to have ended, got %+v", contractor)
+	}
+
+	if _, err := service.AddUser("", "owner123", "user123", "testuser", sql.NullTime{}); err == nil {
+		t.Error("Expected error when adding an active user twice")
+	}
+
+	_ = mockDB.SetUserAccess("", "contractor123", expiresAt, true)
+	renewed, err := service.AddUser("", "owner123", "contractor123", "contractor", sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true})
+	if err != nil {
+		t.Fatalf("Failed to renew expired user: %v", err)
+	}
+	if renewed.Disabled || renewed.AccessEnded(time.Now()) {
+		t.Errorf("Expected contractor to be enabled again, got %+v", renewed)
+	}
 }
 
 // TestUserServicePromoteToOwner はオーナー昇格のテスト
@@ -73,26 +99,26 @@ func TestUserServicePromoteToOwner(t *testing.T) {
 	mockDB := &MockDB{
 		users: make(map[string]*db.User),
 	}
-	service := NewUserService(mockDB)
+	service := NewUserService(mockDB, ownerAuthorizer{})
 
 	// オーナーと一般ユーザーを作成
-	_, _ = service.InitializeUser("owner123", "owner", true)
-	_, _ = service.AddUser("owner123", "user123", "testuser")
+	_, _ = service.InitializeUser("owner123", "owner", "", true)
+	_, _ = service.AddUser("", "owner123", "user123", "testuser", sql.NullTime{})
 
 	// 一般ユーザーをオーナーに昇格
-	err := service.PromoteToOwner("owner123", "user123")
+	err := service.PromoteToOwner("", "owner123", "user123")
 	if err != nil {
 		t.Fatalf("Failed to promote user to owner: %v", err)
 	}
 
 	// 更新されたユーザー情報を確認
-	updatedUser, _ := service.GetUser("user123")
+	updatedUser, _ := service.GetUser("", "user123")
 	if updatedUser.Role != "owner" {
 		t.Errorf("Expected role 'owner', got '%s'", updatedUser.Role)
 	}
 
 	// 一般ユーザーが昇格を試行（失敗すべき）
-	err = service.PromoteToOwner("user123", "owner123")
+	err = service.PromoteToOwner("", "user123", "owner123")
 	if err == nil {
 		t.Error("Expected error when non-owner tries to promote user")
 	}
@@ -103,26 +129,26 @@ func TestUserServiceDemoteFromOwner(t *testing.T) {
 	mockDB := &MockDB{
 		users: make(map[string]*db.User),
 	}
-	service := NewUserService(mockDB)
+	service := NewUserService(mockDB, ownerAuthorizer{})
 
 	// 2人のオーナーを作成
-	_, _ = service.InitializeUser("owner1", "owner1", true)
-	_, _ = service.InitializeUser("owner2", "owner2", true)
+	_, _ = service.InitializeUser("owner1", "owner1", "", true)
+	_, _ = service.InitializeUser("owner2", "owner2", "", true)
 
 	// オーナー1がオーナー2を降格
-	err := service.DemoteFromOwner("owner1", "owner2")
+	err := service.DemoteFromOwner("", "owner1", "owner2")
 	if err != nil {
 		t.Fatalf("Failed to demote owner: %v", err)
 	}
 
 	// 更新されたユーザー情報を確認
-	demotedUser, _ := service.GetUser("owner2")
+	demotedUser, _ := service.GetUser("", "owner2")
 	if demotedUser.Role != "user" {
 		t.Errorf("Expected role 'user', got '%s'", demotedUser.Role)
 	}
 
 	// 自分自身を降格しようとする（失敗すべき）
-	err = service.DemoteFromOwner("owner1", "owner1")
+	err = service.DemoteFromOwner("", "owner1", "owner1")
 	if err == nil {
 		t.Error("Expected error when owner tries to demote themselves")
 	}
@@ -133,59 +159,206 @@ func TestUserServiceRemoveUser(t *testing.T) {
 	mockDB := &MockDB{
 		users: make(map[string]*db.User),
 	}
-	service := NewUserService(mockDB)
+	service := NewUserService(mockDB, ownerAuthorizer{})
 
 	// オーナーと一般ユーザーを作成
-	_, _ = service.InitializeUser("owner123", "owner", true)
-	_, _ = service.AddUser("owner123", "user123", "testuser")
+	_, _ = service.InitializeUser("owner123", "owner", "", true)
+	_, _ = service.AddUser("", "owner123", "user123", "testuser", sql.NullTime{})
+
+	// セッションの終了に失敗した場合はユーザーを削除しない
+	terminator := &fakeSessionTerminator{err: fmt.Errorf("sandbox deletion failed")}
+	service.SetSessionTerminator(terminator)
+	if _, err := service.RemoveUser(context.Background(), "", "owner123", "user123"); err == nil {
+		t.Fatal("Expected error when terminating sessions fails")
+	}
+	user, _ := service.GetUser("", "user123")
+	if user == nil {
+		t.Fatal("Expected user to remain after failed removal")
+	}
+	// 残ったユーザーは無効化され、再実行までに新しいセッションを作成できない
+	if !user.Disabled {
+		t.Error("Expected user to be disabled after failed removal")
+	}
 
-	// ユーザーを削除
-	err := service.RemoveUser("owner123", "user123")
+	// 再実行するとセッションを終了してからユーザーを削除する
+	terminator.err = nil
+	terminated, err := service.RemoveUser(context.Background(), "", "owner123", "user123")
 	if err != nil {
 		t.Fatalf("Failed to remove user: %v", err)
 	}
+	if terminated != 1 || len(terminator.users) != 2 || terminator.users[1] != "user123" {
+		t.Errorf("Expected sessions of user123 to be terminated, got %d (%v)", terminated, terminator.users)
+	}
 
 	// 削除されたユーザーが取得できないことを確認
-	deletedUser, _ := service.GetUser("user123")
+	deletedUser, _ := service.GetUser("", "user123")
 	if deletedUser != nil {
 		t.Error("Expected user to be deleted")
 	}
 
 	// 自分自身を削除しようとする（失敗すべき）
-	err = service.RemoveUser("owner123", "owner123")
-	if err == nil {
+	if _, err := service.RemoveUser(context.Background(), "", "owner123", "owner123"); err == nil {
 		t.Error("Expected error when owner tries to remove themselves")
 	}
 }
 
+// TestUserServiceAssignRole はロールの割り当てのテスト
+func TestUserServiceAssignRole(t *testing.T) {
+	store := db.NewMemoryStore(3)
+	service := NewUserService(store, NewPermissionService(store, Limits{}))
+	service.SetAuditLogger(NewAuditLogger(store))
+
+	_, _ = store.CreateRole("", "reviewer", "", []string{"view_usage"})
+	_, _ = service.InitializeUser("owner123", "owner", "", true)
+	_, _ = service.AddUser("", "owner123", "user123", "testuser", sql.NullTime{})
+
+	if err := service.AssignRole("", "owner123", "user123", "reviewer"); err != nil {
+		t.Fatalf("Failed to assign role: %v", err)
+	}
+	if user, _ := store.GetUserByDiscordID("", "user123"); user.Role != "reviewer" {
+		t.Errorf("Expected role 'reviewer', got '%s'", user.Role)
+	}
+
+	// 存在しないロールは割り当てられない
+	if err := service.AssignRole("", "owner123", "user123", "admin"); err == nil {
+		t.Error("Expected error for unknown role")
+	}
+
+	// manage_users を持たないユーザーは割り当てられない
+	if err := service.AssignRole("", "user123", "owner123", "user"); !IsPermissionDenied(err) {
+		t.Errorf("Expected permission error, got %v", err)
+	}
+
+	// 自分自身のロールは変更できない
+	if err := service.AssignRole("", "owner123", "owner123", "user"); err == nil {
+		t.Error("Expected error when owner tries to change their own role")
+	}
+
+	events, _ := store.ListAuditEvents("", "user123", 1)
+	if len(events) != 1 || events[0].Action != AuditUserRoleAssign || events[0].BeforeRole.String != "user" || events[0].AfterRole.String != "reviewer" {
+		t.Errorf("Unexpected audit events: %+v", events)
+	}
+}
+
+// TestUserServiceGuild はギルドごとのユーザー管理のテスト
+func TestUserServiceGuild(t *testing.T) {
+	store := db.NewMemoryStore(3)
+	service := NewUserService(store, NewPermissionService(store, Limits{}))
+
+	_, _ = store.UpsertGuild("guild1", "guild1")
+	_, _ = store.UpsertGuild("guild2", "guild2")
+	_, _ = service.InitializeUser("owner1", "owner1", "guild1", true)
+	_, _ = service.InitializeUser("owner2", "owner2", "guild2", true)
+
+	// 追加したユーザーは指定したギルドに所属する
+	user, err := service.AddUser("guild1", "owner1", "user123", "testuser", sql.NullTime{})
+	if err != nil {
+		t.Fatalf("Failed to add user: %v", err)
+	}
+	if !user.InGuild("guild1") {
+		t.Errorf("Expected user in guild1, got %+v", user.GuildID)
+	}
+
+	// 他のギルドのユーザーは管理できない
+	if err := service.PromoteToOwner("guild2", "owner2", "user123"); err == nil {
+		t.Error("Expected error when promoting a user of another guild")
+	}
+	if _, err := service.AddUser("guild2", "owner1", "user456", "anotheruser", sql.NullTime{}); err == nil {
+		t.Error("Expected error when the requester is not registered in the guild")
+	}
+
+	// 同じDiscordユーザーを他のギルドでは別のユーザーとして追加・削除できる
+	other, err := service.AddUser("guild2", "owner2", "user123", "testuser", sql.NullTime{})
+	if err != nil {
+		t.Fatalf("Failed to add user to guild2: %v", err)
+	}
+	if other.ID == user.ID || !other.InGuild("guild2") {
+		t.Errorf("Expected separate user in guild2, got %+v", other)
+	}
+	if _, err := service.RemoveUser(context.Background(), "guild2", "owner2", "user123"); err != nil {
+		t.Fatalf("Failed to remove user from guild2: %v", err)
+	}
+	if remaining, _ := service.GetUser("guild1", "user123"); remaining == nil {
+		t.Error("Expected user in guild1 to remain")
+	}
+
+	// 他のギルドで作成されたロールは割り当てられず、同じ名前のロールをギルドごとに作成できる
+	_, _ = store.CreateRole("guild2", "reviewer", "", []string{"view_usage"})
+	if err := service.AssignRole("guild1", "owner1", "user123", "reviewer"); err == nil {
+		t.Error("Expected error for role of another guild")
+	}
+	if _, err := store.CreateRole("guild1", "reviewer", "", []string{"view_audit"}); err != nil {
+		t.Fatalf("Failed to create role with the same name in guild1: %v", err)
+	}
+	if err := service.AssignRole("guild1", "owner1", "user123", "reviewer"); err != nil {
+		t.Errorf("Expected guild1 role to be assigned, got %v", err)
+	}
+	if err := service.AssignRole("guild1", "owner1", "user123", "owner"); err != nil {
+		t.Errorf("Expected builtin role to be available in every guild, got %v", err)
+	}
+}
+
+// TestFindHomeUser はギルドを特定できない操作でのユーザーの検索のテスト
+func TestFindHomeUser(t *testing.T) {
+	store := db.NewMemoryStore(3)
+	_, _ = store.UpsertGuild("guild1", "guild1")
+	_, _ = store.UpsertGuild("guild2", "guild2")
+
+	if user, err := FindHomeUser(store, "guild1", "user123"); err != nil || user != nil {
+		t.Errorf("Expected no user, got %+v, %v", user, err)
+	}
+
+	// 1つのギルドにのみ登録されている場合は、デフォルトのギルドでなくてもそのユーザー
+	only, _ := store.CreateUser("guild2", "user123", "user", "user")
+	if user, err := FindHomeUser(store, "guild1", "user123"); err != nil || user == nil || user.ID != only.ID {
+		t.Errorf("Expected the only registered user, got %+v, %v", user, err)
+	}
+
+	// 複数のギルドに登録されている場合は、デフォルトのギルドのユーザーを優先する
+	home, _ := store.CreateUser("guild1", "user123", "user", "user")
+	if user, err := FindHomeUser(store, "guild1", "user123"); err != nil || user == nil || user.ID != home.ID {
+		t.Errorf("Expected the user of the default guild, got %+v, %v", user, err)
+	}
+	if _, err := FindHomeUser(store, "", "user123"); !errors.Is(err, ErrAmbiguousGuild) {
+		t.Errorf("Expected ErrAmbiguousGuild without default guild, got %v", err)
+	}
+}
+
 // MockDB はテスト用のモックデータベース
+// ユーザーはギルドとDiscord IDの組をキーにして保持する
 type MockDB struct {
 	users  map[string]*db.User
 	nextID int
 }
 
-func (m *MockDB) GetUserByDiscordID(discordID string) (*db.User, error) {
-	user, exists := m.users[discordID]
+// mockUserKey はMockDBのユーザーのキー
+func mockUserKey(guildID, discordID string) string {
+	return guildID + "/" + discordID
+}
+
+func (m *MockDB) GetUserByDiscordID(guildID, discordID string) (*db.User, error) {
+	user, exists := m.users[mockUserKey(guildID, discordID)]
 	if !exists {
 		return nil, nil
 	}
 	return user, nil
 }
 
-func (m *MockDB) CreateUser(discordID, username, role string) (*db.User, error) {
+func (m *MockDB) CreateUser(guildID, discordID, username, role string) (*db.User, error) {
 	m.nextID++
 	user := &db.User{
 		ID:        m.nextID,
 		DiscordID: discordID,
 		Username:  username,
 		Role:      role,
+		GuildID:   sql.NullString{String: guildID, Valid: guildID != ""},
 	}
-	m.users[discordID] = user
+	m.users[mockUserKey(guildID, discordID)] = user
 	return user, nil
 }
 
-func (m *MockDB) UpdateUserRole(discordID, role string) error {
-	user, exists := m.users[discordID]
+func (m *MockDB) UpdateUserRole(guildID, discordID, role string) error {
+	user, exists := m.users[mockUserKey(guildID, discordID)]
 	if !exists {
 		return fmt.Errorf("user not found")
 	}
@@ -193,11 +366,62 @@ func (m *MockDB) UpdateUserRole(discordID, role string) error {
 	return nil
 }
 
-func (m *MockDB) DeleteUser(discordID string) error {
-	_, exists := m.users[discordID]
+func (m *MockDB) SetUserRoleSource(guildID, discordID, source string) error {
+	user, exists := m.users[mockUserKey(guildID, discordID)]
 	if !exists {
 		return fmt.Errorf("user not found")
 	}
-	delete(m.users, discordID)
+	user.RoleSource = source
+	return nil
+}
+
+func (m *MockDB) SetUserAccess(guildID, discordID string, expiresAt sql.NullTime, disabled bool) error {
+	user, exists := m.users[mockUserKey(guildID, discordID)]
+	if !exists {
+		return fmt.Errorf("user not found")
+	}
+	user.ExpiresAt = expiresAt
+	user.Disabled = disabled
+	return nil
+}
+
+func (m *MockDB) DeleteUser(guildID, discordID string) error {
+	_, exists := m.users[mockUserKey(guildID, discordID)]
+	if !exists {
+		return fmt.Errorf("user not found")
+	}
+	delete(m.users, mockUserKey(guildID, discordID))
+	return nil
+}
+
+func (m *MockDB) GetRoleByName(guildID, name string) (*db.Role, error) {
+	if name != "owner" && name != "user" {
+		return nil, nil
+	}
+	return &db.Role{Name: name, Builtin: true}, nil
+}
+
+// fakeSessionTerminator はテスト用のUserSessionTerminator
+// 呼び出されたユーザーを記録し、errが設定されている場合は失敗する
+type fakeSessionTerminator struct {
+	users []string
+	err   error
+}
+
+func (f *fakeSessionTerminator) TerminateUserSessions(ctx context.Context, user, actor *db.User, reason string) (int, error) {
+	f.users = append(f.users, user.DiscordID)
+	if f.err != nil {
+		return 0, f.err
+	}
+	return 1, nil
+}
+
+// ownerAuthorizer はオーナーにのみすべての操作を許可するテスト用のAuthorizer
+type ownerAuthorizer struct{}
+
+func (ownerAuthorizer) Authorize(actor *db.User, capability Capability, resource Resource) error {
+	if actor == nil || !actor.IsOwner() {
+		return &PermissionError{Capability: capability, message: "permission denied"}
+	}
 	return nil
 }
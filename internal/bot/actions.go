@@ -0,0 +1,214 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/auth"
+	"github.com/hirano00o/disclaude/internal/db"
+	"github.com/hirano00o/disclaude/internal/render"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+)
+
+// maxWorkspaceArchiveSize はダウンロードボタンで添付できるワークスペースのアーカイブの最大サイズ（Discordの添付ファイルの上限）
+const maxWorkspaceArchiveSize = 10 << 20
+
+// sessionActionHandler はセッションの操作ボタンの処理
+type sessionActionHandler func(b *Bot, s DiscordSession, i *discordgo.InteractionCreate, user *db.User, session *db.Session)
+
+// sessionActions はセッションの操作ボタンのカスタムIDの接頭辞と処理
+var sessionActions = map[string]sessionActionHandler{
+	render.CloseSessionButtonPrefix:      (*Bot).handleCloseButton,
+	render.ExtendSessionButtonPrefix:     (*Bot).handleExtendButton,
+	render.DownloadWorkspaceButtonPrefix: (*Bot).handleDownloadWorkspaceButton,
+	render.ViewDiffButtonPrefix:          (*Bot).handleViewDiffButton,
+}
+
+// handleSessionAction はセッションの操作ボタンを処理する（該当するボタンでない場合はfalseを返す）
+func (b *Bot) handleSessionAction(s DiscordSession, i *discordgo.InteractionCreate, customID string) bool {
+	for prefix, handler := range sessionActions {
+		if !strings.HasPrefix(customID, prefix) {
+			continue
+		}
+
+		sessionID, err := strconv.Atoi(strings.TrimPrefix(customID, prefix))
+		if err != nil {
+			b.respondEphemeral(s, i, "不正なボタンです")
+			return true
+		}
+
+		user, session, ok := b.interactionSession(s, i, sessionID)
+		if !ok {
+			return true
+		}
+
+		handler(b, s, i, user, session)
+		return true
+	}
+
+	return false
+}
+
+// handleCloseButton は終了ボタンでセッションを終了する
+func (b *Bot) handleCloseButton(s DiscordSession, i *discordgo.InteractionCreate, user *db.User, session *db.Session) {
+	if !session.IsActive() {
+		b.respondEphemeral(s, i, "このセッションは既に終了しています")
+		return
+	}
+
+	// セッション所有者または manage_sessions 権限を持つユーザーのみ終了可能（招待されたユーザーは終了できない）
+	if !b.authorizeInteraction(s, i, b.permService.AuthorizeSession(user, session, ""), "このセッションを終了する権限がありません") {
+		return
+	}
+
+	// 終了したセッションのボタンを取り除く
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    i.Message.Content,
+			Embeds:     i.Message.Embeds,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to respond to interaction")
+	}
+
+	b.closeSession(s, user, session)
+}
+
+// handleExtendButton は延長ボタンでセッションの最大利用時間を延長する
+func (b *Bot) handleExtendButton(s DiscordSession, i *discordgo.InteractionCreate, user *db.User, session *db.Session) {
+	if !session.IsActive() {
+		b.respondEphemeral(s, i, "このセッションは既に終了しています")
+		return
+	}
+
+	// 延長は利用上限を超えるため、自分のセッションでも manage_sessions 権限を必要とする
+	if !b.authorizeInteraction(s, i, b.permService.Authorize(user, auth.CapabilityManageSessions, session), fmt.Sprintf("セッションの延長には `%s` 権限が必要です", auth.CapabilityManageSessions)) {
+		return
+	}
+
+	extension := b.config.Dashboard.ExtendDuration
+	if extension <= 0 {
+		b.respondEphemeral(s, i, "セッションの延長は設定されていません")
+		return
+	}
+
+	if err := b.sessionManager.ExtendSession(session.ID, extension); err != nil {
+		logrus.WithError(err).WithField("session_id", session.ID).Error("Failed to extend session")
+		b.respondEphemeral(s, i, "セッションの延長に失敗しました")
+		return
+	}
+
+	message := render.SessionExtended(session.ID, user.Username, extension)
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Embeds: message.Embeds},
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to respond to interaction")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"requester_id": user.ID,
+		"session_id":   session.ID,
+		"extension":    extension.String(),
+	}).Info("Session extended via button")
+}
+
+// handleDownloadWorkspaceButton はダウンロードボタンでワークスペースのアーカイブをスレッドに添付する
+func (b *Bot) handleDownloadWorkspaceButton(s DiscordSession, i *discordgo.InteractionCreate, user *db.User, session *db.Session) {
+	if !b.acknowledgeWorkspaceAction(s, i, user, session) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	archive, err := b.claudeService.ArchiveWorkspace(ctx, session.SandboxName, maxWorkspaceArchiveSize)
+	if errors.Is(err, ErrWorkspaceTooLarge) {
+		b.sendErrorMessage(s, session.ThreadID, fmt.Sprintf("ワークスペースが添付できるサイズ（%d MB）を超えているため、ダウンロードできません", maxWorkspaceArchiveSize>>20))
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("session_id", session.ID).Error("Failed to archive workspace")
+		b.sendErrorMessage(s, session.ThreadID, "ワークスペースのアーカイブに失敗しました")
+		return
+	}
+
+	b.sendRendered(s, session.ThreadID, render.WorkspaceArchive(session.ID, user.Username, archive))
+
+	logrus.WithFields(logrus.Fields{
+		"requester_id": user.ID,
+		"session_id":   session.ID,
+		"size":         len(archive),
+	}).Info("Workspace archive sent")
+}
+
+// handleViewDiffButton は差分ボタンでワークスペースのコミットされていない変更をスレッドに表示する
+func (b *Bot) handleViewDiffButton(s DiscordSession, i *discordgo.InteractionCreate, user *db.User, session *db.Session) {
+	if !b.acknowledgeWorkspaceAction(s, i, user, session) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	status, diff, err := b.claudeService.WorkspaceDiff(ctx, session.SandboxName)
+	if errors.Is(err, ErrNotGitRepository) {
+		b.sendErrorMessage(s, session.ThreadID, "ワークスペースがGitリポジトリではないため、差分を表示できません")
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("session_id", session.ID).Error("Failed to get workspace diff")
+		b.sendErrorMessage(s, session.ThreadID, "差分の取得に失敗しました")
+		return
+	}
+
+	b.sendRendered(s, session.ThreadID, render.WorkspaceDiff(session.ID, status, diff))
+}
+
+// acknowledgeWorkspaceAction はワークスペースを参照するボタンの権限を確認し、インタラクションに応答する
+// サンドボックスでの処理は応答期限を超えることがあるため、結果はスレッドに送信する
+func (b *Bot) acknowledgeWorkspaceAction(s DiscordSession, i *discordgo.InteractionCreate, user *db.User, session *db.Session) bool {
+	if !session.IsActive() {
+		b.respondEphemeral(s, i, "このセッションのサンドボックスは利用できません")
+		return false
+	}
+
+	// セッション所有者、manage_sessions 権限を持つユーザー、招待されたユーザーのみ参照可能
+	if !b.authorizeInteraction(s, i, b.permService.AuthorizeSession(user, session, db.SessionMemberViewer), "このセッションを操作する権限がありません") {
+		return false
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to respond to interaction")
+	}
+	return true
+}
+
+// authorizeInteraction は権限確認の結果をインタラクションに応答し、許可された場合はtrueを返す
+func (b *Bot) authorizeInteraction(s DiscordSession, i *discordgo.InteractionCreate, err error, denied string) bool {
+	if err == nil {
+		return true
+	}
+
+	if !auth.IsPermissionDenied(err) {
+		logrus.WithError(err).Error("Failed to check permission")
+		b.respondEphemeral(s, i, "権限確認中にエラーが発生しました")
+		return false
+	}
+
+	b.respondEphemeral(s, i, denied)
+	return false
+}
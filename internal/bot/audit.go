@@ -0,0 +1,149 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hirano00o/disclaude/internal/auth"
+	"github.com/hirano00o/disclaude/internal/db"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// auditTimeFormat は監査ログの日時の表示形式
+	auditTimeFormat = "2006-01-02 15:04:05"
+	// defaultAuditLimit は `/claude audit` で表示する監査ログのデフォルトの件数
+	defaultAuditLimit = 20
+	// maxAuditLimit は `/claude audit` で表示できる監査ログの最大件数
+	maxAuditLimit = 50
+)
+
+// auditActionLabels は監査ログの操作の表示名
+var auditActionLabels = map[string]string{
+	auth.AuditUserRegister:     "ユーザー登録",
+	auth.AuditUserAdd:          "ユーザー追加",
+	auth.AuditUserRemove:       "ユーザー削除",
+	auth.AuditUserPromote:      "オーナー昇格",
+	auth.AuditUserDemote:       "オーナー降格",
+	auth.AuditUserRoleSync:     "ロール連携による更新",
+	auth.AuditUserExpire:       "アクセス期限切れによる無効化",
+	auth.AuditUserRoleAssign:   "ロールの割り当て",
+	auth.AuditRoleCreate:       "ロールの作成",
+	auth.AuditRoleUpdate:       "ロールの権限の変更",
+	auth.AuditRoleDelete:       "ロールの削除",
+	auth.AuditRoleBind:         "ロール連携の登録",
+	auth.AuditRoleUnbind:       "ロール連携の削除",
+	auth.AuditSessionStart:     "セッション開始",
+	auth.AuditSessionClose:     "セッション終了",
+	auth.AuditSessionTerminate: "セッション強制終了",
+	auth.AuditSessionInvite:    "セッションへの招待",
+}
+
+// AuditLogger は特権操作を記録するAuditLoggerを返す（管理APIと共有する）
+func (b *Bot) AuditLogger() *auth.AuditLogger {
+	return b.audit
+}
+
+// handleAuditCommand は `/claude audit [user] [limit]` コマンドを処理する
+func (b *Bot) handleAuditCommand(s DiscordSession, m *discordgo.MessageCreate, user *db.User, args []string) {
+	// 権限チェック
+	if err := b.permService.Authorize(user, auth.CapabilityViewAudit, nil); err != nil {
+		b.sendErrorMessage(s, m.ChannelID, err.Error())
+		return
+	}
+
+	// 引数の解析（ユーザーIDと件数はどちらも省略可能、順不同）
+	targetID := ""
+	limit := defaultAuditLimit
+	for _, arg := range args {
+		if n, err := strconv.Atoi(arg); err == nil && len(arg) < 15 {
+			if n < 1 || n > maxAuditLimit {
+				b.sendErrorMessage(s, m.ChannelID, fmt.Sprintf("件数は1から%dの範囲で指定してください", maxAuditLimit))
+				return
+			}
+			limit = n
+			continue
+		}
+		targetID = parseUserMention(arg)
+	}
+
+	if targetID != "" && (len(targetID) < 15 || len(targetID) > 20) {
+		b.sendErrorMessage(s, m.ChannelID, "無効なユーザーIDです")
+		return
+	}
+
+	events, err := b.db.ListAuditEvents(user.GuildID.String, targetID, limit)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list audit events")
+		b.sendErrorMessage(s, m.ChannelID, "監査ログの取得に失敗しました")
+		return
+	}
+
+	auditMessage := "📜 **監査ログ**"
+	if targetID != "" {
+		auditMessage += fmt.Sprintf("（ユーザー: %s）", targetID)
+	}
+	auditMessage += "\n"
+
+	if len(events) == 0 {
+		auditMessage += "\n記録された操作はありません"
+		b.sendMessage(s, m.ChannelID, auditMessage)
+		return
+	}
+
+	for _, event := range events {
+		auditMessage += "\n• " + formatAuditEvent(event)
+	}
+
+	b.sendMessage(s, m.ChannelID, auditMessage)
+}
+
+// mirrorAuditEvent は記録された監査ログを、操作が行われたギルドの管理チャンネルに転送する
+func (b *Bot) mirrorAuditEvent(event *db.AuditEvent) {
+	channelID := b.auditChannelFor(event)
+	if channelID == "" {
+		return
+	}
+
+	content := "📜 " + formatAuditEvent(event)
+	if _, err := b.discord.ChannelMessageSend(channelID, content); err != nil {
+		logrus.WithError(err).WithField("audit_event_id", event.ID).Error("Failed to mirror audit event")
+	}
+}
+
+// formatAuditEvent は監査ログを1行で表示する形式に変換する
+// ユーザーへの通知を避けるため、メンションではなくユーザー名で表示する
+func formatAuditEvent(event *db.AuditEvent) string {
+	label, ok := auditActionLabels[event.Action]
+	if !ok {
+		label = event.Action
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "`%s` [%s] **%s**", event.CreatedAt.Format(auditTimeFormat), label, event.ActorUsername)
+	if event.TargetDiscordID.Valid {
+		fmt.Fprintf(&sb, " → **%s** (%s)", event.TargetUsername.String, event.TargetDiscordID.String)
+	}
+	if event.BeforeRole.Valid || event.AfterRole.Valid {
+		fmt.Fprintf(&sb, " %s → %s", formatAuditRole(event.BeforeRole.String), formatAuditRole(event.AfterRole.String))
+	}
+	if event.SessionID.Valid {
+		fmt.Fprintf(&sb, " セッション `#%d` <#%s>", event.SessionID.Int64, event.ThreadID.String)
+	}
+	if event.Detail != "" {
+		fmt.Fprintf(&sb, " (%s)", event.Detail)
+	}
+
+	return sb.String()
+}
+
+// formatAuditRole は監査ログのロールを表示する（ロールがない場合は「なし」）
+func formatAuditRole(role string) string {
+	if role == "" {
+		return "なし"
+	}
+	return role
+}
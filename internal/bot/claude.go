@@ -2,13 +2,18 @@ package bot
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/hirano00o/disclaude/internal/k8s"
+	"github.com/hirano00o/disclaude/internal/metrics"
 
 	"github.com/sirupsen/logrus"
+	utilexec "k8s.io/client-go/util/exec"
 )
 
 // ClaudeService はClaude Codeとの通信を管理するサービス
@@ -23,30 +28,220 @@ func NewClaudeService(sandboxManager *k8s.SandboxManager) *ClaudeService {
 	}
 }
 
+// ClaudeResponse はClaude Codeの1ターンの応答と使用量を表す構造体
+type ClaudeResponse struct {
+	// Text はDiscord表示用に整形した応答
+	Text string
+	// FullText は整形前の応答全文（会話履歴に保存する）
+	FullText     string
+	ToolEvents   []ToolEvent
+	InputTokens  int64
+	OutputTokens int64
+	CostUSD      float64
+	Duration     time.Duration
+	ExitStatus   string
+}
+
+// ToolEvent はClaude Codeのツール呼び出し・結果を表す構造体
+type ToolEvent struct {
+	// Type は tool_use または tool_result
+	Type    string
+	Name    string
+	Content string
+	IsError bool
+}
+
+// claudeStreamEvent は `claude -p --output-format stream-json` が1行ずつ出力するイベント
+type claudeStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Content []struct {
+			Type      string          `json:"type"`
+			Text      string          `json:"text"`
+			ID        string          `json:"id"`
+			Name      string          `json:"name"`
+			Input     json.RawMessage `json:"input"`
+			ToolUseID string          `json:"tool_use_id"`
+			Content   json.RawMessage `json:"content"`
+			IsError   bool            `json:"is_error"`
+		} `json:"content"`
+	} `json:"message"`
+}
+
+// claudeResult はClaude Codeが最後に出力する結果JSON
+type claudeResult struct {
+	Type         string  `json:"type"`
+	Subtype      string  `json:"subtype"`
+	IsError      bool    `json:"is_error"`
+	DurationMS   int64   `json:"duration_ms"`
+	Result       string  `json:"result"`
+	TotalCostUSD float64 `json:"total_cost_usd"`
+	Usage        struct {
+		InputTokens              int64 `json:"input_tokens"`
+		CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+		CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+		OutputTokens             int64 `json:"output_tokens"`
+	} `json:"usage"`
+}
+
 // SendMessage はClaude Codeにメッセージを送信し、応答を取得する
-func (cs *ClaudeService) SendMessage(ctx context.Context, podName, message string) (string, error) {
+func (cs *ClaudeService) SendMessage(ctx context.Context, podName, message string) (*ClaudeResponse, error) {
 	// メッセージの前処理
 	processedMessage := cs.preprocessMessage(message)
 
-	// Claude Codeコマンドの構築
-	claudeCommand := fmt.Sprintf("echo %s | claude", cs.escapeShellString(processedMessage))
+	// Claude Codeコマンドの構築（使用量とツールイベントを取得するためJSONストリームで出力させる）
+	claudeCommand := fmt.Sprintf("echo %s | claude -p --output-format stream-json --verbose", cs.escapeShellString(processedMessage))
 
 	// サンドボックス内でコマンド実行
-	response, err := cs.sandboxManager.ExecuteCommand(ctx, podName, claudeCommand)
+	start := time.Now()
+	output, err := cs.sandboxManager.ExecuteCommand(ctx, podName, claudeCommand)
+	duration := time.Since(start)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute claude command: %w", err)
+		metrics.ClaudeTurnDuration.WithLabelValues("failure").Observe(duration.Seconds())
+		return nil, fmt.Errorf("failed to execute claude command: %w", err)
 	}
 
-	// 応答の後処理
-	processedResponse := cs.postprocessResponse(response)
+	// 応答の解析と後処理
+	response, err := cs.parseResult(output)
+	if err != nil {
+		metrics.ClaudeTurnDuration.WithLabelValues("failure").Observe(duration.Seconds())
+		return nil, err
+	}
+	if response.Duration == 0 {
+		response.Duration = duration
+	}
+	response.FullText = response.Text
+	response.Text = cs.postprocessResponse(response.Text)
+
+	metrics.ClaudeTurnDuration.WithLabelValues("success").Observe(duration.Seconds())
+	metrics.ClaudeResponseBytes.Observe(float64(len(response.Text)))
+	metrics.ClaudeTokens.WithLabelValues("input").Add(float64(response.InputTokens))
+	metrics.ClaudeTokens.WithLabelValues("output").Add(float64(response.OutputTokens))
+	metrics.ClaudeCostUSD.Add(response.CostUSD)
 
 	logrus.WithFields(logrus.Fields{
-		"pod_name":     podName,
-		"message_len":  len(message),
-		"response_len": len(processedResponse),
+		"pod_name":      podName,
+		"message_len":   len(message),
+		"response_len":  len(response.Text),
+		"tool_events":   len(response.ToolEvents),
+		"input_tokens":  response.InputTokens,
+		"output_tokens": response.OutputTokens,
+		"cost_usd":      response.CostUSD,
+		"exit_status":   response.ExitStatus,
 	}).Debug("Claude Code message processed")
 
-	return processedResponse, nil
+	return response, nil
+}
+
+// parseResult はClaude Codeの出力からツールイベントと結果JSONを解析する
+// 結果JSONが見つからない場合はアシスタントのテキストを応答として扱い、テキストもない場合はエラーを返す
+// JSONストリームや標準エラー出力をそのまま応答として扱うことはしない
+func (cs *ClaudeService) parseResult(output string) (*ClaudeResponse, error) {
+	var toolEvents []ToolEvent
+	var texts []string
+	var result *claudeResult
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+
+		var event claudeStreamEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			continue
+		}
+
+		switch event.Type {
+		case "assistant", "user":
+			for _, content := range event.Message.Content {
+				switch content.Type {
+				case "text":
+					if event.Type == "assistant" && content.Text != "" {
+						texts = append(texts, content.Text)
+					}
+				case "tool_use":
+					toolEvents = append(toolEvents, ToolEvent{
+						Type:    "tool_use",
+						Name:    content.Name,
+						Content: string(content.Input),
+					})
+				case "tool_result":
+					toolEvents = append(toolEvents, ToolEvent{
+						Type:    "tool_result",
+						Content: toolResultText(content.Content),
+						IsError: content.IsError,
+					})
+				}
+			}
+		case "result":
+			var r claudeResult
+			if err := json.Unmarshal([]byte(line), &r); err == nil {
+				result = &r
+			}
+		}
+	}
+
+	if result == nil {
+		if len(texts) == 0 {
+			return nil, errors.New("claude code returned neither a result nor a response text")
+		}
+
+		logrus.Warn("Claude Code result JSON not found in output, usage is not recorded")
+		return &ClaudeResponse{
+			Text:       strings.Join(texts, "\n\n"),
+			ToolEvents: toolEvents,
+			ExitStatus: "unknown",
+		}, nil
+	}
+
+	exitStatus := result.Subtype
+	if result.IsError && exitStatus == "success" {
+		exitStatus = "error"
+	}
+
+	return &ClaudeResponse{
+		Text:         result.Result,
+		ToolEvents:   toolEvents,
+		InputTokens:  result.Usage.InputTokens + result.Usage.CacheCreationInputTokens + result.Usage.CacheReadInputTokens,
+		OutputTokens: result.Usage.OutputTokens,
+		CostUSD:      result.TotalCostUSD,
+		Duration:     time.Duration(result.DurationMS) * time.Millisecond,
+		ExitStatus:   exitStatus,
+	}, nil
+}
+
+// toolResultText はtool_resultのcontent（文字列またはブロック配列）をテキストに変換する
+func toolResultText(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+
+	var blocks []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &blocks); err == nil {
+		var parts []string
+		for _, block := range blocks {
+			if block.Type == "text" {
+				parts = append(parts, block.Text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+
+	return string(raw)
+}
+
+// exitCodeOf はコマンド実行エラーから終了コードを取り出す
+func exitCodeOf(err error) (int, bool) {
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), true
+	}
+	return 0, false
 }
 
 // SendFileContent はファイル内容をClaude Codeに送信する
@@ -243,6 +438,116 @@ func (cs *ClaudeService) isDangerousCommand(command string) bool {
 	return false
 }
 
+var (
+	// ErrNotGitRepository はワークスペースがGitリポジトリではないことを示すエラー
+	ErrNotGitRepository = errors.New("workspace is not a git repository")
+
+	// ErrWorkspaceTooLarge はワークスペースのアーカイブが上限のサイズを超えていることを示すエラー
+	ErrWorkspaceTooLarge = errors.New("workspace archive is too large")
+)
+
+const (
+	// notGitRepositoryMarker はワークスペースがGitリポジトリではない場合にコマンドが出力する目印
+	notGitRepositoryMarker = "__DISCLAUDE_NOT_GIT__"
+
+	// diffMarker は `git status` と `git diff` の出力の区切り
+	diffMarker = "__DISCLAUDE_DIFF__"
+
+	// tooLargeMarker はアーカイブが上限のサイズを超えている場合にコマンドが出力する目印
+	tooLargeMarker = "__DISCLAUDE_TOO_LARGE__"
+
+	// endMarker はコマンドが最後まで実行されたことを示す目印
+	endMarker = "__DISCLAUDE_END__"
+)
+
+// ArchiveWorkspace はサンドボックスの /workspace をtar.gzでアーカイブして返す
+// execの出力はテキストとして扱われるため、Base64で符号化して取得する
+// アーカイブが maxSize バイトを超える場合は転送せずに ErrWorkspaceTooLarge を返す
+func (cs *ClaudeService) ArchiveWorkspace(ctx context.Context, podName string, maxSize int) ([]byte, error) {
+	// pipefail に対応していないシェルもあるため、base64 の失敗は標準エラー出力でも通知する
+	command := fmt.Sprintf(`(set -o pipefail) 2>/dev/null && set -o pipefail
+archive=$(mktemp) || exit 1
+trap 'rm -f "$archive"' EXIT
+tar -czf "$archive" -C /workspace . || exit 1
+if [ "$(wc -c < "$archive")" -gt %d ]; then
+  echo %s
+else
+  { base64 "$archive" || echo "base64 failed" >&2; } | tr -d '\n' || exit 1
+  echo
+fi
+echo %s`, maxSize, tooLargeMarker, endMarker)
+
+	output, err := cs.sandboxManager.ExecuteCommand(ctx, podName, command)
+	if err != nil {
+		return nil, fmt.Errorf("failed to archive workspace: %w", err)
+	}
+
+	output, err = commandStdout(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to archive workspace: %w", err)
+	}
+
+	output = strings.TrimSpace(output)
+	if output == tooLargeMarker {
+		return nil, ErrWorkspaceTooLarge
+	}
+
+	archive, err := base64.StdEncoding.DecodeString(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode workspace archive: %w", err)
+	}
+
+	return archive, nil
+}
+
+// WorkspaceDiff はワークスペースのコミットされていない変更を `git status --short` と `git diff` の出力で返す
+// ワークスペースがGitリポジトリではない場合は ErrNotGitRepository を返す
+func (cs *ClaudeService) WorkspaceDiff(ctx context.Context, podName string) (string, string, error) {
+	command := fmt.Sprintf(`cd /workspace || exit 1
+git rev-parse --is-inside-work-tree >/dev/null 2>&1 || { echo %s; echo %s; exit 0; }
+git status --short || exit 1
+echo %s
+if git rev-parse --verify --quiet HEAD >/dev/null; then git diff HEAD; else git diff; fi || exit 1
+echo %s`, notGitRepositoryMarker, endMarker, diffMarker, endMarker)
+
+	output, err := cs.sandboxManager.ExecuteCommand(ctx, podName, command)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get workspace diff: %w", err)
+	}
+
+	output, err = commandStdout(output)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get workspace diff: %w", err)
+	}
+
+	if strings.TrimSpace(output) == notGitRepositoryMarker {
+		return "", "", ErrNotGitRepository
+	}
+
+	status, diff, found := strings.Cut(output, diffMarker+"\n")
+	if !found {
+		return "", "", fmt.Errorf("unexpected git output: %q", output)
+	}
+
+	return strings.TrimRight(status, "\n"), strings.TrimRight(diff, "\n"), nil
+}
+
+// commandStdout は endMarker で終わるコマンドの ExecuteCommand の出力から標準出力を取り出す
+// 標準エラー出力がある場合や、コマンドが最後まで実行されなかった場合はエラーを返す
+func commandStdout(output string) (string, error) {
+	index := strings.LastIndex(output, endMarker+"\n")
+	if index < 0 {
+		return "", fmt.Errorf("command did not complete: %q", output)
+	}
+
+	stderr := strings.TrimPrefix(output[index+len(endMarker)+1:], k8s.StderrSeparator)
+	if stderr = strings.TrimSpace(stderr); stderr != "" {
+		return "", fmt.Errorf("command wrote to stderr: %s", stderr)
+	}
+
+	return output[:index], nil
+}
+
 // GetSandboxInfo はサンドボックスの情報を取得する
 func (cs *ClaudeService) GetSandboxInfo(ctx context.Context, podName string) (*SandboxInfo, error) {
 	// システム情報の取得
@@ -0,0 +1,114 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+// TestClaudeServiceParseResult はClaude Codeの結果JSONの解析のテスト
+func TestClaudeServiceParseResult(t *testing.T) {
+	cs := &ClaudeService{}
+
+	output := `{"type":"result","subtype":"success","is_error":false,"duration_ms":1500,"result":"Hello!","total_cost_usd":0.0123,"usage":{"input_tokens":10,"cache_creation_input_tokens":20,"cache_read_input_tokens":30,"output_tokens":40}}
+STDERR:
+warning: something`
+
+	response, err := cs.parseResult(output)
+	if err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+	if response.Text != "Hello!" {
+		t.Errorf("Expected text 'Hello!', got '%s'", response.Text)
+	}
+
+	if response.InputTokens != 60 {
+		t.Errorf("Expected 60 input tokens, got %d", response.InputTokens)
+	}
+
+	if response.OutputTokens != 40 {
+		t.Errorf("Expected 40 output tokens, got %d", response.OutputTokens)
+	}
+
+	if response.CostUSD != 0.0123 {
+		t.Errorf("Expected cost 0.0123, got %f", response.CostUSD)
+	}
+
+	if response.Duration != 1500*time.Millisecond {
+		t.Errorf("Expected duration 1.5s, got %s", response.Duration)
+	}
+
+	if response.ExitStatus != "success" {
+		t.Errorf("Expected exit status 'success', got '%s'", response.ExitStatus)
+	}
+
+	// エラー終了の場合
+	response, err = cs.parseResult(`{"type":"result","subtype":"success","is_error":true,"result":"API error"}`)
+	if err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+	if response.ExitStatus != "error" {
+		t.Errorf("Expected exit status 'error', got '%s'", response.ExitStatus)
+	}
+
+	// 結果JSONがない場合はアシスタントのテキストのみを応答として扱い、JSONストリームや標準エラー出力は含めない
+	response, err = cs.parseResult(`{"type":"system","subtype":"init"}
+{"type":"assistant","message":{"content":[{"type":"text","text":"First."},{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"ls"}}]}}
+{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"t1","content":"main.go\n"}]}}
+{"type":"assistant","message":{"content":[{"type":"text","text":"Second."}]}}
+STDERR:
+killed`)
+	if err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+	if response.Text != "First.\n\nSecond." {
+		t.Errorf("Expected assistant text as response, got '%s'", response.Text)
+	}
+
+	if response.ExitStatus != "unknown" {
+		t.Errorf("Expected exit status 'unknown', got '%s'", response.ExitStatus)
+	}
+
+	if len(response.ToolEvents) != 2 {
+		t.Errorf("Expected 2 tool events, got %d", len(response.ToolEvents))
+	}
+
+	// 応答として扱えるテキストがない場合はエラー
+	if _, err := cs.parseResult("plain text output\nSTDERR:\nerror"); err == nil {
+		t.Error("Expected error for output without result or assistant text")
+	}
+}
+
+// TestClaudeServiceParseResultToolEvents はstream-json出力からのツールイベント解析のテスト
+func TestClaudeServiceParseResultToolEvents(t *testing.T) {
+	cs := &ClaudeService{}
+
+	output := `{"type":"system","subtype":"init"}
+{"type":"assistant","message":{"content":[{"type":"text","text":"Let me check."},{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"ls"}}]}}
+{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"t1","content":"main.go\n"}]}}
+{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"t2","content":[{"type":"text","text":"denied"}],"is_error":true}]}}
+{"type":"result","subtype":"success","is_error":false,"result":"Done.","total_cost_usd":0.01,"usage":{"input_tokens":1,"output_tokens":2}}`
+
+	response, err := cs.parseResult(output)
+	if err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+	if response.Text != "Done." {
+		t.Errorf("Expected text 'Done.', got '%s'", response.Text)
+	}
+
+	if len(response.ToolEvents) != 3 {
+		t.Fatalf("Expected 3 tool events, got %d", len(response.ToolEvents))
+	}
+
+	if response.ToolEvents[0].Type != "tool_use" || response.ToolEvents[0].Name != "Bash" || response.ToolEvents[0].Content != `{"command":"ls"}` {
+		t.Errorf("Unexpected tool_use event: %+v", response.ToolEvents[0])
+	}
+
+	if response.ToolEvents[1].Type != "tool_result" || response.ToolEvents[1].Content != "main.go\n" {
+		t.Errorf("Unexpected tool_result event: %+v", response.ToolEvents[1])
+	}
+
+	if !response.ToolEvents[2].IsError || response.ToolEvents[2].Content != "denied" {
+		t.Errorf("Unexpected error tool_result event: %+v", response.ToolEvents[2])
+	}
+}
@@ -1,25 +1,40 @@
 package bot
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/hirano00o/disclaude/internal/auth"
 	"github.com/hirano00o/disclaude/internal/db"
+	"github.com/hirano00o/disclaude/internal/k8s"
+	"github.com/hirano00o/disclaude/internal/metrics"
+	"github.com/hirano00o/disclaude/internal/render"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/sirupsen/logrus"
 )
 
 // handleStartCommand は `/claude start` コマンドを処理する
-func (b *Bot) handleStartCommand(s *discordgo.Session, m *discordgo.MessageCreate, user *db.User) {
+func (b *Bot) handleStartCommand(s DiscordSession, m *discordgo.MessageCreate, user *db.User) {
 	// 権限チェック
-	if err := b.permService.ValidateUserAction(user.DiscordID, "create_sandbox"); err != nil {
+	if err := b.permService.Authorize(user, auth.CapabilityCreateSandbox, nil); err != nil {
 		b.sendErrorMessage(s, m.ChannelID, err.Error())
 		return
 	}
 
+	// 同時セッション数と予算のチェック（セッションを記録するまで枠を確保する）
+	releaseQuota, err := b.permService.ReserveSession(user.ID)
+	if err != nil {
+		b.sendErrorMessage(s, m.ChannelID, err.Error())
+		return
+	}
+	defer releaseQuota()
+
 	// 既存のアクティブセッションチェック
 	existingSession, err := b.db.GetSessionByThreadID(m.ChannelID)
 	if err != nil {
@@ -33,23 +48,33 @@ func (b *Bot) handleStartCommand(s *discordgo.Session, m *discordgo.MessageCreat
 		return
 	}
 
-	// スレッドの作成
-	thread, err := s.MessageThreadStartComplex(m.ChannelID, m.ID, &discordgo.ThreadStart{
-		Name: fmt.Sprintf("Claude Code - %s", user.Username),
-		Type: discordgo.ChannelTypeGuildPublicThread,
-	})
-	if err != nil {
-		logrus.WithError(err).Error("Failed to create thread")
-		b.sendErrorMessage(s, m.ChannelID, "スレッドの作成に失敗しました")
-		return
+	// DMではスレッドを作成せず、DMチャンネルをそのままセッションの会話に使う
+	// DMチャンネルでは終了後に新しいセッションを開始できるよう、サンドボックス名に作成時刻を含める
+	channelID := m.ChannelID
+	sandboxKey := fmt.Sprintf("dm-%s-%d", m.ChannelID, time.Now().UnixNano())
+	channelLabel := "このDM"
+	if m.GuildID != "" {
+		thread, err := s.MessageThreadStartComplex(m.ChannelID, m.ID, &discordgo.ThreadStart{
+			Name: fmt.Sprintf("Claude Code - %s", user.Username),
+			Type: discordgo.ChannelTypeGuildPublicThread,
+		})
+		if err != nil {
+			logrus.WithError(err).Error("Failed to create thread")
+			b.sendErrorMessage(s, m.ChannelID, "スレッドの作成に失敗しました")
+			return
+		}
+		channelID = thread.ID
+		sandboxKey = thread.ID
+		channelLabel = "このスレッド"
 	}
 
 	// セッションの作成
-	sandboxName := fmt.Sprintf("claude-sandbox-%s", strings.ReplaceAll(thread.ID, "_", "-"))
-	session, err := b.db.CreateSession(user.ID, thread.ID, sandboxName)
+	sandboxName := fmt.Sprintf("claude-sandbox-%s", strings.ReplaceAll(sandboxKey, "_", "-"))
+	session, err := b.db.CreateSession(user.ID, channelID, sandboxName)
+	releaseQuota()
 	if err != nil {
 		logrus.WithError(err).Error("Failed to create session")
-		b.sendErrorMessage(s, thread.ID, "セッションの作成に失敗しました")
+		b.sendErrorMessage(s, channelID, "セッションの作成に失敗しました")
 		return
 	}
 
@@ -57,71 +82,99 @@ func (b *Bot) handleStartCommand(s *discordgo.Session, m *discordgo.MessageCreat
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
-	b.sendMessage(s, thread.ID, "🚀 **Claude Codeサンドボックスを作成中...**\n少々お待ちください。")
+	b.sendMessage(s, channelID, "🚀 **Claude Codeサンドボックスを作成中...**\n少々お待ちください。")
 
-	sandbox, err := b.sandboxManager.CreateSandbox(ctx, session.ID, thread.ID)
+	sandbox, err := b.sandboxManager.CreateSandbox(ctx, session.ID, sandboxKey)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to create sandbox")
-		b.sendErrorMessage(s, thread.ID, fmt.Sprintf("サンドボックスの作成に失敗しました: %v", err))
+		b.sendErrorMessage(s, channelID, fmt.Sprintf("サンドボックスの作成に失敗しました: %v", err))
 		// セッションステータスを失敗に更新
 		b.db.UpdateSessionStatus(session.ID, "failed")
 		return
 	}
 
-	// サンドボックスの準備完了まで待機
-	b.sendMessage(s, thread.ID, "⏳ **サンドボックスの準備中...**")
+	// 待機サンドボックスが割り当てられた場合はセッションのサンドボックス名を更新
+	if sandbox.PodName != session.SandboxName {
+		if err := b.db.UpdateSessionSandboxName(session.ID, sandbox.PodName); err != nil {
+			logrus.WithError(err).Error("Failed to update session sandbox name")
+			b.sendErrorMessage(s, channelID, "セッションの作成に失敗しました")
+			if err := b.sandboxManager.DeleteSandbox(ctx, sandbox.PodName); err != nil {
+				logrus.WithError(err).Error("Failed to delete sandbox")
+			}
+			b.db.UpdateSessionStatus(session.ID, "failed")
+			return
+		}
+		session.SandboxName = sandbox.PodName
+	}
 
-	err = b.sandboxManager.WaitForSandboxReady(ctx, sandbox.PodName, 3*time.Minute)
-	if err != nil {
-		logrus.WithError(err).Error("Failed to wait for sandbox ready")
-		b.sendErrorMessage(s, thread.ID, "サンドボックスの準備に失敗しました")
+	// サンドボックスの準備完了まで待機
+	if !b.waitForSandbox(ctx, s, channelID, session, sandbox) {
 		return
 	}
 
 	// 成功メッセージの送信
-	successMessage := fmt.Sprintf(`✅ **Claude Codeサンドボックスが準備完了しました！**
-
-🏷️ **セッション情報:**
-• セッションID: %d
-• サンドボックス名: %s
-• 作成者: %s
-• CPU: 1GB, メモリ: 2GB
-
-💬 **使用方法:**
-このスレッド内でClaude Codeと自由に会話できます。
-セッション終了時は `+"`/claude close`"+` を実行してください。
+	b.sendRendered(s, channelID, render.SessionStarted(render.SessionView{
+		ID:          session.ID,
+		SandboxName: sandbox.PodName,
+		Owner:       user.Username,
+		Location:    channelLabel,
+		Extend:      b.config.Dashboard.ExtendDuration,
+	}))
 
-🔧 **利用可能な機能:**
-• ファイル作成・編集
-• コード実行とテスト
-• プロジェクト管理
-• Git操作
-
-⚠️ **注意事項:**
-• ファイルは一時的なものです
-• セッション終了時にすべてのデータが削除されます`, 
-		session.ID, 
-		sandbox.PodName, 
-		user.Username)
-
-	b.sendMessage(s, thread.ID, successMessage)
+	b.audit.RecordSession(auth.AuditSessionStart, user, user, session, "")
 
 	logrus.WithFields(logrus.Fields{
 		"user_id":      user.ID,
 		"session_id":   session.ID,
-		"thread_id":    thread.ID,
+		"thread_id":    channelID,
 		"sandbox_name": sandbox.PodName,
 	}).Info("Claude Code session started successfully")
 }
 
-// handleCloseCommand は `/claude close` コマンドを処理する
-func (b *Bot) handleCloseCommand(s *discordgo.Session, m *discordgo.MessageCreate, user *db.User) {
-	// 権限チェック
-	if err := b.permService.ValidateUserAction(user.DiscordID, "close_sandbox"); err != nil {
-		b.sendErrorMessage(s, m.ChannelID, err.Error())
-		return
+// waitForSandbox はサンドボックスの準備完了まで待機し、準備状況をスレッドに表示する
+// 準備状況が変化するたびに準備中メッセージを編集し、失敗した場合はサンドボックスを削除してセッションを失敗にする
+func (b *Bot) waitForSandbox(ctx context.Context, s DiscordSession, threadID string, session *db.Session, sandbox *db.Sandbox) bool {
+	progressMessage, err := s.ChannelMessageSend(threadID, sandboxPreparingMessage)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to send progress message")
+	}
+	updateProgress := func(content string) {
+		if progressMessage == nil {
+			return
+		}
+		if _, err := s.ChannelMessageEdit(threadID, progressMessage.ID, content); err != nil {
+			logrus.WithError(err).Warn("Failed to update progress message")
+		}
+	}
+
+	var lastProgress k8s.PodProgress
+	err = b.sandboxManager.WaitForSandboxReady(ctx, sandbox.PodName, 3*time.Minute, func(progress k8s.PodProgress) {
+		lastProgress = progress
+		updateProgress(formatSandboxProgress(progress))
+	})
+	if err == nil {
+		return true
+	}
+
+	logrus.WithError(err).WithField("pod_name", sandbox.PodName).Error("Failed to wait for sandbox ready")
+	updateProgress(formatSandboxWaitError(err, lastProgress))
+
+	// 準備できなかったサンドボックスは削除して枠を解放する
+	cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cleanupCancel()
+	if err := b.sandboxManager.DeleteSandbox(cleanupCtx, sandbox.PodName); err != nil {
+		logrus.WithError(err).Error("Failed to delete sandbox after readiness failure")
+	}
+	if err := b.db.UpdateSessionStatus(session.ID, "failed"); err != nil {
+		logrus.WithError(err).Error("Failed to update session status")
 	}
 
+	b.sendErrorMessage(s, threadID, "サンドボックスの準備に失敗したため、セッションを終了しました。`/claude start` で再度お試しください。")
+	return false
+}
+
+// handleCloseCommand は `/claude close` コマンドを処理する
+func (b *Bot) handleCloseCommand(s DiscordSession, m *discordgo.MessageCreate, user *db.User) {
 	// セッションの取得
 	session, err := b.db.GetSessionByThreadID(m.ChannelID)
 	if err != nil {
@@ -140,29 +193,33 @@ func (b *Bot) handleCloseCommand(s *discordgo.Session, m *discordgo.MessageCreat
 		return
 	}
 
-	// セッション所有者またはオーナーのみ終了可能
-	canClose, err := b.permService.CanDeleteSandbox(user.DiscordID, session.UserID)
-	if err != nil {
-		logrus.WithError(err).Error("Failed to check permission")
-		b.sendErrorMessage(s, m.ChannelID, "権限確認中にエラーが発生しました")
-		return
-	}
-
-	if !canClose {
+	// セッション所有者または manage_sessions 権限を持つユーザーのみ終了可能（招待されたユーザーは終了できない）
+	if err := b.permService.AuthorizeSession(user, session, ""); err != nil {
+		if !auth.IsPermissionDenied(err) {
+			logrus.WithError(err).Error("Failed to check permission")
+			b.sendErrorMessage(s, m.ChannelID, "権限確認中にエラーが発生しました")
+			return
+		}
 		b.sendErrorMessage(s, m.ChannelID, "このセッションを終了する権限がありません")
 		return
 	}
 
+	b.closeSession(s, user, session)
+}
+
+// closeSession はセッションのサンドボックスを削除して終了し、スレッドをアーカイブする
+// `/claude close` と終了ボタンから呼び出し、権限の確認は呼び出し元で行う
+func (b *Bot) closeSession(s DiscordSession, user *db.User, session *db.Session) {
 	// サンドボックスの削除
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
-	b.sendMessage(s, m.ChannelID, "🛑 **セッションを終了中...**")
+	b.sendMessage(s, session.ThreadID, "🛑 **セッションを終了中...**")
 
-	err = b.sandboxManager.DeleteSandbox(ctx, session.SandboxName)
+	err := b.sandboxManager.DeleteSandbox(ctx, session.SandboxName)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to delete sandbox")
-		b.sendErrorMessage(s, m.ChannelID, "サンドボックスの削除に失敗しました")
+		b.sendErrorMessage(s, session.ThreadID, "サンドボックスの削除に失敗しました")
 		return
 	}
 
@@ -172,38 +229,36 @@ func (b *Bot) handleCloseCommand(s *discordgo.Session, m *discordgo.MessageCreat
 		logrus.WithError(err).Error("Failed to update session status")
 	}
 
-	// 終了メッセージの送信
-	endMessage := fmt.Sprintf(`✅ **セッションが正常に終了しました**
-
-🏷️ **終了したセッション:**
-• セッションID: %d
-• サンドボックス名: %s
-• 実行時間: %s
-
-💾 **データについて:**
-このセッションで作成されたファイルやデータはすべて削除されました。
+	owner, err := b.db.GetUserByID(session.OwnerUserID())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get session owner")
+	}
+	b.audit.RecordSession(auth.AuditSessionClose, user, owner, session, "")
 
-🆕 **新しいセッション:**
-新しいセッションを開始するには `+"`/claude start`"+` を実行してください。`,
-		session.ID,
-		session.SandboxName,
-		time.Since(session.CreatedAt).Round(time.Second).String())
+	// 終了メッセージの送信
+	b.sendRendered(s, session.ThreadID, render.SessionClosed(render.ClosedSessionView{
+		ID:          session.ID,
+		SandboxName: session.SandboxName,
+		Elapsed:     time.Since(session.CreatedAt),
+	}))
 
-	b.sendMessage(s, m.ChannelID, endMessage)
+	// 終了したセッションのスレッドに投稿されないよう、アーカイブしてロックする
+	b.archiveThread(s, session.ThreadID)
 
 	logrus.WithFields(logrus.Fields{
 		"user_id":      user.ID,
 		"session_id":   session.ID,
-		"thread_id":    m.ChannelID,
+		"thread_id":    session.ThreadID,
 		"sandbox_name": session.SandboxName,
 		"duration":     time.Since(session.CreatedAt),
 	}).Info("Claude Code session terminated successfully")
 }
 
 // handleAddCommand は `/claude add` コマンドを処理する
-func (b *Bot) handleAddCommand(s *discordgo.Session, m *discordgo.MessageCreate, user *db.User, target, userID string) {
+// optionsには `/claude add user` のアクセスの有効期間を指定できる
+func (b *Bot) handleAddCommand(s DiscordSession, m *discordgo.MessageCreate, user *db.User, target, userID string, options []string) {
 	// 権限チェック
-	if err := b.permService.ValidateUserAction(user.DiscordID, "add_user"); err != nil {
+	if err := b.permService.Authorize(user, auth.CapabilityManageUsers, nil); err != nil {
 		b.sendErrorMessage(s, m.ChannelID, err.Error())
 		return
 	}
@@ -214,6 +269,22 @@ func (b *Bot) handleAddCommand(s *discordgo.Session, m *discordgo.MessageCreate,
 		return
 	}
 
+	// アクセスの有効期間の解析（省略時は無期限）
+	expiresAt := sql.NullTime{}
+	if len(options) > 0 {
+		if target != "user" || len(options) > 1 {
+			b.sendErrorMessage(s, m.ChannelID, "使用方法: `/claude add user <ユーザーID> [期間]`（期間は `/claude add user` でのみ指定できます）")
+			return
+		}
+
+		validFor, err := parseAccessDuration(options[0])
+		if err != nil {
+			b.sendErrorMessage(s, m.ChannelID, err.Error())
+			return
+		}
+		expiresAt = sql.NullTime{Time: time.Now().Add(validFor), Valid: true}
+	}
+
 	// 対象ユーザーの情報取得
 	targetUser, err := s.User(userID)
 	if err != nil {
@@ -225,29 +296,19 @@ func (b *Bot) handleAddCommand(s *discordgo.Session, m *discordgo.MessageCreate,
 	switch target {
 	case "user":
 		// 一般ユーザーとして追加
-		createdUser, err := b.userService.AddUser(user.DiscordID, targetUser.ID, targetUser.Username)
+		createdUser, err := b.userService.AddUser(user.GuildID.String, user.DiscordID, targetUser.ID, targetUser.Username, expiresAt)
 		if err != nil {
 			logrus.WithError(err).Error("Failed to add user")
 			b.sendErrorMessage(s, m.ChannelID, fmt.Sprintf("ユーザー追加に失敗しました: %v", err))
 			return
 		}
 
-		successMessage := fmt.Sprintf(`✅ **ユーザーを追加しました**
-
-👤 **追加されたユーザー:**
-• 名前: %s
-• ID: %s
-• 権限: 一般ユーザー
-• 追加者: %s
-
-🎯 **権限:**
-• Claude Codeサンドボックスの作成・使用
-• 自分のセッションの管理`,
-			createdUser.Username,
-			createdUser.DiscordID,
-			user.Username)
-
-		b.sendMessage(s, m.ChannelID, successMessage)
+		b.sendRendered(s, m.ChannelID, render.UserAdded(render.UserView{
+			Name:   createdUser.Username,
+			ID:     createdUser.DiscordID,
+			Expiry: formatAccessExpiry(createdUser),
+			Actor:  user.Username,
+		}))
 
 		logrus.WithFields(logrus.Fields{
 			"requester_id": user.ID,
@@ -257,30 +318,18 @@ func (b *Bot) handleAddCommand(s *discordgo.Session, m *discordgo.MessageCreate,
 
 	case "owner":
 		// オーナーに昇格
-		err := b.userService.PromoteToOwner(user.DiscordID, targetUser.ID)
+		err := b.userService.PromoteToOwner(user.GuildID.String, user.DiscordID, targetUser.ID)
 		if err != nil {
 			logrus.WithError(err).Error("Failed to promote to owner")
 			b.sendErrorMessage(s, m.ChannelID, fmt.Sprintf("オーナー昇格に失敗しました: %v", err))
 			return
 		}
 
-		successMessage := fmt.Sprintf(`✅ **ユーザーをオーナーに昇格しました**
-
-👑 **昇格されたオーナー:**
-• 名前: %s
-• ID: %s
-• 権限: オーナー
-• 昇格者: %s
-
-🎯 **オーナー権限:**
-• Claude Codeサンドボックスの作成・使用
-• 全セッションの管理
-• ユーザー管理（追加・削除・権限変更）`,
-			targetUser.Username,
-			targetUser.ID,
-			user.Username)
-
-		b.sendMessage(s, m.ChannelID, successMessage)
+		b.sendRendered(s, m.ChannelID, render.OwnerPromoted(render.UserView{
+			Name:  targetUser.Username,
+			ID:    targetUser.ID,
+			Actor: user.Username,
+		}))
 
 		logrus.WithFields(logrus.Fields{
 			"requester_id": user.ID,
@@ -294,9 +343,9 @@ func (b *Bot) handleAddCommand(s *discordgo.Session, m *discordgo.MessageCreate,
 }
 
 // handleDeleteCommand は `/claude delete` コマンドを処理する
-func (b *Bot) handleDeleteCommand(s *discordgo.Session, m *discordgo.MessageCreate, user *db.User, target, userID string) {
+func (b *Bot) handleDeleteCommand(s DiscordSession, m *discordgo.MessageCreate, user *db.User, target, userID string) {
 	// 権限チェック
-	if err := b.permService.ValidateUserAction(user.DiscordID, "delete_user"); err != nil {
+	if err := b.permService.Authorize(user, auth.CapabilityManageUsers, nil); err != nil {
 		b.sendErrorMessage(s, m.ChannelID, err.Error())
 		return
 	}
@@ -308,7 +357,7 @@ func (b *Bot) handleDeleteCommand(s *discordgo.Session, m *discordgo.MessageCrea
 	}
 
 	// 対象ユーザーの情報取得
-	targetUser, err := b.userService.GetUser(userID)
+	targetUser, err := b.userService.GetUser(user.GuildID.String, userID)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to get target user")
 		b.sendErrorMessage(s, m.ChannelID, "ユーザー情報の取得に失敗しました")
@@ -316,34 +365,28 @@ func (b *Bot) handleDeleteCommand(s *discordgo.Session, m *discordgo.MessageCrea
 	}
 
 	if targetUser == nil {
-		b.sendErrorMessage(s, m.ChannelID, "指定されたユーザーは登録されていません")
+		b.sendErrorMessage(s, m.ChannelID, "指定されたユーザーはこのサーバーに登録されていません")
 		return
 	}
 
 	switch target {
 	case "user":
-		// ユーザーを削除
-		err := b.userService.RemoveUser(user.DiscordID, userID)
+		// セッションとサンドボックスを終了してからユーザーを削除
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		terminated, err := b.userService.RemoveUser(ctx, user.GuildID.String, user.DiscordID, userID)
 		if err != nil {
 			logrus.WithError(err).Error("Failed to remove user")
-			b.sendErrorMessage(s, m.ChannelID, fmt.Sprintf("ユーザー削除に失敗しました: %v", err))
+			b.sendErrorMessage(s, m.ChannelID, fmt.Sprintf("ユーザー削除に失敗しました: %v\n終了済みのセッション: %d 件（もう一度実行すると残りの処理を再試行します）", err, terminated))
 			return
 		}
 
-		successMessage := fmt.Sprintf(`✅ **ユーザーを削除しました**
-
-👤 **削除されたユーザー:**
-• 名前: %s
-• ID: %s
-• 削除者: %s
-
-⚠️ **注意:**
-このユーザーのアクティブなセッションも終了されます。`,
-			targetUser.Username,
-			targetUser.DiscordID,
-			user.Username)
-
-		b.sendMessage(s, m.ChannelID, successMessage)
+		b.sendRendered(s, m.ChannelID, render.UserRemoved(render.UserView{
+			Name:  targetUser.Username,
+			ID:    targetUser.DiscordID,
+			Actor: user.Username,
+		}, terminated))
 
 		logrus.WithFields(logrus.Fields{
 			"requester_id": user.ID,
@@ -353,29 +396,18 @@ func (b *Bot) handleDeleteCommand(s *discordgo.Session, m *discordgo.MessageCrea
 
 	case "owner":
 		// オーナーを一般ユーザーに降格
-		err := b.userService.DemoteFromOwner(user.DiscordID, userID)
+		err := b.userService.DemoteFromOwner(user.GuildID.String, user.DiscordID, userID)
 		if err != nil {
 			logrus.WithError(err).Error("Failed to demote from owner")
 			b.sendErrorMessage(s, m.ChannelID, fmt.Sprintf("オーナー降格に失敗しました: %v", err))
 			return
 		}
 
-		successMessage := fmt.Sprintf(`✅ **オーナーを一般ユーザーに降格しました**
-
-👤 **降格されたユーザー:**
-• 名前: %s
-• ID: %s
-• 新しい権限: 一般ユーザー
-• 実行者: %s
-
-🎯 **現在の権限:**
-• Claude Codeサンドボックスの作成・使用
-• 自分のセッションの管理`,
-			targetUser.Username,
-			targetUser.DiscordID,
-			user.Username)
-
-		b.sendMessage(s, m.ChannelID, successMessage)
+		b.sendRendered(s, m.ChannelID, render.OwnerDemoted(render.UserView{
+			Name:  targetUser.Username,
+			ID:    targetUser.DiscordID,
+			Actor: user.Username,
+		}))
 
 		logrus.WithFields(logrus.Fields{
 			"requester_id": user.ID,
@@ -388,8 +420,27 @@ func (b *Bot) handleDeleteCommand(s *discordgo.Session, m *discordgo.MessageCrea
 	}
 }
 
+// adminCommands は `/claude status` に表示する管理コマンドと、その実行に必要な権限
+var adminCommands = []struct {
+	capability auth.Capability
+	usage      string
+}{
+	{auth.CapabilityManageUsers, "`/claude add user <ID>` - ユーザー追加"},
+	{auth.CapabilityManageUsers, "`/claude add owner <ID>` - オーナー昇格"},
+	{auth.CapabilityManageUsers, "`/claude delete user <ID>` - ユーザー削除"},
+	{auth.CapabilityManageUsers, "`/claude delete owner <ID>` - オーナー降格"},
+	{auth.CapabilityManageUsers, "`/claude role assign <ID> <ロール>` - ロールの割り当て"},
+	{auth.CapabilityViewUsage, "`/claude usage [ユーザーID] [期間]` - 使用量の確認"},
+	{auth.CapabilityManageConfig, "`/claude limit <ID> [項目 値]` - 利用上限の確認・設定"},
+	{auth.CapabilityManageConfig, "`/claude role <list|create|set|delete|bind|unbind>` - ロールとDiscordロール連携の管理"},
+	{auth.CapabilityViewAllSessions, "`/claude sessions` - セッション一覧"},
+	{auth.CapabilityManageSessions, "`/claude kill <セッションID> [理由]` - セッションの強制終了"},
+	{auth.CapabilityViewAudit, "`/claude audit [ID] [件数]` - 監査ログの確認"},
+	{auth.CapabilityManageConfig, "`/claude guild [set 項目 値]` - サーバーの設定の確認・変更"},
+}
+
 // handleStatusCommand は `/claude status` コマンドを処理する
-func (b *Bot) handleStatusCommand(s *discordgo.Session, m *discordgo.MessageCreate, user *db.User) {
+func (b *Bot) handleStatusCommand(s DiscordSession, m *discordgo.MessageCreate, user *db.User) {
 	// サンドボックス使用状況の取得
 	usage, err := b.db.GetSandboxUsage()
 	if err != nil {
@@ -414,53 +465,596 @@ func (b *Bot) handleStatusCommand(s *discordgo.Session, m *discordgo.MessageCrea
 	}
 
 	// ステータスメッセージの作成
-	statusMessage := fmt.Sprintf(`📊 **Discord Claude システム ステータス**
+	view := render.StatusView{
+		Username:          user.Username,
+		Role:              user.Role,
+		Expiry:            formatAccessExpiry(user),
+		SandboxesInUse:    usage.CurrentCount,
+		MaxSandboxes:      usage.MaxCount,
+		RemainingCapacity: usage.RemainingCapacity(),
+		GuildUsage:        b.guildSandboxUsage(user),
+		Extend:            b.config.Dashboard.ExtendDuration,
+	}
 
-👤 **ユーザー情報:**
-• 名前: %s
-• 権限: %s
+	if currentSession != nil && currentSession.IsActive() {
+		view.Session = &render.SessionStatus{
+			ID:          currentSession.ID,
+			SandboxName: currentSession.SandboxName,
+			Elapsed:     time.Since(currentSession.CreatedAt),
+		}
 
-🏗️ **サンドボックス使用状況:**
-• 使用中: %d/%d
-• 利用可能: %d
+		sessionUsage, err := b.db.GetSessionUsage(currentSession.ID)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to get session usage")
+		} else {
+			view.Session.Usage = &render.SessionUsage{
+				Turns:        sessionUsage.Turns,
+				InputTokens:  sessionUsage.InputTokens,
+				OutputTokens: sessionUsage.OutputTokens,
+				CostUSD:      sessionUsage.CostUSD,
+			}
+		}
+	}
 
-📍 **現在のチャンネル:**`,
-		user.Username,
-		user.Role,
-		usage.CurrentCount,
-		usage.MaxCount,
-		usage.RemainingCapacity())
+	// アクティブなサンドボックス一覧
+	for _, sandbox := range sandboxes {
+		view.Sandboxes = append(view.Sandboxes, fmt.Sprintf("%s (%s)", sandbox.Name, sandbox.Status.Phase))
+	}
 
-	if currentSession != nil && currentSession.IsActive() {
-		sessionDuration := time.Since(currentSession.CreatedAt).Round(time.Second)
-		statusMessage += fmt.Sprintf(`
-• セッション: アクティブ ✅
-• セッションID: %d
-• 実行時間: %s
-• サンドボックス: %s`,
-			currentSession.ID,
-			sessionDuration.String(),
-			currentSession.SandboxName)
-	} else {
-		statusMessage += "\n• セッション: なし ⭕"
+	// 権限情報
+	role, err := b.permService.UserRole(user)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get user role")
+	} else if role != nil {
+		view.RoleName = role.Name
+		view.Capabilities = role.Capabilities
+
+		for _, command := range adminCommands {
+			if role.HasCapability(string(command.capability)) {
+				view.AdminCommands = append(view.AdminCommands, command.usage)
+			}
+		}
 	}
 
-	// アクティブなサンドボックス一覧
-	if len(sandboxes) > 0 {
-		statusMessage += "\n\n🔧 **アクティブなサンドボックス一覧:**"
-		for i, sandbox := range sandboxes {
-			if i >= 10 { // 最大10個まで表示
-				statusMessage += fmt.Sprintf("\n• ... 他 %d 個", len(sandboxes)-10)
-				break
+	b.sendRendered(s, m.ChannelID, render.Status(view))
+}
+
+// handleUsageCommand は `/claude usage [user] [period]` コマンドを処理する
+func (b *Bot) handleUsageCommand(s DiscordSession, m *discordgo.MessageCreate, user *db.User, args []string) {
+	// 権限チェック
+	if err := b.permService.Authorize(user, auth.CapabilityViewUsage, nil); err != nil {
+		b.sendErrorMessage(s, m.ChannelID, err.Error())
+		return
+	}
+
+	// 引数の解析（ユーザーIDと期間はどちらも省略可能、順不同）
+	targetID := ""
+	period := "month"
+	for _, arg := range args {
+		if _, ok := usagePeriods[arg]; ok {
+			period = arg
+			continue
+		}
+		targetID = parseUserMention(arg)
+	}
+
+	if targetID != "" && (len(targetID) < 15 || len(targetID) > 20) {
+		b.sendErrorMessage(s, m.ChannelID, "無効なユーザーIDです")
+		return
+	}
+
+	since := usagePeriodStart(period, time.Now())
+	// 実行したユーザーと同じギルドのユーザーの使用量のみ表示する
+	usages, err := b.db.GetUserUsage(since, user.GuildID.String, targetID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get user usage")
+		b.sendErrorMessage(s, m.ChannelID, "使用量の取得に失敗しました")
+		return
+	}
+
+	usageMessage := fmt.Sprintf("💰 **Claude Code 使用量（%s）**\n", usagePeriods[period])
+	if len(usages) == 0 {
+		usageMessage += "\n記録された使用量はありません"
+		b.sendMessage(s, m.ChannelID, usageMessage)
+		return
+	}
+
+	total := &db.UsageSummary{}
+	for _, usage := range usages {
+		usageMessage += fmt.Sprintf("\n• **%s** (%s): $%.4f / %d ターン / 入力 %d・出力 %d トークン",
+			usage.Username,
+			usage.DiscordID,
+			usage.CostUSD,
+			usage.Turns,
+			usage.InputTokens,
+			usage.OutputTokens)
+
+		total.Turns += usage.Turns
+		total.InputTokens += usage.InputTokens
+		total.OutputTokens += usage.OutputTokens
+		total.CostUSD += usage.CostUSD
+	}
+
+	if len(usages) > 1 {
+		usageMessage += fmt.Sprintf("\n\n**合計:** $%.4f / %d ターン / %d トークン",
+			total.CostUSD,
+			total.Turns,
+			total.TotalTokens())
+	}
+
+	b.sendMessage(s, m.ChannelID, usageMessage)
+}
+
+// usagePeriods は `/claude usage` で指定できる期間と表示名
+var usagePeriods = map[string]string{
+	"day":   "今日",
+	"week":  "過去7日間",
+	"month": "今月",
+	"all":   "全期間",
+}
+
+// usagePeriodStart は期間の開始日時を返す
+func usagePeriodStart(period string, now time.Time) time.Time {
+	switch period {
+	case "day":
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	case "week":
+		return now.AddDate(0, 0, -7)
+	case "month":
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	default:
+		return time.Time{}
+	}
+}
+
+// guildSandboxUsage はユーザーが属するギルドのサンドボックスの使用状況を表示用に返す（上限がない場合は空文字列）
+func (b *Bot) guildSandboxUsage(user *db.User) string {
+	if !user.GuildID.Valid {
+		return ""
+	}
+
+	guild, err := b.db.GetGuild(user.GuildID.String)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get guild")
+		return ""
+	}
+	if guild == nil || !guild.MaxSandboxes.Valid || guild.MaxSandboxes.Int64 <= 0 {
+		return ""
+	}
+
+	count, err := b.db.CountActiveSessionsByGuild(guild.GuildID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to count active sessions in guild")
+		return ""
+	}
+
+	return fmt.Sprintf("このサーバー: %d/%d", count, guild.MaxSandboxes.Int64)
+}
+
+// parseUserMention は `<@123>` / `<@!123>` 形式のメンションからユーザーIDを取り出す
+func parseUserMention(arg string) string {
+	arg = strings.TrimPrefix(arg, "<@")
+	arg = strings.TrimPrefix(arg, "!")
+	return strings.TrimSuffix(arg, ">")
+}
+
+// limitItems は `/claude limit` で設定できる項目と表示名
+var limitItems = map[string]string{
+	"daily_cost":     "1日の利用額（USD）",
+	"monthly_cost":   "1ヶ月の利用額（USD）",
+	"daily_tokens":   "1日のトークン数",
+	"monthly_tokens": "1ヶ月のトークン数",
+	"sessions":       "同時セッション数",
+	"duration":       "最大セッション時間",
+}
+
+// handleLimitCommand は `/claude limit <user> [item value]` コマンドを処理する
+func (b *Bot) handleLimitCommand(s DiscordSession, m *discordgo.MessageCreate, user *db.User, args []string) {
+	// 権限チェック
+	if err := b.permService.Authorize(user, auth.CapabilityManageConfig, nil); err != nil {
+		b.sendErrorMessage(s, m.ChannelID, err.Error())
+		return
+	}
+
+	if len(args) != 1 && len(args) != 3 {
+		b.sendErrorMessage(s, m.ChannelID, "使用方法: `/claude limit <ユーザーID>` または `/claude limit <ユーザーID> <daily_cost|monthly_cost|daily_tokens|monthly_tokens|sessions|duration> <値|unlimited|default>`")
+		return
+	}
+
+	targetUser, err := b.userService.GetUser(user.GuildID.String, parseUserMention(args[0]))
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get target user")
+		b.sendErrorMessage(s, m.ChannelID, "ユーザー情報の取得に失敗しました")
+		return
+	}
+
+	if targetUser == nil {
+		b.sendErrorMessage(s, m.ChannelID, "指定されたユーザーはこのサーバーに登録されていません")
+		return
+	}
+
+	if len(args) == 3 {
+		if err := b.setUserLimit(targetUser, args[1], args[2]); err != nil {
+			b.sendErrorMessage(s, m.ChannelID, err.Error())
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"requester_id": user.ID,
+			"target_id":    targetUser.ID,
+			"item":         args[1],
+			"value":        args[2],
+		}).Info("User limit updated")
+	}
+
+	limits, err := b.permService.GetEffectiveLimits(targetUser.ID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get effective limits")
+		b.sendErrorMessage(s, m.ChannelID, "利用上限の取得に失敗しました")
+		return
+	}
+
+	limitMessage := fmt.Sprintf(`📏 **%s さんの利用上限**
+
+• %s: %s
+• %s: %s
+• %s: %s
+• %s: %s
+• %s: %s
+• %s: %s`,
+		targetUser.Username,
+		limitItems["daily_cost"], formatLimit(limits.DailyCostUSD > 0, fmt.Sprintf("$%.2f", limits.DailyCostUSD)),
+		limitItems["monthly_cost"], formatLimit(limits.MonthlyCostUSD > 0, fmt.Sprintf("$%.2f", limits.MonthlyCostUSD)),
+		limitItems["daily_tokens"], formatLimit(limits.DailyTokens > 0, fmt.Sprintf("%d", limits.DailyTokens)),
+		limitItems["monthly_tokens"], formatLimit(limits.MonthlyTokens > 0, fmt.Sprintf("%d", limits.MonthlyTokens)),
+		limitItems["sessions"], formatLimit(limits.MaxSessions > 0, fmt.Sprintf("%d", limits.MaxSessions)),
+		limitItems["duration"], formatLimit(limits.MaxSessionDuration > 0, limits.MaxSessionDuration.String()))
+
+	b.sendMessage(s, m.ChannelID, limitMessage)
+}
+
+// setUserLimit はユーザーの利用上限の1項目を上書きする
+// valueが "default" の場合はデフォルト値に戻し、"unlimited" の場合は無制限にする
+func (b *Bot) setUserLimit(targetUser *db.User, item, value string) error {
+	if _, ok := limitItems[item]; !ok {
+		return fmt.Errorf("無効な項目です: `%s`", item)
+	}
+
+	limits, err := b.db.GetUserLimits(targetUser.ID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get user limits")
+		return fmt.Errorf("利用上限の取得に失敗しました")
+	}
+
+	if limits == nil {
+		limits = &db.UserLimits{UserID: targetUser.ID}
+	}
+
+	if err := applyLimitValue(limits, item, value); err != nil {
+		return err
+	}
+
+	if err := b.db.UpsertUserLimits(limits); err != nil {
+		logrus.WithError(err).Error("Failed to update user limits")
+		return fmt.Errorf("利用上限の更新に失敗しました")
+	}
+
+	return nil
+}
+
+// applyLimitValue は利用上限の1項目にvalueを設定する（ユーザーとギルドの上書き設定で共通）
+// valueが "default" の場合は上書きを解除し、"unlimited" の場合は無制限にする
+func applyLimitValue(limits *db.UserLimits, item, value string) error {
+	reset := value == "default"
+	if value == "unlimited" {
+		value = "0"
+	}
+
+	switch item {
+	case "daily_cost", "monthly_cost":
+		var parsed sql.NullFloat64
+		if !reset {
+			amount, err := strconv.ParseFloat(value, 64)
+			if err != nil || amount < 0 {
+				return fmt.Errorf("無効な金額です: `%s`", value)
+			}
+			parsed = sql.NullFloat64{Float64: amount, Valid: true}
+		}
+		if item == "daily_cost" {
+			limits.DailyCostUSD = parsed
+		} else {
+			limits.MonthlyCostUSD = parsed
+		}
+	case "daily_tokens", "monthly_tokens", "sessions":
+		var parsed sql.NullInt64
+		if !reset {
+			count, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || count < 0 {
+				return fmt.Errorf("無効な数値です: `%s`", value)
+			}
+			parsed = sql.NullInt64{Int64: count, Valid: true}
+		}
+		switch item {
+		case "daily_tokens":
+			limits.DailyTokens = parsed
+		case "monthly_tokens":
+			limits.MonthlyTokens = parsed
+		default:
+			limits.MaxSessions = parsed
+		}
+	case "duration":
+		var parsed sql.NullInt64
+		if !reset {
+			duration, err := time.ParseDuration(value)
+			if err != nil || duration < 0 {
+				return fmt.Errorf("無効な時間です（例: `2h`, `90m`）: `%s`", value)
+			}
+			// 分単位で記録するため、1分未満は0分（無制限）にならないよう拒否する
+			if duration > 0 && duration < time.Minute {
+				return fmt.Errorf("時間は1分以上で指定してください（無制限にする場合は `unlimited`）: `%s`", value)
 			}
-			statusMessage += fmt.Sprintf("\n• %s (%s)", sandbox.Name, sandbox.Status.Phase)
+			parsed = sql.NullInt64{Int64: int64(duration / time.Minute), Valid: true}
 		}
+		limits.MaxSessionMinutes = parsed
 	}
 
-	// 権限情報
-	if user.IsOwner() {
-		statusMessage += "\n\n👑 **オーナー権限で利用可能なコマンド:**\n• `/claude add user <ID>` - ユーザー追加\n• `/claude add owner <ID>` - オーナー昇格\n• `/claude delete user <ID>` - ユーザー削除\n• `/claude delete owner <ID>` - オーナー降格"
+	return nil
+}
+
+// formatLimit は上限値を表示用に整形する
+func formatLimit(limited bool, value string) string {
+	if !limited {
+		return "無制限"
+	}
+	return value
+}
+
+// handleExportCommand は `/claude export [format:markdown|json]` コマンドを処理する
+func (b *Bot) handleExportCommand(s DiscordSession, m *discordgo.MessageCreate, user *db.User, args []string) {
+	// 出力形式の解析
+	format := "markdown"
+	if len(args) > 0 {
+		format = strings.ToLower(strings.TrimPrefix(args[0], "format:"))
+	}
+
+	if format == "md" {
+		format = "markdown"
+	}
+
+	if format != "markdown" && format != "json" {
+		b.sendErrorMessage(s, m.ChannelID, "使用方法: `/claude export [format:markdown|json]`")
+		return
+	}
+
+	// セッションの取得（終了済みのセッションもエクスポート可能）
+	session, err := b.db.GetSessionByThreadID(m.ChannelID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get session")
+		b.sendErrorMessage(s, m.ChannelID, "セッション情報の取得に失敗しました")
+		return
+	}
+
+	if session == nil {
+		b.sendErrorMessage(s, m.ChannelID, "このチャンネルにはセッションが存在しません")
+		return
+	}
+
+	// セッション所有者、manage_sessions 権限を持つユーザー、招待されたユーザーのみエクスポート可能
+	if err := b.permService.AuthorizeSession(user, session, db.SessionMemberViewer); err != nil {
+		if !auth.IsPermissionDenied(err) {
+			logrus.WithError(err).Error("Failed to check permission")
+			b.sendErrorMessage(s, m.ChannelID, "権限確認中にエラーが発生しました")
+			return
+		}
+		b.sendErrorMessage(s, m.ChannelID, "このセッションの会話履歴をエクスポートする権限がありません")
+		return
+	}
+
+	messages, err := b.db.GetMessagesBySessionID(session.ID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get messages")
+		b.sendErrorMessage(s, m.ChannelID, "会話履歴の取得に失敗しました")
+		return
+	}
+
+	// 発言者の名前解決
+	owner, err := b.db.GetUserByID(session.OwnerUserID())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get session owner")
+	}
+
+	authors := make(map[int64]string)
+	for _, message := range messages {
+		if !message.UserID.Valid {
+			continue
+		}
+		if _, ok := authors[message.UserID.Int64]; ok {
+			continue
+		}
+		author, err := b.db.GetUserByID(int(message.UserID.Int64))
+		if err != nil || author == nil {
+			authors[message.UserID.Int64] = ""
+			continue
+		}
+		authors[message.UserID.Int64] = author.Username
+	}
+
+	// ファイルの作成
+	var file *discordgo.File
+	switch format {
+	case "json":
+		data, err := renderTranscriptJSON(session, owner, messages, authors)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to render transcript")
+			b.sendErrorMessage(s, m.ChannelID, "会話履歴の変換に失敗しました")
+			return
+		}
+		file = &discordgo.File{
+			Name:        fmt.Sprintf("session-%d.json", session.ID),
+			ContentType: "application/json",
+			Reader:      bytes.NewReader(data),
+		}
+	default:
+		file = &discordgo.File{
+			Name:        fmt.Sprintf("session-%d.md", session.ID),
+			ContentType: "text/markdown",
+			Reader:      bytes.NewReader(renderTranscriptMarkdown(session, owner, messages, authors)),
+		}
+	}
+
+	_, err = s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("📄 **セッション #%d の会話履歴**（%d 件）", session.ID, len(messages)),
+		Files:   []*discordgo.File{file},
+	})
+	if err != nil {
+		metrics.DiscordSendFailures.Inc()
+		logrus.WithError(err).Error("Failed to send transcript")
+		b.sendErrorMessage(s, m.ChannelID, "会話履歴の送信に失敗しました")
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"user_id":    user.ID,
+		"session_id": session.ID,
+		"format":     format,
+		"messages":   len(messages),
+	}).Info("Session transcript exported")
+}
+
+// maxListedSessions は `/claude sessions` で表示するセッションの最大数
+const maxListedSessions = 20
+
+// handleSessionsCommand は `/claude sessions` コマンドを処理する
+func (b *Bot) handleSessionsCommand(s DiscordSession, m *discordgo.MessageCreate, user *db.User) {
+	// 権限チェック
+	if err := b.permService.Authorize(user, auth.CapabilityViewAllSessions, nil); err != nil {
+		b.sendErrorMessage(s, m.ChannelID, err.Error())
+		return
+	}
+
+	// 実行したユーザーと同じギルドのセッションのみ表示する
+	sessions, err := b.db.ListSessionsByGuild(user.GuildID.String, "active", 0)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list sessions")
+		b.sendErrorMessage(s, m.ChannelID, "セッション一覧の取得に失敗しました")
+		return
+	}
+
+	sessionsMessage := fmt.Sprintf("💬 **アクティブなセッション（%d件）**\n", len(sessions))
+	if len(sessions) == 0 {
+		sessionsMessage += "\nアクティブなセッションはありません"
+		b.sendMessage(s, m.ChannelID, sessionsMessage)
+		return
+	}
+
+	for i, session := range sessions {
+		if i >= maxListedSessions {
+			sessionsMessage += fmt.Sprintf("\n• ... 他 %d 件", len(sessions)-maxListedSessions)
+			break
+		}
+
+		// 所有者が削除されたセッションも、強制終了できるよう表示する
+		owner := auth.DeletedUserName
+		if sessionOwner, err := b.db.GetUserByID(session.OwnerUserID()); err != nil {
+			logrus.WithError(err).Error("Failed to get session owner")
+		} else if sessionOwner != nil {
+			owner = sessionOwner.Username
+		}
+
+		lastActivity := "なし"
+		if message, err := b.db.GetLastMessageBySessionID(session.ID); err != nil {
+			logrus.WithError(err).Error("Failed to get last message")
+		} else if message != nil {
+			lastActivity = time.Since(message.CreatedAt).Round(time.Second).String() + "前"
+		}
+
+		sessionsMessage += fmt.Sprintf("\n• `#%d` <#%s> - %s / 経過 %s / 最終操作 %s",
+			session.ID,
+			session.ThreadID,
+			owner,
+			time.Since(session.CreatedAt).Round(time.Second).String(),
+			lastActivity)
+	}
+
+	sessionsMessage += "\n\n`/claude kill <セッションID> [理由]` でセッションを強制終了できます"
+
+	b.sendMessage(s, m.ChannelID, sessionsMessage)
+}
+
+// handleKillCommand は `/claude kill <session-id> [reason]` コマンドを処理する
+func (b *Bot) handleKillCommand(s DiscordSession, m *discordgo.MessageCreate, user *db.User, args []string) {
+	// 権限チェック
+	if err := b.permService.Authorize(user, auth.CapabilityManageSessions, nil); err != nil {
+		b.sendErrorMessage(s, m.ChannelID, err.Error())
+		return
+	}
+
+	if len(args) < 1 {
+		b.sendErrorMessage(s, m.ChannelID, "使用方法: `/claude kill <セッションID> [理由]`")
+		return
+	}
+
+	sessionID, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+	if err != nil {
+		b.sendErrorMessage(s, m.ChannelID, "無効なセッションIDです")
+		return
+	}
+
+	reason := strings.Join(args[1:], " ")
+	if reason == "" {
+		reason = "オーナーによる強制終了"
+	}
+
+	session, err := b.db.GetSessionByID(sessionID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get session")
+		b.sendErrorMessage(s, m.ChannelID, "セッション情報の取得に失敗しました")
+		return
+	}
+
+	if session == nil || !session.IsActive() {
+		b.sendErrorMessage(s, m.ChannelID, fmt.Sprintf("セッション `#%d` はアクティブではありません", sessionID))
+		return
+	}
+
+	// 他のギルドのユーザーのセッションは強制終了できない
+	if err := b.permService.Authorize(user, auth.CapabilityManageSessions, session); err != nil {
+		b.sendErrorMessage(s, m.ChannelID, err.Error())
+		return
+	}
+
+	if err := b.sessionManager.ForceTerminateSession(context.Background(), session.ID, user, reason); err != nil {
+		logrus.WithError(err).Error("Failed to force terminate session")
+		b.sendErrorMessage(s, m.ChannelID, "セッションの強制終了に失敗しました")
+		return
+	}
+
+	b.sendMessage(s, m.ChannelID, fmt.Sprintf("🛑 セッション `#%d`（<#%s>）を強制終了しました\n理由: %s", session.ID, session.ThreadID, reason))
+}
+
+// notifySessionTerminated は強制終了されたセッションのスレッドに実行者と理由を通知する
+// Discordのコマンド・管理API・ダッシュボードのいずれから終了した場合も呼ばれる
+func (b *Bot) notifySessionTerminated(session *db.Session, actor *db.User, reason string) {
+	// アーカイブ・削除されたスレッドには通知しない
+	if _, ok := b.closedThreads.Load(session.ThreadID); ok {
+		return
+	}
+
+	mention := ""
+	if owner, err := b.db.GetUserByID(session.OwnerUserID()); err == nil && owner != nil {
+		mention = fmt.Sprintf("<@%s> ", owner.DiscordID)
+	}
+
+	content := fmt.Sprintf(`🛑 **このセッションは強制終了されました**
+%s実行者: %s
+理由: %s
+
+サンドボックスとデータは削除されました。
+新しいセッションを開始するには `+"`/claude start`"+` を使用してください。`, mention, actor.Username, reason)
+
+	if _, err := b.discord.ChannelMessageSend(session.ThreadID, content); err != nil {
+		logrus.WithError(err).WithField("session_id", session.ID).Error("Failed to send termination notice")
 	}
 
-	b.sendMessage(s, m.ChannelID, statusMessage)
+	b.archiveThread(b.discord, session.ThreadID)
 }
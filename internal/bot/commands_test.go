@@ -0,0 +1,44 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/hirano00o/disclaude/internal/db"
+)
+
+// TestApplyLimitValueDuration はセッションの最大利用時間の設定値の解釈のテスト
+func TestApplyLimitValueDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		minutes int64
+		valid   bool
+		wantErr bool
+	}{
+		{value: "2h", minutes: 120, valid: true},
+		{value: "90m", minutes: 90, valid: true},
+		{value: "unlimited", minutes: 0, valid: true},
+		{value: "default", valid: false},
+		{value: "30s", wantErr: true},
+		{value: "-1h", wantErr: true},
+		{value: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			limits := &db.UserLimits{}
+			err := applyLimitValue(limits, "duration", tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error for %q, got %+v", tt.value, limits.MaxSessionMinutes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if limits.MaxSessionMinutes.Valid != tt.valid || limits.MaxSessionMinutes.Int64 != tt.minutes {
+				t.Errorf("Expected %d minutes (valid=%v), got %+v", tt.minutes, tt.valid, limits.MaxSessionMinutes)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package bot
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// DiscordSession はBotが使用するDiscord REST APIのインターフェース
+// 本番では *discordgo.Session が実装し、テストではフェイクに差し替える
+type DiscordSession interface {
+	ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageEdit(channelID, messageID, content string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	MessageThreadStartComplex(channelID, messageID string, data *discordgo.ThreadStart, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	ThreadMemberAdd(threadID, memberID string, options ...discordgo.RequestOption) error
+	Channel(channelID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	ChannelEdit(channelID string, data *discordgo.ChannelEdit, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	User(userID string, options ...discordgo.RequestOption) (*discordgo.User, error)
+	GuildMember(guildID, userID string, options ...discordgo.RequestOption) (*discordgo.Member, error)
+	GuildRoles(guildID string, options ...discordgo.RequestOption) ([]*discordgo.Role, error)
+	InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error
+}
+
+var _ DiscordSession = (*discordgo.Session)(nil)
+
+// ChannelState はゲートウェイのイベントから構築されたチャンネルのキャッシュ
+// 本番では *discordgo.State が実装し、REST APIを呼び出さずにスレッドの親チャンネルを確認するために使用する
+type ChannelState interface {
+	Channel(channelID string) (*discordgo.Channel, error)
+}
+
+var _ ChannelState = (*discordgo.State)(nil)
@@ -0,0 +1,1161 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/config"
+	"github.com/hirano00o/disclaude/internal/k8s"
+
+	"github.com/bwmarrin/discordgo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const (
+	ownerID = "300000000000000001"
+	aliceID = "300000000000000002"
+	bobID   = "300000000000000003"
+)
+
+// claudeOutput はClaude Codeのstream-json出力を模したテストデータ
+var claudeOutput = strings.Join([]string{
+	`{"type":"system","subtype":"init","session_id":"abc"}`,
+	`{"type":"assistant","message":{"content":[{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"ls"}}]}}`,
+	`{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"t1","content":"main.go"}]}}`,
+	`{"type":"result","subtype":"success","result":"Hello from Claude","total_cost_usd":0.02,"usage":{"input_tokens":120,"output_tokens":30}}`,
+}, "\n")
+
+// startSession は `/claude start` を実行し、作成されたスレッドIDを返す
+func startSession(t *testing.T, h *harness, authorID string) string {
+	t.Helper()
+
+	messages := h.send(authorID, testChannelID, "/claude start")
+	if len(messages) == 0 {
+		t.Fatal("Expected messages for /claude start")
+	}
+	threadID := messages[0].ChannelID
+	expectMessage(t, messages, threadID, "準備完了しました")
+
+	return threadID
+}
+
+// TestE2EOwnerRegistration は初回ユーザーのオーナー登録フローのテスト
+func TestE2EOwnerRegistration(t *testing.T) {
+	h := newHarness(t)
+	h.discord.addUser(ownerID, "owner")
+
+	messages := h.sendDM(ownerID, "/claude")
+	expectMessage(t, messages, "dm-"+ownerID, "あなたが私のオーナーですか？")
+
+	messages = h.sendDM(ownerID, "yes")
+	expectMessage(t, messages, "dm-"+ownerID, "オーナーとして登録されました")
+
+	user, err := h.store.GetUserByDiscordID("", ownerID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if user == nil || !user.IsOwner() {
+		t.Fatalf("Expected owner to be registered, got %+v", user)
+	}
+
+	messages = h.sendDM(ownerID, "/claude help")
+	expectMessage(t, messages, "dm-"+ownerID, "コマンド一覧")
+}
+
+// TestE2ESessionLifecycle はセッションの開始・会話・ステータス確認・終了のテスト
+func TestE2ESessionLifecycle(t *testing.T) {
+	h := newHarness(t)
+	h.addUser(ownerID, "owner", "owner")
+	ctx := context.Background()
+
+	// セッション開始
+	messages := h.send(ownerID, testChannelID, "/claude start")
+	if len(messages) == 0 {
+		t.Fatal("Expected messages for /claude start")
+	}
+	threadID := messages[0].ChannelID
+	if threadID == testChannelID {
+		t.Fatalf("Expected messages to be posted in a new thread, got channel %s", threadID)
+	}
+	expectMessage(t, messages, threadID, "サンドボックスを作成中")
+	expectMessage(t, messages, threadID, "準備完了しました")
+
+	session := h.session(threadID)
+	if session == nil || !session.IsActive() {
+		t.Fatalf("Expected active session for thread %s, got %+v", threadID, session)
+	}
+	if _, err := h.clientset.CoreV1().Pods(testNamespace).Get(ctx, session.SandboxName, metav1.GetOptions{}); err != nil {
+		t.Fatalf("Expected sandbox pod to exist: %v", err)
+	}
+
+	// 同じスレッドで再度開始はできない
+	messages = h.send(ownerID, threadID, "/claude start")
+	expectMessage(t, messages, threadID, "既にアクティブなセッションが存在します")
+
+	// スレッド内の会話
+	h.executor.Push(k8s.FakeExecResult{Stdout: claudeOutput})
+	messages = h.send(ownerID, threadID, "hello")
+	expectMessage(t, messages, threadID, "Hello from Claude")
+
+	calls := h.executor.Calls()
+	if len(calls) != 1 || !strings.Contains(calls[0].Stdin, "hello") || calls[0].PodName != session.SandboxName {
+		t.Fatalf("Expected prompt to be executed in the sandbox, got %+v", calls)
+	}
+
+	transcript, err := h.store.GetMessagesBySessionID(session.ID)
+	if err != nil {
+		t.Fatalf("Failed to get messages: %v", err)
+	}
+	roles := make([]string, 0, len(transcript))
+	for _, message := range transcript {
+		roles = append(roles, message.Role)
+	}
+	if strings.Join(roles, ",") != "user,tool_use,tool_result,assistant" {
+		t.Errorf("Unexpected transcript roles: %v", roles)
+	}
+
+	// ステータス確認
+	messages = h.send(ownerID, threadID, "/claude status")
+	status := expectMessage(t, messages, threadID, "セッション: アクティブ")
+	for _, expected := range []string{"使用中: 1/3", "ターン数: 1", "入力 120 / 出力 30", session.SandboxName} {
+		if !strings.Contains(status.text(), expected) {
+			t.Errorf("Expected status to contain %q, got:\n%s", expected, status.text())
+		}
+	}
+
+	// セッション終了
+	messages = h.send(ownerID, threadID, "/claude close")
+	expectMessage(t, messages, threadID, "セッションを終了中")
+	expectMessage(t, messages, threadID, "セッションが正常に終了しました")
+
+	if session := h.session(threadID); !session.IsTerminated() {
+		t.Errorf("Expected session to be terminated, got '%s'", session.Status)
+	}
+	if _, err := h.clientset.CoreV1().Pods(testNamespace).Get(ctx, session.SandboxName, metav1.GetOptions{}); err == nil {
+		t.Error("Expected sandbox pod to be deleted")
+	}
+	expectArchived(t, h, threadID)
+
+	messages = h.send(ownerID, threadID, "/claude status")
+	expectMessage(t, messages, threadID, "使用中: 0/3")
+	expectMessage(t, messages, threadID, "セッション: なし")
+
+	// 終了後のスレッドでは応答しない
+	if messages := h.send(ownerID, threadID, "hello again"); len(messages) != 0 {
+		t.Errorf("Expected no reply in a closed session, got %d messages", len(messages))
+	}
+
+	messages = h.send(ownerID, threadID, "/claude close")
+	expectMessage(t, messages, threadID, "既に終了しています")
+}
+
+// TestE2EWarmPoolSession は待機サンドボックスが割り当てられたセッションのテスト
+func TestE2EWarmPoolSession(t *testing.T) {
+	h := newHarnessWith(t, func(cfg *config.Config) {
+		cfg.Kubernetes.WarmPoolSize = 1
+	})
+	h.addUser(ownerID, "owner", "owner")
+	ctx := context.Background()
+
+	// 待機Podが作成され、インフォーマーのキャッシュに反映されるまで待機する
+	warmPods := func() []corev1.Pod {
+		pods, err := h.clientset.CoreV1().Pods(testNamespace).List(ctx, metav1.ListOptions{LabelSelector: "disclaude/pool=warm"})
+		if err != nil {
+			t.Fatalf("Failed to list pods: %v", err)
+		}
+		return pods.Items
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(warmPods()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for a warm pool pod")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	warmPod := warmPods()[0].Name
+	time.Sleep(100 * time.Millisecond)
+
+	threadID := startSession(t, h, ownerID)
+
+	session := h.session(threadID)
+	if session.SandboxName != warmPod {
+		t.Fatalf("Expected session to use warm pod %s, got %s", warmPod, session.SandboxName)
+	}
+
+	h.executor.Push(k8s.FakeExecResult{Stdout: claudeOutput})
+	messages := h.send(ownerID, threadID, "hello")
+	expectMessage(t, messages, threadID, "Hello from Claude")
+	if calls := h.executor.Calls(); len(calls) != 1 || calls[0].PodName != warmPod {
+		t.Fatalf("Expected prompt to be executed in the warm pod, got %+v", calls)
+	}
+
+	messages = h.send(ownerID, threadID, "/claude close")
+	expectMessage(t, messages, threadID, "セッションが正常に終了しました")
+	if _, err := h.clientset.CoreV1().Pods(testNamespace).Get(ctx, warmPod, metav1.GetOptions{}); err == nil {
+		t.Error("Expected claimed pod to be deleted")
+	}
+}
+
+// TestE2ESandboxImagePullFailure はサンドボックスのイメージ取得失敗時のテスト
+func TestE2ESandboxImagePullFailure(t *testing.T) {
+	h := newHarness(t)
+	h.addUser(ownerID, "owner", "owner")
+	h.podStatus = corev1.PodStatus{
+		Phase: corev1.PodPending,
+		ContainerStatuses: []corev1.ContainerStatus{{
+			Name: "claude-code",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+				Reason:  "ImagePullBackOff",
+				Message: `Back-off pulling image "anthropic/claude-code:latest"`,
+			}},
+		}},
+	}
+
+	messages := h.send(ownerID, testChannelID, "/claude start")
+	if len(messages) == 0 {
+		t.Fatal("Expected messages for /claude start")
+	}
+	threadID := messages[0].ChannelID
+
+	// 準備中メッセージが失敗理由に書き換えられる
+	progress := expectMessage(t, messages, threadID, "サンドボックスの準備に失敗しました")
+	for _, expected := range []string{"ImagePullBackOff", "コンテナイメージを取得できません", "Back-off pulling image"} {
+		if !strings.Contains(progress.Content, expected) {
+			t.Errorf("Expected progress message to contain %q, got:\n%s", expected, progress.Content)
+		}
+	}
+	for _, message := range messages {
+		if strings.Contains(message.Content, "準備中") {
+			t.Errorf("Expected preparing message to be edited in place, got %q", message.Content)
+		}
+	}
+	expectMessage(t, messages, threadID, "セッションを終了しました")
+
+	if session := h.session(threadID); session.Status != "failed" {
+		t.Errorf("Expected session to be failed, got '%s'", session.Status)
+	}
+	usage, err := h.store.GetSandboxUsage()
+	if err != nil {
+		t.Fatalf("Failed to get sandbox usage: %v", err)
+	}
+	if usage.CurrentCount != 0 {
+		t.Errorf("Expected sandbox capacity to be released, got %d", usage.CurrentCount)
+	}
+	pods, err := h.clientset.CoreV1().Pods(testNamespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Failed to list pods: %v", err)
+	}
+	if len(pods.Items) != 0 {
+		t.Errorf("Expected failed sandbox pod to be deleted, got %d pods", len(pods.Items))
+	}
+}
+
+// TestE2ESandboxFailureAndRecreate はセッション中のサンドボックス停止と再作成のテスト
+func TestE2ESandboxFailureAndRecreate(t *testing.T) {
+	h := newHarness(t)
+	h.addUser(ownerID, "owner", "owner")
+	h.addUser(aliceID, "alice", "user")
+	h.addUser(bobID, "bob", "user")
+	ctx := context.Background()
+
+	threadID := startSession(t, h, aliceID)
+	session := h.session(threadID)
+
+	// セッション中にPodがOOMKilledで停止する
+	pods := h.clientset.CoreV1().Pods(testNamespace)
+	pod, err := pods.Get(ctx, session.SandboxName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get pod: %v", err)
+	}
+	pod.Status = corev1.PodStatus{
+		Phase: corev1.PodFailed,
+		ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "claude-code",
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}},
+		}},
+	}
+	if _, err := pods.UpdateStatus(ctx, pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Failed to update pod status: %v", err)
+	}
+
+	notice := h.waitForMessage(threadID, "サンドボックスが予期せず停止しました")
+	for _, expected := range []string{"<@" + aliceID + ">", "OOMKilled", "メモリ不足"} {
+		if !strings.Contains(notice.Content, expected) {
+			t.Errorf("Expected failure notice to contain %q, got:\n%s", expected, notice.Content)
+		}
+	}
+	customID := fmt.Sprintf("recreate_sandbox:%d", session.ID)
+	if len(notice.Components) != 1 || notice.Components[0].(discordgo.ActionsRow).Components[0].(discordgo.Button).CustomID != customID {
+		t.Fatalf("Expected recreate button %q, got %+v", customID, notice.Components)
+	}
+
+	if session := h.session(threadID); session.Status != "failed" {
+		t.Errorf("Expected session to be failed, got '%s'", session.Status)
+	}
+	if usage, _ := h.store.GetSandboxUsage(); usage.CurrentCount != 0 {
+		t.Errorf("Expected sandbox capacity to be released, got %d", usage.CurrentCount)
+	}
+
+	// 停止中のセッションへのメッセージには理由を返す
+	messages := h.send(aliceID, threadID, "hello")
+	expectMessage(t, messages, threadID, "サンドボックスは停止しています")
+	if calls := h.executor.Calls(); len(calls) != 0 {
+		t.Errorf("Expected no command execution in a stopped session, got %d", len(calls))
+	}
+
+	// 他のユーザーは再作成できない
+	messages = h.click(bobID, notice, customID)
+	if denied := expectMessage(t, messages, threadID, "このセッションを操作する権限がありません"); !denied.Ephemeral {
+		t.Error("Expected permission error to be ephemeral")
+	}
+
+	// セッション所有者がボタンから再作成する
+	messages = h.click(aliceID, notice, customID)
+	updated := expectMessage(t, h.discord.since(0), threadID, "再作成を開始しました")
+	if updated.ID != notice.ID || len(updated.Components) != 0 {
+		t.Errorf("Expected notice to be updated without buttons, got %+v", updated)
+	}
+	expectMessage(t, messages, threadID, "サンドボックスの準備完了")
+	expectMessage(t, messages, threadID, "サンドボックスを再作成しました")
+
+	if session := h.session(threadID); !session.IsActive() {
+		t.Errorf("Expected session to be active again, got '%s'", session.Status)
+	}
+	if usage, _ := h.store.GetSandboxUsage(); usage.CurrentCount != 1 {
+		t.Errorf("Expected sandbox usage 1 after recreation, got %d", usage.CurrentCount)
+	}
+
+	// 再作成後は会話を続けられる
+	h.executor.Push(k8s.FakeExecResult{Stdout: claudeOutput})
+	messages = h.send(aliceID, threadID, "hello again")
+	expectMessage(t, messages, threadID, "Hello from Claude")
+
+	// 古いボタンを再度押しても何も起きない
+	messages = h.click(aliceID, notice, customID)
+	expectMessage(t, messages, threadID, "再作成できる状態ではありません")
+}
+
+// TestE2EClaudeFailure はClaude Codeの実行失敗時のテスト
+func TestE2EClaudeFailure(t *testing.T) {
+	h := newHarness(t)
+	h.addUser(ownerID, "owner", "owner")
+
+	threadID := startSession(t, h, ownerID)
+
+	// 実行結果が登録されていないため、実行は失敗する
+	messages := h.send(ownerID, threadID, "hello")
+	expectMessage(t, messages, threadID, "Claude Codeとの通信に失敗しました")
+
+	usage, err := h.store.GetSessionUsage(h.session(threadID).ID)
+	if err != nil {
+		t.Fatalf("Failed to get session usage: %v", err)
+	}
+	if usage.Turns != 1 {
+		t.Errorf("Expected failed turn to be recorded, got %d turns", usage.Turns)
+	}
+}
+
+// TestE2EUserManagement はユーザーの追加・削除のテスト
+func TestE2EUserManagement(t *testing.T) {
+	h := newHarness(t)
+	h.addUser(ownerID, "owner", "owner")
+	h.discord.addUser(aliceID, "alice")
+	h.discord.addUser(bobID, "bob")
+
+	messages := h.send(ownerID, testChannelID, "/claude add user 123")
+	expectMessage(t, messages, testChannelID, "無効なユーザーIDです")
+
+	messages = h.send(ownerID, testChannelID, "/claude add user 300000000000000099")
+	expectMessage(t, messages, testChannelID, "指定されたユーザーが見つかりません")
+
+	messages = h.send(ownerID, testChannelID, "/claude add user "+aliceID)
+	expectMessage(t, messages, testChannelID, "ユーザーを追加しました")
+
+	alice, err := h.store.GetUserByDiscordID(testGuildID, aliceID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if alice == nil || alice.Role != "user" || alice.Username != "alice" {
+		t.Fatalf("Expected alice to be added as user, got %+v", alice)
+	}
+
+	// 一般ユーザーはユーザーを追加できない
+	messages = h.send(aliceID, testChannelID, "/claude add user "+bobID)
+	expectMessage(t, messages, testChannelID, "ユーザー管理操作には `manage_users` 権限が必要です")
+
+	// 未登録ユーザーには認証フローが始まる
+	messages = h.send(bobID, testChannelID, "/claude start")
+	expectMessage(t, messages, testChannelID, "あなたが私のオーナーですか？")
+
+	messages = h.send(ownerID, testChannelID, "/claude add owner "+aliceID)
+	expectMessage(t, messages, testChannelID, "オーナーに昇格しました")
+
+	messages = h.send(ownerID, testChannelID, "/claude delete owner "+aliceID)
+	expectMessage(t, messages, testChannelID, "一般ユーザーに降格しました")
+
+	messages = h.send(ownerID, testChannelID, "/claude delete user "+aliceID)
+	expectMessage(t, messages, testChannelID, "ユーザーを削除しました")
+
+	if alice, _ := h.store.GetUserByDiscordID(testGuildID, aliceID); alice != nil {
+		t.Errorf("Expected alice to be deleted, got %+v", alice)
+	}
+
+	messages = h.send(ownerID, testChannelID, "/claude delete user "+aliceID)
+	expectMessage(t, messages, testChannelID, "登録されていません")
+}
+
+// TestE2ERemoveUserTerminatesSessions はユーザーの削除時にセッションとサンドボックスを終了するテスト
+func TestE2ERemoveUserTerminatesSessions(t *testing.T) {
+	h := newHarness(t)
+	h.addUser(ownerID, "owner", "owner")
+	h.addUser(aliceID, "alice", "user")
+	ctx := context.Background()
+
+	threadID := startSession(t, h, aliceID)
+	session := h.session(threadID)
+
+	// サンドボックスの削除に失敗した場合はユーザーを削除せず、再実行できるようにする
+	failDeletion := true
+	h.clientset.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if failDeletion {
+			return true, nil, fmt.Errorf("api server unavailable")
+		}
+		return false, nil, nil
+	})
+
+	messages := h.send(ownerID, testChannelID, "/claude delete user "+aliceID)
+	expectMessage(t, messages, testChannelID, "再試行します")
+	if alice, _ := h.store.GetUserByDiscordID(testGuildID, aliceID); alice == nil {
+		t.Fatal("Expected alice to remain after failed removal")
+	}
+	if !h.session(threadID).IsActive() {
+		t.Fatal("Expected session to remain active after failed removal")
+	}
+
+	failDeletion = false
+	messages = h.send(ownerID, testChannelID, "/claude delete user "+aliceID)
+	expectMessage(t, messages, testChannelID, "終了したセッション\n1 件")
+	expectMessage(t, messages, threadID, "ユーザーの削除")
+
+	if alice, _ := h.store.GetUserByDiscordID(testGuildID, aliceID); alice != nil {
+		t.Errorf("Expected alice to be removed, got %+v", alice)
+	}
+	if _, err := h.clientset.CoreV1().Pods(testNamespace).Get(ctx, session.SandboxName, metav1.GetOptions{}); err == nil {
+		t.Error("Expected sandbox pod to be deleted")
+	}
+	if usage, _ := h.store.GetSandboxUsage(); usage.CurrentCount != 0 {
+		t.Errorf("Expected sandbox capacity to be released, got %d", usage.CurrentCount)
+	}
+}
+
+// TestE2ESessionPermissions は他人のセッションへのアクセス制御のテスト
+func TestE2ESessionPermissions(t *testing.T) {
+	h := newHarness(t)
+	h.addUser(ownerID, "owner", "owner")
+	h.addUser(aliceID, "alice", "user")
+	h.addUser(bobID, "bob", "user")
+
+	threadID := startSession(t, h, aliceID)
+
+	messages := h.send(bobID, threadID, "hello")
+	expectMessage(t, messages, threadID, "このセッションを使用する権限がありません")
+
+	messages = h.send(bobID, threadID, "/claude close")
+	expectMessage(t, messages, threadID, "このセッションを終了する権限がありません")
+
+	// Bot自身のメッセージは無視する
+	if messages := h.send(testBotUserID, threadID, "/claude close"); len(messages) != 0 {
+		t.Errorf("Expected bot's own message to be ignored, got %d messages", len(messages))
+	}
+
+	// オーナーは他人のセッションも終了できる
+	messages = h.send(ownerID, threadID, "/claude close")
+	expectMessage(t, messages, threadID, "セッションが正常に終了しました")
+}
+
+// TestE2ESharedSession はセッションへのユーザーの招待と招待ロールごとの権限のテスト
+func TestE2ESharedSession(t *testing.T) {
+	const carolID = "300000000000000004"
+
+	h := newHarness(t)
+	h.addUser(aliceID, "alice", "user")
+	h.addUser(bobID, "bob", "user")
+	h.addUser(carolID, "carol", "user")
+
+	threadID := startSession(t, h, aliceID)
+
+	messages := h.send(aliceID, threadID, "/claude invite <@"+bobID+"> role:viewer")
+	expectMessage(t, messages, threadID, "閲覧者（viewer）")
+	messages = h.send(aliceID, threadID, "/claude invite <@"+carolID+">")
+	expectMessage(t, messages, threadID, "共同作業者（collaborator）")
+
+	h.discord.mu.Lock()
+	members := h.discord.threadMembers[threadID]
+	h.discord.mu.Unlock()
+	if len(members) != 2 || members[0] != bobID || members[1] != carolID {
+		t.Errorf("Expected invited users to join the thread, got %v", members)
+	}
+
+	// 閲覧者は会話できないが、会話履歴を出力できる
+	messages = h.send(bobID, threadID, "hello")
+	expectMessage(t, messages, threadID, "閲覧者（viewer）として招待されているため")
+	messages = h.send(bobID, threadID, "/claude export")
+	if len(messages) != 1 || len(messages[0].Files) != 1 {
+		t.Errorf("Expected viewer to export the transcript, got %+v", messages)
+	}
+
+	// 招待されたユーザーは他のユーザーを招待できない
+	messages = h.send(bobID, threadID, "/claude invite <@"+carolID+"> role:viewer")
+	expectMessage(t, messages, threadID, "招待する権限がありません")
+
+	// 共同作業者は会話できるが、セッションは終了できない
+	h.executor.Push(k8s.FakeExecResult{Stdout: claudeOutput})
+	messages = h.send(carolID, threadID, "hello")
+	expectMessage(t, messages, threadID, "Hello from Claude")
+
+	messages = h.send(carolID, threadID, "/claude close")
+	expectMessage(t, messages, threadID, "このセッションを終了する権限がありません")
+
+	// ロールを変更して再招待できる
+	messages = h.send(aliceID, threadID, "/claude invite <@"+carolID+"> role:viewer")
+	expectMessage(t, messages, threadID, "閲覧者（viewer）")
+	messages = h.send(carolID, threadID, "hello")
+	expectMessage(t, messages, threadID, "閲覧者（viewer）として招待されているため")
+
+	messages = h.send(aliceID, threadID, "/claude invite <@"+aliceID+">")
+	expectMessage(t, messages, threadID, "セッションの所有者は招待できません")
+	messages = h.send(aliceID, threadID, "/claude invite <@"+bobID+"> role:admin")
+	expectMessage(t, messages, threadID, "使用方法")
+
+	messages = h.send(aliceID, threadID, "/claude close")
+	expectMessage(t, messages, threadID, "セッションが正常に終了しました")
+}
+
+// TestE2EAccessExpiry は期限付きで追加したユーザーの期限切れによる無効化のテスト
+func TestE2EAccessExpiry(t *testing.T) {
+	h := newHarness(t)
+	h.addUser(ownerID, "owner", "owner")
+	h.discord.addUser(aliceID, "alice")
+
+	messages := h.send(ownerID, testChannelID, "/claude add user "+aliceID+" 0d")
+	expectMessage(t, messages, testChannelID, "無効な期間です")
+	messages = h.send(ownerID, testChannelID, "/claude add owner "+aliceID+" 1d")
+	expectMessage(t, messages, testChannelID, "使用方法")
+
+	messages = h.send(ownerID, testChannelID, "/claude add user "+aliceID+" 1d")
+	expectMessage(t, messages, testChannelID, "ユーザーを追加しました")
+	if strings.Contains(messages[0].text(), "無期限") {
+		t.Errorf("Expected expiry to be shown, got %q", messages[0].text())
+	}
+
+	threadID := startSession(t, h, aliceID)
+
+	// 期限前は何もしない
+	index := h.discord.sent()
+	h.bot.expireUsers(context.Background(), time.Now())
+	if messages := h.discord.since(index); len(messages) != 0 {
+		t.Errorf("Expected no notifications before expiry, got %+v", messages)
+	}
+
+	// 期限を過ぎるとセッションを終了して無効化し、オーナーにDMで通知する
+	h.bot.expireUsers(context.Background(), time.Now().Add(25*time.Hour))
+	messages = h.discord.since(index)
+	expectMessage(t, messages, threadID, "アクセス期限切れ")
+	expectMessage(t, messages, "dm-"+ownerID, "アクセス期限が切れました")
+
+	if session := h.session(threadID); session.IsActive() {
+		t.Errorf("Expected session to be terminated, got %+v", session)
+	}
+	if alice, _ := h.store.GetUserByDiscordID(testGuildID, aliceID); alice == nil || !alice.Disabled {
+		t.Errorf("Expected alice to be disabled, got %+v", alice)
+	}
+
+	messages = h.send(aliceID, testChannelID, "/claude start")
+	expectMessage(t, messages, testChannelID, "無効化されています")
+
+	// 再度追加すると新しい期限で利用できる
+	messages = h.send(ownerID, testChannelID, "/claude add user "+aliceID+" 2w")
+	expectMessage(t, messages, testChannelID, "ユーザーを追加しました")
+	startSession(t, h, aliceID)
+}
+
+// TestE2EForceTerminateSession はオーナーによるセッション一覧と強制終了のテスト
+func TestE2EForceTerminateSession(t *testing.T) {
+	h := newHarness(t)
+	h.addUser(ownerID, "owner", "owner")
+	h.addUser(aliceID, "alice", "user")
+
+	threadID := startSession(t, h, aliceID)
+	session := h.session(threadID)
+
+	// オーナー以外は実行できない
+	messages := h.send(aliceID, testChannelID, "/claude sessions")
+	expectMessage(t, messages, testChannelID, "セッション一覧の確認には `view_all_sessions` 権限が必要です")
+	messages = h.send(aliceID, testChannelID, fmt.Sprintf("/claude kill %d", session.ID))
+	expectMessage(t, messages, testChannelID, "セッション管理には `manage_sessions` 権限が必要です")
+
+	messages = h.send(ownerID, testChannelID, "/claude sessions")
+	expectMessage(t, messages, testChannelID, fmt.Sprintf("`#%d` <#%s> - alice", session.ID, threadID))
+
+	messages = h.send(ownerID, testChannelID, fmt.Sprintf("/claude kill %d 予算超過のため", session.ID))
+	expectMessage(t, messages, testChannelID, "強制終了しました")
+	notice := expectMessage(t, messages, threadID, "このセッションは強制終了されました")
+	for _, want := range []string{"<@" + aliceID + ">", "実行者: owner", "理由: 予算超過のため"} {
+		if !strings.Contains(notice.Content, want) {
+			t.Errorf("Expected termination notice to contain %q, got %q", want, notice.Content)
+		}
+	}
+
+	if session := h.session(threadID); !session.IsTerminated() {
+		t.Errorf("Expected session to be terminated, got %s", session.Status)
+	}
+	expectArchived(t, h, threadID)
+
+	// 終了済みのセッションは対象外
+	messages = h.send(ownerID, testChannelID, fmt.Sprintf("/claude kill %d", session.ID))
+	expectMessage(t, messages, testChannelID, "アクティブではありません")
+	messages = h.send(ownerID, testChannelID, "/claude sessions")
+	expectMessage(t, messages, testChannelID, "アクティブなセッションはありません")
+}
+
+// TestE2ESessionActions はセッションの操作ボタン（終了・延長・ダウンロード・差分）のテスト
+func TestE2ESessionActions(t *testing.T) {
+	h := newHarnessWith(t, func(cfg *config.Config) {
+		cfg.Dashboard.ExtendDuration = 30 * time.Minute
+	})
+	h.addUser(ownerID, "owner", "owner")
+	h.addUser(aliceID, "alice", "user")
+	h.addUser(bobID, "bob", "user")
+
+	threadID := startSession(t, h, aliceID)
+	session := h.session(threadID)
+	ready := h.waitForMessage(threadID, "準備完了しました")
+
+	var customIDs []string
+	for _, row := range ready.Components {
+		for _, component := range row.(discordgo.ActionsRow).Components {
+			customIDs = append(customIDs, component.(discordgo.Button).CustomID)
+		}
+	}
+	expected := []string{"close_session:", "extend_session:", "download_workspace:", "view_diff:"}
+	if len(customIDs) != len(expected) {
+		t.Fatalf("Expected %d buttons, got %v", len(expected), customIDs)
+	}
+	for i, prefix := range expected {
+		if customIDs[i] != fmt.Sprintf("%s%d", prefix, session.ID) {
+			t.Errorf("Expected button %d to be %s%d, got %s", i, prefix, session.ID, customIDs[i])
+		}
+	}
+	button := func(prefix string) string {
+		return fmt.Sprintf("%s%d", prefix, session.ID)
+	}
+
+	// 延長には manage_sessions 権限が必要
+	messages := h.click(aliceID, ready, button("extend_session:"))
+	if denied := expectMessage(t, messages, threadID, "`manage_sessions` 権限が必要です"); !denied.Ephemeral {
+		t.Error("Expected denial to be ephemeral")
+	}
+	messages = h.click(ownerID, ready, button("extend_session:"))
+	expectMessage(t, messages, threadID, "最大利用時間を 30m 延長しました")
+	if extended := h.session(threadID); extended.ExtensionMinutes != 30 {
+		t.Errorf("Expected session to be extended by 30 minutes, got %d", extended.ExtensionMinutes)
+	}
+
+	// 差分
+	h.executor.Push(k8s.FakeExecResult{Stdout: " M main.go\n__DISCLAUDE_DIFF__\n-package foo\n+package main\n__DISCLAUDE_END__\n"})
+	messages = h.click(aliceID, ready, button("view_diff:"))
+	diff := expectMessage(t, messages, threadID, "+package main")
+	if !strings.Contains(diff.text(), " M main.go") {
+		t.Errorf("Expected changed files in diff, got %q", diff.text())
+	}
+	if strings.Contains(diff.text(), "__DISCLAUDE_END__") {
+		t.Errorf("Expected end marker to be removed from diff, got %q", diff.text())
+	}
+
+	h.executor.Push(k8s.FakeExecResult{Stdout: "__DISCLAUDE_NOT_GIT__\n__DISCLAUDE_END__\n"})
+	messages = h.click(aliceID, ready, button("view_diff:"))
+	expectMessage(t, messages, threadID, "Gitリポジトリではない")
+
+	// 標準エラー出力は差分に混ぜずに失敗として扱う
+	h.executor.Push(k8s.FakeExecResult{Stdout: " M main.go\n__DISCLAUDE_DIFF__\n__DISCLAUDE_END__\n", Stderr: "fatal: bad object HEAD\n"})
+	messages = h.click(aliceID, ready, button("view_diff:"))
+	expectMessage(t, messages, threadID, "差分の取得に失敗しました")
+
+	// ワークスペースのダウンロード（招待されていないユーザーは操作できない）
+	messages = h.click(bobID, ready, button("download_workspace:"))
+	if denied := expectMessage(t, messages, threadID, "このセッションを操作する権限がありません"); !denied.Ephemeral {
+		t.Error("Expected denial to be ephemeral")
+	}
+
+	h.executor.Push(k8s.FakeExecResult{Stdout: "__DISCLAUDE_TOO_LARGE__\n__DISCLAUDE_END__\n"})
+	messages = h.click(aliceID, ready, button("download_workspace:"))
+	expectMessage(t, messages, threadID, "添付できるサイズ（10 MB）を超えている")
+	calls := h.executor.Calls()
+	if command := calls[len(calls)-1].Stdin; !strings.Contains(command, fmt.Sprintf("-gt %d", maxWorkspaceArchiveSize)) {
+		t.Errorf("Expected size check in archive command, got %q", command)
+	}
+
+	h.executor.Push(k8s.FakeExecResult{Stdout: "YXJj\n__DISCLAUDE_END__\n", Stderr: "tar: ./main.go: file changed as we read it\n"})
+	messages = h.click(aliceID, ready, button("download_workspace:"))
+	if failed := expectMessage(t, messages, threadID, "アーカイブに失敗しました"); len(failed.Files) != 0 {
+		t.Errorf("Expected no attachment on failure, got %+v", failed.Files)
+	}
+
+	h.executor.Push(k8s.FakeExecResult{Stdout: "YXJjaGl2ZQ==\n__DISCLAUDE_END__\n"})
+	messages = h.click(aliceID, ready, button("download_workspace:"))
+	archive := expectMessage(t, messages, threadID, "をアーカイブしました")
+	if len(archive.Files) != 1 || archive.Files[0].Name != fmt.Sprintf("workspace-%d.tar.gz", session.ID) {
+		t.Fatalf("Expected workspace archive attachment, got %+v", archive.Files)
+	}
+	if content, _ := io.ReadAll(archive.Files[0].Reader); string(content) != "archive" {
+		t.Errorf("Expected decoded archive, got %q", content)
+	}
+	calls = h.executor.Calls()
+	if command := calls[len(calls)-1].Stdin; !strings.Contains(command, "tar -czf \"$archive\" -C /workspace .") {
+		t.Errorf("Expected tar command, got %q", command)
+	}
+
+	// 終了（ボタンを取り除き、スレッドをアーカイブする）
+	messages = h.click(bobID, ready, button("close_session:"))
+	expectMessage(t, messages, threadID, "このセッションを終了する権限がありません")
+
+	h.click(aliceID, ready, button("close_session:"))
+	if closed := h.session(threadID); !closed.IsTerminated() {
+		t.Fatalf("Expected session to be terminated, got %s", closed.Status)
+	}
+	expectMessage(t, h.discord.since(0), threadID, "セッションが正常に終了しました")
+	expectArchived(t, h, threadID)
+
+	updated := expectMessage(t, h.discord.since(0), threadID, "準備完了しました")
+	if len(updated.Components) != 0 {
+		t.Errorf("Expected buttons to be removed, got %d rows", len(updated.Components))
+	}
+
+	messages = h.click(aliceID, ready, button("close_session:"))
+	expectMessage(t, messages, threadID, "既に終了しています")
+	messages = h.click(aliceID, ready, button("view_diff:"))
+	expectMessage(t, messages, threadID, "サンドボックスは利用できません")
+}
+
+// TestE2EThreadLifecycle はスレッドのアーカイブ・削除によるセッション終了のテスト
+func TestE2EThreadLifecycle(t *testing.T) {
+	h := newHarness(t)
+	h.addUser(ownerID, "owner", "owner")
+	ctx := context.Background()
+
+	expectTerminated := func(threadID string, index int) {
+		t.Helper()
+
+		session := h.session(threadID)
+		if !session.IsTerminated() {
+			t.Fatalf("Expected session to be terminated, got %s", session.Status)
+		}
+		if _, err := h.clientset.CoreV1().Pods(testNamespace).Get(ctx, session.SandboxName, metav1.GetOptions{}); err == nil {
+			t.Error("Expected sandbox pod to be deleted")
+		}
+		// 閉じられたスレッドには投稿しない
+		for _, message := range h.discord.since(index) {
+			if message.ChannelID == threadID {
+				t.Errorf("Expected no message in closed thread, got %q", message.Content)
+			}
+		}
+	}
+
+	// アーカイブ以外の更新では終了しない
+	threadID := startSession(t, h, ownerID)
+	thread, err := h.discord.Channel(threadID)
+	if err != nil {
+		t.Fatalf("Failed to get thread: %v", err)
+	}
+	thread.Name = "renamed"
+	h.bot.handleThreadUpdate(&discordgo.ThreadUpdate{Channel: thread})
+	if session := h.session(threadID); !session.IsActive() {
+		t.Fatalf("Expected session to remain active, got %s", session.Status)
+	}
+
+	index := h.discord.sent()
+	thread.ThreadMetadata = &discordgo.ThreadMetadata{Archived: true}
+	h.bot.handleThreadUpdate(&discordgo.ThreadUpdate{Channel: thread})
+	expectTerminated(threadID, index)
+
+	// スレッドの削除
+	threadID = startSession(t, h, ownerID)
+	thread, err = h.discord.Channel(threadID)
+	if err != nil {
+		t.Fatalf("Failed to get thread: %v", err)
+	}
+	index = h.discord.sent()
+	h.discord.deleteChannel(threadID)
+	h.bot.handleThreadDelete(&discordgo.ThreadDelete{Channel: thread})
+	expectTerminated(threadID, index)
+
+	// 親チャンネルの削除（関係のないチャンネルの削除では終了しない）
+	threadID = startSession(t, h, ownerID)
+	h.bot.handleChannelDelete(nil, &discordgo.ChannelDelete{Channel: &discordgo.Channel{ID: "100000000000000099", GuildID: testGuildID}})
+	if session := h.session(threadID); !session.IsActive() {
+		t.Fatalf("Expected session to remain active, got %s", session.Status)
+	}
+
+	// 他のギルドのチャンネルの削除では、スレッドを確認できなくても終了しない
+	thread, err = h.discord.Channel(threadID)
+	if err != nil {
+		t.Fatalf("Failed to get thread: %v", err)
+	}
+	h.discord.deleteChannel(threadID)
+	h.bot.handleChannelDelete(nil, &discordgo.ChannelDelete{Channel: &discordgo.Channel{ID: "100000000000000098", GuildID: "partner"}})
+	if session := h.session(threadID); !session.IsActive() {
+		t.Fatalf("Expected session of another guild to remain active, got %s", session.Status)
+	}
+
+	// スレッドの親チャンネルはstateのキャッシュから確認し、REST APIを呼び出さない
+	state := discordgo.NewState()
+	if err := state.GuildAdd(&discordgo.Guild{ID: testGuildID}); err != nil {
+		t.Fatalf("Failed to add guild to state: %v", err)
+	}
+	if err := state.ChannelAdd(thread); err != nil {
+		t.Fatalf("Failed to add thread to state: %v", err)
+	}
+	index = h.discord.sent()
+	lookups := h.discord.channelLookups
+	h.discord.deleteChannel(testChannelID)
+	h.bot.handleChannelDelete(state, &discordgo.ChannelDelete{Channel: &discordgo.Channel{ID: testChannelID, GuildID: testGuildID}})
+	if h.discord.channelLookups != lookups {
+		t.Errorf("Expected no REST channel lookups, got %d", h.discord.channelLookups-lookups)
+	}
+	expectTerminated(threadID, index)
+}
+
+// expectArchived はスレッドがアーカイブ・ロックされていることを検証する
+func expectArchived(t *testing.T, h *harness, threadID string) {
+	t.Helper()
+
+	thread, err := h.discord.Channel(threadID)
+	if err != nil {
+		t.Fatalf("Failed to get thread: %v", err)
+	}
+	if thread.ThreadMetadata == nil || !thread.ThreadMetadata.Archived || !thread.ThreadMetadata.Locked {
+		t.Errorf("Expected thread %s to be archived and locked, got %+v", threadID, thread.ThreadMetadata)
+	}
+}
+
+// TestE2EAuditLog は特権操作・セッション操作の監査ログのテスト
+func TestE2EAuditLog(t *testing.T) {
+	const auditChannelID = "audit-channel"
+	h := newHarnessWith(t, func(cfg *config.Config) {
+		cfg.Discord.GuildID = testGuildID
+		cfg.Discord.AuditChannelID = auditChannelID
+	})
+	h.addUser(ownerID, "owner", "owner")
+	h.discord.addUser(aliceID, "alice")
+
+	messages := h.send(ownerID, testChannelID, "/claude add user "+aliceID)
+	expectMessage(t, messages, testChannelID, "ユーザーを追加しました")
+	expectMessage(t, messages, auditChannelID, "[ユーザー追加] **owner** → **alice** ("+aliceID+") なし → user")
+
+	threadID := startSession(t, h, aliceID)
+	session := h.session(threadID)
+
+	messages = h.send(ownerID, threadID, "/claude close")
+	expectMessage(t, messages, threadID, "セッションが正常に終了しました")
+	expectMessage(t, messages, auditChannelID, fmt.Sprintf("[セッション終了] **owner** → **alice** (%s) セッション `#%d`", aliceID, session.ID))
+
+	// オーナー以外は監査ログを確認できない
+	messages = h.send(aliceID, testChannelID, "/claude audit")
+	expectMessage(t, messages, testChannelID, "監査ログの確認には `view_audit` 権限が必要です")
+
+	messages = h.send(ownerID, testChannelID, "/claude audit "+aliceID)
+	log := expectMessage(t, messages, testChannelID, "監査ログ")
+	for _, want := range []string{"[ユーザー追加]", "[セッション開始] **alice**", "[セッション終了] **owner**"} {
+		if !strings.Contains(log.Content, want) {
+			t.Errorf("Expected audit log to contain %q, got %q", want, log.Content)
+		}
+	}
+
+	// 件数を指定すると新しいものから表示する
+	messages = h.send(ownerID, testChannelID, "/claude audit 1")
+	log = expectMessage(t, messages, testChannelID, "[セッション終了]")
+	if strings.Contains(log.Content, "[ユーザー追加]") {
+		t.Errorf("Expected only the newest audit event, got %q", log.Content)
+	}
+
+	messages = h.send(ownerID, testChannelID, "/claude audit 0")
+	expectMessage(t, messages, testChannelID, "件数は1から50の範囲で指定してください")
+}
+
+// TestE2EGuildRoleBinding はDiscordロールによるユーザーの自動登録のテスト
+func TestE2EGuildRoleBinding(t *testing.T) {
+	const (
+		engineeringRoleID = "400000000000000001"
+		platformRoleID    = "400000000000000002"
+		everyoneGuildID   = "500000000000000001"
+		carolID           = "300000000000000004"
+	)
+	h := newHarnessWith(t, func(cfg *config.Config) {
+		cfg.Discord.GuildID = testGuildID
+	})
+	h.addUser(ownerID, "owner", "owner")
+	h.discord.addUser(aliceID, "alice")
+	h.discord.addUser(bobID, "bob")
+	h.discord.setMemberRoles(aliceID, engineeringRoleID)
+	h.discord.setMemberRoles(bobID, engineeringRoleID, platformRoleID)
+
+	// 連携前は未登録として扱う
+	messages := h.send(aliceID, testChannelID, "/claude start")
+	expectMessage(t, messages, testChannelID, "あなたが私のオーナーですか？")
+
+	messages = h.send(ownerID, testChannelID, "/claude role bind <@&"+engineeringRoleID+"> user")
+	expectMessage(t, messages, testChannelID, "メンバーを **user** として扱います")
+	messages = h.send(ownerID, testChannelID, "/claude role bind "+platformRoleID+" owner")
+	expectMessage(t, messages, testChannelID, "メンバーを **owner** として扱います")
+	messages = h.send(ownerID, testChannelID, "/claude role bind "+platformRoleID+" admin")
+	expectMessage(t, messages, testChannelID, "ロール `admin` は定義されていません")
+
+	// サーバーに存在しないDiscordロールと @everyone ロール（IDはギルドIDと同じ）は連携できない
+	messages = h.send(ownerID, testChannelID, "/claude role bind 400000000000000009 user")
+	expectMessage(t, messages, testChannelID, "Discordロール `400000000000000009` はこのサーバーに存在しません")
+	h.addGuildUser(everyoneGuildID, carolID, "carol", "owner")
+	messages = h.dispatch(carolID, testChannelID, everyoneGuildID, "/claude role bind "+everyoneGuildID+" user")
+	expectMessage(t, messages, testChannelID, "@everyone ロールは連携できません")
+
+	messages = h.send(ownerID, testChannelID, "/claude role list")
+	expectMessage(t, messages, testChannelID, "Discordロール `"+engineeringRoleID+"` → user")
+
+	// ロールを持つメンバーは自動で登録され、セッションを開始できる
+	threadID := startSession(t, h, aliceID)
+	alice, _ := h.store.GetUserByDiscordID(testGuildID, aliceID)
+	if alice == nil || alice.Role != "user" || !alice.IsGuildRoleUser() {
+		t.Fatalf("Expected alice to be registered from guild role, got %+v", alice)
+	}
+
+	messages = h.send(aliceID, testChannelID, "/claude role bind <@&"+engineeringRoleID+"> owner")
+	expectMessage(t, messages, testChannelID, "設定の変更には `manage_config` 権限が必要です")
+
+	// 複数のロールを持つ場合は最も強いロールになる
+	messages = h.send(bobID, testChannelID, "/claude usage")
+	expectMessage(t, messages, testChannelID, "使用量")
+
+	// 明示的な降格はロール連携より優先される
+	messages = h.send(ownerID, testChannelID, "/claude delete owner "+bobID)
+	expectMessage(t, messages, testChannelID, "一般ユーザーに降格しました")
+	messages = h.send(bobID, testChannelID, "/claude usage")
+	expectMessage(t, messages, testChannelID, "使用量の確認には `view_usage` 権限が必要です")
+
+	// 連携を削除すると、ロール連携で登録されたユーザーは権限を失う
+	messages = h.send(ownerID, testChannelID, "/claude role unbind "+engineeringRoleID)
+	expectMessage(t, messages, testChannelID, "連携を削除しました")
+	messages = h.send(aliceID, threadID, "hello")
+	expectMessage(t, messages, threadID, "このセッションを使用する権限がありません")
+
+	messages = h.send(ownerID, testChannelID, "/claude audit "+aliceID)
+	expectMessage(t, messages, testChannelID, "[ロール連携による更新] **alice** → **alice** ("+aliceID+") なし → user")
+}
+
+// TestE2ECustomRoles は独自に定義したロールによる権限の管理のテスト
+func TestE2ECustomRoles(t *testing.T) {
+	h := newHarness(t)
+	h.addUser(ownerID, "owner", "owner")
+	h.addUser(aliceID, "alice", "user")
+	h.addUser(bobID, "bob", "user")
+
+	messages := h.send(ownerID, testChannelID, "/claude role create operator view_all_sessions,shell_exec")
+	expectMessage(t, messages, testChannelID, "不明な権限です: shell_exec")
+	messages = h.send(ownerID, testChannelID, "/claude role create operator view_all_sessions,manage_sessions 運用担当")
+	expectMessage(t, messages, testChannelID, "ロール **operator** を作成しました（権限: manage_sessions, view_all_sessions）")
+	messages = h.send(ownerID, testChannelID, "/claude role set owner create_sandbox")
+	expectMessage(t, messages, testChannelID, "組み込みロールは変更・削除できません")
+
+	messages = h.send(ownerID, testChannelID, "/claude role list")
+	expectMessage(t, messages, testChannelID, "• **operator**: manage_sessions, view_all_sessions - 運用担当")
+
+	// manage_users を持たないユーザーはロールを割り当てられない
+	messages = h.send(bobID, testChannelID, "/claude role assign "+aliceID+" operator")
+	expectMessage(t, messages, testChannelID, "ユーザー管理操作には `manage_users` 権限が必要です")
+	messages = h.send(ownerID, testChannelID, "/claude role assign <@"+aliceID+"> operator")
+	expectMessage(t, messages, testChannelID, "**alice** さんにロール **operator** を割り当てました")
+
+	// 割り当てたロールの権限で他のユーザーのセッションを操作できる
+	threadID := startSession(t, h, bobID)
+	session := h.session(threadID)
+	messages = h.send(aliceID, testChannelID, "/claude sessions")
+	expectMessage(t, messages, testChannelID, fmt.Sprintf("`#%d` <#%s> - bob", session.ID, threadID))
+	messages = h.send(aliceID, testChannelID, "/claude status")
+	expectMessage(t, messages, testChannelID, "`/claude kill <セッションID> [理由]` - セッションの強制終了")
+	messages = h.send(aliceID, testChannelID, fmt.Sprintf("/claude kill %d", session.ID))
+	expectMessage(t, messages, testChannelID, "強制終了しました")
+
+	// ロールにない権限は使用できない
+	messages = h.send(aliceID, testChannelID, "/claude start")
+	expectMessage(t, messages, testChannelID, "サンドボックス操作には `create_sandbox` 権限が必要です")
+	messages = h.send(aliceID, testChannelID, "/claude usage")
+	expectMessage(t, messages, testChannelID, "使用量の確認には `view_usage` 権限が必要です")
+
+	// 割り当てられているロールは削除できない
+	messages = h.send(ownerID, testChannelID, "/claude role delete operator")
+	expectMessage(t, messages, testChannelID, "1 人のユーザーに割り当てられているため削除できません")
+	messages = h.send(ownerID, testChannelID, "/claude role assign "+aliceID+" user")
+	expectMessage(t, messages, testChannelID, "ロール **user** を割り当てました")
+	messages = h.send(ownerID, testChannelID, "/claude role delete operator")
+	expectMessage(t, messages, testChannelID, "ロール **operator** を削除しました")
+
+	messages = h.send(ownerID, testChannelID, "/claude audit "+aliceID+" 2")
+	expectMessage(t, messages, testChannelID, "[ロールの割り当て] **owner** → **alice** ("+aliceID+") operator → user")
+}
+
+// TestE2EDMSession はDM内でのセッションの開始・会話・終了・再開のテスト
+func TestE2EDMSession(t *testing.T) {
+	h := newHarness(t)
+	h.addUser(aliceID, "alice", "user")
+	h.addUser(bobID, "bob", "user")
+	dmChannelID := "dm-" + aliceID
+
+	// スレッドを作成せず、DMチャンネルでセッションが開始される
+	messages := h.sendDM(aliceID, "/claude start")
+	expectMessage(t, messages, dmChannelID, "準備完了しました")
+	for _, message := range messages {
+		if message.ChannelID != dmChannelID {
+			t.Errorf("Expected all messages in the DM channel, got %s: %s", message.ChannelID, message.Content)
+		}
+	}
+	session := h.session(dmChannelID)
+	if session == nil || !session.IsActive() {
+		t.Fatalf("Expected active session for DM channel, got %+v", session)
+	}
+
+	// DMごとにアクティブなセッションは1つまで
+	messages = h.sendDM(aliceID, "/claude start")
+	expectMessage(t, messages, dmChannelID, "既にアクティブなセッションが存在します")
+
+	// DM内のメッセージはClaude Codeに送られる
+	h.executor.Push(k8s.FakeExecResult{Stdout: claudeOutput})
+	messages = h.sendDM(aliceID, "hello")
+	expectMessage(t, messages, dmChannelID, "Hello from Claude")
+	if calls := h.executor.Calls(); len(calls) != 1 || calls[0].PodName != session.SandboxName {
+		t.Fatalf("Expected prompt to be executed in the DM sandbox, got %+v", calls)
+	}
+
+	messages = h.sendDM(aliceID, "/claude status")
+	expectMessage(t, messages, dmChannelID, "セッション: アクティブ")
+
+	// DMのセッションは共有できない
+	messages = h.sendDM(aliceID, "/claude invite <@"+bobID+">")
+	expectMessage(t, messages, dmChannelID, "DMのセッションは共有できません")
+
+	// 他のユーザーのDMにはセッションがないため、通常のメッセージは無視される
+	if messages := h.sendDM(bobID, "hello"); len(messages) != 0 {
+		t.Errorf("Expected no response without a DM session, got %+v", messages)
+	}
+
+	messages = h.sendDM(aliceID, "/claude close")
+	expectMessage(t, messages, dmChannelID, "セッションが正常に終了しました")
+
+	// 終了後は同じDMで新しいセッションを開始できる
+	messages = h.sendDM(aliceID, "/claude start")
+	expectMessage(t, messages, dmChannelID, "準備完了しました")
+	next := h.session(dmChannelID)
+	if next == nil || next.ID == session.ID || !next.IsActive() {
+		t.Fatalf("Expected a new active session for DM channel, got %+v", next)
+	}
+}
+
+// TestE2EMultiGuild は複数のギルドでユーザー・セッション・設定が分離されることのテスト
+func TestE2EMultiGuild(t *testing.T) {
+	const (
+		partnerGuildID        = "partner"
+		partnerChannelID      = "100000000000000002"
+		partnerAuditChannelID = "100000000000000003"
+		carolID               = "300000000000000004"
+	)
+	h := newHarness(t)
+	h.discord.addChannel(partnerChannelID, discordgo.ChannelTypeGuildText)
+	h.addUser(ownerID, "owner", "owner")
+	h.addUser(aliceID, "alice", "user")
+	h.addGuildUser(partnerGuildID, bobID, "bob", "owner")
+	h.discord.addUser(carolID, "carol")
+
+	sendPartner := func(authorID, content string) []*sentMessage {
+		return h.dispatch(authorID, partnerChannelID, partnerGuildID, content)
+	}
+
+	// 他のギルドで登録されたユーザーは、このギルドでは未登録のユーザーとして扱われる
+	messages := sendPartner(aliceID, "/claude start")
+	expectMessage(t, messages, partnerChannelID, "あなたが私のオーナーですか？")
+
+	// 他のギルドのユーザーは管理できず、このギルドのユーザーとして別に追加する
+	messages = sendPartner(bobID, "/claude delete user "+aliceID)
+	expectMessage(t, messages, partnerChannelID, "このサーバーに登録されていません")
+	messages = sendPartner(bobID, "/claude add user "+aliceID)
+	expectMessage(t, messages, partnerChannelID, "ユーザーを追加しました")
+	partnerAlice, _ := h.store.GetUserByDiscordID(partnerGuildID, aliceID)
+	homeAlice, _ := h.store.GetUserByDiscordID(testGuildID, aliceID)
+	if partnerAlice == nil || homeAlice == nil || partnerAlice.ID == homeAlice.ID {
+		t.Errorf("Expected separate users per guild, got %+v and %+v", partnerAlice, homeAlice)
+	}
+
+	// 複数のギルドに登録されたユーザーは、DMでは利用するギルドを特定できない
+	messages = h.sendDM(aliceID, "/claude status")
+	expectMessage(t, messages, "dm-"+aliceID, "複数のサーバーに登録されているため")
+
+	// 他のギルドのセッションは一覧に表示されず、強制終了もできない
+	threadID := startSession(t, h, aliceID)
+	session := h.session(threadID)
+	messages = sendPartner(bobID, "/claude sessions")
+	expectMessage(t, messages, partnerChannelID, "アクティブなセッション（0件）")
+	messages = sendPartner(bobID, fmt.Sprintf("/claude kill %d", session.ID))
+	expectMessage(t, messages, partnerChannelID, "他のサーバーのユーザーのセッションは操作できません")
+
+	// サンドボックス数の上限はギルドごとに適用される
+	messages = h.send(ownerID, testChannelID, "/claude guild set max_sandboxes 1")
+	expectMessage(t, messages, testChannelID, "同時に利用できるサンドボックス数: 1（使用中: 1）")
+	messages = h.send(ownerID, testChannelID, "/claude start")
+	expectMessage(t, messages, testChannelID, "このサーバーで同時に利用できるサンドボックス数の上限（1）")
+	messages = sendPartner(bobID, "/claude start")
+	if len(messages) == 0 {
+		t.Fatal("Expected messages for /claude start in partner guild")
+	}
+	expectMessage(t, messages, messages[0].ChannelID, "準備完了しました")
+
+	// 監査ログはギルドの管理チャンネルに転送され、一覧もギルドごとに分離される
+	messages = sendPartner(bobID, "/claude guild set audit_channel <#"+partnerAuditChannelID+">")
+	expectMessage(t, messages, partnerChannelID, "監査ログの管理チャンネル: <#"+partnerAuditChannelID+">")
+	messages = sendPartner(bobID, "/claude add user "+carolID)
+	expectMessage(t, messages, partnerAuditChannelID, "[ユーザー追加] **bob** → **carol**")
+	if carol, _ := h.store.GetUserByDiscordID(partnerGuildID, carolID); carol == nil {
+		t.Error("Expected carol to join the partner guild")
+	}
+
+	messages = h.send(ownerID, testChannelID, "/claude audit")
+	for _, message := range messages {
+		if strings.Contains(message.Content, "carol") {
+			t.Errorf("Expected audit log of another guild to be hidden, got %s", message.Content)
+		}
+	}
+
+	// 設定の変更には manage_config 権限が必要
+	messages = h.send(aliceID, threadID, "/claude guild")
+	expectMessage(t, messages, threadID, "`manage_config` 権限が必要です")
+}
+
+// TestE2EShutdown はシャットダウンの開始後に受信したイベントを処理しないテスト
+func TestE2EShutdown(t *testing.T) {
+	h := newHarness(t)
+	h.addUser(ownerID, "owner", "owner")
+	threadID := startSession(t, h, ownerID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	h.bot.Stop(ctx)
+
+	if messages := h.send(ownerID, testChannelID, "/claude status"); len(messages) != 0 {
+		t.Errorf("Expected no messages after shutdown, got %d", len(messages))
+	}
+	if messages := h.send(ownerID, threadID, "こんにちは"); len(messages) != 0 {
+		t.Errorf("Expected no messages after shutdown, got %d", len(messages))
+	}
+}
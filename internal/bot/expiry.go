@@ -0,0 +1,152 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/auth"
+	"github.com/hirano00o/disclaude/internal/db"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// accessExpiryInterval はアクセス期限を過ぎたユーザーを確認する間隔
+	accessExpiryInterval = time.Minute
+	// accessExpiredReason はアクセス期限切れで終了したセッションに記録する理由
+	accessExpiredReason = "アクセス期限切れ"
+)
+
+// systemActor はバックグラウンドジョブによる操作の実行者として記録するユーザー（データベースには存在しない）
+var systemActor = &db.User{DiscordID: "system", Username: "システム"}
+
+// accessDurationUnits は `/claude add user` の期間で time.ParseDuration に加えて使用できる単位
+var accessDurationUnits = map[string]time.Duration{
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// parseAccessDuration はアクセスの有効期間（`30d`、`2w`、`12h` など）を解析する
+func parseAccessDuration(value string) (time.Duration, error) {
+	invalid := fmt.Errorf("無効な期間です: %s（例: `30d`、`2w`、`12h`）", value)
+
+	for suffix, unit := range accessDurationUnits {
+		if !strings.HasSuffix(value, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(value, suffix))
+		if err != nil || n <= 0 {
+			return 0, invalid
+		}
+		return time.Duration(n) * unit, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, invalid
+	}
+
+	return duration, nil
+}
+
+// formatAccessExpiry はユーザーのアクセス期限を表示する（無期限の場合は「無期限」）
+func formatAccessExpiry(user *db.User) string {
+	if !user.ExpiresAt.Valid {
+		return "無期限"
+	}
+	return user.ExpiresAt.Time.Format(auth.AccessExpiryFormat)
+}
+
+// runAccessExpiry はアクセス期限を過ぎたユーザーを定期的に無効化する
+// ctxが終了すると停止する
+func (b *Bot) runAccessExpiry(ctx context.Context) {
+	ticker := time.NewTicker(accessExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		b.expireUsers(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expireUsers はnowの時点でアクセス期限を過ぎたユーザーを無効化する
+func (b *Bot) expireUsers(ctx context.Context, now time.Time) {
+	users, err := b.db.ListExpiredUsers(now)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list expired users")
+		return
+	}
+
+	for _, user := range users {
+		if err := b.expireUser(ctx, user); err != nil {
+			logrus.WithError(err).WithField("discord_id", user.DiscordID).Error("Failed to expire user")
+		}
+	}
+}
+
+// expireUser はユーザーのアクティブなセッションを終了してから無効化し、ユーザー管理権限を持つユーザーに通知する
+// セッションの終了に失敗した場合は無効化せず、次回の確認で再試行する
+func (b *Bot) expireUser(ctx context.Context, user *db.User) error {
+	terminated, err := b.sessionManager.TerminateUserSessions(ctx, user, systemActor, accessExpiredReason)
+	if err != nil {
+		return fmt.Errorf("failed to terminate user sessions: %w", err)
+	}
+
+	if err := b.db.SetUserAccess(user.GuildID.String, user.DiscordID, user.ExpiresAt, true); err != nil {
+		return fmt.Errorf("failed to disable user: %w", err)
+	}
+
+	b.audit.RecordUserChange(auth.AuditUserExpire, systemActor, user, user.Role, "")
+
+	logrus.WithFields(logrus.Fields{
+		"discord_id":          user.DiscordID,
+		"expires_at":          user.ExpiresAt.Time,
+		"terminated_sessions": terminated,
+	}).Info("User access expired")
+
+	b.notifyAccessExpired(user, terminated)
+	return nil
+}
+
+// notifyAccessExpired は期限切れのユーザーと同じギルドでユーザー管理権限（manage_users）を持つユーザーにアクセス期限切れをDMで通知する
+func (b *Bot) notifyAccessExpired(expired *db.User, terminated int) {
+	users, err := b.db.ListUsers()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list users for expiry notice")
+		return
+	}
+
+	content := fmt.Sprintf(`⏰ **ユーザーのアクセス期限が切れました**
+• ユーザー: %s (%s)
+• 期限: %s
+• 終了したセッション: %d 件
+
+引き続き利用できるようにするには `+"`/claude add user %s [期間]`"+` を実行してください。`,
+		expired.Username, expired.DiscordID, formatAccessExpiry(expired), terminated, expired.DiscordID)
+
+	for _, user := range users {
+		if user.ID == expired.ID || !user.InGuild(expired.GuildID.String) {
+			continue
+		}
+		if err := b.permService.Authorize(user, auth.CapabilityManageUsers, nil); err != nil {
+			continue
+		}
+
+		channel, err := b.discord.UserChannelCreate(user.DiscordID)
+		if err != nil {
+			logrus.WithError(err).WithField("discord_id", user.DiscordID).Error("Failed to open DM channel for expiry notice")
+			continue
+		}
+		if _, err := b.discord.ChannelMessageSend(channel.ID, content); err != nil {
+			logrus.WithError(err).WithField("discord_id", user.DiscordID).Error("Failed to send expiry notice")
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package bot
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hirano00o/disclaude/internal/auth"
+	"github.com/hirano00o/disclaude/internal/db"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+)
+
+// ambiguousGuildUserMessage は複数のギルドに登録されたユーザーがDMでBotを利用しようとした場合のメッセージ
+const ambiguousGuildUserMessage = "あなたは複数のサーバーに登録されているため、DMでは利用するサーバーを特定できません。サーバーのチャンネルから利用してください"
+
+// guildSettingItems は `/claude guild set` で設定できる項目と表示名（利用上限の項目は limitItems と共通）
+var guildSettingItems = map[string]string{
+	"max_sandboxes": "同時に利用できるサンドボックス数",
+	"audit_channel": "監査ログの管理チャンネル",
+}
+
+// guildCreateHandler はギルドへの参加時（起動時に参加済みのギルドを含む）のハンドラー
+func (b *Bot) guildCreateHandler(s *discordgo.Session, event *discordgo.GuildCreate) {
+	if _, err := b.db.UpsertGuild(event.ID, event.Name); err != nil {
+		logrus.WithError(err).WithField("guild_id", event.ID).Error("Failed to register guild")
+		return
+	}
+
+	b.knownGuilds.Store(event.ID, true)
+	logrus.WithFields(logrus.Fields{
+		"guild_id": event.ID,
+		"name":     event.Name,
+	}).Info("Guild registered")
+}
+
+// ensureGuild はギルドがデータベースに登録されていることを保証する
+// 登録済みのギルドはキャッシュし、メッセージごとにデータベースを更新しないようにする
+func (b *Bot) ensureGuild(guildID string) error {
+	if _, ok := b.knownGuilds.Load(guildID); ok {
+		return nil
+	}
+
+	if _, err := b.db.UpsertGuild(guildID, ""); err != nil {
+		return fmt.Errorf("failed to register guild: %w", err)
+	}
+
+	b.knownGuilds.Store(guildID, true)
+	return nil
+}
+
+// adoptDefaultGuild はギルドに属さないユーザー・ロール・監査ログを DISCORD_GUILD_ID のギルドに所属させる
+// ギルド導入前の単一ギルドの構成から移行するため、起動時に呼び出す
+func (b *Bot) adoptDefaultGuild() error {
+	guildID := b.config.Discord.GuildID
+	if guildID == "" {
+		return nil
+	}
+
+	if err := b.ensureGuild(guildID); err != nil {
+		return err
+	}
+
+	adopted, err := b.db.AssignUnscopedToGuild(guildID)
+	if err != nil {
+		return fmt.Errorf("failed to assign unscoped users to guild: %w", err)
+	}
+
+	if adopted > 0 {
+		logrus.WithFields(logrus.Fields{
+			"guild_id": guildID,
+			"users":    adopted,
+		}).Info("Assigned unscoped users to default guild")
+	}
+
+	return nil
+}
+
+// handleGuildCommand は `/claude guild [set <項目> <値|default>]` コマンドを処理する
+// 設定は実行したユーザーが属するギルドに適用する
+func (b *Bot) handleGuildCommand(s DiscordSession, m *discordgo.MessageCreate, user *db.User, args []string) {
+	// 権限チェック
+	if err := b.permService.Authorize(user, auth.CapabilityManageConfig, nil); err != nil {
+		b.sendErrorMessage(s, m.ChannelID, err.Error())
+		return
+	}
+
+	if !user.GuildID.Valid {
+		b.sendErrorMessage(s, m.ChannelID, "サーバーの設定は、サーバーに所属するユーザーのみ変更できます")
+		return
+	}
+
+	if len(args) != 0 && (len(args) != 3 || args[0] != "set") {
+		b.sendErrorMessage(s, m.ChannelID, "使用方法: `/claude guild` または `/claude guild set <max_sandboxes|audit_channel|daily_cost|monthly_cost|daily_tokens|monthly_tokens|sessions|duration> <値|unlimited|default>`")
+		return
+	}
+
+	guild, err := b.db.GetGuild(user.GuildID.String)
+	if err != nil || guild == nil {
+		logrus.WithError(err).Error("Failed to get guild")
+		b.sendErrorMessage(s, m.ChannelID, "サーバーの設定の取得に失敗しました")
+		return
+	}
+
+	if len(args) == 3 {
+		if err := setGuildSetting(guild, args[1], args[2]); err != nil {
+			b.sendErrorMessage(s, m.ChannelID, err.Error())
+			return
+		}
+
+		if err := b.db.UpdateGuildSettings(guild); err != nil {
+			logrus.WithError(err).Error("Failed to update guild settings")
+			b.sendErrorMessage(s, m.ChannelID, "サーバーの設定の更新に失敗しました")
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"requester_id": user.ID,
+			"guild_id":     guild.GuildID,
+			"item":         args[1],
+			"value":        args[2],
+		}).Info("Guild settings updated")
+	}
+
+	b.sendGuildSettings(s, m.ChannelID, guild)
+}
+
+// sendGuildSettings はギルドの設定を送信する（設定していない項目はデフォルト値を使用する）
+func (b *Bot) sendGuildSettings(s DiscordSession, channelID string, guild *db.Guild) {
+	name := guild.Name
+	if name == "" {
+		name = guild.GuildID
+	}
+
+	sandboxes := "デフォルト（全体の上限のみ）"
+	if guild.MaxSandboxes.Valid && guild.MaxSandboxes.Int64 > 0 {
+		count, err := b.db.CountActiveSessionsByGuild(guild.GuildID)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to count active sessions in guild")
+		}
+		sandboxes = fmt.Sprintf("%d（使用中: %d）", guild.MaxSandboxes.Int64, count)
+	}
+
+	auditChannel := "デフォルト"
+	if guild.AuditChannelID.Valid {
+		auditChannel = fmt.Sprintf("<#%s>", guild.AuditChannelID.String)
+	}
+
+	settingsMessage := fmt.Sprintf(`🏠 **サーバーの設定: %s**
+
+• %s: %s
+• %s: %s
+
+📏 **利用上限（ユーザー個別の設定がない場合に適用）**
+• %s: %s
+• %s: %s
+• %s: %s
+• %s: %s
+• %s: %s
+• %s: %s`,
+		name,
+		guildSettingItems["max_sandboxes"], sandboxes,
+		guildSettingItems["audit_channel"], auditChannel,
+		limitItems["daily_cost"], formatGuildLimit(guild.DailyCostUSD.Valid, guild.DailyCostUSD.Float64 > 0, fmt.Sprintf("$%.2f", guild.DailyCostUSD.Float64)),
+		limitItems["monthly_cost"], formatGuildLimit(guild.MonthlyCostUSD.Valid, guild.MonthlyCostUSD.Float64 > 0, fmt.Sprintf("$%.2f", guild.MonthlyCostUSD.Float64)),
+		limitItems["daily_tokens"], formatGuildLimit(guild.DailyTokens.Valid, guild.DailyTokens.Int64 > 0, fmt.Sprintf("%d", guild.DailyTokens.Int64)),
+		limitItems["monthly_tokens"], formatGuildLimit(guild.MonthlyTokens.Valid, guild.MonthlyTokens.Int64 > 0, fmt.Sprintf("%d", guild.MonthlyTokens.Int64)),
+		limitItems["sessions"], formatGuildLimit(guild.MaxSessions.Valid, guild.MaxSessions.Int64 > 0, fmt.Sprintf("%d", guild.MaxSessions.Int64)),
+		limitItems["duration"], formatGuildLimit(guild.MaxSessionMinutes.Valid, guild.MaxSessionMinutes.Int64 > 0, fmt.Sprintf("%dm", guild.MaxSessionMinutes.Int64)))
+
+	b.sendMessage(s, channelID, settingsMessage)
+}
+
+// setGuildSetting はギルドの設定の1項目を変更する
+// valueが "default" の場合は設定を解除し、デフォルト値を使用する
+func setGuildSetting(guild *db.Guild, item, value string) error {
+	switch item {
+	case "max_sandboxes":
+		if value == "default" || value == "unlimited" {
+			guild.MaxSandboxes = sql.NullInt64{}
+			return nil
+		}
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || count < 1 {
+			return fmt.Errorf("無効な数値です: `%s`", value)
+		}
+		guild.MaxSandboxes = sql.NullInt64{Int64: count, Valid: true}
+		return nil
+
+	case "audit_channel":
+		if value == "default" {
+			guild.AuditChannelID = sql.NullString{}
+			return nil
+		}
+		channelID := parseChannelMention(value)
+		if len(channelID) < 15 || len(channelID) > 20 {
+			return fmt.Errorf("無効なチャンネルです: `%s`", value)
+		}
+		guild.AuditChannelID = sql.NullString{String: channelID, Valid: true}
+		return nil
+	}
+
+	if _, ok := limitItems[item]; !ok {
+		return fmt.Errorf("無効な項目です: `%s`", item)
+	}
+
+	// 利用上限はユーザー個別の設定と同じ形式で解析する
+	limits := &db.UserLimits{
+		DailyCostUSD:      guild.DailyCostUSD,
+		MonthlyCostUSD:    guild.MonthlyCostUSD,
+		DailyTokens:       guild.DailyTokens,
+		MonthlyTokens:     guild.MonthlyTokens,
+		MaxSessions:       guild.MaxSessions,
+		MaxSessionMinutes: guild.MaxSessionMinutes,
+	}
+	if err := applyLimitValue(limits, item, value); err != nil {
+		return err
+	}
+
+	guild.DailyCostUSD = limits.DailyCostUSD
+	guild.MonthlyCostUSD = limits.MonthlyCostUSD
+	guild.DailyTokens = limits.DailyTokens
+	guild.MonthlyTokens = limits.MonthlyTokens
+	guild.MaxSessions = limits.MaxSessions
+	guild.MaxSessionMinutes = limits.MaxSessionMinutes
+	return nil
+}
+
+// formatGuildLimit はギルドの利用上限を表示用に整形する（設定していない場合は「デフォルト」）
+func formatGuildLimit(set, limited bool, value string) string {
+	if !set {
+		return "デフォルト"
+	}
+	return formatLimit(limited, value)
+}
+
+// auditChannelFor は監査ログを転送する管理チャンネルを返す（転送しない場合は空文字列）
+// ギルドに管理チャンネルが設定されていない場合、DISCORD_AUDIT_CHANNEL_ID はギルドに属さない操作と DISCORD_GUILD_ID のギルドの操作のみに使用する
+func (b *Bot) auditChannelFor(event *db.AuditEvent) string {
+	if event.GuildID.Valid {
+		guild, err := b.db.GetGuild(event.GuildID.String)
+		if err != nil {
+			logrus.WithError(err).WithField("guild_id", event.GuildID.String).Error("Failed to get guild for audit mirror")
+		} else if guild != nil && guild.AuditChannelID.Valid {
+			return guild.AuditChannelID.String
+		}
+
+		if event.GuildID.String != b.config.Discord.GuildID {
+			return ""
+		}
+	}
+
+	return b.config.Discord.AuditChannelID
+}
+
+// parseChannelMention はチャンネルのメンション（<#ID>）からチャンネルIDを取り出す
+func parseChannelMention(arg string) string {
+	if strings.HasPrefix(arg, "<#") && strings.HasSuffix(arg, ">") {
+		return arg[2 : len(arg)-1]
+	}
+	return arg
+}
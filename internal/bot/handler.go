@@ -2,14 +2,20 @@ package bot
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hirano00o/disclaude/internal/auth"
 	"github.com/hirano00o/disclaude/internal/config"
 	"github.com/hirano00o/disclaude/internal/db"
 	"github.com/hirano00o/disclaude/internal/k8s"
+	"github.com/hirano00o/disclaude/internal/metrics"
+	"github.com/hirano00o/disclaude/internal/render"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/sirupsen/logrus"
@@ -18,17 +24,43 @@ import (
 // Bot はDiscord Botの主要構造体
 type Bot struct {
 	session        *discordgo.Session
+	discord        DiscordSession
 	config         *config.Config
-	db             *db.DB
+	db             db.Store
 	userService    *auth.UserService
+	audit          *auth.AuditLogger
 	permService    *auth.PermissionService
 	k8sClient      *k8s.Client
 	sandboxManager *k8s.SandboxManager
+	sessionManager *SessionManager
 	claudeService  *ClaudeService
+
+	// inflight は処理中のメッセージハンドラー数を追跡する（シャットダウン時のドレイン用）
+	inflight sync.WaitGroup
+
+	// drainMu は inflight への追加と、シャットダウン時の待機の開始を排他する
+	drainMu sync.RWMutex
+	// draining はシャットダウン中で、新しいイベントを受け付けないことを示す
+	draining bool
+
+	// recreating はサンドボックスを再作成中のセッションID（ボタンの二重押し防止用）
+	recreating sync.Map
+
+	// queued はClaude Codeの応答待ちになっているリクエスト数（ダッシュボード表示用）
+	queued atomic.Int64
+
+	// knownGuilds はデータベースに登録済みのギルドID
+	knownGuilds sync.Map
+
+	// pendingOwnerGuilds はオーナー確認中のユーザーが `/claude` を実行したギルドID（DMでの返信時に使用する）
+	pendingOwnerGuilds sync.Map
+
+	// closedThreads はアーカイブ・削除によりセッションを終了中のスレッドID（終了の通知を送信しない）
+	closedThreads sync.Map
 }
 
 // New は新しいBotインスタンスを作成する
-func New(cfg *config.Config, database *db.DB) (*Bot, error) {
+func New(cfg *config.Config, database db.Store) (*Bot, error) {
 	// Discord セッションの作成
 	session, err := discordgo.New("Bot " + cfg.Discord.Token)
 	if err != nil {
@@ -42,27 +74,59 @@ func New(cfg *config.Config, database *db.DB) (*Bot, error) {
 	}
 
 	// サービスの初期化
-	userService := auth.NewUserService(database)
-	permService := auth.NewPermissionService(database)
-	sandboxManager := k8s.NewSandboxManager(k8sClient, database, cfg)
-	claudeService := NewClaudeService(sandboxManager)
+	sandboxManager := k8s.NewSandboxManager(k8sClient.GetClientset(), k8sClient.NewExecutor(), cfg.Kubernetes.Namespace, database, cfg)
+
+	bot := newBot(cfg, database, session, sandboxManager)
+	bot.session = session
+	bot.k8sClient = k8sClient
+
+	// イベントハンドラーの登録
+	session.AddHandler(bot.messageHandler)
+	session.AddHandler(bot.readyHandler)
+	session.AddHandler(bot.interactionHandler)
+	session.AddHandler(bot.guildCreateHandler)
+	session.AddHandler(bot.threadUpdateHandler)
+	session.AddHandler(bot.threadDeleteHandler)
+	session.AddHandler(bot.channelDeleteHandler)
+
+	return bot, nil
+}
+
+// newBot はDiscord接続とKubernetesクライアントを除くBotの依存関係を組み立てる
+// discordはイベントに応答しない通知（サンドボックスの停止など）の送信に使用する
+func newBot(cfg *config.Config, database db.Store, discord DiscordSession, sandboxManager *k8s.SandboxManager) *Bot {
+	permService := auth.NewPermissionService(database, auth.Limits{
+		DailyCostUSD:       cfg.Quota.DailyCostUSD,
+		MonthlyCostUSD:     cfg.Quota.MonthlyCostUSD,
+		DailyTokens:        cfg.Quota.DailyTokens,
+		MonthlyTokens:      cfg.Quota.MonthlyTokens,
+		MaxSessions:        cfg.Quota.MaxSessionsPerUser,
+		MaxSessionDuration: cfg.Quota.MaxSessionDuration,
+	})
 
 	bot := &Bot{
-		session:        session,
+		discord:        discord,
 		config:         cfg,
 		db:             database,
-		userService:    userService,
+		userService:    auth.NewUserService(database, permService),
 		permService:    permService,
-		k8sClient:      k8sClient,
 		sandboxManager: sandboxManager,
-		claudeService:  claudeService,
+		sessionManager: NewSessionManager(database, sandboxManager),
+		claudeService:  NewClaudeService(sandboxManager),
 	}
+	sandboxManager.SetFailureHandler(bot.handleSandboxFailure)
+	bot.sessionManager.SetTerminationHandler(bot.notifySessionTerminated)
 
-	// イベントハンドラーの登録
-	session.AddHandler(bot.messageHandler)
-	session.AddHandler(bot.readyHandler)
+	bot.audit = auth.NewAuditLogger(database)
+	bot.audit.SetMirror(bot.mirrorAuditEvent)
+	bot.userService.SetAuditLogger(bot.audit)
+	bot.userService.SetSessionTerminator(bot.sessionManager)
+	bot.sessionManager.SetAuditLogger(bot.audit)
 
-	return bot, nil
+	// ロール連携はメッセージを受信したギルドのロールで行う
+	bot.permService.SetMemberRoleResolver(bot)
+
+	return bot
 }
 
 // Start はBotを開始する
@@ -72,20 +136,111 @@ func (b *Bot) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to create kubernetes namespace: %w", err)
 	}
 
+	// サンドボックスPodの監視を開始
+	if err := b.sandboxManager.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start sandbox manager: %w", err)
+	}
+
+	// ギルド導入前のユーザーを DISCORD_GUILD_ID のギルドに移行
+	if err := b.adoptDefaultGuild(); err != nil {
+		return fmt.Errorf("failed to adopt default guild: %w", err)
+	}
+
 	// Discord接続を開く
 	if err := b.session.Open(); err != nil {
 		return fmt.Errorf("failed to open discord session: %w", err)
 	}
 
+	// アクセス期限を過ぎたユーザーの無効化を開始
+	go b.runAccessExpiry(ctx)
+
 	logrus.Info("Discord bot started successfully")
 	return nil
 }
 
 // Stop はBotを停止する
-func (b *Bot) Stop() {
+// 新しいイベントの受け付けを止めてDiscord接続を閉じた後、処理中のメッセージが完了するかctxが終了するまで待機する
+func (b *Bot) Stop(ctx context.Context) {
+	// 待機中に inflight が追加されないよう、先に受け付けを止める
+	b.drainMu.Lock()
+	b.draining = true
+	b.drainMu.Unlock()
+
 	if b.session != nil {
 		b.session.Close()
 	}
+
+	done := make(chan struct{})
+	go func() {
+		b.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logrus.Info("All in-flight messages have been processed")
+	case <-ctx.Done():
+		logrus.Warn("Timed out waiting for in-flight messages to finish")
+	}
+}
+
+// beginInflight は処理中のイベントとして登録する（シャットダウン中の場合はfalseを返し、イベントを処理しない）
+// 登録した場合は処理の終了時に b.inflight.Done() を呼び出す
+func (b *Bot) beginInflight() bool {
+	b.drainMu.RLock()
+	defer b.drainMu.RUnlock()
+
+	if b.draining {
+		return false
+	}
+
+	b.inflight.Add(1)
+	return true
+}
+
+// SessionManager はセッションの管理機能を返す（管理APIから使用する）
+func (b *Bot) SessionManager() *SessionManager {
+	return b.sessionManager
+}
+
+// PermissionService は権限・利用上限の判定機能を返す（ダッシュボードから使用する）
+func (b *Bot) PermissionService() *auth.PermissionService {
+	return b.permService
+}
+
+// QueuedRequests はClaude Codeの応答待ちになっているリクエスト数を返す
+func (b *Bot) QueuedRequests() int {
+	return int(b.queued.Load())
+}
+
+// PodPhase はサンドボックスPodの現在のフェーズを返す（不明な場合は空文字）
+func (b *Bot) PodPhase(podName string) string {
+	phase, err := b.sandboxManager.GetPodPhase(podName)
+	if err != nil {
+		logrus.WithError(err).WithField("pod_name", podName).Warn("Failed to get pod phase")
+		return ""
+	}
+	return phase
+}
+
+// CheckDiscord はDiscordゲートウェイに接続済みかチェックする
+func (b *Bot) CheckDiscord(ctx context.Context) error {
+	if b.session == nil || !b.session.DataReady {
+		return fmt.Errorf("discord gateway is not connected")
+	}
+	return nil
+}
+
+// CheckKubernetes はKubernetes APIに到達できるかチェックする
+func (b *Bot) CheckKubernetes(ctx context.Context) error {
+	ready, err := b.k8sClient.IsNamespaceReady(ctx)
+	if err != nil {
+		return err
+	}
+	if !ready {
+		return fmt.Errorf("namespace %s is not active", b.k8sClient.GetNamespace())
+	}
+	return nil
 }
 
 // readyHandler はBot準備完了時のハンドラー
@@ -101,8 +256,19 @@ func (b *Bot) readyHandler(s *discordgo.Session, event *discordgo.Ready) {
 
 // messageHandler はメッセージ受信時のハンドラー
 func (b *Bot) messageHandler(s *discordgo.Session, m *discordgo.MessageCreate) {
+	b.handleMessage(s, s.State.User.ID, m)
+}
+
+// handleMessage は受信したメッセージをコマンドまたはスレッド内の会話として処理する
+func (b *Bot) handleMessage(s DiscordSession, botUserID string, m *discordgo.MessageCreate) {
+	if !b.beginInflight() {
+		logrus.WithField("channel_id", m.ChannelID).Debug("Ignoring message during shutdown")
+		return
+	}
+	defer b.inflight.Done()
+
 	// Bot自身のメッセージは無視
-	if m.Author.ID == s.State.User.ID {
+	if m.Author.ID == botUserID {
 		return
 	}
 
@@ -128,16 +294,21 @@ func (b *Bot) messageHandler(s *discordgo.Session, m *discordgo.MessageCreate) {
 }
 
 // handleCommand はコマンドを処理する
-func (b *Bot) handleCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
+func (b *Bot) handleCommand(s DiscordSession, m *discordgo.MessageCreate) {
 	content := strings.TrimSpace(m.Content)
 	parts := strings.Fields(content)
 	
-	if len(parts) == 0 || !strings.HasPrefix(parts[0], "/claude") {
+	isCommand := len(parts) > 0 && strings.HasPrefix(parts[0], "/claude")
+	if !isCommand && m.GuildID != "" {
 		return
 	}
 
 	// 初回ユーザーの場合、認証フローを開始
-	user, err := b.userService.GetUser(m.Author.ID)
+	user, err := b.resolveUser(m.GuildID, m.Author.ID, m.Author.Username)
+	if errors.Is(err, auth.ErrAmbiguousGuild) {
+		b.sendErrorMessage(s, m.ChannelID, ambiguousGuildUserMessage)
+		return
+	}
 	if err != nil {
 		logrus.WithError(err).Error("Failed to get user")
 		b.sendErrorMessage(s, m.ChannelID, "ユーザー情報の取得に失敗しました")
@@ -149,6 +320,12 @@ func (b *Bot) handleCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
 		return
 	}
 
+	// DMでのコマンド以外のメッセージは、DMのセッションがあればClaude Codeとの会話として扱う
+	if !isCommand {
+		b.handleThreadMessage(s, m)
+		return
+	}
+
 	// コマンドの解析と実行
 	if len(parts) < 2 {
 		b.sendHelpMessage(s, m.ChannelID)
@@ -163,9 +340,9 @@ func (b *Bot) handleCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
 		b.handleCloseCommand(s, m, user)
 	case "add":
 		if len(parts) >= 4 {
-			b.handleAddCommand(s, m, user, parts[2], parts[3])
+			b.handleAddCommand(s, m, user, parts[2], parts[3], parts[4:])
 		} else {
-			b.sendErrorMessage(s, m.ChannelID, "使用方法: `/claude add user <ユーザーID>` または `/claude add owner <ユーザーID>`")
+			b.sendErrorMessage(s, m.ChannelID, "使用方法: `/claude add user <ユーザーID> [期間]` または `/claude add owner <ユーザーID>`")
 		}
 	case "delete":
 		if len(parts) >= 4 {
@@ -175,6 +352,24 @@ func (b *Bot) handleCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
 		}
 	case "status":
 		b.handleStatusCommand(s, m, user)
+	case "usage":
+		b.handleUsageCommand(s, m, user, parts[2:])
+	case "limit":
+		b.handleLimitCommand(s, m, user, parts[2:])
+	case "export":
+		b.handleExportCommand(s, m, user, parts[2:])
+	case "sessions":
+		b.handleSessionsCommand(s, m, user)
+	case "kill":
+		b.handleKillCommand(s, m, user, parts[2:])
+	case "audit":
+		b.handleAuditCommand(s, m, user, parts[2:])
+	case "role":
+		b.handleRoleCommand(s, m, user, parts[2:])
+	case "invite":
+		b.handleInviteCommand(s, m, user, parts[2:])
+	case "guild":
+		b.handleGuildCommand(s, m, user, parts[2:])
 	case "help":
 		b.sendHelpMessage(s, m.ChannelID)
 	default:
@@ -183,13 +378,25 @@ func (b *Bot) handleCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
 }
 
 // handleInitialAuthentication は初回認証を処理する
-func (b *Bot) handleInitialAuthentication(s *discordgo.Session, m *discordgo.MessageCreate) {
+func (b *Bot) handleInitialAuthentication(s DiscordSession, m *discordgo.MessageCreate) {
 	// 既存の認証プロセスをチェック
 	content := strings.ToLower(strings.TrimSpace(m.Content))
 	
 	if content == "yes" || content == "y" || content == "はい" {
-		// オーナーとして登録
-		user, err := b.userService.InitializeUser(m.Author.ID, m.Author.Username, true)
+		// `/claude` を実行したギルド（DMで開始した場合は DISCORD_GUILD_ID のギルド）のオーナーとして登録
+		guildID := b.config.Discord.GuildID
+		if pending, ok := b.pendingOwnerGuilds.LoadAndDelete(m.Author.ID); ok {
+			guildID = pending.(string)
+		}
+		if guildID != "" {
+			if err := b.ensureGuild(guildID); err != nil {
+				logrus.WithError(err).Error("Failed to register guild")
+				b.sendErrorMessage(s, m.ChannelID, "オーナー登録に失敗しました")
+				return
+			}
+		}
+
+		user, err := b.userService.InitializeUser(m.Author.ID, m.Author.Username, guildID, true)
 		if err != nil {
 			logrus.WithError(err).Error("Failed to initialize owner")
 			b.sendErrorMessage(s, m.ChannelID, "オーナー登録に失敗しました")
@@ -200,16 +407,20 @@ func (b *Bot) handleInitialAuthentication(s *discordgo.Session, m *discordgo.Mes
 	
 	} else if content == "no" || content == "n" || content == "いいえ" {
 		// 一般ユーザーとして終了
+		b.pendingOwnerGuilds.Delete(m.Author.ID)
 		b.sendMessage(s, m.ChannelID, "オーナー登録をキャンセルしました。Claude Codeサンドボックスを利用するには、オーナーからユーザー追加をしてもらってください。")
 	
 	} else if strings.HasPrefix(content, "/claude") {
 		// 初回コマンド - オーナー確認
+		if m.GuildID != "" {
+			b.pendingOwnerGuilds.Store(m.Author.ID, m.GuildID)
+		}
 		b.sendMessage(s, m.ChannelID, fmt.Sprintf("こんにちは %sさん！\n\n🤖 **あなたが私のオーナーですか？**\n\n✅ オーナーの場合: `Yes` と返信\n❌ オーナーでない場合: `No` と返信\n\n※オーナーはユーザー管理権限を持ちます", m.Author.Username))
 	}
 }
 
-// handleThreadMessage はスレッド内のメッセージを処理する
-func (b *Bot) handleThreadMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
+// handleThreadMessage はスレッドまたはDMのセッション内のメッセージを処理する
+func (b *Bot) handleThreadMessage(s DiscordSession, m *discordgo.MessageCreate) {
 	// スレッドIDでセッションを取得
 	session, err := b.db.GetSessionByThreadID(m.ChannelID)
 	if err != nil {
@@ -217,12 +428,26 @@ func (b *Bot) handleThreadMessage(s *discordgo.Session, m *discordgo.MessageCrea
 		return
 	}
 
-	if session == nil || !session.IsActive() {
+	if session == nil {
+		return
+	}
+
+	// サンドボックスが停止したセッションでは、メッセージを送っても応答できないことを伝える
+	if session.Status == "failed" {
+		b.sendErrorMessage(s, m.ChannelID, "このセッションのサンドボックスは停止しています。再作成ボタンを押すか、`/claude start` で新しいセッションを開始してください")
+		return
+	}
+
+	if !session.IsActive() {
 		return
 	}
 
 	// ユーザー権限チェック
-	user, err := b.userService.GetUser(m.Author.ID)
+	user, err := b.resolveUser(m.GuildID, m.Author.ID, m.Author.Username)
+	if errors.Is(err, auth.ErrAmbiguousGuild) {
+		b.sendErrorMessage(s, m.ChannelID, ambiguousGuildUserMessage)
+		return
+	}
 	if err != nil {
 		logrus.WithError(err).Error("Failed to get user")
 		return
@@ -233,40 +458,84 @@ func (b *Bot) handleThreadMessage(s *discordgo.Session, m *discordgo.MessageCrea
 		return
 	}
 
-	// セッションの所有者またはオーナーのみ操作可能
-	canUse, err := b.permService.CanDeleteSandbox(m.Author.ID, session.UserID)
-	if err != nil {
-		logrus.WithError(err).Error("Failed to check permission")
+	// セッションの所有者、manage_sessions 権限を持つユーザー、collaboratorとして招待されたユーザーのみ操作可能
+	if err := b.permService.AuthorizeSession(user, session, db.SessionMemberCollaborator); err != nil {
+		if !auth.IsPermissionDenied(err) {
+			logrus.WithError(err).Error("Failed to check permission")
+			return
+		}
+		if errors.Is(err, auth.ErrSessionViewOnly) {
+			b.sendErrorMessage(s, m.ChannelID, err.Error())
+			return
+		}
+		b.sendErrorMessage(s, m.ChannelID, "このセッションを使用する権限がありません")
 		return
 	}
 
-	if !canUse {
-		b.sendErrorMessage(s, m.ChannelID, "このセッションを使用する権限がありません")
+	// 予算・セッション時間の上限チェック
+	if err := b.permService.ValidateTurn(user, session); err != nil {
+		b.sendErrorMessage(s, m.ChannelID, err.Error())
 		return
 	}
 
 	// Claude Codeにメッセージを送信
+	metrics.QueuedRequests.Inc()
+	defer metrics.QueuedRequests.Dec()
+	b.queued.Add(1)
+	defer b.queued.Add(-1)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	b.recordMessage(session, user, "user", m.Content, nil)
+
+	start := time.Now()
 	response, err := b.claudeService.SendMessage(ctx, session.SandboxName, m.Content)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to send message to Claude Code")
+		b.recordClaudeTurn(session, user, &ClaudeResponse{Duration: time.Since(start), ExitStatus: "exec_failed"})
+
+		var exitCode *int
+		if code, ok := exitCodeOf(err); ok {
+			exitCode = &code
+		}
+		b.recordMessage(session, user, "system", err.Error(), exitCode)
+
 		b.sendErrorMessage(s, m.ChannelID, "Claude Codeとの通信に失敗しました")
 		return
 	}
+	b.recordClaudeTurn(session, user, response)
+	b.recordResponse(session, user, response)
 
 	// 応答を送信
-	b.sendMessage(s, m.ChannelID, response)
+	b.sendMessage(s, m.ChannelID, response.Text)
+}
+
+// recordClaudeTurn はClaude Codeの1ターンの使用量を記録する
+func (b *Bot) recordClaudeTurn(session *db.Session, user *db.User, response *ClaudeResponse) {
+	turn := &db.ClaudeTurn{
+		SessionID:    sql.NullInt64{Int64: int64(session.ID), Valid: true},
+		UserID:       sql.NullInt64{Int64: int64(user.ID), Valid: true},
+		InputTokens:  response.InputTokens,
+		OutputTokens: response.OutputTokens,
+		CostUSD:      response.CostUSD,
+		DurationMS:   response.Duration.Milliseconds(),
+		ExitStatus:   response.ExitStatus,
+	}
+
+	if _, err := b.db.CreateClaudeTurn(turn); err != nil {
+		logrus.WithError(err).WithField("session_id", session.ID).Error("Failed to record claude turn")
+	}
 }
 
 // sendMessage はメッセージを送信する
-func (b *Bot) sendMessage(s *discordgo.Session, channelID, content string) {
+func (b *Bot) sendMessage(s DiscordSession, channelID, content string) {
 	// 長いメッセージの分割処理
 	const maxLength = 2000
 	if len(content) <= maxLength {
 		_, err := s.ChannelMessageSend(channelID, content)
 		if err != nil {
+			metrics.DiscordSendFailures.Inc()
 			logrus.WithError(err).Error("Failed to send message")
 		}
 		return
@@ -291,6 +560,7 @@ func (b *Bot) sendMessage(s *discordgo.Session, channelID, content string) {
 
 		_, err := s.ChannelMessageSend(channelID, chunk)
 		if err != nil {
+			metrics.DiscordSendFailures.Inc()
 			logrus.WithError(err).Error("Failed to send message chunk")
 		}
 
@@ -300,35 +570,59 @@ func (b *Bot) sendMessage(s *discordgo.Session, channelID, content string) {
 }
 
 // sendErrorMessage はエラーメッセージを送信する
-func (b *Bot) sendErrorMessage(s *discordgo.Session, channelID, message string) {
-	errorMsg := fmt.Sprintf("❌ **エラー**\n%s", message)
-	b.sendMessage(s, channelID, errorMsg)
+func (b *Bot) sendErrorMessage(s DiscordSession, channelID, message string) {
+	b.sendRendered(s, channelID, render.Error(message))
+}
+
+// sendRendered はrenderパッケージで組み立てた埋め込み・ボタン付きのメッセージを送信する
+func (b *Bot) sendRendered(s DiscordSession, channelID string, message *discordgo.MessageSend) {
+	if _, err := s.ChannelMessageSendComplex(channelID, message); err != nil {
+		metrics.DiscordSendFailures.Inc()
+		logrus.WithError(err).Error("Failed to send message")
+	}
 }
 
 // sendHelpMessage はヘルプメッセージを送信する
-func (b *Bot) sendHelpMessage(s *discordgo.Session, channelID string) {
+func (b *Bot) sendHelpMessage(s DiscordSession, channelID string) {
 	helpMessage := `🤖 **Claude Code Bot - コマンド一覧**
 
 **基本コマンド:**
 • `+"`/claude start`"+` - 新しいClaude Codeセッションを開始
 • `+"`/claude close`"+` - 現在のセッションを終了
 • `+"`/claude status`"+` - 現在のセッション状況を確認
+• `+"`/claude export [format:markdown|json]`"+` - セッションの会話履歴をファイルで出力
+• `+"`/claude invite @ユーザー [role:viewer|collaborator]`"+` - セッションにユーザーを招待（viewer: 閲覧のみ、collaborator: 会話も可能）
 • `+"`/claude help`"+` - このヘルプを表示
 
-**オーナー専用コマンド:**
-• `+"`/claude add user <ユーザーID>`"+` - ユーザーを追加
-• `+"`/claude add owner <ユーザーID>`"+` - ユーザーをオーナーに昇格
-• `+"`/claude delete user <ユーザーID>`"+` - ユーザーを削除
-• `+"`/claude delete owner <ユーザーID>`"+` - オーナーを一般ユーザーに降格
+**管理コマンド（括弧内の権限を持つロールのみ）:**
+• `+"`/claude add user <ユーザーID> [期間]`"+` - ユーザーを追加。期間（例: `+"`30d`"+`、`+"`2w`"+`、`+"`12h`"+`）を指定すると期限付きのアクセスになる（manage_users）
+• `+"`/claude add owner <ユーザーID>`"+` - ユーザーをオーナーに昇格（manage_users）
+• `+"`/claude delete user <ユーザーID>`"+` - ユーザーを削除（manage_users）
+• `+"`/claude delete owner <ユーザーID>`"+` - オーナーを一般ユーザーに降格（manage_users）
+• `+"`/claude usage [ユーザーID] [day|week|month|all]`"+` - ユーザーごとの使用量・コストを表示（view_usage）
+• `+"`/claude limit <ユーザーID>`"+` - ユーザーの利用上限を表示（manage_config）
+• `+"`/claude limit <ユーザーID> <項目> <値|unlimited|default>`"+` - ユーザーの利用上限を設定（manage_config）
+• `+"`/claude sessions`"+` - アクティブなセッションの一覧を表示（view_all_sessions）
+• `+"`/claude kill <セッションID> [理由]`"+` - セッションを強制終了（manage_sessions）
+• `+"`/claude audit [ユーザーID] [件数]`"+` - 監査ログを表示（view_audit）
+• `+"`/claude role list`"+` - ロールと権限、Discordロールとの連携を表示（manage_config）
+• `+"`/claude role create <名前> <権限,...>`"+` - ロールを作成（manage_config）
+• `+"`/claude role set <名前> <権限,...>`"+` - ロールの権限を変更（manage_config）
+• `+"`/claude role delete <名前>`"+` - ロールを削除（manage_config）
+• `+"`/claude role assign <ユーザーID> <ロール>`"+` - ユーザーにロールを割り当て（manage_users）
+• `+"`/claude role bind <Discordロール> <ロール>`"+` - Discordロールのメンバーを自動で登録（manage_config）
+• `+"`/claude role unbind <Discordロール>`"+` - Discordロールとの連携を削除（manage_config）
+• `+"`/claude guild`"+` - このサーバーの設定を表示（manage_config）
+• `+"`/claude guild set <項目> <値|default>`"+` - サーバーのサンドボックス数・管理チャンネル・利用上限を設定（manage_config）
 
 **使用方法:**
-1. `+"`/claude start`"+` でスレッドを作成し、Claude Codeセッションを開始
-2. スレッド内でClaude Codeと自由に会話
+1. `+"`/claude start`"+` でスレッドを作成し、Claude Codeセッションを開始（BotへのDMで実行するとDM内でセッションを開始）
+2. スレッド（またはDM）内でClaude Codeと自由に会話
 3. 作業完了後は `+"`/claude close`"+` でセッション終了
 
 **注意事項:**
 • 同時に作成できるサンドボックスは最大3つまで
-• セッションは作成者のみ終了可能（オーナーは例外）
+• セッションは作成者のみ終了可能（manage_sessions 権限を持つユーザーは例外、招待されたユーザーは終了不可）
 • ファイルは一時的なもので、セッション終了時に削除されます`
 
 	b.sendMessage(s, channelID, helpMessage)
@@ -0,0 +1,537 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/config"
+	"github.com/hirano00o/disclaude/internal/db"
+	"github.com/hirano00o/disclaude/internal/k8s"
+
+	"github.com/bwmarrin/discordgo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const (
+	testGuildID   = "guild"
+	testChannelID = "100000000000000001"
+	testBotUserID = "100000000000000000"
+	testNamespace = "disclaude-test"
+)
+
+// sentMessage はフェイクのDiscordに送信されたメッセージ
+type sentMessage struct {
+	ID         string
+	ChannelID  string
+	Content    string
+	Embeds     []*discordgo.MessageEmbed
+	Files      []*discordgo.File
+	Components []discordgo.MessageComponent
+	// Ephemeral はインタラクションへの本人のみ表示の応答であることを示す
+	Ephemeral bool
+}
+
+// text はメッセージの本文と埋め込みのテキスト（タイトル・説明・フィールド）を連結して返す
+func (m *sentMessage) text() string {
+	parts := []string{m.Content}
+	for _, embed := range m.Embeds {
+		parts = append(parts, embed.Title, embed.Description)
+		for _, field := range embed.Fields {
+			parts = append(parts, field.Name, field.Value)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// fakeDiscord はDiscordSessionのフェイク実装
+// チャンネル・スレッド・ユーザーをメモリ上で管理し、送信されたメッセージを記録する
+type fakeDiscord struct {
+	mu       sync.Mutex
+	nextID   int64
+	channels map[string]*discordgo.Channel
+	users    map[string]*discordgo.User
+	members  map[string][]string
+	messages []*sentMessage
+	// threadMembers はスレッドごとに追加されたメンバーのユーザーID
+	threadMembers map[string][]string
+	// channelLookups はREST APIでチャンネルを取得した回数
+	channelLookups int
+}
+
+// newFakeDiscord は新しいfakeDiscordを作成する
+func newFakeDiscord() *fakeDiscord {
+	return &fakeDiscord{
+		nextID:   200000000000000000,
+		channels: make(map[string]*discordgo.Channel),
+		users:    make(map[string]*discordgo.User),
+		members:  make(map[string][]string),
+
+		threadMembers: make(map[string][]string),
+	}
+}
+
+// newID はスノーフレーク形式のIDを払い出す（ロック取得済みで呼び出す）
+func (f *fakeDiscord) newID() string {
+	f.nextID++
+	return fmt.Sprintf("%d", f.nextID)
+}
+
+// newMessageID は受信メッセージ用のIDを払い出す
+func (f *fakeDiscord) newMessageID() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.newID()
+}
+
+// addChannel はチャンネルを登録する
+func (f *fakeDiscord) addChannel(id string, channelType discordgo.ChannelType) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.channels[id] = &discordgo.Channel{ID: id, GuildID: testGuildID, Type: channelType}
+}
+
+// addUser はDiscordのユーザーを登録する
+func (f *fakeDiscord) addUser(id, username string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[id] = &discordgo.User{ID: id, Username: username}
+}
+
+// setMemberRoles はギルドメンバーのロールを設定する
+func (f *fakeDiscord) setMemberRoles(userID string, roleIDs ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.members[userID] = roleIDs
+}
+
+// sent はこれまでに送信されたメッセージ数を返す
+func (f *fakeDiscord) sent() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.messages)
+}
+
+// since は指定位置以降に送信されたメッセージを返す
+func (f *fakeDiscord) since(index int) []*sentMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var messages []*sentMessage
+	for _, message := range f.messages[index:] {
+		copied := *message
+		messages = append(messages, &copied)
+	}
+	return messages
+}
+
+// ChannelMessageSend はメッセージを記録する
+func (f *fakeDiscord) ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return f.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{Content: content}, options...)
+}
+
+// ChannelMessageSendComplex はメッセージと添付ファイルを記録する
+func (f *fakeDiscord) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	message := &sentMessage{
+		ID:         f.newID(),
+		ChannelID:  channelID,
+		Content:    data.Content,
+		Embeds:     data.Embeds,
+		Files:      data.Files,
+		Components: data.Components,
+	}
+	f.messages = append(f.messages, message)
+
+	return &discordgo.Message{ID: message.ID, ChannelID: channelID, Content: data.Content}, nil
+}
+
+// ChannelMessageEdit は送信済みメッセージの内容を更新する
+func (f *fakeDiscord) ChannelMessageEdit(channelID, messageID, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, message := range f.messages {
+		if message.ID == messageID && message.ChannelID == channelID {
+			message.Content = content
+			return &discordgo.Message{ID: messageID, ChannelID: channelID, Content: content}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown message %s in channel %s", messageID, channelID)
+}
+
+// MessageThreadStartComplex はスレッドを作成して登録する
+func (f *fakeDiscord) MessageThreadStartComplex(channelID, messageID string, data *discordgo.ThreadStart, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.channels[channelID]; !ok {
+		return nil, fmt.Errorf("unknown channel %s", channelID)
+	}
+
+	thread := &discordgo.Channel{
+		ID:       f.newID(),
+		GuildID:  testGuildID,
+		ParentID: channelID,
+		Name:     data.Name,
+		Type:     data.Type,
+	}
+	f.channels[thread.ID] = thread
+
+	copied := *thread
+	return &copied, nil
+}
+
+// ThreadMemberAdd はスレッドにメンバーを追加する
+func (f *fakeDiscord) ThreadMemberAdd(threadID, memberID string, options ...discordgo.RequestOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.channels[threadID]; !ok {
+		return fmt.Errorf("unknown thread %s", threadID)
+	}
+
+	f.threadMembers[threadID] = append(f.threadMembers[threadID], memberID)
+	return nil
+}
+
+// Channel は登録済みのチャンネルを返す
+func (f *fakeDiscord) Channel(channelID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.channelLookups++
+
+	channel, ok := f.channels[channelID]
+	if !ok {
+		return nil, &discordgo.RESTError{Response: &http.Response{StatusCode: http.StatusNotFound}}
+	}
+
+	copied := *channel
+	return &copied, nil
+}
+
+// ChannelEdit はスレッドのアーカイブ・ロック状態を更新する
+func (f *fakeDiscord) ChannelEdit(channelID string, data *discordgo.ChannelEdit, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	channel, ok := f.channels[channelID]
+	if !ok {
+		return nil, &discordgo.RESTError{Response: &http.Response{StatusCode: http.StatusNotFound}}
+	}
+
+	if channel.ThreadMetadata == nil {
+		channel.ThreadMetadata = &discordgo.ThreadMetadata{}
+	}
+	if data.Archived != nil {
+		channel.ThreadMetadata.Archived = *data.Archived
+	}
+	if data.Locked != nil {
+		channel.ThreadMetadata.Locked = *data.Locked
+	}
+
+	copied := *channel
+	return &copied, nil
+}
+
+// deleteChannel はチャンネルと、その中のスレッドを削除する
+func (f *fakeDiscord) deleteChannel(channelID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for id, channel := range f.channels {
+		if id == channelID || channel.ParentID == channelID {
+			delete(f.channels, id)
+		}
+	}
+}
+
+// UserChannelCreate はユーザーとのDMチャンネル（`dm-<ユーザーID>`）を返す
+func (f *fakeDiscord) UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	channel := &discordgo.Channel{ID: "dm-" + recipientID, Type: discordgo.ChannelTypeDM}
+	f.channels[channel.ID] = channel
+
+	copied := *channel
+	return &copied, nil
+}
+
+// User は登録済みのユーザーを返す
+func (f *fakeDiscord) User(userID string, options ...discordgo.RequestOption) (*discordgo.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.users[userID]
+	if !ok {
+		return nil, fmt.Errorf("unknown user %s", userID)
+	}
+
+	copied := *user
+	return &copied, nil
+}
+
+// GuildMember はロールを設定したギルドメンバーを返す（それ以外は404）
+func (f *fakeDiscord) GuildMember(guildID, userID string, options ...discordgo.RequestOption) (*discordgo.Member, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	roleIDs, ok := f.members[userID]
+	if !ok || guildID != testGuildID {
+		return nil, &discordgo.RESTError{Response: &http.Response{StatusCode: http.StatusNotFound}}
+	}
+
+	return &discordgo.Member{GuildID: guildID, User: f.users[userID], Roles: append([]string(nil), roleIDs...)}, nil
+}
+
+// GuildRoles はテスト用のギルドの @everyone ロールと、メンバーに設定したロールを返す
+func (f *fakeDiscord) GuildRoles(guildID string, options ...discordgo.RequestOption) ([]*discordgo.Role, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	roles := []*discordgo.Role{{ID: guildID, Name: "@everyone"}}
+	if guildID != testGuildID {
+		return roles, nil
+	}
+	seen := make(map[string]bool)
+	for _, roleIDs := range f.members {
+		for _, roleID := range roleIDs {
+			if !seen[roleID] {
+				seen[roleID] = true
+				roles = append(roles, &discordgo.Role{ID: roleID})
+			}
+		}
+	}
+	return roles, nil
+}
+
+// InteractionRespond はインタラクションへの応答を記録する
+// メッセージの更新は元のメッセージに反映し、それ以外は新しいメッセージとして記録する
+func (f *fakeDiscord) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch resp.Type {
+	case discordgo.InteractionResponseDeferredMessageUpdate:
+		return nil
+
+	case discordgo.InteractionResponseUpdateMessage:
+		for _, message := range f.messages {
+			if message.ID == interaction.Message.ID {
+				message.Content = resp.Data.Content
+				message.Components = resp.Data.Components
+				if resp.Data.Embeds != nil {
+					message.Embeds = resp.Data.Embeds
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown message %s", interaction.Message.ID)
+	}
+
+	f.messages = append(f.messages, &sentMessage{
+		ID:        f.newID(),
+		ChannelID: interaction.ChannelID,
+		Content:   resp.Data.Content,
+		Embeds:    resp.Data.Embeds,
+		Ephemeral: resp.Data.Flags&discordgo.MessageFlagsEphemeral != 0,
+	})
+	return nil
+}
+
+// harness はフェイクのDiscord・インメモリDB・フェイクのKubernetesでBotを動かすテスト環境
+type harness struct {
+	t         *testing.T
+	bot       *Bot
+	discord   *fakeDiscord
+	store     *db.MemoryStore
+	clientset *fake.Clientset
+	executor  *k8s.FakeExecutor
+
+	// podStatus は作成されたPodに設定するステータス
+	podStatus corev1.PodStatus
+}
+
+// newHarness は新しいテスト環境を作成する
+// 作成されたPodは既定で即座に準備完了になる（podStatusで変更できる）
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	return newHarnessWith(t, nil)
+}
+
+// newHarnessWith は設定を変更してテストハーネスを作成する
+func newHarnessWith(t *testing.T, configure func(*config.Config)) *harness {
+	t.Helper()
+
+	h := &harness{
+		t:         t,
+		discord:   newFakeDiscord(),
+		store:     db.NewMemoryStore(3),
+		clientset: fake.NewSimpleClientset(),
+		executor:  k8s.NewFakeExecutor(),
+		podStatus: corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{Name: "claude-code", Ready: true}},
+		},
+	}
+
+	h.clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Status = h.podStatus
+		return false, nil, nil
+	})
+
+	cfg := &config.Config{
+		Kubernetes: config.KubernetesConfig{Namespace: testNamespace, MaxSandboxes: 3},
+		Claude:     config.ClaudeConfig{ConfigPath: "/home/user/.claude"},
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+	sandboxManager := k8s.NewSandboxManager(h.clientset, h.executor, testNamespace, h.store, cfg)
+	h.bot = newBot(cfg, h.store, h.discord, sandboxManager)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := sandboxManager.Start(ctx); err != nil {
+		t.Fatalf("Failed to start sandbox manager: %v", err)
+	}
+
+	h.discord.addChannel(testChannelID, discordgo.ChannelTypeGuildText)
+
+	return h
+}
+
+// addUser はDiscordとデータベースの両方にユーザーを登録する（テスト用のギルドに所属させる）
+func (h *harness) addUser(discordID, username, role string) *db.User {
+	h.t.Helper()
+	return h.addGuildUser(testGuildID, discordID, username, role)
+}
+
+// addGuildUser はDiscordとデータベースの両方にユーザーを登録し、指定したギルドに所属させる
+func (h *harness) addGuildUser(guildID, discordID, username, role string) *db.User {
+	h.t.Helper()
+
+	h.discord.addUser(discordID, username)
+	if _, err := h.store.UpsertGuild(guildID, guildID); err != nil {
+		h.t.Fatalf("Failed to register guild %s: %v", guildID, err)
+	}
+	user, err := h.store.CreateUser(guildID, discordID, username, role)
+	if err != nil {
+		h.t.Fatalf("Failed to create user %s: %v", username, err)
+	}
+
+	return user
+}
+
+// send はギルドのチャンネルでメッセージを受信させ、Botが送信したメッセージを返す
+func (h *harness) send(authorID, channelID, content string) []*sentMessage {
+	return h.dispatch(authorID, channelID, testGuildID, content)
+}
+
+// sendDM はDMでメッセージを受信させ、Botが送信したメッセージを返す
+func (h *harness) sendDM(authorID, content string) []*sentMessage {
+	return h.dispatch(authorID, "dm-"+authorID, "", content)
+}
+
+// dispatch はMessageCreateイベントをBotに渡す
+func (h *harness) dispatch(authorID, channelID, guildID, content string) []*sentMessage {
+	h.t.Helper()
+
+	username := authorID
+	if user, err := h.discord.User(authorID); err == nil {
+		username = user.Username
+	}
+
+	index := h.discord.sent()
+	h.bot.handleMessage(h.discord, testBotUserID, &discordgo.MessageCreate{
+		Message: &discordgo.Message{
+			ID:        h.discord.newMessageID(),
+			ChannelID: channelID,
+			GuildID:   guildID,
+			Content:   content,
+			Author:    &discordgo.User{ID: authorID, Username: username},
+		},
+	})
+
+	return h.discord.since(index)
+}
+
+// click はメッセージのボタンを押すインタラクションをBotに渡し、Botが送信・更新したメッセージを返す
+func (h *harness) click(authorID string, message *sentMessage, customID string) []*sentMessage {
+	h.t.Helper()
+
+	index := h.discord.sent()
+	h.bot.handleInteraction(h.discord, &discordgo.InteractionCreate{
+		Interaction: &discordgo.Interaction{
+			ID:        h.discord.newMessageID(),
+			Type:      discordgo.InteractionMessageComponent,
+			ChannelID: message.ChannelID,
+			GuildID:   testGuildID,
+			Member:    &discordgo.Member{User: &discordgo.User{ID: authorID}},
+			Message:   &discordgo.Message{ID: message.ID, ChannelID: message.ChannelID, Content: message.Content, Embeds: message.Embeds},
+			Data:      discordgo.MessageComponentInteractionData{CustomID: customID, ComponentType: discordgo.ButtonComponent},
+		},
+	})
+
+	return h.discord.since(index)
+}
+
+// session はスレッドのセッションを返す
+func (h *harness) session(threadID string) *db.Session {
+	h.t.Helper()
+
+	session, err := h.store.GetSessionByThreadID(threadID)
+	if err != nil {
+		h.t.Fatalf("Failed to get session: %v", err)
+	}
+
+	return session
+}
+
+// waitForMessage は非同期に送信されるメッセージを待機する
+func (h *harness) waitForMessage(channelID, substr string) *sentMessage {
+	h.t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, message := range h.discord.since(0) {
+			if message.ChannelID == channelID && strings.Contains(message.text(), substr) {
+				return message
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return expectMessage(h.t, h.discord.since(0), channelID, substr)
+}
+
+// expectMessage は指定チャンネルに指定文字列を含むメッセージが送信されたことを検証する
+func expectMessage(t *testing.T, messages []*sentMessage, channelID, substr string) *sentMessage {
+	t.Helper()
+
+	for _, message := range messages {
+		if message.ChannelID == channelID && strings.Contains(message.text(), substr) {
+			return message
+		}
+	}
+
+	var got []string
+	for _, message := range messages {
+		got = append(got, fmt.Sprintf("[%s] %s", message.ChannelID, message.text()))
+	}
+	t.Fatalf("Expected message containing %q in channel %s, got:\n%s", substr, channelID, strings.Join(got, "\n---\n"))
+	return nil
+}
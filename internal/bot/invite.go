@@ -0,0 +1,126 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hirano00o/disclaude/internal/auth"
+	"github.com/hirano00o/disclaude/internal/db"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+)
+
+// sessionMemberLabels はセッションに招待されたユーザーのロールの表示名
+var sessionMemberLabels = map[string]string{
+	db.SessionMemberViewer:       "閲覧者（viewer）",
+	db.SessionMemberCollaborator: "共同作業者（collaborator）",
+}
+
+// handleInviteCommand は `/claude invite @user [role:viewer|collaborator]` コマンドを処理する
+// 招待されたユーザーはロールに応じてセッションの閲覧・会話ができるが、セッションの終了はできない
+func (b *Bot) handleInviteCommand(s DiscordSession, m *discordgo.MessageCreate, user *db.User, args []string) {
+	usage := "使用方法: `/claude invite @ユーザー [role:viewer|collaborator]`"
+	if len(args) == 0 || len(args) > 2 {
+		b.sendErrorMessage(s, m.ChannelID, usage)
+		return
+	}
+
+	// 招待するロールの解析（省略時は会話も可能なcollaborator）
+	role := db.SessionMemberCollaborator
+	if len(args) == 2 {
+		role = strings.ToLower(strings.TrimPrefix(args[1], "role:"))
+	}
+
+	if _, ok := sessionMemberLabels[role]; !ok {
+		b.sendErrorMessage(s, m.ChannelID, usage)
+		return
+	}
+
+	// DMのセッションは本人専用のため共有できない
+	if m.GuildID == "" {
+		b.sendErrorMessage(s, m.ChannelID, "DMのセッションは共有できません。共有する場合はサーバーのチャンネルで `/claude start` を実行してください")
+		return
+	}
+
+	targetID := parseUserMention(args[0])
+	if len(targetID) < 15 || len(targetID) > 20 {
+		b.sendErrorMessage(s, m.ChannelID, "無効なユーザーIDです")
+		return
+	}
+
+	// セッションの取得
+	session, err := b.db.GetSessionByThreadID(m.ChannelID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get session")
+		b.sendErrorMessage(s, m.ChannelID, "セッション情報の取得に失敗しました")
+		return
+	}
+
+	if session == nil {
+		b.sendErrorMessage(s, m.ChannelID, "このチャンネルにはアクティブなセッションが存在しません")
+		return
+	}
+
+	if !session.IsActive() {
+		b.sendErrorMessage(s, m.ChannelID, "このセッションは既に終了しています")
+		return
+	}
+
+	// セッション所有者または manage_sessions 権限を持つユーザーのみ招待可能（招待されたユーザーは招待できない）
+	if err := b.permService.AuthorizeSession(user, session, ""); err != nil {
+		if !auth.IsPermissionDenied(err) {
+			logrus.WithError(err).Error("Failed to check permission")
+			b.sendErrorMessage(s, m.ChannelID, "権限確認中にエラーが発生しました")
+			return
+		}
+		b.sendErrorMessage(s, m.ChannelID, "このセッションにユーザーを招待する権限がありません")
+		return
+	}
+
+	targetUser, err := b.userService.GetUser(user.GuildID.String, targetID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get target user")
+		b.sendErrorMessage(s, m.ChannelID, "ユーザー情報の取得に失敗しました")
+		return
+	}
+
+	if targetUser == nil {
+		b.sendErrorMessage(s, m.ChannelID, "指定されたユーザーはこのサーバーに登録されていません")
+		return
+	}
+
+	if targetUser.ID == session.OwnerUserID() {
+		b.sendErrorMessage(s, m.ChannelID, "セッションの所有者は招待できません")
+		return
+	}
+
+	if _, err := b.db.UpsertSessionMember(session.ID, targetUser.ID, role, user.ID); err != nil {
+		logrus.WithError(err).Error("Failed to invite session member")
+		b.sendErrorMessage(s, m.ChannelID, "ユーザーの招待に失敗しました")
+		return
+	}
+
+	// スレッドに参加させて通知が届くようにする（失敗しても招待は有効）
+	if err := s.ThreadMemberAdd(session.ThreadID, targetUser.DiscordID); err != nil {
+		logrus.WithError(err).WithField("thread_id", session.ThreadID).Warn("Failed to add thread member")
+	}
+
+	b.audit.RecordSessionInvite(user, targetUser, session, role)
+
+	logrus.WithFields(logrus.Fields{
+		"requester_id": user.ID,
+		"target_id":    targetUser.ID,
+		"session_id":   session.ID,
+		"member_role":  role,
+	}).Info("Session member invited successfully")
+
+	inviteMessage := fmt.Sprintf("✅ <@%s> さんを **%s** としてこのセッションに招待しました\n", targetUser.DiscordID, sessionMemberLabels[role])
+	if role == db.SessionMemberCollaborator {
+		inviteMessage += "このスレッドでClaude Codeと会話できます（セッションの終了はできません）"
+	} else {
+		inviteMessage += "会話の閲覧と `/claude export` による会話履歴の出力ができます（Claude Codeとの会話はできません）"
+	}
+
+	b.sendMessage(s, m.ChannelID, inviteMessage)
+}
@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hirano00o/disclaude/internal/k8s"
+)
+
+// sandboxPreparingMessage はサンドボックス準備中メッセージの見出し
+const sandboxPreparingMessage = "⏳ **サンドボックスの準備中...**"
+
+// podReasonDescriptions はKubernetesが報告する理由の説明
+var podReasonDescriptions = map[string]string{
+	"Unschedulable":              "割り当て可能なノードがありません。リソースが空くまで待機しています",
+	"ContainerCreating":          "コンテナを作成しています",
+	"PodInitializing":            "Podを初期化しています",
+	"ImagePullBackOff":           "コンテナイメージを取得できません",
+	"ErrImagePull":               "コンテナイメージの取得に失敗しました。再試行しています",
+	"InvalidImageName":           "コンテナイメージ名が不正です",
+	"CrashLoopBackOff":           "コンテナが起動直後の異常終了を繰り返しています",
+	"CreateContainerConfigError": "コンテナの設定（Secret/ConfigMap）を読み込めません",
+	"CreateContainerError":       "コンテナの作成に失敗しました。再試行しています",
+	"OOMKilled":                  "メモリ不足でコンテナが強制終了されました",
+	"Evicted":                    "ノードのリソース不足によりPodが退避されました",
+	"Deleted":                    "Podが削除されました",
+	"Terminating":                "Podが削除中です",
+}
+
+// describePodReason は理由の説明を返す
+func describePodReason(progress k8s.PodProgress) string {
+	description, ok := podReasonDescriptions[progress.Reason]
+	if !ok {
+		description = progress.Reason
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s（`%s`）", description, progress.Reason)
+	if progress.Message != "" {
+		fmt.Fprintf(&b, "\n> %s", progress.Message)
+	}
+	return b.String()
+}
+
+// formatSandboxProgress はサンドボックスの準備状況を表すメッセージを作成する
+func formatSandboxProgress(progress k8s.PodProgress) string {
+	switch progress.State {
+	case k8s.PodStateReady:
+		return "✅ **サンドボックスの準備完了**"
+	case k8s.PodStateFailed:
+		return "❌ **サンドボックスの準備に失敗しました**\n" + describePodReason(progress)
+	case k8s.PodStateUnschedulable:
+		return sandboxPreparingMessage + "\n⚠️ " + describePodReason(progress)
+	case k8s.PodStateScheduling:
+		return sandboxPreparingMessage + "\nノードへの割り当てを待機しています"
+	}
+
+	if progress.Reason == "" {
+		return sandboxPreparingMessage + "\nコンテナを起動しています"
+	}
+	return sandboxPreparingMessage + "\n" + describePodReason(progress)
+}
+
+// formatSandboxWaitError はサンドボックスの準備待ちが失敗した場合のメッセージを作成する
+// 最後に観測した準備状況があれば、タイムアウトの原因として併せて表示する
+func formatSandboxWaitError(err error, last k8s.PodProgress) string {
+	var failed *k8s.PodFailedError
+	if errors.As(err, &failed) {
+		return formatSandboxProgress(failed.Progress)
+	}
+
+	message := "❌ **サンドボックスの準備に失敗しました**"
+	if strings.Contains(err.Error(), "timeout") {
+		message = "❌ **サンドボックスの準備がタイムアウトしました**"
+	}
+	if last.Reason != "" {
+		message += "\n最後の状態: " + describePodReason(last)
+	}
+	return message
+}
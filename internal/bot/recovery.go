@@ -0,0 +1,252 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/auth"
+	"github.com/hirano00o/disclaude/internal/db"
+	"github.com/hirano00o/disclaude/internal/k8s"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+)
+
+// recreateSandboxButtonPrefix はサンドボックス再作成ボタンのカスタムIDの接頭辞（後ろにセッションIDが続く）
+const recreateSandboxButtonPrefix = "recreate_sandbox:"
+
+// handleSandboxFailure はセッション中にサンドボックスが停止したことをスレッドに通知する
+// サンドボックスの失敗状態への更新と枠の解放はSandboxManagerが行う
+func (b *Bot) handleSandboxFailure(failure k8s.SandboxFailure) {
+	if !b.beginInflight() {
+		return
+	}
+	defer b.inflight.Done()
+
+	logger := logrus.WithFields(logrus.Fields{
+		"session_id": failure.Sandbox.SessionID,
+		"pod_name":   failure.Sandbox.PodName,
+		"reason":     failure.Progress.Reason,
+	})
+
+	session, err := b.db.GetSessionByID(failure.Sandbox.SessionID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to get session for failed sandbox")
+		return
+	}
+
+	// 終了処理中などアクティブでないセッションには通知しない
+	if session == nil || !session.IsActive() {
+		return
+	}
+
+	if err := b.db.UpdateSessionStatus(session.ID, "failed"); err != nil {
+		logger.WithError(err).Error("Failed to update session status")
+	}
+
+	mention := ""
+	if owner, err := b.db.GetUserByID(session.OwnerUserID()); err == nil && owner != nil {
+		mention = fmt.Sprintf("<@%s> ", owner.DiscordID)
+	}
+
+	content := fmt.Sprintf(`⚠️ **サンドボックスが予期せず停止しました**
+%s理由: %s
+
+このセッションは停止しました。サンドボックス内のファイルは失われています。
+下のボタンから、このスレッドでサンドボックスを再作成できます。`, mention, describePodReason(failure.Progress))
+
+	_, err = b.discord.ChannelMessageSendComplex(session.ThreadID, &discordgo.MessageSend{
+		Content: content,
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "サンドボックスを再作成",
+						Style:    discordgo.PrimaryButton,
+						CustomID: fmt.Sprintf("%s%d", recreateSandboxButtonPrefix, session.ID),
+						Emoji:    discordgo.ComponentEmoji{Name: "🔄"},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to send sandbox failure notice")
+	}
+
+	logger.Info("Session stopped due to sandbox failure")
+}
+
+// interactionHandler はボタンなどのインタラクションのハンドラー
+func (b *Bot) interactionHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	b.handleInteraction(s, i)
+}
+
+// handleInteraction はインタラクションを処理する
+func (b *Bot) handleInteraction(s DiscordSession, i *discordgo.InteractionCreate) {
+	if !b.beginInflight() {
+		return
+	}
+	defer b.inflight.Done()
+
+	if i.Type != discordgo.InteractionMessageComponent {
+		return
+	}
+
+	customID := i.MessageComponentData().CustomID
+	if strings.HasPrefix(customID, recreateSandboxButtonPrefix) {
+		sessionID, err := strconv.Atoi(strings.TrimPrefix(customID, recreateSandboxButtonPrefix))
+		if err != nil {
+			b.respondEphemeral(s, i, "不正なボタンです")
+			return
+		}
+		b.handleRecreateSandbox(s, i, sessionID)
+		return
+	}
+
+	b.handleSessionAction(s, i, customID)
+}
+
+// handleRecreateSandbox は停止したセッションのサンドボックスを再作成する
+func (b *Bot) handleRecreateSandbox(s DiscordSession, i *discordgo.InteractionCreate, sessionID int) {
+	user, session, ok := b.interactionSession(s, i, sessionID)
+	if !ok {
+		return
+	}
+
+	// セッション所有者または manage_sessions 権限を持つユーザーのみ再作成可能
+	if err := b.permService.Authorize(user, auth.CapabilityCreateSandbox, session); err != nil {
+		if !auth.IsPermissionDenied(err) {
+			logrus.WithError(err).Error("Failed to check permission")
+			b.respondEphemeral(s, i, "権限確認中にエラーが発生しました")
+			return
+		}
+		b.respondEphemeral(s, i, "このセッションを操作する権限がありません")
+		return
+	}
+
+	if session.Status != "failed" {
+		b.respondEphemeral(s, i, "このセッションはサンドボックスを再作成できる状態ではありません")
+		return
+	}
+
+	// セッションがアクティブに戻るまで枠を確保する
+	releaseQuota, err := b.permService.ReserveSession(user.ID)
+	if err != nil {
+		b.respondEphemeral(s, i, err.Error())
+		return
+	}
+	defer releaseQuota()
+
+	if _, loaded := b.recreating.LoadOrStore(session.ID, struct{}{}); loaded {
+		b.respondEphemeral(s, i, "サンドボックスを再作成中です")
+		return
+	}
+	defer b.recreating.Delete(session.ID)
+
+	// ボタンを取り除き、再作成の開始を表示する
+	content := fmt.Sprintf("%s\n\n🔄 %sさんがサンドボックスの再作成を開始しました", i.Message.Content, user.Username)
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to respond to interaction")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	sandbox, err := b.sandboxManager.RecreateSandbox(ctx, session.ID, session.SandboxName, session.ThreadID)
+	if err != nil {
+		logrus.WithError(err).WithField("session_id", session.ID).Error("Failed to recreate sandbox")
+		b.sendErrorMessage(s, session.ThreadID, fmt.Sprintf("サンドボックスの再作成に失敗しました: %v", err))
+		return
+	}
+
+	if !b.waitForSandbox(ctx, s, session.ThreadID, session, sandbox) {
+		return
+	}
+
+	if err := b.db.UpdateSessionStatus(session.ID, "active"); err != nil {
+		logrus.WithError(err).Error("Failed to update session status")
+		b.sendErrorMessage(s, session.ThreadID, "セッションの再開に失敗しました")
+		return
+	}
+
+	b.sendMessage(s, session.ThreadID, "✅ **サンドボックスを再作成しました**\nこのスレッドで引き続きClaude Codeと会話できます。以前のファイルは復元されていません。")
+
+	logrus.WithFields(logrus.Fields{
+		"user_id":      user.ID,
+		"session_id":   session.ID,
+		"thread_id":    session.ThreadID,
+		"sandbox_name": sandbox.PodName,
+	}).Info("Sandbox recreated after failure")
+}
+
+// interactionSession はボタンを押したユーザーと操作対象のセッションを取得する
+// 取得できない場合は操作したユーザーにエラーで応答し、falseを返す
+func (b *Bot) interactionSession(s DiscordSession, i *discordgo.InteractionCreate, sessionID int) (*db.User, *db.Session, bool) {
+	actor := interactionUser(i)
+	if actor == nil {
+		return nil, nil, false
+	}
+
+	user, err := b.resolveUser(i.GuildID, actor.ID, actor.Username)
+	if errors.Is(err, auth.ErrAmbiguousGuild) {
+		b.respondEphemeral(s, i, ambiguousGuildUserMessage)
+		return nil, nil, false
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get user")
+		b.respondEphemeral(s, i, "ユーザー情報の取得に失敗しました")
+		return nil, nil, false
+	}
+	if user == nil {
+		b.respondEphemeral(s, i, "ユーザーが登録されていません")
+		return nil, nil, false
+	}
+
+	session, err := b.db.GetSessionByID(sessionID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get session")
+		b.respondEphemeral(s, i, "セッション情報の取得に失敗しました")
+		return nil, nil, false
+	}
+	if session == nil {
+		b.respondEphemeral(s, i, "セッションが見つかりません")
+		return nil, nil, false
+	}
+
+	return user, session, true
+}
+
+// interactionUser はインタラクションを実行したユーザーを返す
+// ギルド内ではMember、DMではUserに設定される
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// respondEphemeral は操作したユーザーにのみ表示されるエラーで応答する
+func (b *Bot) respondEphemeral(s DiscordSession, i *discordgo.InteractionCreate, message string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: fmt.Sprintf("❌ **エラー**\n%s", message),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to respond to interaction")
+	}
+}
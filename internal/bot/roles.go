@@ -0,0 +1,473 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hirano00o/disclaude/internal/auth"
+	"github.com/hirano00o/disclaude/internal/db"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+)
+
+// MemberRoleIDs はギルドメンバーが持つDiscordのロールIDを返す（auth.MemberRoleResolverの実装）
+// ギルドのメンバーでない場合は空のスライスを返す
+func (b *Bot) MemberRoleIDs(guildID, discordID string) ([]string, error) {
+	member, err := b.discord.GuildMember(guildID, discordID)
+	if err != nil {
+		var restErr *discordgo.RESTError
+		if errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get guild member: %w", err)
+	}
+
+	return member.Roles, nil
+}
+
+// resolveUser はDiscordユーザーに対応する登録済みユーザーを返す（未登録の場合はnil）
+// guildIDはメッセージを受信したギルドで、ユーザーはギルドごとに登録される
+// DMの場合は空文字列を渡し、DISCORD_GUILD_ID のギルドまたは唯一登録されているギルドのユーザーとして扱う（複数のギルドに登録されていて特定できない場合は auth.ErrAmbiguousGuild を返す）
+// ギルドに属さないユーザーは最初に利用したギルドに所属させ、明示的に登録されていないユーザーは、ギルドロールから登録・ロールの同期を行う
+func (b *Bot) resolveUser(guildID, discordID, username string) (*db.User, error) {
+	if guildID == "" {
+		home, err := auth.FindHomeUser(b.db, b.config.Discord.GuildID, discordID)
+		if err != nil {
+			return nil, err
+		}
+		guildID = b.config.Discord.GuildID
+		if home != nil && home.GuildID.Valid {
+			guildID = home.GuildID.String
+		}
+		if guildID == "" {
+			return home, nil
+		}
+	}
+
+	if err := b.ensureGuild(guildID); err != nil {
+		return nil, err
+	}
+
+	user, err := b.userService.GetUser(guildID, discordID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		unscoped, err := b.userService.GetUser("", discordID)
+		if err != nil {
+			return nil, err
+		}
+		if unscoped != nil {
+			if err := b.db.AssignUserToGuild(discordID, guildID); err != nil {
+				return nil, fmt.Errorf("failed to assign user to guild: %w", err)
+			}
+			unscoped.GuildID = sql.NullString{String: guildID, Valid: true}
+			user = unscoped
+		}
+	}
+
+	if user != nil && !user.IsGuildRoleUser() {
+		return user, nil
+	}
+
+	role, err := b.permService.ResolveGuildRole(guildID, discordID)
+	if err != nil {
+		logrus.WithError(err).WithField("discord_id", discordID).Warn("Failed to resolve guild role")
+		return user, nil
+	}
+
+	return b.userService.SyncGuildRoleUser(guildID, discordID, username, role)
+}
+
+// roleNamePattern はロール名として使用できる形式
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// handleRoleCommand は `/claude role <list|create|set|delete|assign|bind|unbind>` コマンドを処理する
+func (b *Bot) handleRoleCommand(s DiscordSession, m *discordgo.MessageCreate, user *db.User, args []string) {
+	usage := "使用方法: `/claude role list`、`/claude role create <名前> <権限,...> [説明]`、`/claude role set <名前> <権限,...>`、`/claude role delete <名前>`、`/claude role assign <ユーザーID> <ロール>`、`/claude role bind <Discordロール> <ロール>`、`/claude role unbind <Discordロール>`"
+	if len(args) == 0 {
+		b.sendErrorMessage(s, m.ChannelID, usage)
+		return
+	}
+
+	// 権限チェック（ロールの割り当てはユーザー管理、それ以外は設定の変更として扱う）
+	capability := auth.CapabilityManageConfig
+	if args[0] == "assign" {
+		capability = auth.CapabilityManageUsers
+	}
+	if err := b.permService.Authorize(user, capability, nil); err != nil {
+		b.sendErrorMessage(s, m.ChannelID, err.Error())
+		return
+	}
+
+	if (args[0] == "bind" || args[0] == "unbind") && !user.GuildID.Valid {
+		b.sendErrorMessage(s, m.ChannelID, "ロール連携は、サーバーに所属するユーザーのみ設定できます")
+		return
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		b.sendRoles(s, m.ChannelID, user.GuildID.String)
+	case args[0] == "create" && len(args) >= 3:
+		b.createRole(s, m, user, args[1], args[2], strings.Join(args[3:], " "))
+	case args[0] == "set" && len(args) == 3:
+		b.setRoleCapabilities(s, m, user, args[1], args[2])
+	case args[0] == "delete" && len(args) == 2:
+		b.deleteRole(s, m, user, args[1])
+	case args[0] == "assign" && len(args) == 3:
+		b.assignRole(s, m, user, parseUserMention(args[1]), args[2])
+	case args[0] == "bind" && len(args) == 3:
+		b.bindRole(s, m, user, parseRoleMention(args[1]), args[2])
+	case args[0] == "unbind" && len(args) == 2:
+		b.unbindRole(s, m, user, parseRoleMention(args[1]))
+	default:
+		b.sendErrorMessage(s, m.ChannelID, usage)
+	}
+}
+
+// sendRoles はguildIDのギルドで使用できるロールの定義とギルドロールの対応の一覧を送信する
+// ロールのメンションは通知が飛ぶため、ロールIDで表示する
+func (b *Bot) sendRoles(s DiscordSession, channelID, guildID string) {
+	roles, err := b.db.ListRoles()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list roles")
+		b.sendErrorMessage(s, channelID, "ロールの取得に失敗しました")
+		return
+	}
+
+	rolesMessage := "🔑 **ロール**\n"
+	for _, role := range roles {
+		if !role.AvailableIn(guildID) {
+			continue
+		}
+		name := role.Name
+		if role.Builtin {
+			name += "（組み込み）"
+		}
+		capabilities := strings.Join(role.Capabilities, ", ")
+		if capabilities == "" {
+			capabilities = "なし"
+		}
+		rolesMessage += fmt.Sprintf("\n• **%s**: %s", name, capabilities)
+		if role.Description != "" {
+			rolesMessage += " - " + role.Description
+		}
+	}
+
+	if guildID != "" {
+		bindings, err := b.db.ListRoleBindings()
+		if err != nil {
+			logrus.WithError(err).Error("Failed to list role bindings")
+			b.sendErrorMessage(s, channelID, "ロール連携の取得に失敗しました")
+			return
+		}
+
+		rolesMessage += "\n\n🔗 **ロール連携**\n"
+		bound := 0
+		for _, binding := range bindings {
+			if binding.GuildID.String != guildID {
+				continue
+			}
+			bound++
+			rolesMessage += fmt.Sprintf("\n• Discordロール `%s` → %s", binding.DiscordRoleID, binding.Role)
+		}
+		if bound == 0 {
+			rolesMessage += "\n対応付けられたロールはありません"
+		}
+		rolesMessage += "\n\n`/claude add` などで明示的に登録したユーザーは、ロール連携より登録内容が優先されます"
+	}
+
+	b.sendMessage(s, channelID, rolesMessage)
+}
+
+// createRole は指定した権限を持つロールを作成する
+func (b *Bot) createRole(s DiscordSession, m *discordgo.MessageCreate, user *db.User, name, capabilityList, description string) {
+	if !roleNamePattern.MatchString(name) {
+		b.sendErrorMessage(s, m.ChannelID, "ロール名は英小文字で始まる32文字以内の英小文字・数字・`_`・`-`で指定してください")
+		return
+	}
+
+	capabilities, err := parseCapabilities(capabilityList)
+	if err != nil {
+		b.sendErrorMessage(s, m.ChannelID, err.Error())
+		return
+	}
+
+	existing, err := b.db.GetRoleByName(user.GuildID.String, name)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get role")
+		b.sendErrorMessage(s, m.ChannelID, "ロールの取得に失敗しました")
+		return
+	}
+	if existing != nil {
+		b.sendErrorMessage(s, m.ChannelID, fmt.Sprintf("ロール `%s` は既に存在します", name))
+		return
+	}
+
+	role, err := b.db.CreateRole(user.GuildID.String, name, description, capabilities)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create role")
+		b.sendErrorMessage(s, m.ChannelID, "ロールの作成に失敗しました")
+		return
+	}
+
+	b.permService.InvalidateGuildRoleCache()
+	b.audit.RecordRoleDefinition(auth.AuditRoleCreate, user, role.Name, role.Capabilities)
+
+	b.sendMessage(s, m.ChannelID, fmt.Sprintf("✅ ロール **%s** を作成しました（権限: %s）", role.Name, strings.Join(role.Capabilities, ", ")))
+}
+
+// setRoleCapabilities はロールの権限を置き換える（組み込みロールは変更できない）
+func (b *Bot) setRoleCapabilities(s DiscordSession, m *discordgo.MessageCreate, user *db.User, name, capabilityList string) {
+	capabilities, err := parseCapabilities(capabilityList)
+	if err != nil {
+		b.sendErrorMessage(s, m.ChannelID, err.Error())
+		return
+	}
+
+	role, ok := b.lookupCustomRole(s, m.ChannelID, user.GuildID.String, name)
+	if !ok {
+		return
+	}
+
+	if err := b.db.SetRoleCapabilities(role.GuildID.String, role.Name, capabilities); err != nil {
+		logrus.WithError(err).Error("Failed to set role capabilities")
+		b.sendErrorMessage(s, m.ChannelID, "ロールの権限の変更に失敗しました")
+		return
+	}
+
+	updated, err := b.db.GetRoleByName(role.GuildID.String, role.Name)
+	if err != nil || updated == nil {
+		logrus.WithError(err).Error("Failed to get role")
+		b.sendErrorMessage(s, m.ChannelID, "ロールの取得に失敗しました")
+		return
+	}
+
+	b.permService.InvalidateGuildRoleCache()
+	b.audit.RecordRoleDefinition(auth.AuditRoleUpdate, user, updated.Name, updated.Capabilities)
+
+	b.sendMessage(s, m.ChannelID, fmt.Sprintf("✅ ロール **%s** の権限を変更しました（権限: %s）", updated.Name, strings.Join(updated.Capabilities, ", ")))
+}
+
+// deleteRole はロールを削除する（組み込みロールと使用中のロールは削除できない）
+func (b *Bot) deleteRole(s DiscordSession, m *discordgo.MessageCreate, user *db.User, name string) {
+	role, ok := b.lookupCustomRole(s, m.ChannelID, user.GuildID.String, name)
+	if !ok {
+		return
+	}
+
+	users, err := b.db.ListUsers()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list users")
+		b.sendErrorMessage(s, m.ChannelID, "ユーザー一覧の取得に失敗しました")
+		return
+	}
+	assigned := 0
+	for _, u := range users {
+		if u.Role == role.Name && u.InGuild(role.GuildID.String) {
+			assigned++
+		}
+	}
+	if assigned > 0 {
+		b.sendErrorMessage(s, m.ChannelID, fmt.Sprintf("ロール **%s** は %d 人のユーザーに割り当てられているため削除できません", role.Name, assigned))
+		return
+	}
+
+	bindings, err := b.db.ListRoleBindings()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list role bindings")
+		b.sendErrorMessage(s, m.ChannelID, "ロール連携の取得に失敗しました")
+		return
+	}
+	for _, binding := range bindings {
+		if binding.Role == role.Name && binding.GuildID.String == role.GuildID.String {
+			b.sendErrorMessage(s, m.ChannelID, fmt.Sprintf("ロール **%s** はDiscordロール `%s` と連携されているため削除できません", role.Name, binding.DiscordRoleID))
+			return
+		}
+	}
+
+	if err := b.db.DeleteRole(role.GuildID.String, role.Name); err != nil {
+		logrus.WithError(err).Error("Failed to delete role")
+		b.sendErrorMessage(s, m.ChannelID, "ロールの削除に失敗しました")
+		return
+	}
+
+	b.permService.InvalidateGuildRoleCache()
+	b.audit.RecordRoleDefinition(auth.AuditRoleDelete, user, role.Name, role.Capabilities)
+
+	b.sendMessage(s, m.ChannelID, fmt.Sprintf("✅ ロール **%s** を削除しました", role.Name))
+}
+
+// lookupCustomRole はguildIDのギルドで変更可能なロールを取得し、存在しない場合や組み込みロールの場合はエラーを送信する
+func (b *Bot) lookupCustomRole(s DiscordSession, channelID, guildID, name string) (*db.Role, bool) {
+	role, err := b.db.GetRoleByName(guildID, name)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get role")
+		b.sendErrorMessage(s, channelID, "ロールの取得に失敗しました")
+		return nil, false
+	}
+	if role == nil || !role.AvailableIn(guildID) {
+		b.sendErrorMessage(s, channelID, fmt.Sprintf("ロール `%s` は定義されていません", name))
+		return nil, false
+	}
+	if role.Builtin {
+		b.sendErrorMessage(s, channelID, "組み込みロールは変更・削除できません")
+		return nil, false
+	}
+
+	return role, true
+}
+
+// assignRole はユーザーにロールを割り当てる
+func (b *Bot) assignRole(s DiscordSession, m *discordgo.MessageCreate, user *db.User, targetID, role string) {
+	if len(targetID) < 15 || len(targetID) > 20 {
+		b.sendErrorMessage(s, m.ChannelID, "無効なユーザーIDです")
+		return
+	}
+
+	targetUser, err := b.userService.GetUser(user.GuildID.String, targetID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get target user")
+		b.sendErrorMessage(s, m.ChannelID, "ユーザー情報の取得に失敗しました")
+		return
+	}
+
+	if targetUser == nil {
+		b.sendErrorMessage(s, m.ChannelID, "指定されたユーザーはこのサーバーに登録されていません")
+		return
+	}
+
+	if err := b.userService.AssignRole(user.GuildID.String, user.DiscordID, targetID, role); err != nil {
+		logrus.WithError(err).Error("Failed to assign role")
+		b.sendErrorMessage(s, m.ChannelID, fmt.Sprintf("ロールの割り当てに失敗しました: %v", err))
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"requester_id": user.ID,
+		"target_id":    targetUser.ID,
+		"target_role":  role,
+	}).Info("Role assigned successfully")
+
+	b.sendMessage(s, m.ChannelID, fmt.Sprintf("✅ **%s** さんにロール **%s** を割り当てました", targetUser.Username, role))
+}
+
+// bindRole はギルドロールにBotのロールを対応付ける
+// 対応付けられるのはユーザーが所属するギルドのロールのみで、すべてのメンバーが持つ @everyone ロールは対応付けられない
+func (b *Bot) bindRole(s DiscordSession, m *discordgo.MessageCreate, user *db.User, roleID, role string) {
+	if len(roleID) < 15 || len(roleID) > 20 {
+		b.sendErrorMessage(s, m.ChannelID, "無効なロールIDです")
+		return
+	}
+
+	// @everyone ロールのIDはギルドIDと同じ
+	if roleID == user.GuildID.String {
+		b.sendErrorMessage(s, m.ChannelID, "@everyone ロールは連携できません")
+		return
+	}
+
+	guildRoles, err := s.GuildRoles(user.GuildID.String)
+	if err != nil {
+		logrus.WithError(err).WithField("guild_id", user.GuildID.String).Error("Failed to get guild roles")
+		b.sendErrorMessage(s, m.ChannelID, "Discordロールの取得に失敗しました")
+		return
+	}
+	if !slices.ContainsFunc(guildRoles, func(guildRole *discordgo.Role) bool { return guildRole.ID == roleID }) {
+		b.sendErrorMessage(s, m.ChannelID, fmt.Sprintf("Discordロール `%s` はこのサーバーに存在しません", roleID))
+		return
+	}
+
+	definition, err := b.db.GetRoleByName(user.GuildID.String, role)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get role")
+		b.sendErrorMessage(s, m.ChannelID, "ロールの取得に失敗しました")
+		return
+	}
+	if definition == nil || !definition.AvailableIn(user.GuildID.String) {
+		b.sendErrorMessage(s, m.ChannelID, fmt.Sprintf("ロール `%s` は定義されていません（`/claude role list` で確認できます）", role))
+		return
+	}
+
+	if _, err := b.db.UpsertRoleBinding(user.GuildID.String, roleID, role); err != nil {
+		logrus.WithError(err).Error("Failed to bind role")
+		b.sendErrorMessage(s, m.ChannelID, "ロール連携の登録に失敗しました")
+		return
+	}
+
+	b.permService.InvalidateGuildRoleCache()
+	b.audit.RecordRoleBinding(auth.AuditRoleBind, user, roleID, "", role)
+
+	b.sendMessage(s, m.ChannelID, fmt.Sprintf("✅ Discordロール `%s` のメンバーを **%s** として扱います", roleID, role))
+}
+
+// unbindRole はギルドロールの対応を削除する
+func (b *Bot) unbindRole(s DiscordSession, m *discordgo.MessageCreate, user *db.User, roleID string) {
+	bindings, err := b.db.ListRoleBindings()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list role bindings")
+		b.sendErrorMessage(s, m.ChannelID, "ロール連携の取得に失敗しました")
+		return
+	}
+
+	var binding *db.RoleBinding
+	for _, candidate := range bindings {
+		if candidate.DiscordRoleID == roleID && candidate.GuildID.String == user.GuildID.String {
+			binding = candidate
+		}
+	}
+	if binding == nil {
+		b.sendErrorMessage(s, m.ChannelID, "指定されたロールは連携されていません")
+		return
+	}
+
+	if err := b.db.DeleteRoleBinding(user.GuildID.String, roleID); err != nil {
+		logrus.WithError(err).Error("Failed to unbind role")
+		b.sendErrorMessage(s, m.ChannelID, "ロール連携の削除に失敗しました")
+		return
+	}
+
+	b.permService.InvalidateGuildRoleCache()
+	b.audit.RecordRoleBinding(auth.AuditRoleUnbind, user, roleID, binding.Role, "")
+
+	b.sendMessage(s, m.ChannelID, fmt.Sprintf("✅ Discordロール `%s` の連携を削除しました", roleID))
+}
+
+// parseCapabilities はカンマ区切りの権限の指定を解析する
+func parseCapabilities(arg string) ([]string, error) {
+	var capabilities []string
+	for _, capability := range strings.Split(arg, ",") {
+		capability = strings.TrimSpace(capability)
+		if capability == "" {
+			continue
+		}
+		if !auth.IsValidCapability(capability) {
+			valid := make([]string, 0, len(auth.Capabilities))
+			for _, c := range auth.Capabilities {
+				valid = append(valid, string(c))
+			}
+			return nil, fmt.Errorf("不明な権限です: %s（指定できる権限: %s）", capability, strings.Join(valid, ", "))
+		}
+		capabilities = append(capabilities, capability)
+	}
+
+	if len(capabilities) == 0 {
+		return nil, fmt.Errorf("権限を1つ以上指定してください")
+	}
+
+	return capabilities, nil
+}
+
+// parseRoleMention はロールのメンション（<@&ID>）からロールIDを取り出す
+func parseRoleMention(arg string) string {
+	if strings.HasPrefix(arg, "<@&") && strings.HasSuffix(arg, ">") {
+		return arg[3 : len(arg)-1]
+	}
+	return arg
+}
@@ -2,9 +2,11 @@ package bot
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"time"
 
+	"github.com/hirano00o/disclaude/internal/auth"
 	"github.com/hirano00o/disclaude/internal/db"
 
 	"github.com/sirupsen/logrus"
@@ -12,8 +14,10 @@ import (
 
 // SessionManager はセッション管理を行う構造体
 type SessionManager struct {
-	db             *db.DB
+	db             db.Store
 	sandboxManager SandboxManager
+	onTerminate    func(session *db.Session, actor *db.User, reason string)
+	audit          *auth.AuditLogger
 }
 
 // SessionInfo はセッション情報を表す構造体
@@ -26,13 +30,24 @@ type SessionInfo struct {
 }
 
 // NewSessionManager は新しいSessionManagerを作成する
-func NewSessionManager(database *db.DB, sandboxMgr SandboxManager) *SessionManager {
+func NewSessionManager(database db.Store, sandboxMgr SandboxManager) *SessionManager {
 	return &SessionManager{
 		db:             database,
 		sandboxManager: sandboxMgr,
 	}
 }
 
+// SetTerminationHandler はセッションが強制終了されたときに呼び出される関数を設定する
+// スレッドへの通知など、Discordへの反映に使用する
+func (sm *SessionManager) SetTerminationHandler(handler func(session *db.Session, actor *db.User, reason string)) {
+	sm.onTerminate = handler
+}
+
+// SetAuditLogger はセッションの強制終了を記録するAuditLoggerを設定する
+func (sm *SessionManager) SetAuditLogger(audit *auth.AuditLogger) {
+	sm.audit = audit
+}
+
 // GetSessionInfo はセッション情報を取得する
 func (sm *SessionManager) GetSessionInfo(threadID string) (*SessionInfo, error) {
 	// セッション情報の取得
@@ -48,7 +63,7 @@ func (sm *SessionManager) GetSessionInfo(threadID string) (*SessionInfo, error)
 	}
 
 	// ユーザー情報の取得
-	user, err := sm.db.GetUserByID(session.UserID)
+	user, err := sm.db.GetUserByID(session.OwnerUserID())
 	if err != nil {
 		logrus.WithError(err).Error("Failed to get user for session")
 	}
@@ -116,7 +131,8 @@ func (sm *SessionManager) GetActiveSessionsCount() (int, error) {
 }
 
 // ForceTerminateSession はセッションを強制終了する（管理者機能）
-func (sm *SessionManager) ForceTerminateSession(ctx context.Context, sessionID int, reason string) error {
+// 実行者と理由は会話履歴にシステムメッセージとして記録する
+func (sm *SessionManager) ForceTerminateSession(ctx context.Context, sessionID int, actor *db.User, reason string) error {
 	// セッション情報の取得
 	session, err := sm.db.GetSessionByID(sessionID)
 	if err != nil {
@@ -139,18 +155,110 @@ func (sm *SessionManager) ForceTerminateSession(ctx context.Context, sessionID i
 		}
 	}
 
+	return sm.markTerminated(session, actor, reason)
+}
+
+// TerminateUserSessions はユーザーのアクティブなセッションと停止したセッションをサンドボックスとともに終了し、終了した数を返す
+// ユーザーの削除やアクセス期限切れで使用する。サンドボックスを削除できなかったセッションは終了せずにエラーを返すため、
+// 再実行すると残りのセッションから処理を続けられる
+func (sm *SessionManager) TerminateUserSessions(ctx context.Context, user, actor *db.User, reason string) (int, error) {
+	terminated := 0
+	for _, status := range []string{"active", "failed"} {
+		sessions, err := sm.db.ListSessions(status, 0)
+		if err != nil {
+			return terminated, fmt.Errorf("failed to list %s sessions: %w", status, err)
+		}
+
+		for _, session := range sessions {
+			if session.OwnerUserID() != user.ID {
+				continue
+			}
+
+			if sm.sandboxManager != nil {
+				if err := sm.sandboxManager.DeleteSandbox(ctx, session.SandboxName); err != nil {
+					return terminated, fmt.Errorf("failed to delete sandbox %s: %w", session.SandboxName, err)
+				}
+			}
+
+			if err := sm.markTerminated(session, actor, reason); err != nil {
+				return terminated, err
+			}
+			terminated++
+		}
+	}
+
+	return terminated, nil
+}
+
+// markTerminated はサンドボックスを削除したセッションを終了状態にし、実行者と理由を記録・通知する
+func (sm *SessionManager) markTerminated(session *db.Session, actor *db.User, reason string) error {
 	// セッション状態の更新
-	err = sm.db.UpdateSessionStatus(session.ID, "terminated")
+	err := sm.db.UpdateSessionStatus(session.ID, "terminated")
 	if err != nil {
 		return fmt.Errorf("failed to update session status: %w", err)
 	}
 
+	// 実行者の記録（バックグラウンドジョブによる終了の場合はユーザーを記録しない）
+	_, err = sm.db.CreateMessage(&db.Message{
+		SessionID: session.ID,
+		UserID:    sql.NullInt64{Int64: int64(actor.ID), Valid: actor.ID != 0},
+		Role:      "system",
+		Content:   fmt.Sprintf("session force terminated by %s: %s", actor.Username, reason),
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("session_id", session.ID).Error("Failed to record force termination")
+	}
+
 	logrus.WithFields(logrus.Fields{
-		"session_id":   sessionID,
+		"session_id":   session.ID,
 		"sandbox_name": session.SandboxName,
+		"actor_id":     actor.ID,
 		"reason":       reason,
 	}).Info("Session force terminated")
 
+	owner, err := sm.db.GetUserByID(session.OwnerUserID())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get session owner")
+	}
+	sm.audit.RecordSession(auth.AuditSessionTerminate, actor, owner, session, reason)
+
+	if sm.onTerminate != nil {
+		sm.onTerminate(session, actor, reason)
+	}
+
+	return nil
+}
+
+// ExtendSession はセッションの最大利用時間を延長する（管理者機能）
+// 延長分は分単位で記録するため、1分未満は切り捨てる
+func (sm *SessionManager) ExtendSession(sessionID int, extension time.Duration) error {
+	minutes := int(extension / time.Minute)
+	if minutes < 1 {
+		return fmt.Errorf("extension must be at least one minute")
+	}
+
+	session, err := sm.db.GetSessionByID(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+
+	if session == nil {
+		return fmt.Errorf("session not found")
+	}
+
+	if !session.IsActive() {
+		return fmt.Errorf("session is not active")
+	}
+
+	if err := sm.db.ExtendSession(session.ID, minutes); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"session_id": sessionID,
+		"minutes":    minutes,
+	}).Info("Session extended")
+
 	return nil
 }
 
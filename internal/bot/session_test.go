@@ -0,0 +1,133 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/db"
+)
+
+// fakeSandboxManager は削除されたサンドボックスを記録するSandboxManager
+type fakeSandboxManager struct {
+	deleted []string
+}
+
+// DeleteSandbox は削除要求を記録する
+func (f *fakeSandboxManager) DeleteSandbox(ctx context.Context, podName string) error {
+	f.deleted = append(f.deleted, podName)
+	return nil
+}
+
+// TestSessionManagerValidateSessionOwnership はセッション所有権確認のテスト
+func TestSessionManagerValidateSessionOwnership(t *testing.T) {
+	store := db.NewMemoryStore(3)
+	manager := NewSessionManager(store, &fakeSandboxManager{})
+
+	user, _ := store.CreateUser("", "user123", "user", "user")
+	if _, err := store.CreateSession(user.ID, "thread1", "claude-sandbox-thread1"); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	owned, info, err := manager.ValidateSessionOwnership("thread1", "user123")
+	if err != nil {
+		t.Fatalf("Failed to validate ownership: %v", err)
+	}
+	if !owned || !info.IsActive || info.User.DiscordID != "user123" {
+		t.Errorf("Expected active session owned by user123, got owned=%v info=%+v", owned, info)
+	}
+
+	owned, _, err = manager.ValidateSessionOwnership("thread1", "other")
+	if err != nil {
+		t.Fatalf("Failed to validate ownership: %v", err)
+	}
+	if owned {
+		t.Error("Expected other user not to own the session")
+	}
+
+	_, info, err = manager.ValidateSessionOwnership("missing", "user123")
+	if err != nil {
+		t.Fatalf("Failed to validate ownership of missing session: %v", err)
+	}
+	if info.IsActive || info.Session != nil {
+		t.Errorf("Expected inactive empty info for missing session, got %+v", info)
+	}
+}
+
+// TestSessionManagerForceTerminateSession はセッション強制終了のテスト
+func TestSessionManagerForceTerminateSession(t *testing.T) {
+	store := db.NewMemoryStore(3)
+	sandboxes := &fakeSandboxManager{}
+	manager := NewSessionManager(store, sandboxes)
+
+	owner, _ := store.CreateUser("", "owner123", "owner", "owner")
+	user, _ := store.CreateUser("", "user123", "user", "user")
+	session, _ := store.CreateSession(user.ID, "thread1", "claude-sandbox-thread1")
+
+	var notified string
+	manager.SetTerminationHandler(func(session *db.Session, actor *db.User, reason string) {
+		notified = fmt.Sprintf("%s:%s:%s", session.ThreadID, actor.Username, reason)
+	})
+
+	if err := manager.ForceTerminateSession(context.Background(), session.ID, owner, "test"); err != nil {
+		t.Fatalf("Failed to force terminate session: %v", err)
+	}
+	if notified != "thread1:owner:test" {
+		t.Errorf("Expected termination handler to be called, got %q", notified)
+	}
+
+	// 実行者が会話履歴に記録される
+	last, _ := store.GetLastMessageBySessionID(session.ID)
+	if last == nil || last.Role != "system" || last.UserID.Int64 != int64(owner.ID) {
+		t.Errorf("Expected system message recorded by owner, got %+v", last)
+	}
+
+	if len(sandboxes.deleted) != 1 || sandboxes.deleted[0] != "claude-sandbox-thread1" {
+		t.Errorf("Expected sandbox claude-sandbox-thread1 to be deleted, got %v", sandboxes.deleted)
+	}
+
+	terminated, _ := store.GetSessionByID(session.ID)
+	if !terminated.IsTerminated() {
+		t.Errorf("Expected session to be terminated, got '%s'", terminated.Status)
+	}
+
+	// 終了済みのセッションは再度終了できない
+	if err := manager.ForceTerminateSession(context.Background(), session.ID, owner, "test"); err == nil {
+		t.Error("Expected error for terminated session, got nil")
+	}
+}
+
+// TestSessionManagerExtendSession はセッション延長のテスト
+func TestSessionManagerExtendSession(t *testing.T) {
+	store := db.NewMemoryStore(3)
+	manager := NewSessionManager(store, &fakeSandboxManager{})
+
+	user, _ := store.CreateUser("", "user123", "user", "user")
+	session, err := store.CreateSession(user.ID, "thread1", "claude-sandbox-thread1")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	if err := manager.ExtendSession(session.ID, 30*time.Second); err == nil {
+		t.Error("Expected error for extension shorter than a minute, got nil")
+	}
+	if err := manager.ExtendSession(session.ID, 30*time.Minute); err != nil {
+		t.Fatalf("Failed to extend session: %v", err)
+	}
+
+	found, _ := store.GetSessionByID(session.ID)
+	if found.ExtensionMinutes != 30 {
+		t.Errorf("Expected extension of 30 minutes, got %d", found.ExtensionMinutes)
+	}
+
+	if err := store.UpdateSessionStatus(session.ID, "terminated"); err != nil {
+		t.Fatalf("Failed to terminate session: %v", err)
+	}
+	if err := manager.ExtendSession(session.ID, 30*time.Minute); err == nil {
+		t.Error("Expected error for terminated session, got nil")
+	}
+	if err := manager.ExtendSession(999, 30*time.Minute); err == nil {
+		t.Error("Expected error for missing session, got nil")
+	}
+}
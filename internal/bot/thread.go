@@ -0,0 +1,170 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// threadArchivedReason はスレッドのアーカイブによりセッションを終了した場合の理由
+	threadArchivedReason = "セッションのスレッドがアーカイブされました"
+
+	// threadDeletedReason はスレッドまたは親チャンネルの削除によりセッションを終了した場合の理由
+	threadDeletedReason = "セッションのスレッドが削除されました"
+)
+
+// threadUpdateHandler はスレッドの更新時のハンドラー
+func (b *Bot) threadUpdateHandler(s *discordgo.Session, event *discordgo.ThreadUpdate) {
+	b.handleThreadUpdate(event)
+}
+
+// threadDeleteHandler はスレッドの削除時のハンドラー
+func (b *Bot) threadDeleteHandler(s *discordgo.Session, event *discordgo.ThreadDelete) {
+	b.handleThreadDelete(event)
+}
+
+// channelDeleteHandler はチャンネルの削除時のハンドラー
+func (b *Bot) channelDeleteHandler(s *discordgo.Session, event *discordgo.ChannelDelete) {
+	b.handleChannelDelete(s.State, event)
+}
+
+// handleThreadUpdate はアーカイブされたスレッドのセッションを終了する
+func (b *Bot) handleThreadUpdate(event *discordgo.ThreadUpdate) {
+	if event.Channel == nil || event.ThreadMetadata == nil || !event.ThreadMetadata.Archived {
+		return
+	}
+
+	if !b.beginInflight() {
+		return
+	}
+	defer b.inflight.Done()
+
+	b.terminateThreadSession(event.ID, threadArchivedReason)
+}
+
+// handleThreadDelete は削除されたスレッドのセッションを終了する
+func (b *Bot) handleThreadDelete(event *discordgo.ThreadDelete) {
+	if event.Channel == nil {
+		return
+	}
+
+	if !b.beginInflight() {
+		return
+	}
+	defer b.inflight.Done()
+
+	b.terminateThreadSession(event.ID, threadDeletedReason)
+}
+
+// handleChannelDelete は削除されたチャンネルと、その中のスレッドのセッションを終了する
+// 対象はチャンネルが属するギルドのセッションのみで、スレッドの親チャンネルはstateのキャッシュから確認する
+// 親チャンネルの削除ではスレッドごとの削除イベントが届かないため、取得できなくなったスレッドのセッションを終了する
+func (b *Bot) handleChannelDelete(state ChannelState, event *discordgo.ChannelDelete) {
+	if event.Channel == nil || event.GuildID == "" {
+		return
+	}
+
+	if !b.beginInflight() {
+		return
+	}
+	defer b.inflight.Done()
+
+	sessions, err := b.db.ListSessionsByGuild(event.GuildID, "active", 0)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list active sessions")
+		return
+	}
+
+	for _, session := range sessions {
+		if session.ThreadID != event.ID {
+			parentID, err := b.threadParentID(state, session.ThreadID)
+			if err == nil && parentID != event.ID {
+				continue
+			}
+			if err != nil && !isUnknownChannel(err) {
+				logrus.WithError(err).WithField("session_id", session.ID).Error("Failed to get session thread")
+				continue
+			}
+		}
+
+		b.terminateThreadSession(session.ThreadID, threadDeletedReason)
+	}
+}
+
+// threadParentID はスレッドの親チャンネルのIDを返す
+// stateのキャッシュにない場合（アーカイブ済みのスレッドなど）のみREST APIで取得する
+func (b *Bot) threadParentID(state ChannelState, threadID string) (string, error) {
+	if state != nil {
+		if thread, err := state.Channel(threadID); err == nil {
+			return thread.ParentID, nil
+		}
+	}
+
+	thread, err := b.discord.Channel(threadID)
+	if err != nil {
+		return "", err
+	}
+	return thread.ParentID, nil
+}
+
+// terminateThreadSession はスレッドのアクティブなセッションをサンドボックスとともに終了する
+// 終了したスレッドには投稿できない（投稿するとアーカイブが解除される）ため、終了の通知は送信しない
+func (b *Bot) terminateThreadSession(threadID, reason string) {
+	session, err := b.db.GetSessionByThreadID(threadID)
+	if err != nil {
+		logrus.WithError(err).WithField("thread_id", threadID).Error("Failed to get session")
+		return
+	}
+
+	// `/claude close` の後にBotがアーカイブした場合など、終了済みのセッションは対象外
+	if session == nil || !session.IsActive() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	b.closedThreads.Store(threadID, true)
+	defer b.closedThreads.Delete(threadID)
+
+	if err := b.sessionManager.ForceTerminateSession(ctx, session.ID, systemActor, reason); err != nil {
+		logrus.WithError(err).WithField("session_id", session.ID).Error("Failed to terminate session for closed thread")
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"session_id": session.ID,
+		"thread_id":  threadID,
+		"reason":     reason,
+	}).Info("Session terminated because its thread was closed")
+}
+
+// archiveThread はセッションを終了したスレッドをアーカイブし、ロックする
+// DMのセッションはスレッドではないため何もしない
+func (b *Bot) archiveThread(s DiscordSession, channelID string) {
+	channel, err := s.Channel(channelID)
+	if err != nil {
+		logrus.WithError(err).WithField("channel_id", channelID).Error("Failed to get channel")
+		return
+	}
+
+	if !channel.IsThread() {
+		return
+	}
+
+	archived, locked := true, true
+	if _, err := s.ChannelEdit(channelID, &discordgo.ChannelEdit{Archived: &archived, Locked: &locked}); err != nil {
+		logrus.WithError(err).WithField("thread_id", channelID).Error("Failed to archive thread")
+	}
+}
+
+// isUnknownChannel はチャンネルが存在しない（削除された）ことを示すエラーかどうかを判定する
+func isUnknownChannel(err error) bool {
+	var restErr *discordgo.RESTError
+	return errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound
+}
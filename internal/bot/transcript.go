@@ -0,0 +1,166 @@
+package bot
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/db"
+
+	"github.com/sirupsen/logrus"
+)
+
+// transcriptTimeFormat は会話履歴に表示する日時のフォーマット
+const transcriptTimeFormat = "2006-01-02 15:04:05 MST"
+
+// recordMessage は会話履歴を1件記録する
+func (b *Bot) recordMessage(session *db.Session, user *db.User, role, content string, exitCode *int) {
+	message := &db.Message{
+		SessionID: session.ID,
+		Role:      role,
+		Content:   content,
+	}
+	if user != nil {
+		message.UserID = sql.NullInt64{Int64: int64(user.ID), Valid: true}
+	}
+	if exitCode != nil {
+		message.ExitCode = sql.NullInt64{Int64: int64(*exitCode), Valid: true}
+	}
+
+	if _, err := b.db.CreateMessage(message); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"session_id": session.ID,
+			"role":       role,
+		}).Error("Failed to record message")
+	}
+}
+
+// recordResponse はClaude Codeのツールイベントと応答を会話履歴に記録する
+func (b *Bot) recordResponse(session *db.Session, user *db.User, response *ClaudeResponse) {
+	for _, event := range response.ToolEvents {
+		content := event.Content
+		if event.Type == "tool_use" {
+			content = fmt.Sprintf("%s %s", event.Name, event.Content)
+		}
+		if event.IsError {
+			content = "[error] " + content
+		}
+		b.recordMessage(session, user, event.Type, content, nil)
+	}
+
+	exitCode := 0
+	if response.ExitStatus != "success" && response.ExitStatus != "unknown" {
+		exitCode = 1
+	}
+	b.recordMessage(session, user, "assistant", response.FullText, &exitCode)
+}
+
+// transcriptMessage はJSONエクスポート時の1件分の形式
+type transcriptMessage struct {
+	Role      string    `json:"role"`
+	Author    string    `json:"author,omitempty"`
+	Content   string    `json:"content"`
+	ExitCode  *int64    `json:"exit_code,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// transcript はJSONエクスポートの形式
+type transcript struct {
+	SessionID    int                 `json:"session_id"`
+	ThreadID     string              `json:"thread_id"`
+	SandboxName  string              `json:"sandbox_name"`
+	Owner        string              `json:"owner,omitempty"`
+	Status       string              `json:"status"`
+	CreatedAt    time.Time           `json:"created_at"`
+	TerminatedAt *time.Time          `json:"terminated_at,omitempty"`
+	Messages     []transcriptMessage `json:"messages"`
+}
+
+// renderTranscriptJSON は会話履歴をJSONに変換する
+func renderTranscriptJSON(session *db.Session, owner *db.User, messages []*db.Message, authors map[int64]string) ([]byte, error) {
+	t := transcript{
+		SessionID:   session.ID,
+		ThreadID:    session.ThreadID,
+		SandboxName: session.SandboxName,
+		Status:      session.Status,
+		CreatedAt:   session.CreatedAt,
+		Messages:    make([]transcriptMessage, 0, len(messages)),
+	}
+	if owner != nil {
+		t.Owner = owner.Username
+	}
+	if session.TerminatedAt.Valid {
+		t.TerminatedAt = &session.TerminatedAt.Time
+	}
+
+	for _, message := range messages {
+		tm := transcriptMessage{
+			Role:      message.Role,
+			Content:   message.Content,
+			CreatedAt: message.CreatedAt,
+		}
+		if message.UserID.Valid {
+			tm.Author = authors[message.UserID.Int64]
+		}
+		if message.ExitCode.Valid {
+			exitCode := message.ExitCode.Int64
+			tm.ExitCode = &exitCode
+		}
+		t.Messages = append(t.Messages, tm)
+	}
+
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal transcript: %w", err)
+	}
+
+	return data, nil
+}
+
+// renderTranscriptMarkdown は会話履歴をMarkdownに変換する
+func renderTranscriptMarkdown(session *db.Session, owner *db.User, messages []*db.Message, authors map[int64]string) []byte {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "# Claude Code セッション #%d\n\n", session.ID)
+	fmt.Fprintf(&sb, "- スレッドID: %s\n", session.ThreadID)
+	fmt.Fprintf(&sb, "- サンドボックス名: %s\n", session.SandboxName)
+	if owner != nil {
+		fmt.Fprintf(&sb, "- 作成者: %s\n", owner.Username)
+	}
+	fmt.Fprintf(&sb, "- ステータス: %s\n", session.Status)
+	fmt.Fprintf(&sb, "- 開始: %s\n", session.CreatedAt.Format(transcriptTimeFormat))
+	if session.TerminatedAt.Valid {
+		fmt.Fprintf(&sb, "- 終了: %s\n", session.TerminatedAt.Time.Format(transcriptTimeFormat))
+	}
+
+	for _, message := range messages {
+		timestamp := message.CreatedAt.Format(transcriptTimeFormat)
+
+		switch message.Role {
+		case "user":
+			author := "user"
+			if message.UserID.Valid && authors[message.UserID.Int64] != "" {
+				author = authors[message.UserID.Int64]
+			}
+			fmt.Fprintf(&sb, "\n## 👤 %s (%s)\n\n%s\n", author, timestamp, message.Content)
+		case "assistant":
+			fmt.Fprintf(&sb, "\n## 🤖 Claude Code (%s)\n\n%s\n", timestamp, message.Content)
+			if message.ExitCode.Valid && message.ExitCode.Int64 != 0 {
+				fmt.Fprintf(&sb, "\n_終了コード: %d_\n", message.ExitCode.Int64)
+			}
+		case "tool_use":
+			fmt.Fprintf(&sb, "\n### 🔧 ツール呼び出し (%s)\n\n```\n%s\n```\n", timestamp, message.Content)
+		case "tool_result":
+			fmt.Fprintf(&sb, "\n### 📄 ツール結果 (%s)\n\n```\n%s\n```\n", timestamp, message.Content)
+		default:
+			fmt.Fprintf(&sb, "\n### ⚠️ %s (%s)\n\n%s\n", message.Role, timestamp, message.Content)
+			if message.ExitCode.Valid {
+				fmt.Fprintf(&sb, "\n_終了コード: %d_\n", message.ExitCode.Int64)
+			}
+		}
+	}
+
+	return []byte(sb.String())
+}
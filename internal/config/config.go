@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config はアプリケーション全体の設定を保持する構造体
@@ -12,12 +14,18 @@ type Config struct {
 	Database   DatabaseConfig
 	Kubernetes KubernetesConfig
 	Claude     ClaudeConfig
+	Server     ServerConfig
+	Quota      QuotaConfig
+	Dashboard  DashboardConfig
 }
 
 // DiscordConfig はDiscord Bot関連の設定
 type DiscordConfig struct {
-	Token   string
+	Token string
+	// GuildID はデフォルトのギルドのID（ギルドに属さないユーザーの移行先、DMでのロール連携に使用する）
 	GuildID string
+	// AuditChannelID はギルドに管理チャンネルが設定されていない場合に監査ログを転送するチャンネルのID（空の場合は転送しない）
+	AuditChannelID string
 }
 
 // DatabaseConfig はデータベース関連の設定
@@ -33,6 +41,10 @@ type DatabaseConfig struct {
 type KubernetesConfig struct {
 	Namespace    string
 	MaxSandboxes int
+	// WarmPoolSize は事前に起動しておく待機サンドボックスの数（0は無効）
+	WarmPoolSize int
+	// WarmPoolSeparateBudget がtrueの場合、待機サンドボックスをMaxSandboxesの枠外で数える
+	WarmPoolSeparateBudget bool
 }
 
 // ClaudeConfig はClaude Code関連の設定
@@ -41,13 +53,47 @@ type ClaudeConfig struct {
 	ConfigPath string
 }
 
+// ServerConfig はHTTPサーバー（メトリクス等）関連の設定
+type ServerConfig struct {
+	Addr string
+}
+
+// DashboardConfig はWebダッシュボード関連の設定
+// ClientIDが空の場合、ダッシュボードは無効になる
+type DashboardConfig struct {
+	// ClientID と ClientSecret はDiscord OAuth2アプリケーションの認証情報
+	ClientID     string
+	ClientSecret string
+	// URL は外部から見たダッシュボードのURL（OAuth2のリダイレクト先は URL + "/callback"）
+	URL string
+	// SessionSecret はログインセッションのCookieの署名に使う秘密鍵
+	SessionSecret string
+	// ExtendDuration は延長ボタン1回でセッションの最大利用時間を延ばす時間（ダッシュボードとDiscordのボタンで共通）
+	ExtendDuration time.Duration
+}
+
+// Enabled はダッシュボードが有効かどうかを返す
+func (c DashboardConfig) Enabled() bool {
+	return c.ClientID != ""
+}
+
+// QuotaConfig はユーザーごとの利用上限のデフォルト値（0は無制限）
+// 個別の上限はオーナーが `/claude limit` で上書きできる
+type QuotaConfig struct {
+	DailyCostUSD       float64
+	MonthlyCostUSD     float64
+	DailyTokens        int64
+	MonthlyTokens      int64
+	MaxSessionsPerUser int
+	MaxSessionDuration time.Duration
+}
+
 // Load は環境変数から設定を読み込む
 func Load() (*Config, error) {
-	// データベースポートの取得
-	portStr := getEnvWithDefault("DB_PORT", "5432")
-	port, err := strconv.Atoi(portStr)
+	// データベース設定の取得
+	database, err := LoadDatabase()
 	if err != nil {
-		return nil, fmt.Errorf("invalid DB_PORT: %w", err)
+		return nil, err
 	}
 
 	// 最大サンドボックス数の取得
@@ -57,13 +103,34 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("invalid MAX_SANDBOXES: %w", err)
 	}
 
+	// 待機サンドボックス（ウォームプール）の設定の取得
+	warmPoolSize, err := strconv.Atoi(getEnvWithDefault("WARM_POOL_SIZE", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WARM_POOL_SIZE: %w", err)
+	}
+	if warmPoolSize < 0 {
+		return nil, fmt.Errorf("invalid WARM_POOL_SIZE: must not be negative")
+	}
+	warmPoolSeparateBudget, err := strconv.ParseBool(getEnvWithDefault("WARM_POOL_SEPARATE_BUDGET", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WARM_POOL_SEPARATE_BUDGET: %w", err)
+	}
+
+	// 利用上限のデフォルト値の取得
+	quota, err := loadQuotaConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// ダッシュボードの設定の取得
+	dashboard, err := loadDashboardConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	// 必須環境変数の確認
 	requiredEnvVars := []string{
 		"DISCORD_TOKEN",
-		"DB_HOST",
-		"DB_USER",
-		"DB_PASSWORD",
-		"DB_NAME",
 		"CLAUDE_API_KEY",
 	}
 
@@ -75,29 +142,141 @@ func Load() (*Config, error) {
 
 	config := &Config{
 		Discord: DiscordConfig{
-			Token:   os.Getenv("DISCORD_TOKEN"),
-			GuildID: os.Getenv("DISCORD_GUILD_ID"),
-		},
-		Database: DatabaseConfig{
-			Host:     os.Getenv("DB_HOST"),
-			Port:     port,
-			User:     os.Getenv("DB_USER"),
-			Password: os.Getenv("DB_PASSWORD"),
-			Database: os.Getenv("DB_NAME"),
+			Token:          os.Getenv("DISCORD_TOKEN"),
+			GuildID:        os.Getenv("DISCORD_GUILD_ID"),
+			AuditChannelID: os.Getenv("DISCORD_AUDIT_CHANNEL_ID"),
 		},
+		Database: *database,
 		Kubernetes: KubernetesConfig{
 			Namespace:    getEnvWithDefault("KUBERNETES_NAMESPACE", "disclaude"),
 			MaxSandboxes: maxSandboxes,
+
+			WarmPoolSize:           warmPoolSize,
+			WarmPoolSeparateBudget: warmPoolSeparateBudget,
 		},
 		Claude: ClaudeConfig{
 			APIKey:     os.Getenv("CLAUDE_API_KEY"),
 			ConfigPath: getEnvWithDefault("CLAUDE_CONFIG_PATH", "/home/user/.claude"),
 		},
+		Server: ServerConfig{
+			Addr: getEnvWithDefault("HTTP_ADDR", ":8080"),
+		},
+		Quota:     *quota,
+		Dashboard: *dashboard,
 	}
 
 	return config, nil
 }
 
+// LoadDatabase はデータベース関連の設定のみを環境変数から読み込む
+// `disclaude migrate` のようにDiscordやClaudeの設定が不要なコマンドで使用する
+func LoadDatabase() (*DatabaseConfig, error) {
+	// データベースポートの取得
+	portStr := getEnvWithDefault("DB_PORT", "5432")
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DB_PORT: %w", err)
+	}
+
+	// 必須環境変数の確認
+	requiredEnvVars := []string{
+		"DB_HOST",
+		"DB_USER",
+		"DB_PASSWORD",
+		"DB_NAME",
+	}
+
+	for _, envVar := range requiredEnvVars {
+		if os.Getenv(envVar) == "" {
+			return nil, fmt.Errorf("required environment variable %s is not set", envVar)
+		}
+	}
+
+	return &DatabaseConfig{
+		Host:     os.Getenv("DB_HOST"),
+		Port:     port,
+		User:     os.Getenv("DB_USER"),
+		Password: os.Getenv("DB_PASSWORD"),
+		Database: os.Getenv("DB_NAME"),
+	}, nil
+}
+
+// loadQuotaConfig は利用上限のデフォルト値を環境変数から読み込む
+func loadQuotaConfig() (*QuotaConfig, error) {
+	dailyCost, err := strconv.ParseFloat(getEnvWithDefault("QUOTA_DAILY_COST_USD", "0"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid QUOTA_DAILY_COST_USD: %w", err)
+	}
+
+	monthlyCost, err := strconv.ParseFloat(getEnvWithDefault("QUOTA_MONTHLY_COST_USD", "0"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid QUOTA_MONTHLY_COST_USD: %w", err)
+	}
+
+	dailyTokens, err := strconv.ParseInt(getEnvWithDefault("QUOTA_DAILY_TOKENS", "0"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid QUOTA_DAILY_TOKENS: %w", err)
+	}
+
+	monthlyTokens, err := strconv.ParseInt(getEnvWithDefault("QUOTA_MONTHLY_TOKENS", "0"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid QUOTA_MONTHLY_TOKENS: %w", err)
+	}
+
+	maxSessions, err := strconv.Atoi(getEnvWithDefault("QUOTA_MAX_SESSIONS_PER_USER", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid QUOTA_MAX_SESSIONS_PER_USER: %w", err)
+	}
+
+	maxDuration, err := time.ParseDuration(getEnvWithDefault("QUOTA_MAX_SESSION_DURATION", "0s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid QUOTA_MAX_SESSION_DURATION: %w", err)
+	}
+
+	return &QuotaConfig{
+		DailyCostUSD:       dailyCost,
+		MonthlyCostUSD:     monthlyCost,
+		DailyTokens:        dailyTokens,
+		MonthlyTokens:      monthlyTokens,
+		MaxSessionsPerUser: maxSessions,
+		MaxSessionDuration: maxDuration,
+	}, nil
+}
+
+// loadDashboardConfig はWebダッシュボードの設定を環境変数から読み込む
+// DISCORD_CLIENT_ID が設定されている場合のみ、残りの項目を必須とする
+func loadDashboardConfig() (*DashboardConfig, error) {
+	extendDuration, err := time.ParseDuration(getEnvWithDefault("DASHBOARD_EXTEND_DURATION", "30m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DASHBOARD_EXTEND_DURATION: %w", err)
+	}
+	if extendDuration < time.Minute {
+		return nil, fmt.Errorf("invalid DASHBOARD_EXTEND_DURATION: must be at least 1m")
+	}
+
+	dashboard := &DashboardConfig{
+		ClientID:       os.Getenv("DISCORD_CLIENT_ID"),
+		ClientSecret:   os.Getenv("DISCORD_CLIENT_SECRET"),
+		URL:            strings.TrimSuffix(os.Getenv("DASHBOARD_URL"), "/"),
+		SessionSecret:  os.Getenv("DASHBOARD_SESSION_SECRET"),
+		ExtendDuration: extendDuration,
+	}
+	if !dashboard.Enabled() {
+		return dashboard, nil
+	}
+
+	for _, envVar := range []string{"DISCORD_CLIENT_SECRET", "DASHBOARD_URL", "DASHBOARD_SESSION_SECRET"} {
+		if os.Getenv(envVar) == "" {
+			return nil, fmt.Errorf("required environment variable %s is not set when DISCORD_CLIENT_ID is set", envVar)
+		}
+	}
+	if len(dashboard.SessionSecret) < 32 {
+		return nil, fmt.Errorf("invalid DASHBOARD_SESSION_SECRET: must be at least 32 characters")
+	}
+
+	return dashboard, nil
+}
+
 // getEnvWithDefault は環境変数を取得し、存在しない場合はデフォルト値を返す
 func getEnvWithDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -0,0 +1,76 @@
+package dashboard
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sessionSigner はログインセッションのCookieの署名と検証を行う
+// Cookieには「ユーザーID.有効期限.署名」を保存し、サーバー側には状態を持たない
+// 同じDiscordユーザーがギルドごとに別のユーザーとして登録されるため、ログインしたギルドのユーザーのIDを保存する
+type sessionSigner struct {
+	secret []byte
+}
+
+// sign はユーザーIDと有効期限に署名したCookieの値を返す
+func (s *sessionSigner) sign(userID int, expiresAt time.Time) string {
+	payload := strconv.Itoa(userID) + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	return payload + "." + s.mac("session", payload)
+}
+
+// verify はCookieの値を検証し、有効な場合はユーザーIDを返す
+func (s *sessionSigner) verify(value string, now time.Time) (int, bool) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return 0, false
+	}
+
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(s.mac("session", payload))) {
+		return 0, false
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || !now.Before(time.Unix(expiresAt, 0)) {
+		return 0, false
+	}
+
+	userID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, false
+	}
+
+	return userID, true
+}
+
+// csrfToken はログインセッションに紐づくCSRFトークンを返す
+func (s *sessionSigner) csrfToken(sessionValue string) string {
+	return s.mac("csrf", sessionValue)
+}
+
+// validCSRFToken はCSRFトークンがログインセッションに紐づくものかチェックする
+func (s *sessionSigner) validCSRFToken(sessionValue, token string) bool {
+	return hmac.Equal([]byte(token), []byte(s.csrfToken(sessionValue)))
+}
+
+// mac は用途ごとに区別したHMAC-SHA256を16進数で返す
+func (s *sessionSigner) mac(purpose, value string) string {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(purpose + ":" + value))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// randomState はOAuth2のstateパラメーターに使う乱数を返す
+func randomState() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate oauth state: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,122 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultDiscordEndpoint はDiscordのOAuth2とAPIのベースURL
+const defaultDiscordEndpoint = "https://discord.com"
+
+// discordUser はDiscord APIの /users/@me のレスポンスのうち使用する項目
+type discordUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// oauthClient はDiscord OAuth2の認可コードフローを扱うクライアント
+// ログインしたユーザーのIDを取得するためだけに identify スコープを要求する
+type oauthClient struct {
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	endpoint     string
+	httpClient   *http.Client
+}
+
+// newOAuthClient は新しいoauthClientを作成する
+func newOAuthClient(clientID, clientSecret, redirectURL string) *oauthClient {
+	return &oauthClient{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		endpoint:     defaultDiscordEndpoint,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// authorizeURL はDiscordの認可画面のURLを返す
+func (c *oauthClient) authorizeURL(state string) string {
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {c.clientID},
+		"scope":         {"identify"},
+		"redirect_uri":  {c.redirectURL},
+		"state":         {state},
+	}
+	return c.endpoint + "/oauth2/authorize?" + params.Encode()
+}
+
+// fetchUser は認可コードをアクセストークンに交換し、ログインしたDiscordユーザーを取得する
+func (c *oauthClient) fetchUser(ctx context.Context, code string) (*discordUser, error) {
+	accessToken, err := c.exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+"/api/users/@me", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	var user discordUser
+	if err := c.do(req, &user); err != nil {
+		return nil, fmt.Errorf("failed to get discord user: %w", err)
+	}
+	if user.ID == "" {
+		return nil, fmt.Errorf("failed to get discord user: empty user id")
+	}
+
+	return &user, nil
+}
+
+// exchange は認可コードをアクセストークンに交換する
+func (c *oauthClient) exchange(ctx context.Context, code string) (string, error) {
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {c.redirectURL},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/api/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.clientID, c.clientSecret)
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := c.do(req, &token); err != nil {
+		return "", fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("failed to exchange authorization code: empty access token")
+	}
+
+	return token.AccessToken, nil
+}
+
+// do はリクエストを送信し、JSONのレスポンスをデコードする
+func (c *oauthClient) do(req *http.Request, v any) error {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
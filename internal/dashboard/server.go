@@ -0,0 +1,366 @@
+package dashboard
+
+import (
+	"context"
+	"crypto/subtle"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/auth"
+	"github.com/hirano00o/disclaude/internal/config"
+	"github.com/hirano00o/disclaude/internal/db"
+
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+const (
+	// sessionCookieName はログインセッションのCookie名
+	sessionCookieName = "disclaude_dashboard"
+	// stateCookieName はOAuth2のstateを保存するCookie名
+	stateCookieName = "disclaude_oauth_state"
+	// sessionTTL はログインセッションの有効期間
+	sessionTTL = 12 * time.Hour
+	// stateTTL はOAuth2の認可画面から戻ってくるまでの有効期間
+	stateTTL = 10 * time.Minute
+	// cookiePath はダッシュボードのCookieを送信するパス
+	cookiePath = "/dashboard"
+)
+
+// SessionController はダッシュボードから行うセッションの操作
+// bot.SessionManager が実装する
+type SessionController interface {
+	ForceTerminateSession(ctx context.Context, sessionID int, actor *db.User, reason string) error
+	ExtendSession(sessionID int, extension time.Duration) error
+}
+
+// StatusProvider はBotの実行時の状態を提供する
+// bot.Bot が実装する
+type StatusProvider interface {
+	PodPhase(podName string) string
+	QueuedRequests() int
+}
+
+// Server は運用者向けのWebダッシュボード
+// Discord OAuth2でログインした登録済みユーザーが閲覧でき、セッションの終了・延長は manage_sessions 権限を持つユーザーのみが行える
+type Server struct {
+	config      config.DashboardConfig
+	db          db.Store
+	permService *auth.PermissionService
+	sessions    SessionController
+	status      StatusProvider
+	oauth       *oauthClient
+	signer      *sessionSigner
+	templates   *template.Template
+	secure      bool
+	// defaultGuildID は複数のギルドに登録されたユーザーがログインするギルド（DISCORD_GUILD_ID）
+	defaultGuildID string
+}
+
+// NewServer は新しいServerを作成する
+func NewServer(cfg config.DashboardConfig, database db.Store, permService *auth.PermissionService, sessions SessionController, status StatusProvider) *Server {
+	return &Server{
+		config:      cfg,
+		db:          database,
+		permService: permService,
+		sessions:    sessions,
+		status:      status,
+		oauth:       newOAuthClient(cfg.ClientID, cfg.ClientSecret, cfg.URL+"/callback"),
+		signer:      &sessionSigner{secret: []byte(cfg.SessionSecret)},
+		templates:   template.Must(template.ParseFS(templateFS, "templates/*.html")),
+		secure:      strings.HasPrefix(cfg.URL, "https://"),
+	}
+}
+
+// SetDefaultGuild は複数のギルドに登録されたユーザーがログインするギルドを設定する
+// 設定しない場合、複数のギルドに登録されたユーザーはログインできない
+func (s *Server) SetDefaultGuild(guildID string) {
+	s.defaultGuildID = guildID
+}
+
+// Handler は /dashboard 以下のルーティングを行うハンドラーを返す
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("GET /dashboard", http.RedirectHandler("/dashboard/", http.StatusMovedPermanently))
+	mux.HandleFunc("GET /dashboard/{$}", s.handleIndex)
+	mux.HandleFunc("GET /dashboard/login", s.handleLogin)
+	mux.HandleFunc("GET /dashboard/callback", s.handleCallback)
+	mux.HandleFunc("POST /dashboard/logout", s.handleLogout)
+	mux.HandleFunc("POST /dashboard/sessions/{sessionID}/terminate", s.operatorOnly(s.handleTerminate))
+	mux.HandleFunc("POST /dashboard/sessions/{sessionID}/extend", s.operatorOnly(s.handleExtend))
+
+	return mux
+}
+
+// handleIndex はダッシュボードのトップページを表示する
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	viewer, sessionValue, err := s.currentUser(r)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get dashboard user")
+		s.renderError(w, http.StatusInternalServerError, "ユーザー情報の取得に失敗しました")
+		return
+	}
+	if viewer == nil {
+		s.render(w, http.StatusOK, "login.html", nil)
+		return
+	}
+
+	view, err := s.buildIndexView(viewer, s.signer.csrfToken(sessionValue))
+	if err != nil {
+		logrus.WithError(err).Error("Failed to build dashboard")
+		s.renderError(w, http.StatusInternalServerError, "ダッシュボードの表示に失敗しました")
+		return
+	}
+
+	s.render(w, http.StatusOK, "index.html", view)
+}
+
+// handleLogin はDiscordの認可画面にリダイレクトする
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	state, err := randomState()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to start dashboard login")
+		s.renderError(w, http.StatusInternalServerError, "ログインを開始できませんでした")
+		return
+	}
+
+	s.setCookie(w, stateCookieName, state, stateTTL)
+	http.Redirect(w, r, s.oauth.authorizeURL(state), http.StatusFound)
+}
+
+// handleCallback はDiscordの認可画面からのリダイレクトを処理し、登録済みユーザーをログインさせる
+func (s *Server) handleCallback(w http.ResponseWriter, r *http.Request) {
+	stateCookie, err := r.Cookie(stateCookieName)
+	state := r.URL.Query().Get("state")
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(stateCookie.Value), []byte(state)) != 1 {
+		s.renderError(w, http.StatusBadRequest, "ログインの有効期限が切れました。もう一度ログインしてください")
+		return
+	}
+	s.clearCookie(w, stateCookieName)
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		s.renderError(w, http.StatusForbidden, "Discordでの認可がキャンセルされました")
+		return
+	}
+
+	discordUser, err := s.oauth.fetchUser(r.Context(), code)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to complete dashboard login")
+		s.renderError(w, http.StatusBadGateway, "Discordからユーザー情報を取得できませんでした")
+		return
+	}
+
+	user, err := auth.FindHomeUser(s.db, s.defaultGuildID, discordUser.ID)
+	if errors.Is(err, auth.ErrAmbiguousGuild) {
+		logrus.WithField("discord_id", discordUser.ID).Warn("User registered in multiple guilds tried to log in to dashboard")
+		s.renderError(w, http.StatusForbidden, "このDiscordアカウントは複数のサーバーに登録されているため、ログインするサーバーを特定できません")
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get dashboard user")
+		s.renderError(w, http.StatusInternalServerError, "ユーザー情報の取得に失敗しました")
+		return
+	}
+	if user == nil {
+		logrus.WithField("discord_id", discordUser.ID).Warn("Unregistered user tried to log in to dashboard")
+		s.renderError(w, http.StatusForbidden, "このDiscordアカウントは登録されていません")
+		return
+	}
+	if user.AccessEnded(time.Now()) {
+		logrus.WithField("user_id", user.ID).Warn("User whose access has ended tried to log in to dashboard")
+		s.renderError(w, http.StatusForbidden, "このDiscordアカウントのアクセス期限が切れているか、無効化されています")
+		return
+	}
+
+	s.setCookie(w, sessionCookieName, s.signer.sign(user.ID, time.Now().Add(sessionTTL)), sessionTTL)
+
+	logrus.WithFields(logrus.Fields{
+		"user_id": user.ID,
+		"role":    user.Role,
+	}).Info("User logged in to dashboard")
+
+	http.Redirect(w, r, "/dashboard/", http.StatusFound)
+}
+
+// handleLogout はログインセッションを破棄する
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	s.clearCookie(w, sessionCookieName)
+	http.Redirect(w, r, "/dashboard/", http.StatusSeeOther)
+}
+
+// operatorOnly はログイン中の manage_sessions 権限を持つユーザーからの正しいフォーム送信のみを通す
+func (s *Server) operatorOnly(next func(w http.ResponseWriter, r *http.Request, actor *db.User)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actor, sessionValue, err := s.currentUser(r)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to get dashboard user")
+			s.renderError(w, http.StatusInternalServerError, "ユーザー情報の取得に失敗しました")
+			return
+		}
+		if actor == nil {
+			s.renderError(w, http.StatusUnauthorized, "ログインしてください")
+			return
+		}
+		if !s.signer.validCSRFToken(sessionValue, r.PostFormValue("csrf_token")) {
+			s.renderError(w, http.StatusForbidden, "不正なリクエストです。ページを再読み込みしてください")
+			return
+		}
+		if err := s.permService.Authorize(actor, auth.CapabilityManageSessions, nil); err != nil {
+			if !auth.IsPermissionDenied(err) {
+				logrus.WithError(err).Error("Failed to check permission")
+				s.renderError(w, http.StatusInternalServerError, "権限の確認に失敗しました")
+				return
+			}
+			s.renderError(w, http.StatusForbidden, err.Error())
+			return
+		}
+
+		next(w, r, actor)
+	}
+}
+
+// handleTerminate はセッションを強制終了する
+func (s *Server) handleTerminate(w http.ResponseWriter, r *http.Request, actor *db.User) {
+	session, ok := s.lookupActiveSession(w, r, actor)
+	if !ok {
+		return
+	}
+
+	reason := fmt.Sprintf("terminated via dashboard by %s", actor.Username)
+	if err := s.sessions.ForceTerminateSession(r.Context(), session.ID, actor, reason); err != nil {
+		logrus.WithError(err).WithField("session_id", session.ID).Error("Failed to terminate session from dashboard")
+		s.renderError(w, http.StatusInternalServerError, "セッションの終了に失敗しました")
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"requester_id": actor.ID,
+		"session_id":   session.ID,
+	}).Info("Session terminated via dashboard")
+
+	http.Redirect(w, r, "/dashboard/", http.StatusSeeOther)
+}
+
+// handleExtend はセッションの最大利用時間を延長する
+func (s *Server) handleExtend(w http.ResponseWriter, r *http.Request, actor *db.User) {
+	session, ok := s.lookupActiveSession(w, r, actor)
+	if !ok {
+		return
+	}
+
+	if err := s.sessions.ExtendSession(session.ID, s.config.ExtendDuration); err != nil {
+		logrus.WithError(err).WithField("session_id", session.ID).Error("Failed to extend session from dashboard")
+		s.renderError(w, http.StatusInternalServerError, "セッションの延長に失敗しました")
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"requester_id": actor.ID,
+		"session_id":   session.ID,
+		"extension":    s.config.ExtendDuration.String(),
+	}).Info("Session extended via dashboard")
+
+	http.Redirect(w, r, "/dashboard/", http.StatusSeeOther)
+}
+
+// lookupActiveSession はパスのセッションIDからアクティブなセッションを取得し、該当しない場合はエラーページを表示する
+// actorと異なるギルドのユーザーのセッションは見つからないものとして扱う
+func (s *Server) lookupActiveSession(w http.ResponseWriter, r *http.Request, actor *db.User) (*db.Session, bool) {
+	sessionID, err := strconv.Atoi(r.PathValue("sessionID"))
+	if err != nil {
+		s.renderError(w, http.StatusBadRequest, "セッションIDが不正です")
+		return nil, false
+	}
+
+	session, err := s.db.GetSessionByID(sessionID)
+	if err != nil {
+		logrus.WithError(err).WithField("session_id", sessionID).Error("Failed to get session")
+		s.renderError(w, http.StatusInternalServerError, "セッション情報の取得に失敗しました")
+		return nil, false
+	}
+	if session == nil || !session.InGuild(actor.GuildID.String) {
+		s.renderError(w, http.StatusNotFound, "セッションが見つかりません")
+		return nil, false
+	}
+	if !session.IsActive() {
+		s.renderError(w, http.StatusConflict, "このセッションは既に終了しています")
+		return nil, false
+	}
+
+	return session, true
+}
+
+// currentUser はCookieからログイン中のユーザーとCookieの値を取得する
+// 未ログイン、Cookieが無効、ユーザーが削除済み、またはアクセス期限が切れている場合はnilを返す
+func (s *Server) currentUser(r *http.Request) (*db.User, string, error) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil, "", nil
+	}
+
+	userID, ok := s.signer.verify(cookie.Value, time.Now())
+	if !ok {
+		return nil, "", nil
+	}
+
+	user, err := s.db.GetUserByID(userID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get user: %w", err)
+	}
+	// ログイン後にアクセス期限が切れた・無効化されたユーザーは未ログインとして扱う
+	if user == nil || user.AccessEnded(time.Now()) {
+		return nil, "", nil
+	}
+
+	return user, cookie.Value, nil
+}
+
+// setCookie はダッシュボード用のCookieを設定する
+func (s *Server) setCookie(w http.ResponseWriter, name, value string, ttl time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     cookiePath,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearCookie はダッシュボード用のCookieを削除する
+func (s *Server) clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Path:     cookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// render はテンプレートを描画する
+func (s *Server) render(w http.ResponseWriter, status int, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := s.templates.ExecuteTemplate(w, name, data); err != nil {
+		logrus.WithError(err).WithField("template", name).Error("Failed to render dashboard")
+	}
+}
+
+// renderError はエラーページを表示する
+func (s *Server) renderError(w http.ResponseWriter, status int, message string) {
+	s.render(w, status, "error.html", map[string]any{"Status": status, "Message": message})
+}
@@ -0,0 +1,371 @@
+package dashboard
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/auth"
+	"github.com/hirano00o/disclaude/internal/config"
+	"github.com/hirano00o/disclaude/internal/db"
+)
+
+// fakeController はテスト用のSessionControllerとStatusProvider
+type fakeController struct {
+	db db.Store
+}
+
+func (f *fakeController) ForceTerminateSession(ctx context.Context, sessionID int, actor *db.User, reason string) error {
+	return f.db.UpdateSessionStatus(sessionID, "terminated")
+}
+
+func (f *fakeController) ExtendSession(sessionID int, extension time.Duration) error {
+	return f.db.ExtendSession(sessionID, int(extension/time.Minute))
+}
+
+func (f *fakeController) PodPhase(podName string) string {
+	return "Running"
+}
+
+func (f *fakeController) QueuedRequests() int {
+	return 2
+}
+
+// testEnv はテスト用のダッシュボードとフェイクのDiscord
+type testEnv struct {
+	db      *db.MemoryStore
+	server  *Server
+	handler http.Handler
+	owner   *db.User
+	user    *db.User
+	session *db.Session
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	store := db.NewMemoryStore(4)
+	owner, _ := store.CreateUser("", "100000000000000001", "owner", "owner")
+	user, _ := store.CreateUser("", "100000000000000002", "alice", "user")
+	session, err := store.CreateSession(user.ID, "thread-1", "claude-thread-1")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	// 認可コードをそのままDiscordユーザーIDとして返すフェイクのDiscord
+	discord := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/oauth2/token":
+			if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "token-" + r.PostFormValue("code")})
+		case "/api/users/@me":
+			discordID := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer token-")
+			json.NewEncoder(w).Encode(discordUser{ID: discordID, Username: "discord-" + discordID})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(discord.Close)
+
+	cfg := config.DashboardConfig{
+		ClientID:       "client",
+		ClientSecret:   "secret",
+		URL:            "http://localhost:8080/dashboard",
+		SessionSecret:  strings.Repeat("s", 32),
+		ExtendDuration: 30 * time.Minute,
+	}
+	permService := auth.NewPermissionService(store, auth.Limits{MaxSessionDuration: time.Hour})
+	controller := &fakeController{db: store}
+	server := NewServer(cfg, store, permService, controller, controller)
+	server.oauth.endpoint = discord.URL
+
+	return &testEnv{
+		db:      store,
+		server:  server,
+		handler: server.Handler(),
+		owner:   owner,
+		user:    user,
+		session: session,
+	}
+}
+
+// serve はCookieを付けてリクエストを送信する
+func (e *testEnv) serve(req *http.Request, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	e.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// login はOAuth2のフローを実行し、ログインセッションのCookieを返す
+func (e *testEnv) login(t *testing.T, discordID string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := e.serve(httptest.NewRequest(http.MethodGet, "/dashboard/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Expected redirect to Discord, got %d", rec.Code)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Failed to parse redirect location: %v", err)
+	}
+	state := location.Query().Get("state")
+	if location.Query().Get("redirect_uri") != "http://localhost:8080/dashboard/callback" {
+		t.Errorf("Unexpected redirect_uri: %s", location.Query().Get("redirect_uri"))
+	}
+
+	callback := httptest.NewRequest(http.MethodGet, "/dashboard/callback?code="+discordID+"&state="+state, nil)
+	return e.serve(callback, findCookie(t, rec, stateCookieName))
+}
+
+// findCookie はレスポンスで設定されたCookieを取得する
+func findCookie(t *testing.T, rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	t.Helper()
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	t.Fatalf("Expected cookie %s to be set", name)
+	return nil
+}
+
+// postForm はCSRFトークンを付けてフォームを送信する
+func (e *testEnv) postForm(path, csrfToken string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	form := url.Values{"csrf_token": {csrfToken}}
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return e.serve(req, cookie)
+}
+
+var csrfPattern = regexp.MustCompile(`name="csrf_token" value="([0-9a-f]+)"`)
+
+// TestLogin はDiscord OAuth2によるログインのテスト
+func TestLogin(t *testing.T) {
+	env := newTestEnv(t)
+
+	// 未ログインの場合はログインページを表示する
+	rec := env.serve(httptest.NewRequest(http.MethodGet, "/dashboard/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Discordでログイン") {
+		t.Fatalf("Expected login page, got %d", rec.Code)
+	}
+
+	// 登録済みユーザーはログインできる
+	rec = env.login(t, env.user.DiscordID)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Expected redirect after login, got %d: %s", rec.Code, rec.Body.String())
+	}
+	cookie := findCookie(t, rec, sessionCookieName)
+
+	rec = env.serve(httptest.NewRequest(http.MethodGet, "/dashboard/", nil), cookie)
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "閲覧のみ") {
+		t.Fatalf("Expected read-only dashboard, got %d", rec.Code)
+	}
+	for _, want := range []string{"claude-thread-1", "Running", "alice"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected dashboard to contain %q", want)
+		}
+	}
+	if strings.Contains(body, "/terminate") {
+		t.Error("Expected no terminate button for non-owner")
+	}
+
+	// 未登録のユーザーはログインできない
+	rec = env.login(t, "100000000000000099")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for unregistered user, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	// アクセス期限が切れたユーザーはログインできず、ログイン済みのCookieも無効になる
+	if err := env.db.SetUserAccess("", env.user.DiscordID, sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}, false); err != nil {
+		t.Fatalf("Failed to set user access: %v", err)
+	}
+	rec = env.login(t, env.user.DiscordID)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for expired user, got %d", http.StatusForbidden, rec.Code)
+	}
+	rec = env.serve(httptest.NewRequest(http.MethodGet, "/dashboard/", nil), cookie)
+	if !strings.Contains(rec.Body.String(), "Discordでログイン") {
+		t.Error("Expected expired user to be logged out")
+	}
+	if err := env.db.SetUserAccess("", env.user.DiscordID, sql.NullTime{}, false); err != nil {
+		t.Fatalf("Failed to restore user access: %v", err)
+	}
+
+	// stateが一致しない場合は拒否する
+	req := httptest.NewRequest(http.MethodGet, "/dashboard/callback?code="+env.owner.DiscordID+"&state=forged", nil)
+	rec = env.serve(req, &http.Cookie{Name: stateCookieName, Value: "expected"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for mismatched state, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	// 改ざんしたCookieは無効
+	tampered := &http.Cookie{Name: sessionCookieName, Value: strconv.Itoa(env.owner.ID) + strings.TrimPrefix(cookie.Value, strconv.Itoa(env.user.ID))}
+	rec = env.serve(httptest.NewRequest(http.MethodGet, "/dashboard/", nil), tampered)
+	if !strings.Contains(rec.Body.String(), "Discordでログイン") {
+		t.Error("Expected tampered cookie to be rejected")
+	}
+}
+
+// TestLoginMultipleGuilds は複数のギルドに登録されたユーザーのログインのテスト
+func TestLoginMultipleGuilds(t *testing.T) {
+	env := newTestEnv(t)
+	const discordID = "100000000000000004"
+
+	_, _ = env.db.UpsertGuild("guild1", "guild1")
+	_, _ = env.db.UpsertGuild("guild2", "guild2")
+	_, _ = env.db.CreateUser("guild1", discordID, "carol", "user")
+	home, _ := env.db.CreateUser("guild2", discordID, "carol", "owner")
+
+	// ログインするギルドを特定できない場合は拒否する
+	if rec := env.login(t, discordID); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without default guild, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	// デフォルトのギルドのユーザーとしてログインする
+	env.server.SetDefaultGuild("guild2")
+	rec := env.login(t, discordID)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Expected redirect after login, got %d: %s", rec.Code, rec.Body.String())
+	}
+	req := httptest.NewRequest(http.MethodGet, "/dashboard/", nil)
+	req.AddCookie(findCookie(t, rec, sessionCookieName))
+	viewer, _, err := env.server.currentUser(req)
+	if err != nil {
+		t.Fatalf("Failed to get current user: %v", err)
+	}
+	if viewer == nil || viewer.ID != home.ID {
+		t.Errorf("Expected the user of the default guild, got %+v", viewer)
+	}
+}
+
+// TestSessionActions はセッションの終了・延長のテスト
+func TestSessionActions(t *testing.T) {
+	env := newTestEnv(t)
+	extendPath := "/dashboard/sessions/" + strconv.Itoa(env.session.ID) + "/extend"
+	terminatePath := "/dashboard/sessions/" + strconv.Itoa(env.session.ID) + "/terminate"
+
+	// manage_sessions 権限を持たないユーザーは操作できない
+	userCookie := findCookie(t, env.login(t, env.user.DiscordID), sessionCookieName)
+	userCSRF := env.server.signer.csrfToken(userCookie.Value)
+	if rec := env.postForm(terminatePath, userCSRF, userCookie); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for non-owner, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	ownerCookie := findCookie(t, env.login(t, env.owner.DiscordID), sessionCookieName)
+	rec := env.serve(httptest.NewRequest(http.MethodGet, "/dashboard/", nil), ownerCookie)
+	match := csrfPattern.FindStringSubmatch(rec.Body.String())
+	if match == nil {
+		t.Fatal("Expected CSRF token in owner dashboard")
+	}
+	csrf := match[1]
+
+	// CSRFトークンがない場合は拒否する
+	if rec := env.postForm(extendPath, "", ownerCookie); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without CSRF token, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	// 延長
+	if rec := env.postForm(extendPath, csrf, ownerCookie); rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected redirect after extend, got %d: %s", rec.Code, rec.Body.String())
+	}
+	session, _ := env.db.GetSessionByID(env.session.ID)
+	if session.ExtensionMinutes != 30 {
+		t.Errorf("Expected extension of 30 minutes, got %d", session.ExtensionMinutes)
+	}
+
+	// 終了
+	if rec := env.postForm(terminatePath, csrf, ownerCookie); rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected redirect after terminate, got %d: %s", rec.Code, rec.Body.String())
+	}
+	session, _ = env.db.GetSessionByID(env.session.ID)
+	if !session.IsTerminated() {
+		t.Errorf("Expected session to be terminated, got %s", session.Status)
+	}
+	if rec := env.postForm(terminatePath, csrf, ownerCookie); rec.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for terminated session, got %d", http.StatusConflict, rec.Code)
+	}
+}
+
+// TestDeletedUserSession は所有者が削除されたセッションを同じギルドで表示・終了できることのテスト
+func TestDeletedUserSession(t *testing.T) {
+	env := newTestEnv(t)
+	if err := env.db.DeleteUser("", env.user.DiscordID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+
+	ownerCookie := findCookie(t, env.login(t, env.owner.DiscordID), sessionCookieName)
+	body := env.serve(httptest.NewRequest(http.MethodGet, "/dashboard/", nil), ownerCookie).Body.String()
+	for _, want := range []string{"claude-thread-1", auth.DeletedUserName} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected owner dashboard to contain %q", want)
+		}
+	}
+
+	match := csrfPattern.FindStringSubmatch(body)
+	if match == nil {
+		t.Fatal("Expected CSRF token in owner dashboard")
+	}
+	terminatePath := "/dashboard/sessions/" + strconv.Itoa(env.session.ID) + "/terminate"
+	if rec := env.postForm(terminatePath, match[1], ownerCookie); rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected redirect after terminate, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if session, _ := env.db.GetSessionByID(env.session.ID); !session.IsTerminated() {
+		t.Errorf("Expected session to be terminated, got %s", session.Status)
+	}
+}
+
+// TestIndexVisibility は view_all_sessions・view_usage 権限がない場合に自分のセッションと使用量のみ表示するテスト
+func TestIndexVisibility(t *testing.T) {
+	env := newTestEnv(t)
+
+	bob, _ := env.db.CreateUser("", "100000000000000003", "bob", "user")
+	bobSession, err := env.db.CreateSession(bob.ID, "thread-2", "claude-thread-2")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	for _, turn := range []*db.ClaudeTurn{
+		{SessionID: sql.NullInt64{Int64: int64(env.session.ID), Valid: true}, UserID: sql.NullInt64{Int64: int64(env.user.ID), Valid: true}, CostUSD: 0.5},
+		{SessionID: sql.NullInt64{Int64: int64(bobSession.ID), Valid: true}, UserID: sql.NullInt64{Int64: int64(bob.ID), Valid: true}, CostUSD: 0.25},
+	} {
+		if _, err := env.db.CreateClaudeTurn(turn); err != nil {
+			t.Fatalf("Failed to create claude turn: %v", err)
+		}
+	}
+
+	userCookie := findCookie(t, env.login(t, env.user.DiscordID), sessionCookieName)
+	body := env.serve(httptest.NewRequest(http.MethodGet, "/dashboard/", nil), userCookie).Body.String()
+	for _, want := range []string{"あなたのアクティブなセッション", "claude-thread-1", "あなたの今月の使用量", "$0.5000"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected user dashboard to contain %q", want)
+		}
+	}
+	for _, hidden := range []string{"claude-thread-2", "bob", "$0.2500"} {
+		if strings.Contains(body, hidden) {
+			t.Errorf("Expected user dashboard to hide %q", hidden)
+		}
+	}
+
+	ownerCookie := findCookie(t, env.login(t, env.owner.DiscordID), sessionCookieName)
+	body = env.serve(httptest.NewRequest(http.MethodGet, "/dashboard/", nil), ownerCookie).Body.String()
+	for _, want := range []string{"claude-thread-1", "claude-thread-2", "bob", "$0.5000", "$0.2500"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected owner dashboard to contain %q", want)
+		}
+	}
+}
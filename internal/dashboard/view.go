@@ -0,0 +1,179 @@
+package dashboard
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/auth"
+	"github.com/hirano00o/disclaude/internal/db"
+)
+
+// indexView はトップページの表示内容
+type indexView struct {
+	Viewer     *db.User
+	CanOperate bool
+	// AllSessions は全ユーザーのセッションを表示するか（view_all_sessions 権限がない場合は自分のセッションのみ）
+	AllSessions bool
+	// AllUsage は全ユーザーの使用量を表示するか（view_usage 権限がない場合は自分の使用量のみ）
+	AllUsage    bool
+	CSRFToken   string
+	ExtendLabel string
+	Capacity    capacityView
+	Sessions    []sessionView
+	Usage       []usageView
+	UsageSince  string
+	GeneratedAt string
+}
+
+// capacityView はサンドボックスの使用状況の表示内容
+type capacityView struct {
+	Current        int
+	Max            int
+	Remaining      int
+	Percent        int
+	ActiveSessions int
+	QueuedRequests int
+}
+
+// sessionView はアクティブなセッション1件分の表示内容
+type sessionView struct {
+	ID          int
+	Owner       string
+	ThreadID    string
+	SandboxName string
+	PodPhase    string
+	Duration    string
+	Deadline    string
+	Expired     bool
+}
+
+// usageView はユーザーごとの使用量1件分の表示内容
+type usageView struct {
+	Username string
+	Turns    int
+	Tokens   int64
+	CostUSD  string
+}
+
+// buildIndexView はトップページの表示内容を組み立てる
+func (s *Server) buildIndexView(viewer *db.User, csrfToken string) (*indexView, error) {
+	canOperate, err := s.can(viewer, auth.CapabilityManageSessions)
+	if err != nil {
+		return nil, err
+	}
+	allSessions, err := s.can(viewer, auth.CapabilityViewAllSessions)
+	if err != nil {
+		return nil, err
+	}
+	allUsage, err := s.can(viewer, auth.CapabilityViewUsage)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	view := &indexView{
+		Viewer:      viewer,
+		CanOperate:  canOperate,
+		AllSessions: allSessions,
+		AllUsage:    allUsage,
+		CSRFToken:   csrfToken,
+		ExtendLabel: s.config.ExtendDuration.String(),
+		GeneratedAt: now.Format("2006-01-02 15:04:05"),
+	}
+
+	usage, err := s.db.GetSandboxUsage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sandbox usage: %w", err)
+	}
+	view.Capacity = capacityView{
+		Current:        usage.CurrentCount,
+		Max:            usage.MaxCount,
+		Remaining:      usage.RemainingCapacity(),
+		QueuedRequests: s.status.QueuedRequests(),
+	}
+	if usage.MaxCount > 0 {
+		view.Capacity.Percent = min(100, usage.CurrentCount*100/usage.MaxCount)
+	}
+
+	sessions, err := s.db.ListSessions("active", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	view.Capacity.ActiveSessions = len(sessions)
+
+	// セッション一覧には閲覧者と同じギルドのセッションのみ表示する
+	// view_all_sessions 権限がない場合は閲覧者自身のセッションのみ表示する
+	owners := make(map[int]string)
+	for _, session := range sessions {
+		if !session.InGuild(viewer.GuildID.String) || (!allSessions && session.OwnerUserID() != viewer.ID) {
+			continue
+		}
+
+		owner, ok := owners[session.OwnerUserID()]
+		if !ok {
+			user, err := s.db.GetUserByID(session.OwnerUserID())
+			if err != nil {
+				return nil, fmt.Errorf("failed to get session owner: %w", err)
+			}
+			// 所有者が削除されたセッションも、同じギルドで管理できるよう表示する
+			owner = auth.DeletedUserName
+			if user != nil {
+				owner = user.Username
+			}
+			owners[session.OwnerUserID()] = owner
+		}
+
+		item := sessionView{
+			ID:          session.ID,
+			Owner:       owner,
+			ThreadID:    session.ThreadID,
+			SandboxName: session.SandboxName,
+			PodPhase:    s.status.PodPhase(session.SandboxName),
+			Duration:    now.Sub(session.CreatedAt).Round(time.Second).String(),
+		}
+
+		deadline, limited, err := s.permService.SessionDeadline(session)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get session deadline: %w", err)
+		}
+		if limited {
+			item.Deadline = deadline.Format("2006-01-02 15:04")
+			item.Expired = !now.Before(deadline)
+		}
+
+		view.Sessions = append(view.Sessions, item)
+	}
+
+	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	view.UsageSince = startOfMonth.Format("2006-01-02")
+	// view_usage 権限がない場合は閲覧者自身の使用量のみ表示する
+	discordID := viewer.DiscordID
+	if allUsage {
+		discordID = ""
+	}
+	usages, err := s.db.GetUserUsage(startOfMonth, viewer.GuildID.String, discordID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user usage: %w", err)
+	}
+	for _, u := range usages {
+		view.Usage = append(view.Usage, usageView{
+			Username: u.Username,
+			Turns:    u.Turns,
+			Tokens:   u.TotalTokens(),
+			CostUSD:  fmt.Sprintf("$%.4f", u.CostUSD),
+		})
+	}
+
+	return view, nil
+}
+
+// can は閲覧者が権限を持つかを返す
+func (s *Server) can(viewer *db.User, capability auth.Capability) (bool, error) {
+	if err := s.permService.Authorize(viewer, capability, nil); err != nil {
+		if !auth.IsPermissionDenied(err) {
+			return false, fmt.Errorf("failed to check permission: %w", err)
+		}
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,1480 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore はStoreのインメモリ実装
+// PostgreSQLと同じ一意制約・外部キー・CHECK制約を再現し、データベースなしでのテストに使用する
+type MemoryStore struct {
+	mu sync.Mutex
+
+	users     []*User
+	sessions  []*Session
+	sandboxes []*Sandbox
+	usage     SandboxUsage
+	turns     []*ClaudeTurn
+	limits    map[int]*UserLimits
+	messages  []*Message
+	apiTokens []*APIToken
+	audit     []*AuditEvent
+	bindings  []*RoleBinding
+	roles     []*Role
+	members   []*SessionMember
+	guilds    []*Guild
+
+	nextUserID    int
+	nextSessionID int
+	nextSandboxID int
+	nextTurnID    int
+	nextMessageID int
+	nextTokenID   int
+	nextAuditID   int
+	nextBindingID int
+	nextRoleID    int
+}
+
+var (
+	validRoleSources     = map[string]bool{"manual": true, "guild_role": true}
+	validSessionStatuses = map[string]bool{"active": true, "inactive": true, "terminated": true, "failed": true}
+	validSandboxStatuses = map[string]bool{"pending": true, "running": true, "succeeded": true, "failed": true, "terminated": true}
+	validMessageRoles    = map[string]bool{"user": true, "assistant": true, "tool_use": true, "tool_result": true, "system": true}
+	validMemberRoles     = map[string]bool{SessionMemberViewer: true, SessionMemberCollaborator: true}
+)
+
+// builtinRoles はマイグレーションで作成される組み込みロール
+var builtinRoles = []Role{
+	{
+		Name:        "owner",
+		Description: "オーナー",
+		Capabilities: []string{
+			"create_sandbox",
+			"view_all_sessions",
+			"manage_sessions",
+			"manage_users",
+			"manage_config",
+			"view_usage",
+			"view_audit",
+		},
+	},
+	{
+		Name:         "user",
+		Description:  "一般ユーザー",
+		Capabilities: []string{"create_sandbox"},
+	},
+}
+
+// NewMemoryStore は新しいMemoryStoreを作成する
+func NewMemoryStore(maxSandboxes int) *MemoryStore {
+	m := &MemoryStore{
+		usage: SandboxUsage{
+			ID:        1,
+			MaxCount:  maxSandboxes,
+			UpdatedAt: time.Now(),
+		},
+		limits: make(map[int]*UserLimits),
+	}
+
+	for _, builtin := range builtinRoles {
+		m.nextRoleID++
+		m.roles = append(m.roles, &Role{
+			ID:           m.nextRoleID,
+			Name:         builtin.Name,
+			Description:  builtin.Description,
+			Builtin:      true,
+			Capabilities: sortedCapabilities(builtin.Capabilities),
+			CreatedAt:    time.Now(),
+		})
+	}
+
+	return m
+}
+
+// CreateUser はguildIDのギルドに新しいユーザーを作成する（空文字列の場合はギルドに属さない）
+// ロールはギルドで使用できるもの（ギルドの独自ロールまたはギルドに属さないロール）のみ指定できる
+func (m *MemoryStore) CreateUser(guildID, discordID, username, role string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findRole(guildID, role) == nil {
+		return nil, fmt.Errorf("failed to create user: role %q does not exist", role)
+	}
+	if err := m.checkGuildExists(guildID); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	if m.findUser(guildID, discordID) != nil {
+		return nil, fmt.Errorf("failed to create user: discord_id %s already exists", discordID)
+	}
+
+	now := time.Now()
+	m.nextUserID++
+	user := &User{
+		ID:         m.nextUserID,
+		DiscordID:  discordID,
+		Username:   username,
+		Role:       role,
+		RoleSource: "manual",
+		GuildID:    nullGuildID(guildID),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	m.users = append(m.users, user)
+
+	created := *user
+	return &created, nil
+}
+
+// GetUserByDiscordID はguildIDのギルドに登録されたユーザーをDiscord IDで取得する（空文字列の場合はギルドに属さないユーザー）
+func (m *MemoryStore) GetUserByDiscordID(guildID, discordID string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.findUser(guildID, discordID)
+	if user == nil {
+		return nil, nil
+	}
+
+	found := *user
+	return &found, nil
+}
+
+// ListUsersByDiscordID はDiscord IDで登録されたすべてのギルドのユーザーを登録順に取得する
+func (m *MemoryStore) ListUsersByDiscordID(discordID string) ([]*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var users []*User
+	for _, user := range m.users {
+		if user.DiscordID == discordID {
+			found := *user
+			users = append(users, &found)
+		}
+	}
+	return users, nil
+}
+
+// GetUserByID はIDでユーザーを取得する
+func (m *MemoryStore) GetUserByID(userID int) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.findUserByID(userID)
+	if user == nil {
+		return nil, nil
+	}
+
+	found := *user
+	return &found, nil
+}
+
+// UpdateUserRole はguildIDのギルドのユーザーの役割を更新する
+// ロールはギルドで使用できるもの（ギルドの独自ロールまたはギルドに属さないロール）のみ指定できる
+func (m *MemoryStore) UpdateUserRole(guildID, discordID, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findRole(guildID, role) == nil {
+		return fmt.Errorf("failed to update user role: role %q does not exist", role)
+	}
+
+	user := m.findUser(guildID, discordID)
+	if user == nil {
+		return fmt.Errorf("user not found")
+	}
+
+	user.Role = role
+	user.UpdatedAt = time.Now()
+	return nil
+}
+
+// SetUserRoleSource はguildIDのギルドのユーザーのロールの管理元（manual または guild_role）を更新する
+func (m *MemoryStore) SetUserRoleSource(guildID, discordID, source string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !validRoleSources[source] {
+		return fmt.Errorf("failed to set user role source: invalid source %q", source)
+	}
+
+	user := m.findUser(guildID, discordID)
+	if user == nil {
+		return fmt.Errorf("user not found")
+	}
+
+	user.RoleSource = source
+	user.UpdatedAt = time.Now()
+	return nil
+}
+
+// SetUserAccess はguildIDのギルドのユーザーのアクセス期限（NULLの場合は無期限）と無効化フラグを更新する
+func (m *MemoryStore) SetUserAccess(guildID, discordID string, expiresAt sql.NullTime, disabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.findUser(guildID, discordID)
+	if user == nil {
+		return fmt.Errorf("user not found")
+	}
+
+	user.ExpiresAt = expiresAt
+	user.Disabled = disabled
+	user.UpdatedAt = time.Now()
+	return nil
+}
+
+// AssignUserToGuild はギルドに属さないユーザーをguildIDのギルドに所属させる
+// 外部キー・一意制約と同様に、登録されていないギルドや、既にそのギルドに登録されているDiscord IDの場合はエラーを返す
+func (m *MemoryStore) AssignUserToGuild(discordID, guildID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if guildID == "" || m.findGuild(guildID) == nil {
+		return fmt.Errorf("failed to assign user to guild: guild %s does not exist", guildID)
+	}
+	if m.findUser(guildID, discordID) != nil {
+		return fmt.Errorf("failed to assign user to guild: discord_id %s already exists", discordID)
+	}
+
+	user := m.findUser("", discordID)
+	if user == nil {
+		return fmt.Errorf("user not found")
+	}
+
+	user.GuildID = nullGuildID(guildID)
+	user.UpdatedAt = time.Now()
+
+	// ユーザーのセッションも同じギルドに移す
+	for _, session := range m.sessions {
+		if !session.GuildID.Valid && session.OwnerUserID() == user.ID {
+			session.GuildID = user.GuildID
+		}
+	}
+	return nil
+}
+
+// ListExpiredUsers はアクセス期限を過ぎたが、まだ無効化されていないユーザーを期限順に取得する
+func (m *MemoryStore) ListExpiredUsers(now time.Time) ([]*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var users []*User
+	for _, user := range m.users {
+		if user.ExpiresAt.Valid && !user.ExpiresAt.Time.After(now) && !user.Disabled {
+			found := *user
+			users = append(users, &found)
+		}
+	}
+
+	sort.SliceStable(users, func(i, j int) bool {
+		return users[i].ExpiresAt.Time.Before(users[j].ExpiresAt.Time)
+	})
+	return users, nil
+}
+
+// DeleteUser はguildIDのギルドのユーザーを削除する
+// 外部キーと同様に、利用上限・招待・APIトークンを連鎖削除し、セッション・会話履歴・使用量の参照はNULLにする
+func (m *MemoryStore) DeleteUser(guildID, discordID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.findUser(guildID, discordID)
+	if user == nil {
+		return fmt.Errorf("user not found")
+	}
+
+	for _, session := range m.sessions {
+		if session.OwnerUserID() == user.ID {
+			session.UserID = sql.NullInt64{}
+		}
+	}
+
+	for _, message := range m.messages {
+		if message.UserID.Valid && int(message.UserID.Int64) == user.ID {
+			message.UserID = sql.NullInt64{}
+		}
+	}
+
+	for _, turn := range m.turns {
+		if turn.UserID.Valid && int(turn.UserID.Int64) == user.ID {
+			turn.UserID = sql.NullInt64{}
+		}
+	}
+
+	delete(m.limits, user.ID)
+
+	members := m.members[:0]
+	for _, member := range m.members {
+		if member.UserID == user.ID {
+			continue
+		}
+		if member.InvitedBy.Valid && int(member.InvitedBy.Int64) == user.ID {
+			member.InvitedBy = sql.NullInt64{}
+		}
+		members = append(members, member)
+	}
+	m.members = members
+
+	tokens := m.apiTokens[:0]
+	for _, token := range m.apiTokens {
+		if token.UserID != user.ID {
+			tokens = append(tokens, token)
+		}
+	}
+	m.apiTokens = tokens
+
+	users := m.users[:0]
+	for _, u := range m.users {
+		if u.ID != user.ID {
+			users = append(users, u)
+		}
+	}
+	m.users = users
+
+	return nil
+}
+
+// CreateSession は新しいセッションを作成する
+func (m *MemoryStore) CreateSession(userID int, threadID, sandboxName string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	owner := m.findUserByID(userID)
+	if owner == nil {
+		return nil, fmt.Errorf("failed to create session: user %d does not exist", userID)
+	}
+	for _, session := range m.sessions {
+		if session.ThreadID == threadID && session.IsActive() {
+			return nil, fmt.Errorf("failed to create session: active session for thread_id %s already exists", threadID)
+		}
+		if session.SandboxName == sandboxName {
+			return nil, fmt.Errorf("failed to create session: sandbox_name %s already exists", sandboxName)
+		}
+	}
+
+	now := time.Now()
+	m.nextSessionID++
+	session := &Session{
+		ID:          m.nextSessionID,
+		UserID:      sql.NullInt64{Int64: int64(userID), Valid: true},
+		GuildID:     owner.GuildID,
+		ThreadID:    threadID,
+		SandboxName: sandboxName,
+		Status:      "active",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	m.sessions = append(m.sessions, session)
+
+	created := *session
+	return &created, nil
+}
+
+// GetSessionByThreadID はスレッドIDでセッションを取得する
+// DMのように同じチャンネルで複数のセッションが作成された場合は最新のセッションを返す
+func (m *MemoryStore) GetSessionByThreadID(threadID string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.sessions) - 1; i >= 0; i-- {
+		if session := m.sessions[i]; session.ThreadID == threadID {
+			found := *session
+			return &found, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// GetSessionByID はIDでセッションを取得する
+func (m *MemoryStore) GetSessionByID(sessionID int) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session := m.findSessionByID(sessionID)
+	if session == nil {
+		return nil, nil
+	}
+
+	found := *session
+	return &found, nil
+}
+
+// UpdateSessionStatus はセッションのステータスを更新する
+func (m *MemoryStore) UpdateSessionStatus(sessionID int, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !validSessionStatuses[status] {
+		return fmt.Errorf("failed to update session status: invalid status %q", status)
+	}
+
+	session := m.findSessionByID(sessionID)
+	if session == nil {
+		return nil
+	}
+	if status == "active" {
+		for _, other := range m.sessions {
+			if other.ID != session.ID && other.ThreadID == session.ThreadID && other.IsActive() {
+				return fmt.Errorf("failed to update session status: active session for thread_id %s already exists", session.ThreadID)
+			}
+		}
+	}
+
+	now := time.Now()
+	session.Status = status
+	session.UpdatedAt = now
+	session.TerminatedAt = sql.NullTime{}
+	if status == "terminated" {
+		session.TerminatedAt = sql.NullTime{Time: now, Valid: true}
+	}
+
+	return nil
+}
+
+// UpdateSessionSandboxName はセッションに割り当てたサンドボックス名を更新する
+func (m *MemoryStore) UpdateSessionSandboxName(sessionID int, sandboxName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, session := range m.sessions {
+		if session.ID != sessionID && session.SandboxName == sandboxName {
+			return fmt.Errorf("failed to update session sandbox name: sandbox_name %s already exists", sandboxName)
+		}
+	}
+
+	session := m.findSessionByID(sessionID)
+	if session == nil {
+		return nil
+	}
+
+	session.SandboxName = sandboxName
+	session.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// ExtendSession はセッションの最大利用時間を指定した分数だけ延長する
+func (m *MemoryStore) ExtendSession(sessionID int, minutes int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session := m.findSessionByID(sessionID)
+	if session == nil {
+		return nil
+	}
+
+	session.ExtensionMinutes += minutes
+	session.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// CountActiveSessions はアクティブなセッション数を取得する
+func (m *MemoryStore) CountActiveSessions() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, session := range m.sessions {
+		if session.IsActive() {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// CountActiveSessionsByGuild はギルドのアクティブなセッション数を取得する
+func (m *MemoryStore) CountActiveSessionsByGuild(guildID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, session := range m.sessions {
+		if session.InGuild(guildID) && session.IsActive() {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// CountActiveSessionsByUserID はユーザーのアクティブなセッション数を取得する
+func (m *MemoryStore) CountActiveSessionsByUserID(userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, session := range m.sessions {
+		if session.OwnerUserID() == userID && session.IsActive() {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// CreateSandbox は新しいサンドボックスを作成する
+func (m *MemoryStore) CreateSandbox(sessionID int, podName, namespace string) (*Sandbox, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findSessionByID(sessionID) == nil {
+		return nil, fmt.Errorf("failed to create sandbox: session %d does not exist", sessionID)
+	}
+	if m.findSandboxByPodName(podName) != nil {
+		return nil, fmt.Errorf("failed to create sandbox: pod_name %s already exists", podName)
+	}
+
+	now := time.Now()
+	m.nextSandboxID++
+	sandbox := &Sandbox{
+		ID:          m.nextSandboxID,
+		SessionID:   sessionID,
+		PodName:     podName,
+		Namespace:   namespace,
+		CPULimit:    "1000m",
+		MemoryLimit: "2Gi",
+		Status:      "pending",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	m.sandboxes = append(m.sandboxes, sandbox)
+
+	created := *sandbox
+	return &created, nil
+}
+
+// GetSandboxByPodName はPod名でサンドボックスを取得する
+func (m *MemoryStore) GetSandboxByPodName(podName string) (*Sandbox, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sandbox := m.findSandboxByPodName(podName)
+	if sandbox == nil {
+		return nil, nil
+	}
+
+	found := *sandbox
+	return &found, nil
+}
+
+// UpdateSandboxStatus はサンドボックスのステータスを更新する
+func (m *MemoryStore) UpdateSandboxStatus(sandboxID int, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !validSandboxStatuses[status] {
+		return fmt.Errorf("failed to update sandbox status: invalid status %q", status)
+	}
+
+	for _, sandbox := range m.sandboxes {
+		if sandbox.ID == sandboxID {
+			sandbox.Status = status
+			sandbox.UpdatedAt = time.Now()
+			break
+		}
+	}
+
+	return nil
+}
+
+// TransitionSandboxStatus はサンドボックスのステータスがfromの場合のみtoに更新し、更新したかを返す
+func (m *MemoryStore) TransitionSandboxStatus(sandboxID int, from, to string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !validSandboxStatuses[to] {
+		return false, fmt.Errorf("failed to transition sandbox status: invalid status %q", to)
+	}
+
+	for _, sandbox := range m.sandboxes {
+		if sandbox.ID == sandboxID && sandbox.Status == from {
+			sandbox.Status = to
+			sandbox.UpdatedAt = time.Now()
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// GetSandboxUsage はサンドボックスの使用状況を取得する
+func (m *MemoryStore) GetSandboxUsage() (*SandboxUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage := m.usage
+	return &usage, nil
+}
+
+// IncrementSandboxUsage はサンドボックスの使用数を増加させる
+func (m *MemoryStore) IncrementSandboxUsage() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.usage.CurrentCount++
+	m.usage.UpdatedAt = time.Now()
+	return nil
+}
+
+// DecrementSandboxUsage はサンドボックスの使用数を減少させる
+func (m *MemoryStore) DecrementSandboxUsage() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.usage.CurrentCount > 0 {
+		m.usage.CurrentCount--
+	}
+	m.usage.UpdatedAt = time.Now()
+	return nil
+}
+
+// GetSessionGuild はセッションが属するギルドの設定を取得する（ギルドに属さない場合はnil）
+func (m *MemoryStore) GetSessionGuild(sessionID int) (*Guild, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session := m.findSessionByID(sessionID)
+	if session == nil || !session.GuildID.Valid {
+		return nil, nil
+	}
+	guild := m.findGuild(session.GuildID.String)
+	if guild == nil {
+		return nil, nil
+	}
+
+	found := *guild
+	return &found, nil
+}
+
+// CountActiveSandboxesByGuild はギルドのセッションで作成中・実行中のサンドボックス数を取得する
+func (m *MemoryStore) CountActiveSandboxesByGuild(guildID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, sandbox := range m.sandboxes {
+		if sandbox.Status != "pending" && sandbox.Status != "running" {
+			continue
+		}
+		if session := m.findSessionByID(sandbox.SessionID); session != nil && session.InGuild(guildID) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// CreateClaudeTurn はClaude Codeの1ターンの使用量を記録する
+func (m *MemoryStore) CreateClaudeTurn(turn *ClaudeTurn) (*ClaudeTurn, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if turn.SessionID.Valid && m.findSessionByID(int(turn.SessionID.Int64)) == nil {
+		return nil, fmt.Errorf("failed to create claude turn: session %d does not exist", turn.SessionID.Int64)
+	}
+	if turn.UserID.Valid && m.findUserByID(int(turn.UserID.Int64)) == nil {
+		return nil, fmt.Errorf("failed to create claude turn: user %d does not exist", turn.UserID.Int64)
+	}
+
+	m.nextTurnID++
+	stored := *turn
+	stored.ID = m.nextTurnID
+	stored.CreatedAt = time.Now()
+	m.turns = append(m.turns, &stored)
+
+	created := stored
+	return &created, nil
+}
+
+// GetSessionUsage はセッションの累計使用量を取得する
+func (m *MemoryStore) GetSessionUsage(sessionID int) (*UsageSummary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	summary := &UsageSummary{}
+	for _, turn := range m.turns {
+		if turn.SessionID.Valid && int(turn.SessionID.Int64) == sessionID {
+			addTurn(summary, turn)
+		}
+	}
+
+	return summary, nil
+}
+
+// GetUserUsage は指定日時以降のguildIDのギルドのユーザーごとの使用量を取得する
+// discordIDが空の場合はギルドの全ユーザーを対象とする
+func (m *MemoryStore) GetUserUsage(since time.Time, guildID, discordID string) ([]*UserUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byUser := make(map[int]*UserUsage)
+	for _, turn := range m.turns {
+		if !turn.UserID.Valid || turn.CreatedAt.Before(since) {
+			continue
+		}
+
+		user := m.findUserByID(int(turn.UserID.Int64))
+		if user == nil || !user.InGuild(guildID) || (discordID != "" && user.DiscordID != discordID) {
+			continue
+		}
+
+		usage, ok := byUser[user.ID]
+		if !ok {
+			usage = &UserUsage{DiscordID: user.DiscordID, Username: user.Username}
+			byUser[user.ID] = usage
+		}
+		addTurn(&usage.UsageSummary, turn)
+	}
+
+	var usages []*UserUsage
+	for _, usage := range byUser {
+		usages = append(usages, usage)
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].CostUSD != usages[j].CostUSD {
+			return usages[i].CostUSD > usages[j].CostUSD
+		}
+		return usages[i].Username < usages[j].Username
+	})
+
+	return usages, nil
+}
+
+// GetUsageByUserID は指定日時以降のユーザーの使用量を取得する
+func (m *MemoryStore) GetUsageByUserID(userID int, since time.Time) (*UsageSummary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	summary := &UsageSummary{}
+	for _, turn := range m.turns {
+		if turn.UserID.Valid && int(turn.UserID.Int64) == userID && !turn.CreatedAt.Before(since) {
+			addTurn(summary, turn)
+		}
+	}
+
+	return summary, nil
+}
+
+// GetUserLimits はユーザーの利用上限の上書き設定を取得する
+func (m *MemoryStore) GetUserLimits(userID int) (*UserLimits, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	limits, ok := m.limits[userID]
+	if !ok {
+		return nil, nil
+	}
+
+	found := *limits
+	return &found, nil
+}
+
+// UpsertUserLimits はユーザーの利用上限の上書き設定を作成または更新する
+func (m *MemoryStore) UpsertUserLimits(limits *UserLimits) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findUserByID(limits.UserID) == nil {
+		return fmt.Errorf("failed to upsert user limits: user %d does not exist", limits.UserID)
+	}
+
+	now := time.Now()
+	stored := *limits
+	stored.CreatedAt = now
+	if existing, ok := m.limits[limits.UserID]; ok {
+		stored.CreatedAt = existing.CreatedAt
+	}
+	stored.UpdatedAt = now
+	m.limits[limits.UserID] = &stored
+
+	return nil
+}
+
+// CreateMessage は会話履歴を1件記録する
+func (m *MemoryStore) CreateMessage(message *Message) (*Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !validMessageRoles[message.Role] {
+		return nil, fmt.Errorf("failed to create message: invalid role %q", message.Role)
+	}
+	if m.findSessionByID(message.SessionID) == nil {
+		return nil, fmt.Errorf("failed to create message: session %d does not exist", message.SessionID)
+	}
+	if message.UserID.Valid && m.findUserByID(int(message.UserID.Int64)) == nil {
+		return nil, fmt.Errorf("failed to create message: user %d does not exist", message.UserID.Int64)
+	}
+
+	m.nextMessageID++
+	stored := *message
+	stored.ID = m.nextMessageID
+	stored.CreatedAt = time.Now()
+	m.messages = append(m.messages, &stored)
+
+	created := stored
+	return &created, nil
+}
+
+// GetMessagesBySessionID はセッションの会話履歴を記録順に取得する
+func (m *MemoryStore) GetMessagesBySessionID(sessionID int) ([]*Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var messages []*Message
+	for _, message := range m.messages {
+		if message.SessionID == sessionID {
+			found := *message
+			messages = append(messages, &found)
+		}
+	}
+
+	return messages, nil
+}
+
+// GetLastMessageBySessionID はセッションで最後に記録されたメッセージを取得する
+func (m *MemoryStore) GetLastMessageBySessionID(sessionID int) (*Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].SessionID == sessionID {
+			found := *m.messages[i]
+			return &found, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// ListUsers はすべてのユーザーを登録順に取得する
+func (m *MemoryStore) ListUsers() ([]*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var users []*User
+	for _, user := range m.users {
+		found := *user
+		users = append(users, &found)
+	}
+	return users, nil
+}
+
+// ListSessions はセッションを新しい順に取得する
+// statusが空の場合はすべての状態、limitが0以下の場合は件数を制限しない
+func (m *MemoryStore) ListSessions(status string, limit int) ([]*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sessions []*Session
+	for i := len(m.sessions) - 1; i >= 0; i-- {
+		if status != "" && m.sessions[i].Status != status {
+			continue
+		}
+		if limit > 0 && len(sessions) >= limit {
+			break
+		}
+		found := *m.sessions[i]
+		sessions = append(sessions, &found)
+	}
+	return sessions, nil
+}
+
+// ListSessionsByGuild はguildIDのギルドのセッションを新しい順に取得する（空文字列はギルドに属さないセッション）
+// statusが空の場合はすべての状態、limitが0以下の場合は件数を制限しない
+func (m *MemoryStore) ListSessionsByGuild(guildID, status string, limit int) ([]*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sessions []*Session
+	for i := len(m.sessions) - 1; i >= 0; i-- {
+		if !m.sessions[i].InGuild(guildID) || (status != "" && m.sessions[i].Status != status) {
+			continue
+		}
+		if limit > 0 && len(sessions) >= limit {
+			break
+		}
+		found := *m.sessions[i]
+		sessions = append(sessions, &found)
+	}
+	return sessions, nil
+}
+
+// CreateAPIToken は管理APIのアクセストークンを登録する
+func (m *MemoryStore) CreateAPIToken(userID int, name, tokenHash string) (*APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findUserByID(userID) == nil {
+		return nil, fmt.Errorf("failed to create api token: user %d does not exist", userID)
+	}
+	if m.findAPITokenByHash(tokenHash) != nil {
+		return nil, fmt.Errorf("failed to create api token: token_hash already exists")
+	}
+
+	m.nextTokenID++
+	token := &APIToken{
+		ID:        m.nextTokenID,
+		UserID:    userID,
+		Name:      name,
+		TokenHash: tokenHash,
+		CreatedAt: time.Now(),
+	}
+	m.apiTokens = append(m.apiTokens, token)
+
+	created := *token
+	return &created, nil
+}
+
+// GetAPITokenByHash はハッシュでアクセストークンを取得する（失効済みも含む）
+func (m *MemoryStore) GetAPITokenByHash(tokenHash string) (*APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token := m.findAPITokenByHash(tokenHash)
+	if token == nil {
+		return nil, nil
+	}
+	found := *token
+	return &found, nil
+}
+
+// ListAPITokens はすべてのアクセストークンを登録順に取得する
+func (m *MemoryStore) ListAPITokens() ([]*APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tokens []*APIToken
+	for _, token := range m.apiTokens {
+		found := *token
+		tokens = append(tokens, &found)
+	}
+	return tokens, nil
+}
+
+// TouchAPIToken はアクセストークンの最終使用日時を更新する
+func (m *MemoryStore) TouchAPIToken(tokenID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, token := range m.apiTokens {
+		if token.ID == tokenID {
+			token.LastUsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+// RevokeAPIToken はアクセストークンを失効させる
+func (m *MemoryStore) RevokeAPIToken(tokenID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, token := range m.apiTokens {
+		if token.ID == tokenID && !token.RevokedAt.Valid {
+			token.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			return nil
+		}
+	}
+	return fmt.Errorf("api token not found")
+}
+
+// CreateAuditEvent は監査ログを記録する
+func (m *MemoryStore) CreateAuditEvent(event *AuditEvent) (*AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextAuditID++
+	stored := *event
+	stored.ID = m.nextAuditID
+	stored.CreatedAt = time.Now()
+	m.audit = append(m.audit, &stored)
+
+	created := stored
+	return &created, nil
+}
+
+// ListAuditEvents はギルドの監査ログを新しい順に取得する
+// discordIDを指定した場合は、そのユーザーが実行者または対象の記録のみを返す（limitが0以下の場合は全件）
+func (m *MemoryStore) ListAuditEvents(guildID, discordID string, limit int) ([]*AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []*AuditEvent
+	for i := len(m.audit) - 1; i >= 0; i-- {
+		event := m.audit[i]
+		if event.GuildID != nullGuildID(guildID) {
+			continue
+		}
+		if discordID != "" && event.ActorDiscordID != discordID && event.TargetDiscordID.String != discordID {
+			continue
+		}
+		if limit > 0 && len(events) >= limit {
+			break
+		}
+		found := *event
+		events = append(events, &found)
+	}
+	return events, nil
+}
+
+// UpsertRoleBinding はguildIDのギルドのDiscordロールとBotのロールの対応を登録または更新する
+func (m *MemoryStore) UpsertRoleBinding(guildID, discordRoleID, role string) (*RoleBinding, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findRole(guildID, role) == nil {
+		return nil, fmt.Errorf("failed to upsert role binding: role %q does not exist", role)
+	}
+	if err := m.checkGuildExists(guildID); err != nil {
+		return nil, fmt.Errorf("failed to upsert role binding: %w", err)
+	}
+
+	if binding := m.findBinding(guildID, discordRoleID); binding != nil {
+		binding.Role = role
+		updated := *binding
+		return &updated, nil
+	}
+
+	m.nextBindingID++
+	binding := &RoleBinding{
+		ID:            m.nextBindingID,
+		GuildID:       nullGuildID(guildID),
+		DiscordRoleID: discordRoleID,
+		Role:          role,
+		CreatedAt:     time.Now(),
+	}
+	m.bindings = append(m.bindings, binding)
+
+	created := *binding
+	return &created, nil
+}
+
+// DeleteRoleBinding はguildIDのギルドのDiscordロールの対応を削除する
+func (m *MemoryStore) DeleteRoleBinding(guildID, discordRoleID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, binding := range m.bindings {
+		if binding.GuildID.String == guildID && binding.DiscordRoleID == discordRoleID {
+			m.bindings = append(m.bindings[:i], m.bindings[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("role binding not found")
+}
+
+// findBinding はguildIDのギルドのDiscordロールの対応を返す（ロック取得済みで呼び出す）
+func (m *MemoryStore) findBinding(guildID, discordRoleID string) *RoleBinding {
+	for _, binding := range m.bindings {
+		if binding.GuildID.String == guildID && binding.DiscordRoleID == discordRoleID {
+			return binding
+		}
+	}
+	return nil
+}
+
+// ListRoleBindings はすべてのギルドロールの対応を登録順に取得する
+func (m *MemoryStore) ListRoleBindings() ([]*RoleBinding, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var bindings []*RoleBinding
+	for _, binding := range m.bindings {
+		found := *binding
+		bindings = append(bindings, &found)
+	}
+	return bindings, nil
+}
+
+// CreateRole は新しいロールをケイパビリティとともに作成する
+// guildIDを指定した場合はそのギルドの独自ロールになる
+func (m *MemoryStore) CreateRole(guildID, name, description string, capabilities []string) (*Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findScopedRole(guildID, name) != nil {
+		return nil, fmt.Errorf("failed to create role: name %s already exists", name)
+	}
+	if err := m.checkGuildExists(guildID); err != nil {
+		return nil, fmt.Errorf("failed to create role: %w", err)
+	}
+
+	m.nextRoleID++
+	role := &Role{
+		ID:           m.nextRoleID,
+		Name:         name,
+		Description:  description,
+		GuildID:      nullGuildID(guildID),
+		Capabilities: sortedCapabilities(capabilities),
+		CreatedAt:    time.Now(),
+	}
+	m.roles = append(m.roles, role)
+
+	return copyRole(role), nil
+}
+
+// GetRoleByName はguildIDのギルドで使用できるロールを名前でケイパビリティとともに取得する
+// ギルドの独自ロールを、同じ名前のギルドに属さないロールより優先する
+func (m *MemoryStore) GetRoleByName(guildID, name string) (*Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	role := m.findRole(guildID, name)
+	if role == nil {
+		return nil, nil
+	}
+	return copyRole(role), nil
+}
+
+// ListRoles はすべてのロールをケイパビリティとともに作成順に取得する
+func (m *MemoryStore) ListRoles() ([]*Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var roles []*Role
+	for _, role := range m.roles {
+		roles = append(roles, copyRole(role))
+	}
+	return roles, nil
+}
+
+// SetRoleCapabilities はguildIDのギルドのロール（空文字列の場合はギルドに属さないロール）のケイパビリティを指定したものに置き換える
+func (m *MemoryStore) SetRoleCapabilities(guildID, name string, capabilities []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	role := m.findScopedRole(guildID, name)
+	if role == nil {
+		return fmt.Errorf("role not found")
+	}
+
+	role.Capabilities = sortedCapabilities(capabilities)
+	return nil
+}
+
+// DeleteRole はguildIDのギルドのロール（空文字列の場合はギルドに属さないロール）を削除する
+// ロールを使用できるギルドのユーザーまたはロール連携から参照されている場合はエラーを返す
+func (m *MemoryStore) DeleteRole(guildID, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	target := m.findScopedRole(guildID, name)
+	if target == nil {
+		return fmt.Errorf("role not found")
+	}
+
+	// ギルドに属さないロールはすべてのギルドから参照できる
+	for _, user := range m.users {
+		if user.Role == name && (guildID == "" || user.InGuild(guildID)) {
+			return fmt.Errorf("failed to delete role: role %q is referenced by users or role bindings", name)
+		}
+	}
+	for _, binding := range m.bindings {
+		if binding.Role == name && (guildID == "" || binding.GuildID.String == guildID) {
+			return fmt.Errorf("failed to delete role: role %q is referenced by users or role bindings", name)
+		}
+	}
+
+	for i, role := range m.roles {
+		if role == target {
+			m.roles = append(m.roles[:i], m.roles[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// UpsertSessionMember はセッションにユーザーを招待する（招待済みの場合はロールを更新する）
+func (m *MemoryStore) UpsertSessionMember(sessionID, userID int, role string, invitedBy int) (*SessionMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findSessionByID(sessionID) == nil {
+		return nil, fmt.Errorf("failed to upsert session member: session %d does not exist", sessionID)
+	}
+	if m.findUserByID(userID) == nil || m.findUserByID(invitedBy) == nil {
+		return nil, fmt.Errorf("failed to upsert session member: user does not exist")
+	}
+	if !validMemberRoles[role] {
+		return nil, fmt.Errorf("failed to upsert session member: invalid role %q", role)
+	}
+
+	inviter := sql.NullInt64{Int64: int64(invitedBy), Valid: true}
+	for _, member := range m.members {
+		if member.SessionID == sessionID && member.UserID == userID {
+			member.Role = role
+			member.InvitedBy = inviter
+			updated := *member
+			return &updated, nil
+		}
+	}
+
+	member := &SessionMember{
+		SessionID: sessionID,
+		UserID:    userID,
+		Role:      role,
+		InvitedBy: inviter,
+		CreatedAt: time.Now(),
+	}
+	m.members = append(m.members, member)
+
+	created := *member
+	return &created, nil
+}
+
+// GetSessionMember はセッションに招待されたユーザーを取得する
+func (m *MemoryStore) GetSessionMember(sessionID, userID int) (*SessionMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, member := range m.members {
+		if member.SessionID == sessionID && member.UserID == userID {
+			found := *member
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListSessionMembers はセッションに招待されたユーザーを招待順に取得する
+func (m *MemoryStore) ListSessionMembers(sessionID int) ([]*SessionMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var members []*SessionMember
+	for _, member := range m.members {
+		if member.SessionID == sessionID {
+			found := *member
+			members = append(members, &found)
+		}
+	}
+	return members, nil
+}
+
+// UpsertGuild はギルドを登録する（登録済みの場合は名前のみ更新し、空の名前では更新しない）
+func (m *MemoryStore) UpsertGuild(guildID, name string) (*Guild, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	guild := m.findGuild(guildID)
+	if guild == nil {
+		guild = &Guild{GuildID: guildID, CreatedAt: now, UpdatedAt: now}
+		m.guilds = append(m.guilds, guild)
+	}
+	if name != "" {
+		guild.Name = name
+		guild.UpdatedAt = now
+	}
+
+	found := *guild
+	return &found, nil
+}
+
+// GetGuild はギルドIDでギルドの設定を取得する
+func (m *MemoryStore) GetGuild(guildID string) (*Guild, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	guild := m.findGuild(guildID)
+	if guild == nil {
+		return nil, nil
+	}
+
+	found := *guild
+	return &found, nil
+}
+
+// ListGuilds はすべてのギルドの設定を登録順に取得する
+func (m *MemoryStore) ListGuilds() ([]*Guild, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var guilds []*Guild
+	for _, guild := range m.guilds {
+		found := *guild
+		guilds = append(guilds, &found)
+	}
+	return guilds, nil
+}
+
+// UpdateGuildSettings はギルドのサンドボックス数・管理チャンネル・利用上限を更新する
+func (m *MemoryStore) UpdateGuildSettings(guild *Guild) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.findGuild(guild.GuildID)
+	if stored == nil {
+		return fmt.Errorf("guild not found")
+	}
+
+	stored.MaxSandboxes = guild.MaxSandboxes
+	stored.AuditChannelID = guild.AuditChannelID
+	stored.DailyCostUSD = guild.DailyCostUSD
+	stored.MonthlyCostUSD = guild.MonthlyCostUSD
+	stored.DailyTokens = guild.DailyTokens
+	stored.MonthlyTokens = guild.MonthlyTokens
+	stored.MaxSessions = guild.MaxSessions
+	stored.MaxSessionMinutes = guild.MaxSessionMinutes
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+// AssignUnscopedToGuild はギルドに属さないユーザー・セッション・独自ロール・ロール連携・監査ログをギルドに割り当て、割り当てたユーザー数を返す
+func (m *MemoryStore) AssignUnscopedToGuild(guildID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if guildID == "" || m.findGuild(guildID) == nil {
+		return 0, fmt.Errorf("failed to assign records to guild: guild %s does not exist", guildID)
+	}
+
+	assigned := 0
+	scoped := nullGuildID(guildID)
+	// 一意制約に反するため、既にギルドに登録されているDiscord IDのユーザー・同じ名前のロール・同じDiscordロールの連携はギルドに属さないまま残す
+	for _, user := range m.users {
+		if !user.GuildID.Valid && m.findUser(guildID, user.DiscordID) == nil {
+			user.GuildID = scoped
+			assigned++
+		}
+	}
+	for _, role := range m.roles {
+		if !role.GuildID.Valid && !role.Builtin && m.findScopedRole(guildID, role.Name) == nil {
+			role.GuildID = scoped
+		}
+	}
+	for _, binding := range m.bindings {
+		if !binding.GuildID.Valid && m.findBinding(guildID, binding.DiscordRoleID) == nil {
+			binding.GuildID = scoped
+		}
+	}
+	for _, event := range m.audit {
+		if !event.GuildID.Valid {
+			event.GuildID = scoped
+		}
+	}
+	// 移行したユーザーのセッションと、所有者が削除されたギルドに属さないセッション
+	for _, session := range m.sessions {
+		if session.GuildID.Valid {
+			continue
+		}
+		if owner := m.findUserByID(session.OwnerUserID()); owner == nil || owner.InGuild(guildID) {
+			session.GuildID = scoped
+		}
+	}
+
+	return assigned, nil
+}
+
+// checkGuildExists は外部キーと同様に、ギルドが登録されているかチェックする（空文字列はNULLとして許可する、ロック取得済みで呼び出す）
+func (m *MemoryStore) checkGuildExists(guildID string) error {
+	if guildID != "" && m.findGuild(guildID) == nil {
+		return fmt.Errorf("guild %s does not exist", guildID)
+	}
+	return nil
+}
+
+// findGuild はギルドIDでギルドを検索する（ロック取得済みで呼び出す）
+func (m *MemoryStore) findGuild(guildID string) *Guild {
+	for _, guild := range m.guilds {
+		if guild.GuildID == guildID {
+			return guild
+		}
+	}
+	return nil
+}
+
+// nullGuildID は空文字列をNULLとして扱うギルドIDを返す
+func nullGuildID(guildID string) sql.NullString {
+	return sql.NullString{String: guildID, Valid: guildID != ""}
+}
+
+// findRole はguildIDのギルドで使用できるロールを名前で検索する（ギルドの独自ロールを優先する、ロック取得済みで呼び出す）
+func (m *MemoryStore) findRole(guildID, name string) *Role {
+	if role := m.findScopedRole(guildID, name); role != nil {
+		return role
+	}
+	return m.findScopedRole("", name)
+}
+
+// findScopedRole はguildIDのギルドのロール（空文字列の場合はギルドに属さないロール）を名前で検索する（ロック取得済みで呼び出す）
+func (m *MemoryStore) findScopedRole(guildID, name string) *Role {
+	for _, role := range m.roles {
+		if role.Name == name && role.GuildID.String == guildID {
+			return role
+		}
+	}
+	return nil
+}
+
+// copyRole はケイパビリティのスライスを含めてロールを複製する
+func copyRole(role *Role) *Role {
+	copied := *role
+	copied.Capabilities = append([]string(nil), role.Capabilities...)
+	return &copied
+}
+
+// findAPITokenByHash はハッシュでアクセストークンを検索する（ロック取得済みで呼び出す）
+func (m *MemoryStore) findAPITokenByHash(tokenHash string) *APIToken {
+	for _, token := range m.apiTokens {
+		if token.TokenHash == tokenHash {
+			return token
+		}
+	}
+	return nil
+}
+
+// findUser はguildIDのギルドのユーザー（空文字列の場合はギルドに属さないユーザー）をDiscord IDで検索する（ロック取得済みで呼び出す）
+func (m *MemoryStore) findUser(guildID, discordID string) *User {
+	for _, user := range m.users {
+		if user.DiscordID == discordID && user.InGuild(guildID) {
+			return user
+		}
+	}
+	return nil
+}
+
+// findUserByID はIDでユーザーを検索する（ロック取得済みで呼び出す）
+func (m *MemoryStore) findUserByID(userID int) *User {
+	for _, user := range m.users {
+		if user.ID == userID {
+			return user
+		}
+	}
+	return nil
+}
+
+// findSessionByID はIDでセッションを検索する（ロック取得済みで呼び出す）
+func (m *MemoryStore) findSessionByID(sessionID int) *Session {
+	for _, session := range m.sessions {
+		if session.ID == sessionID {
+			return session
+		}
+	}
+	return nil
+}
+
+// findSandboxByPodName はPod名でサンドボックスを検索する（ロック取得済みで呼び出す）
+func (m *MemoryStore) findSandboxByPodName(podName string) *Sandbox {
+	for _, sandbox := range m.sandboxes {
+		if sandbox.PodName == podName {
+			return sandbox
+		}
+	}
+	return nil
+}
+
+// addTurn はターンの使用量を集計結果に加算する
+func addTurn(summary *UsageSummary, turn *ClaudeTurn) {
+	summary.Turns++
+	summary.InputTokens += turn.InputTokens
+	summary.OutputTokens += turn.OutputTokens
+	summary.CostUSD += turn.CostUSD
+}
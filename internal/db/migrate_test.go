@@ -0,0 +1,69 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestLoadMigrations は埋め込まれたマイグレーションの読み込みのテスト
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("Expected at least one migration")
+	}
+
+	if migrations[0].Version != 1 || migrations[0].Name != "initial" {
+		t.Errorf("Expected first migration 0001_initial, got %04d_%s", migrations[0].Version, migrations[0].Name)
+	}
+
+	for i, migration := range migrations {
+		if i > 0 && migration.Version <= migrations[i-1].Version {
+			t.Errorf("Migrations are not ordered: %d after %d", migration.Version, migrations[i-1].Version)
+		}
+
+		if strings.TrimSpace(migration.Up) == "" || strings.TrimSpace(migration.Down) == "" {
+			t.Errorf("Migration %04d_%s has empty up or down script", migration.Version, migration.Name)
+		}
+	}
+}
+
+// TestLoadMigrationsInvalid は不正なマイグレーションファイルの検出のテスト
+func TestLoadMigrationsInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{
+			name: "down file is missing",
+			files: fstest.MapFS{
+				"migrations/0001_initial.up.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+		{
+			name: "invalid file name",
+			files: fstest.MapFS{
+				"migrations/initial.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+		{
+			name: "conflicting names",
+			files: fstest.MapFS{
+				"migrations/0001_initial.up.sql": {Data: []byte("SELECT 1;")},
+				"migrations/0001_other.down.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadMigrations(tt.files); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
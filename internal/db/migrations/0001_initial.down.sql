@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS sandbox_usage;
+DROP TABLE IF EXISTS sandboxes;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
+DROP FUNCTION IF EXISTS update_updated_at_column();
@@ -1,4 +1,5 @@
--- Discord Claude システムのデータベーススキーマ
+-- Discord Claude システムの初期スキーマ
+-- 既存の schema.sql で作成済みのデータベースにも適用できるよう冪等に記述する
 
 -- ユーザー管理テーブル
 CREATE TABLE IF NOT EXISTS users (
@@ -43,9 +44,10 @@ CREATE TABLE IF NOT EXISTS sandbox_usage (
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
--- 初期データの挿入
-INSERT INTO sandbox_usage (current_count, max_count) VALUES (0, 3)
-ON CONFLICT DO NOTHING;
+-- 初期データの挿入（1行のみ）
+INSERT INTO sandbox_usage (current_count, max_count)
+SELECT 0, 3
+WHERE NOT EXISTS (SELECT 1 FROM sandbox_usage);
 
 -- インデックスの作成
 CREATE INDEX IF NOT EXISTS idx_users_discord_id ON users(discord_id);
@@ -66,14 +68,18 @@ END;
 $$ language 'plpgsql';
 
 -- 更新日時の自動更新トリガー
+DROP TRIGGER IF EXISTS update_users_updated_at ON users;
 CREATE TRIGGER update_users_updated_at BEFORE UPDATE ON users
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
+DROP TRIGGER IF EXISTS update_sessions_updated_at ON sessions;
 CREATE TRIGGER update_sessions_updated_at BEFORE UPDATE ON sessions
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
+DROP TRIGGER IF EXISTS update_sandboxes_updated_at ON sandboxes;
 CREATE TRIGGER update_sandboxes_updated_at BEFORE UPDATE ON sandboxes
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
+DROP TRIGGER IF EXISTS update_sandbox_usage_updated_at ON sandbox_usage;
 CREATE TRIGGER update_sandbox_usage_updated_at BEFORE UPDATE ON sandbox_usage
-    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
\ No newline at end of file
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,15 @@
+-- Claude Codeのターン（1回の問い合わせ）ごとの使用量テーブル
+CREATE TABLE IF NOT EXISTS claude_turns (
+    id SERIAL PRIMARY KEY,
+    session_id INTEGER REFERENCES sessions(id) ON DELETE SET NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    input_tokens BIGINT NOT NULL DEFAULT 0,
+    output_tokens BIGINT NOT NULL DEFAULT 0,
+    cost_usd NUMERIC(12, 6) NOT NULL DEFAULT 0,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    exit_status VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_claude_turns_session_id ON claude_turns(session_id);
+CREATE INDEX IF NOT EXISTS idx_claude_turns_user_id_created_at ON claude_turns(user_id, created_at);
@@ -0,0 +1,16 @@
+-- ユーザーごとの利用上限テーブル（NULLの項目は設定のデフォルト値、0は無制限）
+CREATE TABLE IF NOT EXISTS user_limits (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    daily_cost_usd NUMERIC(12, 6),
+    monthly_cost_usd NUMERIC(12, 6),
+    daily_tokens BIGINT,
+    monthly_tokens BIGINT,
+    max_sessions INTEGER,
+    max_session_minutes INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+DROP TRIGGER IF EXISTS update_user_limits_updated_at ON user_limits;
+CREATE TRIGGER update_user_limits_updated_at BEFORE UPDATE ON user_limits
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
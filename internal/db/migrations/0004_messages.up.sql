@@ -0,0 +1,12 @@
+-- セッションの会話履歴テーブル（プロンプト・応答・ツールイベント）
+CREATE TABLE IF NOT EXISTS messages (
+    id SERIAL PRIMARY KEY,
+    session_id INTEGER REFERENCES sessions(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    role VARCHAR(50) NOT NULL CHECK (role IN ('user', 'assistant', 'tool_use', 'tool_result', 'system')),
+    content TEXT NOT NULL,
+    exit_code INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_session_id ON messages(session_id, id);
@@ -0,0 +1,4 @@
+UPDATE sessions SET status = 'terminated' WHERE status = 'failed';
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_status_check;
+ALTER TABLE sessions ADD CONSTRAINT sessions_status_check
+    CHECK (status IN ('active', 'inactive', 'terminated'));
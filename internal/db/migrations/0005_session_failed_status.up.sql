@@ -0,0 +1,4 @@
+-- サンドボックス作成に失敗したセッションを 'failed' として記録できるようにする
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_status_check;
+ALTER TABLE sessions ADD CONSTRAINT sessions_status_check
+    CHECK (status IN ('active', 'inactive', 'terminated', 'failed'));
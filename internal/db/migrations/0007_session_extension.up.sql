@@ -0,0 +1,2 @@
+-- 最大セッション時間をセッションごとに延長できるようにする（延長した合計分数）
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS extension_minutes INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,20 @@
+-- 特権操作とセッション操作の監査ログ
+-- ユーザー削除後も記録を残すため、ユーザーは外部キーではなくDiscord IDとユーザー名で保持する
+CREATE TABLE IF NOT EXISTS audit_events (
+    id SERIAL PRIMARY KEY,
+    actor_discord_id VARCHAR(255) NOT NULL,
+    actor_username VARCHAR(255) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    target_discord_id VARCHAR(255),
+    target_username VARCHAR(255),
+    before_role VARCHAR(20),
+    after_role VARCHAR(20),
+    session_id INTEGER,
+    thread_id VARCHAR(255),
+    detail TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_discord_id ON audit_events(actor_discord_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target_discord_id ON audit_events(target_discord_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS role_source;
+DROP TABLE IF EXISTS role_bindings;
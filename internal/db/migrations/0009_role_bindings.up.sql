@@ -0,0 +1,12 @@
+-- Discordのギルドロールとボットのロールの対応
+CREATE TABLE IF NOT EXISTS role_bindings (
+    id SERIAL PRIMARY KEY,
+    discord_role_id VARCHAR(255) UNIQUE NOT NULL,
+    role VARCHAR(50) NOT NULL CHECK (role IN ('owner', 'user')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- ユーザーのロールの管理元（manual: 明示的に登録、guild_role: ロール連携で自動登録）
+-- 明示的に登録されたユーザーのロールはロール連携より優先する
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role_source VARCHAR(20) NOT NULL DEFAULT 'manual'
+    CHECK (role_source IN ('manual', 'guild_role'));
@@ -0,0 +1,15 @@
+ALTER TABLE audit_events ALTER COLUMN after_role TYPE VARCHAR(20) USING LEFT(after_role, 20);
+ALTER TABLE audit_events ALTER COLUMN before_role TYPE VARCHAR(20) USING LEFT(before_role, 20);
+
+ALTER TABLE role_bindings DROP CONSTRAINT IF EXISTS role_bindings_role_fkey;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_fkey;
+
+-- 独自のロールは組み込みロールに戻す
+DELETE FROM role_bindings WHERE role NOT IN ('owner', 'user');
+UPDATE users SET role = 'user' WHERE role NOT IN ('owner', 'user');
+
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('owner', 'user'));
+ALTER TABLE role_bindings ADD CONSTRAINT role_bindings_role_check CHECK (role IN ('owner', 'user'));
+
+DROP TABLE IF EXISTS role_capabilities;
+DROP TABLE IF EXISTS roles;
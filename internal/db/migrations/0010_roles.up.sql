@@ -0,0 +1,52 @@
+-- ケイパビリティの集合として定義するロール
+-- 組み込みロール（owner, user）は変更・削除できない
+CREATE TABLE IF NOT EXISTS roles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) UNIQUE NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    builtin BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- ロールが持つケイパビリティ
+CREATE TABLE IF NOT EXISTS role_capabilities (
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    capability VARCHAR(50) NOT NULL,
+    PRIMARY KEY (role_id, capability)
+);
+
+-- 組み込みロール（これまでのオーナー・一般ユーザーと同じ権限）
+INSERT INTO roles (name, description, builtin) VALUES
+    ('owner', 'オーナー', TRUE),
+    ('user', '一般ユーザー', TRUE)
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_capabilities (role_id, capability)
+SELECT roles.id, capability
+FROM roles, unnest(ARRAY[
+    'create_sandbox',
+    'view_all_sessions',
+    'manage_sessions',
+    'manage_users',
+    'manage_config',
+    'view_usage',
+    'view_audit'
+]) AS capability
+WHERE roles.name = 'owner'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_capabilities (role_id, capability)
+SELECT roles.id, 'create_sandbox'
+FROM roles
+WHERE roles.name = 'user'
+ON CONFLICT DO NOTHING;
+
+-- ユーザーとロール連携のロールを、固定の値からロールの定義への参照に変更する
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles(name);
+ALTER TABLE role_bindings DROP CONSTRAINT IF EXISTS role_bindings_role_check;
+ALTER TABLE role_bindings ADD CONSTRAINT role_bindings_role_fkey FOREIGN KEY (role) REFERENCES roles(name);
+
+-- 独自のロール名を記録できるよう、監査ログのロールの長さをロール名に合わせる
+ALTER TABLE audit_events ALTER COLUMN before_role TYPE VARCHAR(50);
+ALTER TABLE audit_events ALTER COLUMN after_role TYPE VARCHAR(50);
@@ -0,0 +1,12 @@
+-- セッションに招待されたユーザー（viewer: 閲覧のみ、collaborator: Claude Codeとの会話も可能）
+-- セッションの終了は所有者と manage_sessions 権限を持つユーザーのみ行える
+CREATE TABLE IF NOT EXISTS session_members (
+    session_id INTEGER NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('viewer', 'collaborator')),
+    invited_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (session_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_members_user_id ON session_members(user_id);
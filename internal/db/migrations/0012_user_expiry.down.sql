@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_expires_at;
+ALTER TABLE users DROP COLUMN IF EXISTS disabled;
+ALTER TABLE users DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,6 @@
+-- ユーザーのアクセス期限（NULLの場合は無期限）と無効化フラグ
+-- 期限を過ぎたユーザーはバックグラウンドジョブで無効化され、セッションが終了される
+ALTER TABLE users ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_users_expires_at ON users(expires_at) WHERE expires_at IS NOT NULL AND disabled = FALSE;
@@ -0,0 +1,3 @@
+-- 同じDMチャンネルで複数のセッションが作成されている場合は、最新以外を削除してから実行すること
+DROP INDEX IF EXISTS idx_sessions_active_thread_id;
+ALTER TABLE sessions ADD CONSTRAINT sessions_thread_id_key UNIQUE (thread_id);
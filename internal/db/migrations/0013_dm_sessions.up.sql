@@ -0,0 +1,5 @@
+-- DMのセッションはDMチャンネルIDをスレッドIDとして使うため、同じチャンネルで終了後に新しいセッションを開始できるようにする
+-- スレッドIDの一意制約はアクティブなセッションに限定する
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_thread_id_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_active_thread_id ON sessions(thread_id) WHERE status = 'active';
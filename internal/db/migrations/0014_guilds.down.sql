@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_audit_events_guild_id;
+DROP INDEX IF EXISTS idx_users_guild_id;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS guild_id;
+ALTER TABLE role_bindings DROP COLUMN IF EXISTS guild_id;
+ALTER TABLE roles DROP COLUMN IF EXISTS guild_id;
+ALTER TABLE users DROP COLUMN IF EXISTS guild_id;
+DROP TABLE IF EXISTS guilds;
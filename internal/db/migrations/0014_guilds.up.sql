@@ -0,0 +1,32 @@
+-- 1つのBotで複数のDiscordサーバー（ギルド）を扱うためのギルドごとの設定
+-- NULLの項目は環境変数のデフォルト値を使用し、0は無制限を表す
+CREATE TABLE IF NOT EXISTS guilds (
+    guild_id VARCHAR(255) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    max_sandboxes INTEGER,
+    audit_channel_id VARCHAR(255),
+    daily_cost_usd NUMERIC(12, 6),
+    monthly_cost_usd NUMERIC(12, 6),
+    daily_tokens BIGINT,
+    monthly_tokens BIGINT,
+    max_sessions INTEGER,
+    max_session_minutes INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+DROP TRIGGER IF EXISTS update_guilds_updated_at ON guilds;
+CREATE TRIGGER update_guilds_updated_at BEFORE UPDATE ON guilds
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- ユーザー・独自ロール・ロール連携が属するギルド
+-- NULLは複数ギルドに対応する前に登録されたもので、起動時に DISCORD_GUILD_ID のギルドに割り当てられる
+ALTER TABLE users ADD COLUMN IF NOT EXISTS guild_id VARCHAR(255) REFERENCES guilds(guild_id) ON DELETE SET NULL;
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS guild_id VARCHAR(255) REFERENCES guilds(guild_id) ON DELETE CASCADE;
+ALTER TABLE role_bindings ADD COLUMN IF NOT EXISTS guild_id VARCHAR(255) REFERENCES guilds(guild_id) ON DELETE CASCADE;
+
+-- 監査ログはギルドが削除されても残すため、外部キーにしない
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS guild_id VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_users_guild_id ON users(guild_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_guild_id ON audit_events(guild_id);
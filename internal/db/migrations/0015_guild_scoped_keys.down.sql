@@ -0,0 +1,8 @@
+-- 複数のギルドに同じDiscordユーザー・同じロール名が登録されている場合は、1つを残して削除してから実行すること
+-- 外部キーはロール名の一意性制約を参照するため、一意性制約を戻してから追加する
+DROP INDEX IF EXISTS idx_roles_guild_name;
+DROP INDEX IF EXISTS idx_users_guild_discord_id;
+ALTER TABLE roles ADD CONSTRAINT roles_name_key UNIQUE (name);
+ALTER TABLE users ADD CONSTRAINT users_discord_id_key UNIQUE (discord_id);
+ALTER TABLE role_bindings ADD CONSTRAINT role_bindings_role_fkey FOREIGN KEY (role) REFERENCES roles(name);
+ALTER TABLE users ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles(name);
@@ -0,0 +1,11 @@
+-- 同じDiscordユーザー・同じロール名を複数のギルドで個別に登録できるよう、一意性をギルドごとにする
+-- ギルドに属さない行（組み込みロールと移行前のユーザー）は guild_id がNULLのまま、1つのギルドとして扱う
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_discord_id_key;
+ALTER TABLE roles DROP CONSTRAINT IF EXISTS roles_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_guild_discord_id ON users (COALESCE(guild_id, ''), discord_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_guild_name ON roles (COALESCE(guild_id, ''), name);
+
+-- ロール名だけではロールを特定できなくなるため、ユーザーとロール連携のロールの外部キーを外す
+-- ロールの存在はユーザー・ロール連携の登録時に、ロールの削除時の参照はロールの削除時にクエリで確認する
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_fkey;
+ALTER TABLE role_bindings DROP CONSTRAINT IF EXISTS role_bindings_role_fkey;
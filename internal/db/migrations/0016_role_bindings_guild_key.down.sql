@@ -0,0 +1,3 @@
+-- 複数のギルドで同じDiscordロールが連携されている場合は、1つを残して削除してから実行すること
+DROP INDEX IF EXISTS idx_role_bindings_guild_discord_role_id;
+ALTER TABLE role_bindings ADD CONSTRAINT role_bindings_discord_role_id_key UNIQUE (discord_role_id);
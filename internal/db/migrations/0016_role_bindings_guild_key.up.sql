@@ -0,0 +1,4 @@
+-- ロール連携をギルドごとに管理するため、Discordロールの一意性をギルドごとにする
+-- 他のギルドのロール連携を上書き・削除できないよう、登録と削除はギルドとDiscordロールの組で行う
+ALTER TABLE role_bindings DROP CONSTRAINT IF EXISTS role_bindings_discord_role_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_role_bindings_guild_discord_role_id ON role_bindings (COALESCE(guild_id, ''), discord_role_id);
@@ -0,0 +1,7 @@
+-- 所有者が削除されたセッションは、移行前と同様に会話履歴とともに削除する
+DELETE FROM sessions WHERE user_id IS NULL;
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_user_id_fkey;
+ALTER TABLE sessions ADD CONSTRAINT sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+DROP INDEX IF EXISTS idx_sessions_guild_id;
+ALTER TABLE sessions DROP COLUMN IF EXISTS guild_id;
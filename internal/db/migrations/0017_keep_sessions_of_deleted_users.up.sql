@@ -0,0 +1,8 @@
+-- ユーザーを削除しても、サンドボックスの削除後のレビューや障害調査のためにセッションと会話履歴を残す
+-- 所有者が削除されたセッションもギルドごとに管理できるよう、セッションにギルドを記録する
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS guild_id VARCHAR(255) REFERENCES guilds(guild_id) ON DELETE SET NULL;
+UPDATE sessions SET guild_id = users.guild_id FROM users WHERE users.id = sessions.user_id AND sessions.guild_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_sessions_guild_id ON sessions(guild_id);
+
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_user_id_fkey;
+ALTER TABLE sessions ADD CONSTRAINT sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
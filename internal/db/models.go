@@ -2,29 +2,37 @@ package db
 
 import (
 	"database/sql"
+	"sort"
 	"time"
 )
 
 // User はユーザー情報を表すモデル
 type User struct {
-	ID        int       `db:"id"`
-	DiscordID string    `db:"discord_id"`
-	Username  string    `db:"username"`
-	Role      string    `db:"role"`
-	CreatedAt time.Time `db:"created_at"`
-	UpdatedAt time.Time `db:"updated_at"`
+	ID         int            `db:"id"`
+	DiscordID  string         `db:"discord_id"`
+	Username   string         `db:"username"`
+	Role       string         `db:"role"`
+	RoleSource string         `db:"role_source"` // manual: 明示的に登録、guild_role: Discordのロール連携で登録
+	ExpiresAt  sql.NullTime   `db:"expires_at"`  // アクセス期限（NULLの場合は無期限）
+	Disabled   bool           `db:"disabled"`    // 無効化されたユーザーはすべての操作が拒否される
+	GuildID    sql.NullString `db:"guild_id"`    // 所属するギルド（NULLの場合はギルドに属さない）
+	CreatedAt  time.Time      `db:"created_at"`
+	UpdatedAt  time.Time      `db:"updated_at"`
 }
 
 // Session はセッション情報を表すモデル
+// 所有者が削除されてもレビューや障害調査のために残し、UserIDはNULLになる
 type Session struct {
-	ID           int            `db:"id"`
-	UserID       int            `db:"user_id"`
-	ThreadID     string         `db:"thread_id"`
-	SandboxName  string         `db:"sandbox_name"`
-	Status       string         `db:"status"`
-	CreatedAt    time.Time      `db:"created_at"`
-	UpdatedAt    time.Time      `db:"updated_at"`
-	TerminatedAt sql.NullTime   `db:"terminated_at"`
+	ID               int            `db:"id"`
+	UserID           sql.NullInt64  `db:"user_id"`
+	GuildID          sql.NullString `db:"guild_id"` // 作成時に所有者が属していたギルド
+	ThreadID         string         `db:"thread_id"`
+	SandboxName      string         `db:"sandbox_name"`
+	Status           string         `db:"status"`
+	ExtensionMinutes int            `db:"extension_minutes"` // 最大セッション時間の延長分（分）
+	CreatedAt        time.Time      `db:"created_at"`
+	UpdatedAt        time.Time      `db:"updated_at"`
+	TerminatedAt     sql.NullTime   `db:"terminated_at"`
 }
 
 // Sandbox はサンドボックス情報を表すモデル
@@ -48,6 +56,179 @@ type SandboxUsage struct {
 	UpdatedAt    time.Time `db:"updated_at"`
 }
 
+// ClaudeTurn はClaude Codeの1ターンの使用量を表すモデル
+type ClaudeTurn struct {
+	ID           int           `db:"id"`
+	SessionID    sql.NullInt64 `db:"session_id"`
+	UserID       sql.NullInt64 `db:"user_id"`
+	InputTokens  int64         `db:"input_tokens"`
+	OutputTokens int64         `db:"output_tokens"`
+	CostUSD      float64       `db:"cost_usd"`
+	DurationMS   int64         `db:"duration_ms"`
+	ExitStatus   string        `db:"exit_status"`
+	CreatedAt    time.Time     `db:"created_at"`
+}
+
+// Message はセッションの会話履歴の1件を表すモデル
+// Roleは user / assistant / tool_use / tool_result / system のいずれか
+type Message struct {
+	ID        int           `db:"id"`
+	SessionID int           `db:"session_id"`
+	UserID    sql.NullInt64 `db:"user_id"`
+	Role      string        `db:"role"`
+	Content   string        `db:"content"`
+	ExitCode  sql.NullInt64 `db:"exit_code"`
+	CreatedAt time.Time     `db:"created_at"`
+}
+
+// APIToken は管理APIのアクセストークンを表すモデル
+// トークン本体は保存せず、SHA-256ハッシュのみを保持する
+type APIToken struct {
+	ID         int          `db:"id"`
+	UserID     int          `db:"user_id"`
+	Name       string       `db:"name"`
+	TokenHash  string       `db:"token_hash"`
+	CreatedAt  time.Time    `db:"created_at"`
+	LastUsedAt sql.NullTime `db:"last_used_at"`
+	RevokedAt  sql.NullTime `db:"revoked_at"`
+}
+
+// Role はケイパビリティの集合として定義されたロールを表すモデル
+type Role struct {
+	ID           int            `db:"id"`
+	Name         string         `db:"name"`
+	Description  string         `db:"description"`
+	Builtin      bool           `db:"builtin"`
+	GuildID      sql.NullString `db:"guild_id"` // 独自ロールを作成したギルド（組み込みロールはNULLで、すべてのギルドで使用できる）
+	Capabilities []string       // role_capabilities テーブルのケイパビリティ（名前順）
+	CreatedAt    time.Time      `db:"created_at"`
+}
+
+// HasCapability はロールが指定したケイパビリティを持つかチェックする
+func (r *Role) HasCapability(capability string) bool {
+	for _, c := range r.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// AvailableIn はロールが指定したギルドで使用できるかチェックする
+// ギルドに属さないロール（組み込みロールとギルド導入前のロール）はすべてのギルドで使用できる
+func (r *Role) AvailableIn(guildID string) bool {
+	return !r.GuildID.Valid || r.GuildID.String == guildID
+}
+
+// sortedCapabilities は重複を除いたケイパビリティを名前順に並べて返す（データベースから取得した場合と同じ順序）
+func sortedCapabilities(capabilities []string) []string {
+	seen := make(map[string]bool, len(capabilities))
+	var sorted []string
+	for _, capability := range capabilities {
+		if !seen[capability] {
+			seen[capability] = true
+			sorted = append(sorted, capability)
+		}
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// セッションに招待されたユーザーのロール
+const (
+	// SessionMemberViewer はセッションの閲覧（会話履歴のエクスポートなど）のみ行えるロール
+	SessionMemberViewer = "viewer"
+	// SessionMemberCollaborator は閲覧に加えてClaude Codeとの会話も行えるロール（セッションの終了は不可）
+	SessionMemberCollaborator = "collaborator"
+)
+
+// SessionMember はセッションに招待されたユーザーを表すモデル
+type SessionMember struct {
+	SessionID int           `db:"session_id"`
+	UserID    int           `db:"user_id"`
+	Role      string        `db:"role"`
+	InvitedBy sql.NullInt64 `db:"invited_by"` // 招待したユーザー（削除された場合はNULL）
+	CreatedAt time.Time     `db:"created_at"`
+}
+
+// CanPrompt はメンバーがClaude Codeとの会話を行えるかどうかを判定する
+func (m *SessionMember) CanPrompt() bool {
+	return m.Role == SessionMemberCollaborator
+}
+
+// RoleBinding はDiscordのギルドロールとBotのロールの対応を表すモデル
+type RoleBinding struct {
+	ID            int            `db:"id"`
+	GuildID       sql.NullString `db:"guild_id"` // Discordロールが属するギルド
+	DiscordRoleID string         `db:"discord_role_id"`
+	Role          string         `db:"role"`
+	CreatedAt     time.Time      `db:"created_at"`
+}
+
+// AuditEvent は特権操作・セッション操作の監査ログを表すモデル
+// ユーザー削除後も記録を残すため、実行者と対象はDiscord IDとユーザー名で保持する
+type AuditEvent struct {
+	ID              int            `db:"id"`
+	ActorDiscordID  string         `db:"actor_discord_id"`
+	ActorUsername   string         `db:"actor_username"`
+	Action          string         `db:"action"`
+	TargetDiscordID sql.NullString `db:"target_discord_id"`
+	TargetUsername  sql.NullString `db:"target_username"`
+	BeforeRole      sql.NullString `db:"before_role"`
+	AfterRole       sql.NullString `db:"after_role"`
+	SessionID       sql.NullInt64  `db:"session_id"`
+	ThreadID        sql.NullString `db:"thread_id"`
+	Detail          string         `db:"detail"`
+	GuildID         sql.NullString `db:"guild_id"` // 操作が行われたギルド（実行者または対象のユーザーが属するギルド）
+	CreatedAt       time.Time      `db:"created_at"`
+}
+
+// Guild はギルド（Discordサーバー）ごとの設定を表すモデル
+// NULLの項目は設定のデフォルト値を使用し、0は無制限を表す
+type Guild struct {
+	GuildID           string          `db:"guild_id"`
+	Name              string          `db:"name"`
+	MaxSandboxes      sql.NullInt64   `db:"max_sandboxes"`    // ギルドのユーザーが同時に利用できるサンドボックス数
+	AuditChannelID    sql.NullString  `db:"audit_channel_id"` // 監査ログを転送する管理チャンネル
+	DailyCostUSD      sql.NullFloat64 `db:"daily_cost_usd"`
+	MonthlyCostUSD    sql.NullFloat64 `db:"monthly_cost_usd"`
+	DailyTokens       sql.NullInt64   `db:"daily_tokens"`
+	MonthlyTokens     sql.NullInt64   `db:"monthly_tokens"`
+	MaxSessions       sql.NullInt64   `db:"max_sessions"`
+	MaxSessionMinutes sql.NullInt64   `db:"max_session_minutes"`
+	CreatedAt         time.Time       `db:"created_at"`
+	UpdatedAt         time.Time       `db:"updated_at"`
+}
+
+// UsageSummary は使用量の集計結果を表すモデル
+type UsageSummary struct {
+	Turns        int
+	InputTokens  int64
+	OutputTokens int64
+	CostUSD      float64
+}
+
+// UserUsage はユーザーごとの使用量の集計結果を表すモデル
+type UserUsage struct {
+	DiscordID string
+	Username  string
+	UsageSummary
+}
+
+// UserLimits はユーザーごとの利用上限の上書き設定を表すモデル
+// NULLの項目は設定のデフォルト値を使用し、0は無制限を表す
+type UserLimits struct {
+	UserID            int             `db:"user_id"`
+	DailyCostUSD      sql.NullFloat64 `db:"daily_cost_usd"`
+	MonthlyCostUSD    sql.NullFloat64 `db:"monthly_cost_usd"`
+	DailyTokens       sql.NullInt64   `db:"daily_tokens"`
+	MonthlyTokens     sql.NullInt64   `db:"monthly_tokens"`
+	MaxSessions       sql.NullInt64   `db:"max_sessions"`
+	MaxSessionMinutes sql.NullInt64   `db:"max_session_minutes"`
+	CreatedAt         time.Time       `db:"created_at"`
+	UpdatedAt         time.Time       `db:"updated_at"`
+}
+
 // IsOwner はユーザーがオーナーかどうかを判定する
 func (u *User) IsOwner() bool {
 	return u.Role == "owner"
@@ -58,6 +239,42 @@ func (u *User) IsUser() bool {
 	return u.Role == "user"
 }
 
+// IsGuildRoleUser はユーザーがDiscordのロール連携で登録されたかどうかを判定する
+// 明示的に登録されたユーザーのロールはロール連携より優先される
+func (u *User) IsGuildRoleUser() bool {
+	return u.RoleSource == "guild_role"
+}
+
+// InGuild はユーザーが指定したギルドに属するかどうかを判定する（空文字列はギルドに属さないことを表す）
+func (u *User) InGuild(guildID string) bool {
+	return u.GuildID.String == guildID
+}
+
+// AccessEnded はユーザーが無効化されているか、アクセス期限を過ぎているかどうかを判定する
+func (u *User) AccessEnded(now time.Time) bool {
+	return u.Disabled || (u.ExpiresAt.Valid && !now.Before(u.ExpiresAt.Time))
+}
+
+// OwnerUserID はセッションを所有するユーザーのIDを返す（auth.Resourceの実装、所有者が削除された場合は0）
+func (s *Session) OwnerUserID() int {
+	return int(s.UserID.Int64)
+}
+
+// OwnerGuildID はセッションが属するギルドのIDを返す（auth.Resourceの実装、ギルドに属さない場合は空文字列）
+func (s *Session) OwnerGuildID() string {
+	return s.GuildID.String
+}
+
+// InGuild はセッションが指定したギルドに属するかどうかを判定する（空文字列はギルドに属さないことを表す）
+func (s *Session) InGuild(guildID string) bool {
+	return s.GuildID.String == guildID
+}
+
+// HasOwner はセッションの所有者が削除されていないかどうかを判定する
+func (s *Session) HasOwner() bool {
+	return s.UserID.Valid
+}
+
 // IsActive はセッションがアクティブかどうかを判定する
 func (s *Session) IsActive() bool {
 	return s.Status == "active"
@@ -83,11 +300,21 @@ func (sb *Sandbox) IsTerminated() bool {
 	return sb.Status == "terminated"
 }
 
+// IsRevoked はトークンが失効しているかどうかを判定する
+func (t *APIToken) IsRevoked() bool {
+	return t.RevokedAt.Valid
+}
+
 // CanCreateSandbox はサンドボックスを作成できるかどうかを判定する
 func (su *SandboxUsage) CanCreateSandbox() bool {
 	return su.CurrentCount < su.MaxCount
 }
 
+// TotalTokens は入力・出力の合計トークン数を返す
+func (us *UsageSummary) TotalTokens() int64 {
+	return us.InputTokens + us.OutputTokens
+}
+
 // RemainingCapacity は残りのサンドボックス作成可能数を返す
 func (su *SandboxUsage) RemainingCapacity() int {
 	return su.MaxCount - su.CurrentCount
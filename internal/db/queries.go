@@ -3,12 +3,9 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	"io/ioutil"
-	"path/filepath"
 	"time"
 
 	_ "github.com/lib/pq"
-	"github.com/sirupsen/logrus"
 )
 
 // DB はデータベース接続を管理する構造体
@@ -53,40 +50,37 @@ type DatabaseConfig struct {
 	Database string
 }
 
-// Migrate はデータベースマイグレーションを実行する
-func Migrate(db *DB) error {
-	schemaFile := filepath.Join("sql", "schema.sql")
-	schema, err := ioutil.ReadFile(schemaFile)
+// CreateUser はguildIDのギルドに新しいユーザーを作成する（空文字列の場合はギルドに属さない）
+// ロールはギルドで使用できるもの（ギルドの独自ロールまたはギルドに属さないロール）のみ指定できる
+func (db *DB) CreateUser(guildID, discordID, username, role string) (*User, error) {
+	available, err := db.roleAvailable(guildID, role)
 	if err != nil {
-		return fmt.Errorf("failed to read schema file: %w", err)
+		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
-
-	if _, err := db.Exec(string(schema)); err != nil {
-		return fmt.Errorf("failed to execute schema: %w", err)
+	if !available {
+		return nil, fmt.Errorf("failed to create user: role %q does not exist", role)
 	}
 
-	logrus.Info("Database migration completed successfully")
-	return nil
-}
-
-// CreateUser は新しいユーザーを作成する
-func (db *DB) CreateUser(discordID, username, role string) (*User, error) {
 	query := `
-		INSERT INTO users (discord_id, username, role)
-		VALUES ($1, $2, $3)
-		RETURNING id, discord_id, username, role, created_at, updated_at
+		INSERT INTO users (guild_id, discord_id, username, role)
+		VALUES (NULLIF($1, ''), $2, $3, $4)
+		RETURNING id, discord_id, username, role, role_source, expires_at, disabled, guild_id, created_at, updated_at
 	`
-	
+
 	user := &User{}
-	err := db.QueryRow(query, discordID, username, role).Scan(
+	err = db.QueryRow(query, guildID, discordID, username, role).Scan(
 		&user.ID,
 		&user.DiscordID,
 		&user.Username,
 		&user.Role,
+		&user.RoleSource,
+		&user.ExpiresAt,
+		&user.Disabled,
+		&user.GuildID,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
-	
+
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
@@ -94,24 +88,28 @@ func (db *DB) CreateUser(discordID, username, role string) (*User, error) {
 	return user, nil
 }
 
-// GetUserByDiscordID はDiscord IDでユーザーを取得する
-func (db *DB) GetUserByDiscordID(discordID string) (*User, error) {
+// GetUserByDiscordID はguildIDのギルドに登録されたユーザーをDiscord IDで取得する（空文字列の場合はギルドに属さないユーザー）
+func (db *DB) GetUserByDiscordID(guildID, discordID string) (*User, error) {
 	query := `
-		SELECT id, discord_id, username, role, created_at, updated_at
+		SELECT id, discord_id, username, role, role_source, expires_at, disabled, guild_id, created_at, updated_at
 		FROM users
-		WHERE discord_id = $1
+		WHERE COALESCE(guild_id, '') = $1 AND discord_id = $2
 	`
-	
+
 	user := &User{}
-	err := db.QueryRow(query, discordID).Scan(
+	err := db.QueryRow(query, guildID, discordID).Scan(
 		&user.ID,
 		&user.DiscordID,
 		&user.Username,
 		&user.Role,
+		&user.RoleSource,
+		&user.ExpiresAt,
+		&user.Disabled,
+		&user.GuildID,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
-	
+
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -122,24 +120,75 @@ func (db *DB) GetUserByDiscordID(discordID string) (*User, error) {
 	return user, nil
 }
 
-// UpdateUserRole はユーザーの役割を更新する
-func (db *DB) UpdateUserRole(discordID, role string) error {
+// ListUsersByDiscordID はDiscord IDで登録されたすべてのギルドのユーザーを登録順に取得する
+func (db *DB) ListUsersByDiscordID(discordID string) ([]*User, error) {
+	query := `
+		SELECT id, discord_id, username, role, role_source, expires_at, disabled, guild_id, created_at, updated_at
+		FROM users
+		WHERE discord_id = $1
+		ORDER BY id
+	`
+
+	rows, err := db.Query(query, discordID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user := &User{}
+		if err := rows.Scan(
+			&user.ID,
+			&user.DiscordID,
+			&user.Username,
+			&user.Role,
+			&user.RoleSource,
+			&user.ExpiresAt,
+			&user.Disabled,
+			&user.GuildID,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate users: %w", err)
+	}
+
+	return users, nil
+}
+
+// UpdateUserRole はguildIDのギルドのユーザーの役割を更新する
+// ロールはギルドで使用できるもの（ギルドの独自ロールまたはギルドに属さないロール）のみ指定できる
+func (db *DB) UpdateUserRole(guildID, discordID, role string) error {
+	available, err := db.roleAvailable(guildID, role)
+	if err != nil {
+		return fmt.Errorf("failed to update user role: %w", err)
+	}
+	if !available {
+		return fmt.Errorf("failed to update user role: role %q does not exist", role)
+	}
+
 	query := `
 		UPDATE users
 		SET role = $1
-		WHERE discord_id = $2
+		WHERE COALESCE(guild_id, '') = $2 AND discord_id = $3
 	`
-	
-	result, err := db.Exec(query, role, discordID)
+
+	result, err := db.Exec(query, role, guildID, discordID)
 	if err != nil {
 		return fmt.Errorf("failed to update user role: %w", err)
 	}
-	
+
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
-	
+
 	if rowsAffected == 0 {
 		return fmt.Errorf("user not found")
 	}
@@ -147,20 +196,20 @@ func (db *DB) UpdateUserRole(discordID, role string) error {
 	return nil
 }
 
-// DeleteUser はユーザーを削除する
-func (db *DB) DeleteUser(discordID string) error {
-	query := `DELETE FROM users WHERE discord_id = $1`
-	
-	result, err := db.Exec(query, discordID)
+// DeleteUser はguildIDのギルドのユーザーを削除する
+func (db *DB) DeleteUser(guildID, discordID string) error {
+	query := `DELETE FROM users WHERE COALESCE(guild_id, '') = $1 AND discord_id = $2`
+
+	result, err := db.Exec(query, guildID, discordID)
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
-	
+
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
-	
+
 	if rowsAffected == 0 {
 		return fmt.Errorf("user not found")
 	}
@@ -171,18 +220,20 @@ func (db *DB) DeleteUser(discordID string) error {
 // CreateSession は新しいセッションを作成する
 func (db *DB) CreateSession(userID int, threadID, sandboxName string) (*Session, error) {
 	query := `
-		INSERT INTO sessions (user_id, thread_id, sandbox_name, status)
-		VALUES ($1, $2, $3, 'active')
-		RETURNING id, user_id, thread_id, sandbox_name, status, created_at, updated_at
+		INSERT INTO sessions (user_id, guild_id, thread_id, sandbox_name, status)
+		VALUES ($1, (SELECT guild_id FROM users WHERE id = $1), $2, $3, 'active')
+		RETURNING id, user_id, guild_id, thread_id, sandbox_name, status, extension_minutes, created_at, updated_at
 	`
 	
 	session := &Session{}
 	err := db.QueryRow(query, userID, threadID, sandboxName).Scan(
 		&session.ID,
 		&session.UserID,
+		&session.GuildID,
 		&session.ThreadID,
 		&session.SandboxName,
 		&session.Status,
+		&session.ExtensionMinutes,
 		&session.CreatedAt,
 		&session.UpdatedAt,
 	)
@@ -195,20 +246,25 @@ func (db *DB) CreateSession(userID int, threadID, sandboxName string) (*Session,
 }
 
 // GetSessionByThreadID はスレッドIDでセッションを取得する
+// DMのように同じチャンネルで複数のセッションが作成された場合は最新のセッションを返す
 func (db *DB) GetSessionByThreadID(threadID string) (*Session, error) {
 	query := `
-		SELECT id, user_id, thread_id, sandbox_name, status, created_at, updated_at, terminated_at
+		SELECT id, user_id, guild_id, thread_id, sandbox_name, status, extension_minutes, created_at, updated_at, terminated_at
 		FROM sessions
 		WHERE thread_id = $1
+		ORDER BY id DESC
+		LIMIT 1
 	`
 	
 	session := &Session{}
 	err := db.QueryRow(query, threadID).Scan(
 		&session.ID,
 		&session.UserID,
+		&session.GuildID,
 		&session.ThreadID,
 		&session.SandboxName,
 		&session.Status,
+		&session.ExtensionMinutes,
 		&session.CreatedAt,
 		&session.UpdatedAt,
 		&session.TerminatedAt,
@@ -240,6 +296,23 @@ func (db *DB) UpdateSessionStatus(sessionID int, status string) error {
 	return nil
 }
 
+// UpdateSessionSandboxName はセッションに割り当てたサンドボックス名を更新する
+// ウォームプールのPodを割り当てた場合など、作成時に決めた名前と異なるPodを使う場合に呼び出す
+func (db *DB) UpdateSessionSandboxName(sessionID int, sandboxName string) error {
+	query := `
+		UPDATE sessions
+		SET sandbox_name = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`
+
+	_, err := db.Exec(query, sandboxName, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to update session sandbox name: %w", err)
+	}
+
+	return nil
+}
+
 // CreateSandbox は新しいサンドボックスを作成する
 func (db *DB) CreateSandbox(sessionID int, podName, namespace string) (*Sandbox, error) {
 	query := `
@@ -315,6 +388,28 @@ func (db *DB) UpdateSandboxStatus(sandboxID int, status string) error {
 	return nil
 }
 
+// TransitionSandboxStatus はサンドボックスのステータスがfromの場合のみtoに更新し、更新したかを返す
+// 停止の検知と削除が同時に起きても、使用数の減算が一度だけになるよう条件付きで更新する
+func (db *DB) TransitionSandboxStatus(sandboxID int, from, to string) (bool, error) {
+	query := `
+		UPDATE sandboxes
+		SET status = $1
+		WHERE id = $2 AND status = $3
+	`
+
+	result, err := db.Exec(query, to, sandboxID, from)
+	if err != nil {
+		return false, fmt.Errorf("failed to transition sandbox status: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
 // GetSandboxUsage はサンドボックスの使用状況を取得する
 func (db *DB) GetSandboxUsage() (*SandboxUsage, error) {
 	query := `
@@ -370,10 +465,48 @@ func (db *DB) DecrementSandboxUsage() error {
 	return nil
 }
 
+// GetSessionGuild はセッションが属するギルドの設定を取得する（ギルドに属さない場合はnil）
+func (db *DB) GetSessionGuild(sessionID int) (*Guild, error) {
+	query := `
+		SELECT guilds.guild_id, guilds.name, guilds.max_sandboxes, guilds.audit_channel_id, guilds.daily_cost_usd, guilds.monthly_cost_usd,
+			guilds.daily_tokens, guilds.monthly_tokens, guilds.max_sessions, guilds.max_session_minutes, guilds.created_at, guilds.updated_at
+		FROM sessions
+		JOIN guilds ON guilds.guild_id = sessions.guild_id
+		WHERE sessions.id = $1
+	`
+
+	guild, err := scanGuild(db.QueryRow(query, sessionID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get session guild: %w", err)
+	}
+
+	return guild, nil
+}
+
+// CountActiveSandboxesByGuild はギルドのセッションで作成中・実行中のサンドボックス数を取得する
+func (db *DB) CountActiveSandboxesByGuild(guildID string) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM sandboxes
+		JOIN sessions ON sessions.id = sandboxes.session_id
+		WHERE sandboxes.status IN ('pending', 'running') AND sessions.guild_id IS NOT DISTINCT FROM NULLIF($1, '')
+	`
+
+	var count int
+	if err := db.QueryRow(query, guildID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count active sandboxes by guild: %w", err)
+	}
+
+	return count, nil
+}
+
 // GetUserByID はIDでユーザーを取得する
 func (db *DB) GetUserByID(userID int) (*User, error) {
 	query := `
-		SELECT id, discord_id, username, role, created_at, updated_at
+		SELECT id, discord_id, username, role, role_source, expires_at, disabled, guild_id, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
@@ -384,6 +517,10 @@ func (db *DB) GetUserByID(userID int) (*User, error) {
 		&user.DiscordID,
 		&user.Username,
 		&user.Role,
+		&user.RoleSource,
+		&user.ExpiresAt,
+		&user.Disabled,
+		&user.GuildID,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -401,7 +538,7 @@ func (db *DB) GetUserByID(userID int) (*User, error) {
 // GetSessionByID はIDでセッションを取得する
 func (db *DB) GetSessionByID(sessionID int) (*Session, error) {
 	query := `
-		SELECT id, user_id, thread_id, sandbox_name, status, created_at, updated_at, terminated_at
+		SELECT id, user_id, guild_id, thread_id, sandbox_name, status, extension_minutes, created_at, updated_at, terminated_at
 		FROM sessions
 		WHERE id = $1
 	`
@@ -410,9 +547,11 @@ func (db *DB) GetSessionByID(sessionID int) (*Session, error) {
 	err := db.QueryRow(query, sessionID).Scan(
 		&session.ID,
 		&session.UserID,
+		&session.GuildID,
 		&session.ThreadID,
 		&session.SandboxName,
 		&session.Status,
+		&session.ExtensionMinutes,
 		&session.CreatedAt,
 		&session.UpdatedAt,
 		&session.TerminatedAt,
@@ -426,4 +565,1407 @@ func (db *DB) GetSessionByID(sessionID int) (*Session, error) {
 	}
 
 	return session, nil
-}
\ No newline at end of file
+}
+
+// ExtendSession はセッションの最大利用時間を指定した分数だけ延長する
+func (db *DB) ExtendSession(sessionID int, minutes int) error {
+	query := `
+		UPDATE sessions
+		SET extension_minutes = extension_minutes + $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`
+
+	_, err := db.Exec(query, minutes, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to extend session: %w", err)
+	}
+
+	return nil
+}
+
+// CountActiveSessions はアクティブなセッション数を取得する
+func (db *DB) CountActiveSessions() (int, error) {
+	query := `SELECT COUNT(*) FROM sessions WHERE status = 'active'`
+
+	var count int
+	if err := db.QueryRow(query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count active sessions: %w", err)
+	}
+
+	return count, nil
+}
+
+// CreateClaudeTurn はClaude Codeの1ターンの使用量を記録する
+func (db *DB) CreateClaudeTurn(turn *ClaudeTurn) (*ClaudeTurn, error) {
+	query := `
+		INSERT INTO claude_turns (session_id, user_id, input_tokens, output_tokens, cost_usd, duration_ms, exit_status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+
+	created := *turn
+	err := db.QueryRow(query,
+		turn.SessionID,
+		turn.UserID,
+		turn.InputTokens,
+		turn.OutputTokens,
+		turn.CostUSD,
+		turn.DurationMS,
+		turn.ExitStatus,
+	).Scan(&created.ID, &created.CreatedAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create claude turn: %w", err)
+	}
+
+	return &created, nil
+}
+
+// GetSessionUsage はセッションの累計使用量を取得する
+func (db *DB) GetSessionUsage(sessionID int) (*UsageSummary, error) {
+	query := `
+		SELECT COUNT(*), COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0), COALESCE(SUM(cost_usd), 0)
+		FROM claude_turns
+		WHERE session_id = $1
+	`
+
+	summary := &UsageSummary{}
+	err := db.QueryRow(query, sessionID).Scan(
+		&summary.Turns,
+		&summary.InputTokens,
+		&summary.OutputTokens,
+		&summary.CostUSD,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session usage: %w", err)
+	}
+
+	return summary, nil
+}
+
+// GetUserUsage は指定日時以降のguildIDのギルドのユーザーごとの使用量を取得する
+// discordIDが空の場合はギルドの全ユーザーを対象とする
+func (db *DB) GetUserUsage(since time.Time, guildID, discordID string) ([]*UserUsage, error) {
+	query := `
+		SELECT u.discord_id, u.username, COUNT(t.id),
+			COALESCE(SUM(t.input_tokens), 0), COALESCE(SUM(t.output_tokens), 0), COALESCE(SUM(t.cost_usd), 0)
+		FROM claude_turns t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.created_at >= $1 AND u.guild_id IS NOT DISTINCT FROM NULLIF($2, '') AND ($3 = '' OR u.discord_id = $3)
+		GROUP BY u.id, u.discord_id, u.username
+		ORDER BY SUM(t.cost_usd) DESC, u.username
+	`
+
+	rows, err := db.Query(query, since, guildID, discordID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user usage: %w", err)
+	}
+	defer rows.Close()
+
+	var usages []*UserUsage
+	for rows.Next() {
+		usage := &UserUsage{}
+		if err := rows.Scan(
+			&usage.DiscordID,
+			&usage.Username,
+			&usage.Turns,
+			&usage.InputTokens,
+			&usage.OutputTokens,
+			&usage.CostUSD,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan user usage: %w", err)
+		}
+		usages = append(usages, usage)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate user usage: %w", err)
+	}
+
+	return usages, nil
+}
+
+// GetUsageByUserID は指定日時以降のユーザーの使用量を取得する
+func (db *DB) GetUsageByUserID(userID int, since time.Time) (*UsageSummary, error) {
+	query := `
+		SELECT COUNT(*), COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0), COALESCE(SUM(cost_usd), 0)
+		FROM claude_turns
+		WHERE user_id = $1 AND created_at >= $2
+	`
+
+	summary := &UsageSummary{}
+	err := db.QueryRow(query, userID, since).Scan(
+		&summary.Turns,
+		&summary.InputTokens,
+		&summary.OutputTokens,
+		&summary.CostUSD,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage by user: %w", err)
+	}
+
+	return summary, nil
+}
+
+// CountActiveSessionsByUserID はユーザーのアクティブなセッション数を取得する
+func (db *DB) CountActiveSessionsByUserID(userID int) (int, error) {
+	query := `SELECT COUNT(*) FROM sessions WHERE user_id = $1 AND status = 'active'`
+
+	var count int
+	if err := db.QueryRow(query, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count active sessions by user: %w", err)
+	}
+
+	return count, nil
+}
+
+// CountActiveSessionsByGuild はギルドのアクティブなセッション数を取得する
+func (db *DB) CountActiveSessionsByGuild(guildID string) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM sessions
+		WHERE status = 'active' AND guild_id IS NOT DISTINCT FROM NULLIF($1, '')
+	`
+
+	var count int
+	if err := db.QueryRow(query, guildID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count active sessions by guild: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetUserLimits はユーザーの利用上限の上書き設定を取得する
+func (db *DB) GetUserLimits(userID int) (*UserLimits, error) {
+	query := `
+		SELECT user_id, daily_cost_usd, monthly_cost_usd, daily_tokens, monthly_tokens,
+			max_sessions, max_session_minutes, created_at, updated_at
+		FROM user_limits
+		WHERE user_id = $1
+	`
+
+	limits := &UserLimits{}
+	err := db.QueryRow(query, userID).Scan(
+		&limits.UserID,
+		&limits.DailyCostUSD,
+		&limits.MonthlyCostUSD,
+		&limits.DailyTokens,
+		&limits.MonthlyTokens,
+		&limits.MaxSessions,
+		&limits.MaxSessionMinutes,
+		&limits.CreatedAt,
+		&limits.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user limits: %w", err)
+	}
+
+	return limits, nil
+}
+
+// UpsertUserLimits はユーザーの利用上限の上書き設定を作成または更新する
+func (db *DB) UpsertUserLimits(limits *UserLimits) error {
+	query := `
+		INSERT INTO user_limits (user_id, daily_cost_usd, monthly_cost_usd, daily_tokens, monthly_tokens,
+			max_sessions, max_session_minutes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id) DO UPDATE SET
+			daily_cost_usd = EXCLUDED.daily_cost_usd,
+			monthly_cost_usd = EXCLUDED.monthly_cost_usd,
+			daily_tokens = EXCLUDED.daily_tokens,
+			monthly_tokens = EXCLUDED.monthly_tokens,
+			max_sessions = EXCLUDED.max_sessions,
+			max_session_minutes = EXCLUDED.max_session_minutes
+	`
+
+	_, err := db.Exec(query,
+		limits.UserID,
+		limits.DailyCostUSD,
+		limits.MonthlyCostUSD,
+		limits.DailyTokens,
+		limits.MonthlyTokens,
+		limits.MaxSessions,
+		limits.MaxSessionMinutes,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upsert user limits: %w", err)
+	}
+
+	return nil
+}
+
+// CreateMessage は会話履歴を1件記録する
+func (db *DB) CreateMessage(message *Message) (*Message, error) {
+	query := `
+		INSERT INTO messages (session_id, user_id, role, content, exit_code)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	created := *message
+	err := db.QueryRow(query,
+		message.SessionID,
+		message.UserID,
+		message.Role,
+		message.Content,
+		message.ExitCode,
+	).Scan(&created.ID, &created.CreatedAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create message: %w", err)
+	}
+
+	return &created, nil
+}
+
+// GetMessagesBySessionID はセッションの会話履歴を記録順に取得する
+func (db *DB) GetMessagesBySessionID(sessionID int) ([]*Message, error) {
+	query := `
+		SELECT id, session_id, user_id, role, content, exit_code, created_at
+		FROM messages
+		WHERE session_id = $1
+		ORDER BY id
+	`
+
+	rows, err := db.Query(query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*Message
+	for rows.Next() {
+		message := &Message{}
+		if err := rows.Scan(
+			&message.ID,
+			&message.SessionID,
+			&message.UserID,
+			&message.Role,
+			&message.Content,
+			&message.ExitCode,
+			&message.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// GetLastMessageBySessionID はセッションで最後に記録されたメッセージを取得する
+func (db *DB) GetLastMessageBySessionID(sessionID int) (*Message, error) {
+	query := `
+		SELECT id, session_id, user_id, role, content, exit_code, created_at
+		FROM messages
+		WHERE session_id = $1
+		ORDER BY id DESC
+		LIMIT 1
+	`
+
+	message := &Message{}
+	err := db.QueryRow(query, sessionID).Scan(
+		&message.ID,
+		&message.SessionID,
+		&message.UserID,
+		&message.Role,
+		&message.Content,
+		&message.ExitCode,
+		&message.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get last message: %w", err)
+	}
+
+	return message, nil
+}
+
+// ListUsers はすべてのユーザーを登録順に取得する
+func (db *DB) ListUsers() ([]*User, error) {
+	query := `
+		SELECT id, discord_id, username, role, role_source, expires_at, disabled, guild_id, created_at, updated_at
+		FROM users
+		ORDER BY id
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user := &User{}
+		if err := rows.Scan(
+			&user.ID,
+			&user.DiscordID,
+			&user.Username,
+			&user.Role,
+			&user.RoleSource,
+			&user.ExpiresAt,
+			&user.Disabled,
+			&user.GuildID,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate users: %w", err)
+	}
+
+	return users, nil
+}
+
+// ListSessions はセッションを新しい順に取得する
+// statusが空の場合はすべての状態、limitが0以下の場合は件数を制限しない
+func (db *DB) ListSessions(status string, limit int) ([]*Session, error) {
+	query := `
+		SELECT id, user_id, guild_id, thread_id, sandbox_name, status, extension_minutes, created_at, updated_at, terminated_at
+		FROM sessions
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY id DESC
+		LIMIT NULLIF($2, 0)
+	`
+
+	if limit < 0 {
+		limit = 0
+	}
+
+	rows, err := db.Query(query, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		session := &Session{}
+		if err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.GuildID,
+			&session.ThreadID,
+			&session.SandboxName,
+			&session.Status,
+			&session.ExtensionMinutes,
+			&session.CreatedAt,
+			&session.UpdatedAt,
+			&session.TerminatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// ListSessionsByGuild はguildIDのギルドのセッションを新しい順に取得する（空文字列はギルドに属さないセッション）
+// statusが空の場合はすべての状態、limitが0以下の場合は件数を制限しない
+func (db *DB) ListSessionsByGuild(guildID, status string, limit int) ([]*Session, error) {
+	query := `
+		SELECT id, user_id, guild_id, thread_id, sandbox_name, status, extension_minutes, created_at, updated_at, terminated_at
+		FROM sessions
+		WHERE guild_id IS NOT DISTINCT FROM NULLIF($1, '') AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT NULLIF($3, 0)
+	`
+
+	if limit < 0 {
+		limit = 0
+	}
+
+	rows, err := db.Query(query, guildID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions by guild: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		session := &Session{}
+		if err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.GuildID,
+			&session.ThreadID,
+			&session.SandboxName,
+			&session.Status,
+			&session.ExtensionMinutes,
+			&session.CreatedAt,
+			&session.UpdatedAt,
+			&session.TerminatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// CreateAPIToken は管理APIのアクセストークンを登録する
+func (db *DB) CreateAPIToken(userID int, name, tokenHash string) (*APIToken, error) {
+	query := `
+		INSERT INTO api_tokens (user_id, name, token_hash)
+		VALUES ($1, $2, $3)
+		RETURNING id, user_id, name, token_hash, created_at, last_used_at, revoked_at
+	`
+
+	token := &APIToken{}
+	err := db.QueryRow(query, userID, name, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.TokenHash,
+		&token.CreatedAt,
+		&token.LastUsedAt,
+		&token.RevokedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api token: %w", err)
+	}
+
+	return token, nil
+}
+
+// GetAPITokenByHash はハッシュでアクセストークンを取得する（失効済みも含む）
+func (db *DB) GetAPITokenByHash(tokenHash string) (*APIToken, error) {
+	query := `
+		SELECT id, user_id, name, token_hash, created_at, last_used_at, revoked_at
+		FROM api_tokens
+		WHERE token_hash = $1
+	`
+
+	token := &APIToken{}
+	err := db.QueryRow(query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.TokenHash,
+		&token.CreatedAt,
+		&token.LastUsedAt,
+		&token.RevokedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get api token: %w", err)
+	}
+
+	return token, nil
+}
+
+// ListAPITokens はすべてのアクセストークンを登録順に取得する
+func (db *DB) ListAPITokens() ([]*APIToken, error) {
+	query := `
+		SELECT id, user_id, name, token_hash, created_at, last_used_at, revoked_at
+		FROM api_tokens
+		ORDER BY id
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []*APIToken
+	for rows.Next() {
+		token := &APIToken{}
+		if err := rows.Scan(
+			&token.ID,
+			&token.UserID,
+			&token.Name,
+			&token.TokenHash,
+			&token.CreatedAt,
+			&token.LastUsedAt,
+			&token.RevokedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan api token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate api tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// TouchAPIToken はアクセストークンの最終使用日時を更新する
+func (db *DB) TouchAPIToken(tokenID int) error {
+	query := `UPDATE api_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1`
+
+	if _, err := db.Exec(query, tokenID); err != nil {
+		return fmt.Errorf("failed to touch api token: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAPIToken はアクセストークンを失効させる
+func (db *DB) RevokeAPIToken(tokenID int) error {
+	query := `
+		UPDATE api_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND revoked_at IS NULL
+	`
+
+	result, err := db.Exec(query, tokenID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("api token not found")
+	}
+
+	return nil
+}
+
+// CreateAuditEvent は監査ログを記録する
+func (db *DB) CreateAuditEvent(event *AuditEvent) (*AuditEvent, error) {
+	query := `
+		INSERT INTO audit_events (actor_discord_id, actor_username, action, target_discord_id, target_username, before_role, after_role, session_id, thread_id, detail, guild_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, created_at
+	`
+
+	created := *event
+	err := db.QueryRow(query,
+		event.ActorDiscordID,
+		event.ActorUsername,
+		event.Action,
+		event.TargetDiscordID,
+		event.TargetUsername,
+		event.BeforeRole,
+		event.AfterRole,
+		event.SessionID,
+		event.ThreadID,
+		event.Detail,
+		event.GuildID,
+	).Scan(&created.ID, &created.CreatedAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit event: %w", err)
+	}
+
+	return &created, nil
+}
+
+// ListAuditEvents はギルドの監査ログを新しい順に取得する
+// discordIDを指定した場合は、そのユーザーが実行者または対象の記録のみを返す（limitが0以下の場合は全件）
+func (db *DB) ListAuditEvents(guildID, discordID string, limit int) ([]*AuditEvent, error) {
+	query := `
+		SELECT id, actor_discord_id, actor_username, action, target_discord_id, target_username,
+		       before_role, after_role, session_id, thread_id, detail, guild_id, created_at
+		FROM audit_events
+		WHERE guild_id IS NOT DISTINCT FROM NULLIF($1, '')
+		  AND ($2 = '' OR actor_discord_id = $2 OR target_discord_id = $2)
+		ORDER BY id DESC
+		LIMIT NULLIF($3, 0)
+	`
+
+	if limit < 0 {
+		limit = 0
+	}
+
+	rows, err := db.Query(query, guildID, discordID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*AuditEvent
+	for rows.Next() {
+		event := &AuditEvent{}
+		if err := rows.Scan(
+			&event.ID,
+			&event.ActorDiscordID,
+			&event.ActorUsername,
+			&event.Action,
+			&event.TargetDiscordID,
+			&event.TargetUsername,
+			&event.BeforeRole,
+			&event.AfterRole,
+			&event.SessionID,
+			&event.ThreadID,
+			&event.Detail,
+			&event.GuildID,
+			&event.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate audit events: %w", err)
+	}
+
+	return events, nil
+}
+
+// SetUserRoleSource はguildIDのギルドのユーザーのロールの管理元（manual または guild_role）を更新する
+func (db *DB) SetUserRoleSource(guildID, discordID, source string) error {
+	query := `UPDATE users SET role_source = $1 WHERE COALESCE(guild_id, '') = $2 AND discord_id = $3`
+
+	result, err := db.Exec(query, source, guildID, discordID)
+	if err != nil {
+		return fmt.Errorf("failed to set user role source: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
+// SetUserAccess はguildIDのギルドのユーザーのアクセス期限（NULLの場合は無期限）と無効化フラグを更新する
+func (db *DB) SetUserAccess(guildID, discordID string, expiresAt sql.NullTime, disabled bool) error {
+	query := `UPDATE users SET expires_at = $1, disabled = $2 WHERE COALESCE(guild_id, '') = $3 AND discord_id = $4`
+
+	result, err := db.Exec(query, expiresAt, disabled, guildID, discordID)
+	if err != nil {
+		return fmt.Errorf("failed to set user access: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
+// AssignUserToGuild はギルドに属さないユーザーをguildIDのギルドに所属させる
+// 既にそのギルドに同じDiscord IDのユーザーが登録されている場合は一意制約によりエラーになる
+func (db *DB) AssignUserToGuild(discordID, guildID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRow(`UPDATE users SET guild_id = $1 WHERE guild_id IS NULL AND discord_id = $2 RETURNING id`, guildID, discordID).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("user not found")
+		}
+		return fmt.Errorf("failed to assign user to guild: %w", err)
+	}
+
+	// ユーザーのセッションも同じギルドに移す
+	if _, err := tx.Exec(`UPDATE sessions SET guild_id = $1 WHERE guild_id IS NULL AND user_id = $2`, guildID, userID); err != nil {
+		return fmt.Errorf("failed to assign sessions to guild: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ListExpiredUsers はアクセス期限を過ぎたが、まだ無効化されていないユーザーを期限順に取得する
+func (db *DB) ListExpiredUsers(now time.Time) ([]*User, error) {
+	query := `
+		SELECT id, discord_id, username, role, role_source, expires_at, disabled, guild_id, created_at, updated_at
+		FROM users
+		WHERE expires_at <= $1 AND disabled = FALSE
+		ORDER BY expires_at, id
+	`
+
+	rows, err := db.Query(query, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user := &User{}
+		if err := rows.Scan(
+			&user.ID,
+			&user.DiscordID,
+			&user.Username,
+			&user.Role,
+			&user.RoleSource,
+			&user.ExpiresAt,
+			&user.Disabled,
+			&user.GuildID,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate users: %w", err)
+	}
+
+	return users, nil
+}
+
+// UpsertRoleBinding はguildIDのギルドのDiscordロールとBotのロールの対応を登録または更新する
+func (db *DB) UpsertRoleBinding(guildID, discordRoleID, role string) (*RoleBinding, error) {
+	available, err := db.roleAvailable(guildID, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert role binding: %w", err)
+	}
+	if !available {
+		return nil, fmt.Errorf("failed to upsert role binding: role %q does not exist", role)
+	}
+
+	query := `
+		INSERT INTO role_bindings (guild_id, discord_role_id, role)
+		VALUES (NULLIF($1, ''), $2, $3)
+		ON CONFLICT ((COALESCE(guild_id, '')), discord_role_id) DO UPDATE SET role = EXCLUDED.role
+		RETURNING id, guild_id, discord_role_id, role, created_at
+	`
+
+	binding := &RoleBinding{}
+	err = db.QueryRow(query, guildID, discordRoleID, role).Scan(
+		&binding.ID,
+		&binding.GuildID,
+		&binding.DiscordRoleID,
+		&binding.Role,
+		&binding.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert role binding: %w", err)
+	}
+
+	return binding, nil
+}
+
+// DeleteRoleBinding はguildIDのギルドのDiscordロールの対応を削除する
+func (db *DB) DeleteRoleBinding(guildID, discordRoleID string) error {
+	query := `DELETE FROM role_bindings WHERE COALESCE(guild_id, '') = $1 AND discord_role_id = $2`
+
+	result, err := db.Exec(query, guildID, discordRoleID)
+	if err != nil {
+		return fmt.Errorf("failed to delete role binding: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("role binding not found")
+	}
+
+	return nil
+}
+
+// ListRoleBindings はすべてのギルドロールの対応を登録順に取得する
+func (db *DB) ListRoleBindings() ([]*RoleBinding, error) {
+	query := `
+		SELECT id, guild_id, discord_role_id, role, created_at
+		FROM role_bindings
+		ORDER BY id
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list role bindings: %w", err)
+	}
+	defer rows.Close()
+
+	var bindings []*RoleBinding
+	for rows.Next() {
+		binding := &RoleBinding{}
+		if err := rows.Scan(
+			&binding.ID,
+			&binding.GuildID,
+			&binding.DiscordRoleID,
+			&binding.Role,
+			&binding.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan role binding: %w", err)
+		}
+		bindings = append(bindings, binding)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate role bindings: %w", err)
+	}
+
+	return bindings, nil
+}
+
+// CreateRole は新しいロールをケイパビリティとともに作成する
+// guildIDを指定した場合はそのギルドの独自ロールになる
+func (db *DB) CreateRole(guildID, name, description string, capabilities []string) (*Role, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO roles (name, description, guild_id)
+		VALUES ($1, $2, NULLIF($3, ''))
+		RETURNING id, name, description, builtin, guild_id, created_at
+	`
+
+	role := &Role{}
+	err = tx.QueryRow(query, name, description, guildID).Scan(
+		&role.ID,
+		&role.Name,
+		&role.Description,
+		&role.Builtin,
+		&role.GuildID,
+		&role.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create role: %w", err)
+	}
+
+	if err := insertRoleCapabilities(tx, role.ID, capabilities); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	role.Capabilities = sortedCapabilities(capabilities)
+	return role, nil
+}
+
+// GetRoleByName はguildIDのギルドで使用できるロールを名前でケイパビリティとともに取得する
+// ギルドの独自ロールを、同じ名前のギルドに属さないロールより優先する
+func (db *DB) GetRoleByName(guildID, name string) (*Role, error) {
+	query := `
+		SELECT id, name, description, builtin, guild_id, created_at
+		FROM roles
+		WHERE name = $1 AND (guild_id IS NULL OR guild_id = $2)
+		ORDER BY guild_id NULLS LAST
+		LIMIT 1
+	`
+
+	role := &Role{}
+	err := db.QueryRow(query, name, guildID).Scan(
+		&role.ID,
+		&role.Name,
+		&role.Description,
+		&role.Builtin,
+		&role.GuildID,
+		&role.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	capabilities, err := db.listRoleCapabilities(`WHERE role_id = $1`, role.ID)
+	if err != nil {
+		return nil, err
+	}
+	role.Capabilities = capabilities[role.ID]
+
+	return role, nil
+}
+
+// ListRoles はすべてのロールをケイパビリティとともに作成順に取得する
+func (db *DB) ListRoles() ([]*Role, error) {
+	query := `
+		SELECT id, name, description, builtin, guild_id, created_at
+		FROM roles
+		ORDER BY id
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []*Role
+	for rows.Next() {
+		role := &Role{}
+		if err := rows.Scan(
+			&role.ID,
+			&role.Name,
+			&role.Description,
+			&role.Builtin,
+			&role.GuildID,
+			&role.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate roles: %w", err)
+	}
+
+	capabilities, err := db.listRoleCapabilities("")
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		role.Capabilities = capabilities[role.ID]
+	}
+
+	return roles, nil
+}
+
+// SetRoleCapabilities はguildIDのギルドのロール（空文字列の場合はギルドに属さないロール）のケイパビリティを指定したものに置き換える
+func (db *DB) SetRoleCapabilities(guildID, name string, capabilities []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var roleID int
+	if err := tx.QueryRow(`SELECT id FROM roles WHERE COALESCE(guild_id, '') = $1 AND name = $2`, guildID, name).Scan(&roleID); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("role not found")
+		}
+		return fmt.Errorf("failed to get role: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM role_capabilities WHERE role_id = $1`, roleID); err != nil {
+		return fmt.Errorf("failed to delete role capabilities: %w", err)
+	}
+
+	if err := insertRoleCapabilities(tx, roleID, capabilities); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteRole はguildIDのギルドのロール（空文字列の場合はギルドに属さないロール）を削除する
+// ロールを使用できるギルドのユーザーまたはロール連携から参照されている場合はエラーを返す
+func (db *DB) DeleteRole(guildID, name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var roleID int
+	if err := tx.QueryRow(`SELECT id FROM roles WHERE COALESCE(guild_id, '') = $1 AND name = $2 FOR UPDATE`, guildID, name).Scan(&roleID); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("role not found")
+		}
+		return fmt.Errorf("failed to get role: %w", err)
+	}
+
+	// ギルドに属さないロールはすべてのギルドから参照できる
+	var referenced bool
+	query := `
+		SELECT EXISTS (SELECT 1 FROM users WHERE role = $2 AND ($1 = '' OR guild_id = $1))
+			OR EXISTS (SELECT 1 FROM role_bindings WHERE role = $2 AND ($1 = '' OR guild_id = $1))
+	`
+	if err := tx.QueryRow(query, guildID, name).Scan(&referenced); err != nil {
+		return fmt.Errorf("failed to check role references: %w", err)
+	}
+	if referenced {
+		return fmt.Errorf("failed to delete role: role %q is referenced by users or role bindings", name)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM roles WHERE id = $1`, roleID); err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// roleAvailable はguildIDのギルドで名前がnameのロールを使用できるかチェックする
+func (db *DB) roleAvailable(guildID, name string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM roles WHERE name = $1 AND (guild_id IS NULL OR guild_id = $2))`
+
+	var available bool
+	if err := db.QueryRow(query, name, guildID).Scan(&available); err != nil {
+		return false, fmt.Errorf("failed to check role: %w", err)
+	}
+
+	return available, nil
+}
+
+// UpsertSessionMember はセッションにユーザーを招待する（招待済みの場合はロールを更新する）
+func (db *DB) UpsertSessionMember(sessionID, userID int, role string, invitedBy int) (*SessionMember, error) {
+	query := `
+		INSERT INTO session_members (session_id, user_id, role, invited_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (session_id, user_id) DO UPDATE SET role = EXCLUDED.role, invited_by = EXCLUDED.invited_by
+		RETURNING session_id, user_id, role, invited_by, created_at
+	`
+
+	member := &SessionMember{}
+	err := db.QueryRow(query, sessionID, userID, role, invitedBy).Scan(
+		&member.SessionID,
+		&member.UserID,
+		&member.Role,
+		&member.InvitedBy,
+		&member.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert session member: %w", err)
+	}
+
+	return member, nil
+}
+
+// GetSessionMember はセッションに招待されたユーザーを取得する
+func (db *DB) GetSessionMember(sessionID, userID int) (*SessionMember, error) {
+	query := `
+		SELECT session_id, user_id, role, invited_by, created_at
+		FROM session_members
+		WHERE session_id = $1 AND user_id = $2
+	`
+
+	member := &SessionMember{}
+	err := db.QueryRow(query, sessionID, userID).Scan(
+		&member.SessionID,
+		&member.UserID,
+		&member.Role,
+		&member.InvitedBy,
+		&member.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get session member: %w", err)
+	}
+
+	return member, nil
+}
+
+// ListSessionMembers はセッションに招待されたユーザーを招待順に取得する
+func (db *DB) ListSessionMembers(sessionID int) ([]*SessionMember, error) {
+	query := `
+		SELECT session_id, user_id, role, invited_by, created_at
+		FROM session_members
+		WHERE session_id = $1
+		ORDER BY created_at, user_id
+	`
+
+	rows, err := db.Query(query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list session members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []*SessionMember
+	for rows.Next() {
+		member := &SessionMember{}
+		if err := rows.Scan(
+			&member.SessionID,
+			&member.UserID,
+			&member.Role,
+			&member.InvitedBy,
+			&member.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan session member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate session members: %w", err)
+	}
+
+	return members, nil
+}
+
+// listRoleCapabilities はロールのケイパビリティをロールIDごとに名前順で取得する
+func (db *DB) listRoleCapabilities(where string, args ...interface{}) (map[int][]string, error) {
+	query := `SELECT role_id, capability FROM role_capabilities ` + where + ` ORDER BY role_id, capability`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list role capabilities: %w", err)
+	}
+	defer rows.Close()
+
+	capabilities := make(map[int][]string)
+	for rows.Next() {
+		var roleID int
+		var capability string
+		if err := rows.Scan(&roleID, &capability); err != nil {
+			return nil, fmt.Errorf("failed to scan role capability: %w", err)
+		}
+		capabilities[roleID] = append(capabilities[roleID], capability)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate role capabilities: %w", err)
+	}
+
+	return capabilities, nil
+}
+
+// insertRoleCapabilities はロールにケイパビリティを追加する（重複は無視する）
+func insertRoleCapabilities(tx *sql.Tx, roleID int, capabilities []string) error {
+	for _, capability := range capabilities {
+		_, err := tx.Exec(`
+			INSERT INTO role_capabilities (role_id, capability)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, roleID, capability)
+		if err != nil {
+			return fmt.Errorf("failed to add role capability: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// UpsertGuild はギルドを登録する（登録済みの場合は名前のみ更新し、空の名前では更新しない）
+func (db *DB) UpsertGuild(guildID, name string) (*Guild, error) {
+	query := `
+		INSERT INTO guilds (guild_id, name)
+		VALUES ($1, $2)
+		ON CONFLICT (guild_id) DO UPDATE SET name = COALESCE(NULLIF(EXCLUDED.name, ''), guilds.name)
+	`
+
+	if _, err := db.Exec(query, guildID, name); err != nil {
+		return nil, fmt.Errorf("failed to upsert guild: %w", err)
+	}
+
+	return db.GetGuild(guildID)
+}
+
+// GetGuild はギルドIDでギルドの設定を取得する
+func (db *DB) GetGuild(guildID string) (*Guild, error) {
+	query := `
+		SELECT guild_id, name, max_sandboxes, audit_channel_id, daily_cost_usd, monthly_cost_usd,
+			daily_tokens, monthly_tokens, max_sessions, max_session_minutes, created_at, updated_at
+		FROM guilds
+		WHERE guild_id = $1
+	`
+
+	guild, err := scanGuild(db.QueryRow(query, guildID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get guild: %w", err)
+	}
+
+	return guild, nil
+}
+
+// ListGuilds はすべてのギルドの設定を登録順に取得する
+func (db *DB) ListGuilds() ([]*Guild, error) {
+	query := `
+		SELECT guild_id, name, max_sandboxes, audit_channel_id, daily_cost_usd, monthly_cost_usd,
+			daily_tokens, monthly_tokens, max_sessions, max_session_minutes, created_at, updated_at
+		FROM guilds
+		ORDER BY created_at, guild_id
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list guilds: %w", err)
+	}
+	defer rows.Close()
+
+	var guilds []*Guild
+	for rows.Next() {
+		guild, err := scanGuild(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan guild: %w", err)
+		}
+		guilds = append(guilds, guild)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate guilds: %w", err)
+	}
+
+	return guilds, nil
+}
+
+// UpdateGuildSettings はギルドのサンドボックス数・管理チャンネル・利用上限を更新する
+func (db *DB) UpdateGuildSettings(guild *Guild) error {
+	query := `
+		UPDATE guilds SET
+			max_sandboxes = $1,
+			audit_channel_id = $2,
+			daily_cost_usd = $3,
+			monthly_cost_usd = $4,
+			daily_tokens = $5,
+			monthly_tokens = $6,
+			max_sessions = $7,
+			max_session_minutes = $8
+		WHERE guild_id = $9
+	`
+
+	result, err := db.Exec(query,
+		guild.MaxSandboxes,
+		guild.AuditChannelID,
+		guild.DailyCostUSD,
+		guild.MonthlyCostUSD,
+		guild.DailyTokens,
+		guild.MonthlyTokens,
+		guild.MaxSessions,
+		guild.MaxSessionMinutes,
+		guild.GuildID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update guild settings: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("guild not found")
+	}
+
+	return nil
+}
+
+// AssignUnscopedToGuild はギルドに属さないユーザー・セッション・独自ロール・ロール連携・監査ログをギルドに割り当て、割り当てたユーザー数を返す
+// 複数ギルドに対応する前のデータを DISCORD_GUILD_ID のギルドに移行するために使用する
+func (db *DB) AssignUnscopedToGuild(guildID string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 既にギルドに登録されているDiscord IDのユーザーは、一意制約に反するためギルドに属さないまま残す
+	result, err := tx.Exec(`
+		UPDATE users SET guild_id = $1
+		WHERE guild_id IS NULL
+			AND NOT EXISTS (SELECT 1 FROM users scoped WHERE scoped.guild_id = $1 AND scoped.discord_id = users.discord_id)
+	`, guildID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to assign users to guild: %w", err)
+	}
+
+	assigned, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	statements := []string{
+		`UPDATE roles SET guild_id = $1 WHERE guild_id IS NULL AND builtin = FALSE
+			AND NOT EXISTS (SELECT 1 FROM roles scoped WHERE scoped.guild_id = $1 AND scoped.name = roles.name)`,
+		`UPDATE role_bindings SET guild_id = $1 WHERE guild_id IS NULL
+			AND NOT EXISTS (SELECT 1 FROM role_bindings scoped WHERE scoped.guild_id = $1 AND scoped.discord_role_id = role_bindings.discord_role_id)`,
+		`UPDATE audit_events SET guild_id = $1 WHERE guild_id IS NULL`,
+		// 移行したユーザーのセッションと、所有者が削除されたギルドに属さないセッション
+		`UPDATE sessions SET guild_id = $1 WHERE guild_id IS NULL
+			AND (user_id IS NULL OR user_id IN (SELECT id FROM users WHERE guild_id = $1))`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, guildID); err != nil {
+			return 0, fmt.Errorf("failed to assign records to guild: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return int(assigned), nil
+}
+
+// rowScanner は *sql.Row と *sql.Rows に共通する読み取り操作
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanGuild はギルドの設定を1行読み取る
+func scanGuild(row rowScanner) (*Guild, error) {
+	guild := &Guild{}
+	err := row.Scan(
+		&guild.GuildID,
+		&guild.Name,
+		&guild.MaxSandboxes,
+		&guild.AuditChannelID,
+		&guild.DailyCostUSD,
+		&guild.MonthlyCostUSD,
+		&guild.DailyTokens,
+		&guild.MonthlyTokens,
+		&guild.MaxSessions,
+		&guild.MaxSessionMinutes,
+		&guild.CreatedAt,
+		&guild.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return guild, nil
+}
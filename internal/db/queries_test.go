@@ -12,7 +12,7 @@ func TestUserCRUD(t *testing.T) {
 	defer db.Close()
 
 	// ユーザー作成テスト
-	user, err := db.CreateUser("123456789", "testuser", "user")
+	user, err := db.CreateUser("", "123456789", "testuser", "user")
 	if err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
@@ -26,7 +26,7 @@ func TestUserCRUD(t *testing.T) {
 	}
 
 	// ユーザー取得テスト
-	retrievedUser, err := db.GetUserByDiscordID("123456789")
+	retrievedUser, err := db.GetUserByDiscordID("", "123456789")
 	if err != nil {
 		t.Fatalf("Failed to get user: %v", err)
 	}
@@ -40,12 +40,12 @@ func TestUserCRUD(t *testing.T) {
 	}
 
 	// ユーザーロール更新テスト
-	err = db.UpdateUserRole("123456789", "owner")
+	err = db.UpdateUserRole("", "123456789", "owner")
 	if err != nil {
 		t.Fatalf("Failed to update user role: %v", err)
 	}
 
-	updatedUser, err := db.GetUserByDiscordID("123456789")
+	updatedUser, err := db.GetUserByDiscordID("", "123456789")
 	if err != nil {
 		t.Fatalf("Failed to get updated user: %v", err)
 	}
@@ -55,12 +55,12 @@ func TestUserCRUD(t *testing.T) {
 	}
 
 	// ユーザー削除テスト
-	err = db.DeleteUser("123456789")
+	err = db.DeleteUser("", "123456789")
 	if err != nil {
 		t.Fatalf("Failed to delete user: %v", err)
 	}
 
-	deletedUser, err := db.GetUserByDiscordID("123456789")
+	deletedUser, err := db.GetUserByDiscordID("", "123456789")
 	if err != nil {
 		t.Fatalf("Failed to check deleted user: %v", err)
 	}
@@ -76,7 +76,7 @@ func TestSessionCRUD(t *testing.T) {
 	defer db.Close()
 
 	// テスト用ユーザー作成
-	user, err := db.CreateUser("123456789", "testuser", "user")
+	user, err := db.CreateUser("", "123456789", "testuser", "user")
 	if err != nil {
 		t.Fatalf("Failed to create test user: %v", err)
 	}
@@ -135,7 +135,7 @@ func TestSandboxCRUD(t *testing.T) {
 	defer db.Close()
 
 	// テスト用ユーザーとセッション作成
-	user, err := db.CreateUser("123456789", "testuser", "user")
+	user, err := db.CreateUser("", "123456789", "testuser", "user")
 	if err != nil {
 		t.Fatalf("Failed to create test user: %v", err)
 	}
@@ -270,7 +270,7 @@ func setupTestDB(t *testing.T) *DB {
 // cleanupTestData はテストデータをクリーンアップする
 func cleanupTestData(t *testing.T, db *DB) {
 	// 外部キー制約を考慮した順序で削除
-	tables := []string{"sandboxes", "sessions", "users"}
+	tables := []string{"api_tokens", "sandboxes", "sessions", "role_bindings", "users"}
 
 	for _, table := range tables {
 		_, err := db.Exec("DELETE FROM " + table + " WHERE created_at < NOW()")
@@ -279,6 +279,11 @@ func cleanupTestData(t *testing.T, db *DB) {
 		}
 	}
 
+	// 組み込みロール以外のロールを削除
+	if _, err := db.Exec("DELETE FROM roles WHERE builtin = FALSE"); err != nil {
+		t.Logf("Warning: Failed to cleanup table roles: %v", err)
+	}
+
 	// サンドボックス使用量をリセット
 	_, err := db.Exec("UPDATE sandbox_usage SET current_count = 0")
 	if err != nil {
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// UserStore はユーザーの永続化を行うインターフェース
+// ユーザーはギルドとDiscord IDの組で一意になり、ギルドIDの空文字列はギルドに属さないこと（NULL）を表す
+type UserStore interface {
+	CreateUser(guildID, discordID, username, role string) (*User, error)
+	GetUserByDiscordID(guildID, discordID string) (*User, error)
+	ListUsersByDiscordID(discordID string) ([]*User, error)
+	GetUserByID(userID int) (*User, error)
+	ListUsers() ([]*User, error)
+	UpdateUserRole(guildID, discordID, role string) error
+	SetUserRoleSource(guildID, discordID, source string) error
+	SetUserAccess(guildID, discordID string, expiresAt sql.NullTime, disabled bool) error
+	AssignUserToGuild(discordID, guildID string) error
+	ListExpiredUsers(now time.Time) ([]*User, error)
+	DeleteUser(guildID, discordID string) error
+}
+
+// SessionStore はセッションの永続化を行うインターフェース
+type SessionStore interface {
+	CreateSession(userID int, threadID, sandboxName string) (*Session, error)
+	GetSessionByThreadID(threadID string) (*Session, error)
+	GetSessionByID(sessionID int) (*Session, error)
+	ListSessions(status string, limit int) ([]*Session, error)
+	ListSessionsByGuild(guildID, status string, limit int) ([]*Session, error)
+	UpdateSessionStatus(sessionID int, status string) error
+	UpdateSessionSandboxName(sessionID int, sandboxName string) error
+	ExtendSession(sessionID int, minutes int) error
+	CountActiveSessions() (int, error)
+	CountActiveSessionsByUserID(userID int) (int, error)
+	CountActiveSessionsByGuild(guildID string) (int, error)
+}
+
+// SandboxStore はサンドボックスと同時実行数の永続化を行うインターフェース
+type SandboxStore interface {
+	CreateSandbox(sessionID int, podName, namespace string) (*Sandbox, error)
+	GetSandboxByPodName(podName string) (*Sandbox, error)
+	UpdateSandboxStatus(sandboxID int, status string) error
+	TransitionSandboxStatus(sandboxID int, from, to string) (bool, error)
+	GetSandboxUsage() (*SandboxUsage, error)
+	IncrementSandboxUsage() error
+	DecrementSandboxUsage() error
+	GetSessionGuild(sessionID int) (*Guild, error)
+	CountActiveSandboxesByGuild(guildID string) (int, error)
+}
+
+// UsageStore は使用量・利用上限・会話履歴の永続化を行うインターフェース
+type UsageStore interface {
+	CreateClaudeTurn(turn *ClaudeTurn) (*ClaudeTurn, error)
+	GetSessionUsage(sessionID int) (*UsageSummary, error)
+	GetUserUsage(since time.Time, guildID, discordID string) ([]*UserUsage, error)
+	GetUsageByUserID(userID int, since time.Time) (*UsageSummary, error)
+	GetUserLimits(userID int) (*UserLimits, error)
+	UpsertUserLimits(limits *UserLimits) error
+	CreateMessage(message *Message) (*Message, error)
+	GetMessagesBySessionID(sessionID int) ([]*Message, error)
+	GetLastMessageBySessionID(sessionID int) (*Message, error)
+}
+
+// APITokenStore は管理APIのアクセストークンの永続化を行うインターフェース
+type APITokenStore interface {
+	CreateAPIToken(userID int, name, tokenHash string) (*APIToken, error)
+	GetAPITokenByHash(tokenHash string) (*APIToken, error)
+	ListAPITokens() ([]*APIToken, error)
+	TouchAPIToken(tokenID int) error
+	RevokeAPIToken(tokenID int) error
+}
+
+// RoleBindingStore はDiscordのギルドロールとBotのロールの対応の永続化を行うインターフェース
+type RoleBindingStore interface {
+	UpsertRoleBinding(guildID, discordRoleID, role string) (*RoleBinding, error)
+	DeleteRoleBinding(guildID, discordRoleID string) error
+	ListRoleBindings() ([]*RoleBinding, error)
+}
+
+// RoleStore はロールとケイパビリティの定義の永続化を行うインターフェース
+// ロールはギルドと名前の組で一意になり、組み込みロールはギルドに属さない
+type RoleStore interface {
+	CreateRole(guildID, name, description string, capabilities []string) (*Role, error)
+	GetRoleByName(guildID, name string) (*Role, error)
+	ListRoles() ([]*Role, error)
+	SetRoleCapabilities(guildID, name string, capabilities []string) error
+	DeleteRole(guildID, name string) error
+}
+
+// SessionMemberStore はセッションに招待されたユーザーの永続化を行うインターフェース
+type SessionMemberStore interface {
+	UpsertSessionMember(sessionID, userID int, role string, invitedBy int) (*SessionMember, error)
+	GetSessionMember(sessionID, userID int) (*SessionMember, error)
+	ListSessionMembers(sessionID int) ([]*SessionMember, error)
+}
+
+// AuditStore は監査ログの永続化を行うインターフェース
+type AuditStore interface {
+	CreateAuditEvent(event *AuditEvent) (*AuditEvent, error)
+	ListAuditEvents(guildID, discordID string, limit int) ([]*AuditEvent, error)
+}
+
+// GuildStore はギルド（Discordサーバー）ごとの設定の永続化を行うインターフェース
+// ギルドIDの空文字列はギルドに属さないこと（NULL）を表す
+type GuildStore interface {
+	UpsertGuild(guildID, name string) (*Guild, error)
+	GetGuild(guildID string) (*Guild, error)
+	ListGuilds() ([]*Guild, error)
+	UpdateGuildSettings(guild *Guild) error
+	AssignUnscopedToGuild(guildID string) (int, error)
+}
+
+// Store はアプリケーションが使用するすべての永続化操作をまとめたインターフェース
+// PostgreSQL実装の *DB とテスト用の *MemoryStore が実装する
+type Store interface {
+	UserStore
+	SessionStore
+	SandboxStore
+	UsageStore
+	APITokenStore
+	AuditStore
+	RoleBindingStore
+	RoleStore
+	SessionMemberStore
+	GuildStore
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
@@ -0,0 +1,1285 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMemoryStoreContract はMemoryStoreがStoreの契約を満たすかのテスト
+func TestMemoryStoreContract(t *testing.T) {
+	testStoreContract(t, func(t *testing.T) Store {
+		return NewMemoryStore(3)
+	})
+}
+
+// TestPostgresStoreContract はPostgreSQL実装がStoreの契約を満たすかのテスト
+func TestPostgresStoreContract(t *testing.T) {
+	testStoreContract(t, func(t *testing.T) Store {
+		db := setupTestDB(t)
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
+
+// testStoreContract はStoreの実装が満たすべき振る舞いを検証する
+func testStoreContract(t *testing.T, newStore func(t *testing.T) Store) {
+	t.Run("Users", func(t *testing.T) {
+		store := newStore(t)
+
+		user := mustCreateUser(t, store, "contract-user", "user")
+
+		if _, err := store.CreateUser("", "contract-user", "duplicate", "user"); err == nil {
+			t.Error("Expected error for duplicate discord ID, got nil")
+		}
+
+		if _, err := store.CreateUser("", "contract-invalid", "invalid", "admin"); err == nil {
+			t.Error("Expected error for invalid role, got nil")
+		}
+
+		found, err := store.GetUserByID(user.ID)
+		if err != nil {
+			t.Fatalf("Failed to get user by ID: %v", err)
+		}
+		if found == nil || found.DiscordID != "contract-user" {
+			t.Fatalf("Expected user contract-user, got %+v", found)
+		}
+
+		if err := store.UpdateUserRole("", "contract-user", "owner"); err != nil {
+			t.Fatalf("Failed to update user role: %v", err)
+		}
+		found, err = store.GetUserByDiscordID("", "contract-user")
+		if err != nil {
+			t.Fatalf("Failed to get user: %v", err)
+		}
+		if !found.IsOwner() {
+			t.Errorf("Expected role 'owner', got '%s'", found.Role)
+		}
+
+		if err := store.UpdateUserRole("", "contract-missing", "owner"); err == nil {
+			t.Error("Expected error when updating missing user, got nil")
+		}
+
+		// ロールの管理元は明示的な登録が既定
+		if found.IsGuildRoleUser() {
+			t.Errorf("Expected role source 'manual', got '%s'", found.RoleSource)
+		}
+		if err := store.SetUserRoleSource("", "contract-user", "guild_role"); err != nil {
+			t.Fatalf("Failed to set user role source: %v", err)
+		}
+		if found, _ := store.GetUserByDiscordID("", "contract-user"); !found.IsGuildRoleUser() {
+			t.Errorf("Expected role source 'guild_role', got '%s'", found.RoleSource)
+		}
+		if err := store.SetUserRoleSource("", "contract-user", "ldap"); err == nil {
+			t.Error("Expected error for invalid role source, got nil")
+		}
+		if err := store.SetUserRoleSource("", "contract-missing", "manual"); err == nil {
+			t.Error("Expected error when updating missing user, got nil")
+		}
+
+		mustCreateUser(t, store, "contract-user-2", "user")
+		users, err := store.ListUsers()
+		if err != nil {
+			t.Fatalf("Failed to list users: %v", err)
+		}
+		if len(users) != 2 || users[0].DiscordID != "contract-user" || users[1].DiscordID != "contract-user-2" {
+			t.Errorf("Expected users in registration order, got %+v", users)
+		}
+
+		if err := store.DeleteUser("", "contract-user"); err != nil {
+			t.Fatalf("Failed to delete user: %v", err)
+		}
+		if err := store.DeleteUser("", "contract-user"); err == nil {
+			t.Error("Expected error when deleting missing user, got nil")
+		}
+
+		found, err = store.GetUserByDiscordID("", "contract-user")
+		if err != nil {
+			t.Fatalf("Failed to get deleted user: %v", err)
+		}
+		if found != nil {
+			t.Error("Expected user to be deleted, but still exists")
+		}
+	})
+
+	t.Run("UserAccess", func(t *testing.T) {
+		store := newStore(t)
+
+		now := time.Now()
+		expired := mustCreateUser(t, store, "contract-expired", "user")
+		active := mustCreateUser(t, store, "contract-active", "user")
+		mustCreateUser(t, store, "contract-permanent", "user")
+
+		if expired.ExpiresAt.Valid || expired.Disabled || expired.AccessEnded(now) {
+			t.Errorf("Expected new user to have unlimited access, got %+v", expired)
+		}
+
+		if err := store.SetUserAccess("", expired.DiscordID, sql.NullTime{Time: now.Add(-time.Minute), Valid: true}, false); err != nil {
+			t.Fatalf("Failed to set user access: %v", err)
+		}
+		if err := store.SetUserAccess("", active.DiscordID, sql.NullTime{Time: now.Add(time.Hour), Valid: true}, false); err != nil {
+			t.Fatalf("Failed to set user access: %v", err)
+		}
+		if err := store.SetUserAccess("", "contract-missing", sql.NullTime{}, true); err == nil {
+			t.Error("Expected error for missing user, got nil")
+		}
+
+		users, err := store.ListExpiredUsers(now)
+		if err != nil {
+			t.Fatalf("Failed to list expired users: %v", err)
+		}
+		if len(users) != 1 || users[0].DiscordID != expired.DiscordID || !users[0].AccessEnded(now) {
+			t.Errorf("Expected only contract-expired, got %+v", users)
+		}
+
+		// 無効化されたユーザーは期限切れとして再度取得されない
+		if err := store.SetUserAccess("", expired.DiscordID, users[0].ExpiresAt, true); err != nil {
+			t.Fatalf("Failed to disable user: %v", err)
+		}
+		if users, _ := store.ListExpiredUsers(now); len(users) != 0 {
+			t.Errorf("Expected no expired users after disabling, got %+v", users)
+		}
+
+		found, _ := store.GetUserByDiscordID("", expired.DiscordID)
+		if found == nil || !found.Disabled || !found.AccessEnded(now) {
+			t.Errorf("Expected user to be disabled, got %+v", found)
+		}
+	})
+
+	t.Run("Sessions", func(t *testing.T) {
+		store := newStore(t)
+
+		user := mustCreateUser(t, store, "contract-user", "user")
+		session, err := store.CreateSession(user.ID, "contract-thread", "contract-sandbox")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		if !session.IsActive() {
+			t.Errorf("Expected status 'active', got '%s'", session.Status)
+		}
+
+		if _, err := store.CreateSession(user.ID, "contract-thread", "contract-sandbox-2"); err == nil {
+			t.Error("Expected error for duplicate thread ID, got nil")
+		}
+		if _, err := store.CreateSession(user.ID+1000, "contract-thread-2", "contract-sandbox-2"); err == nil {
+			t.Error("Expected error for missing user, got nil")
+		}
+
+		found, err := store.GetSessionByID(session.ID)
+		if err != nil {
+			t.Fatalf("Failed to get session by ID: %v", err)
+		}
+		if found == nil || found.ThreadID != "contract-thread" {
+			t.Fatalf("Expected session contract-thread, got %+v", found)
+		}
+
+		missing, err := store.GetSessionByThreadID("contract-missing")
+		if err != nil {
+			t.Fatalf("Failed to get missing session: %v", err)
+		}
+		if missing != nil {
+			t.Errorf("Expected nil for missing session, got %+v", missing)
+		}
+
+		assertCount(t, "active sessions by user", store.CountActiveSessionsByUserID, user.ID, 1)
+
+		other, err := store.CreateSession(user.ID, "contract-thread-3", "contract-sandbox-3")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		if err := store.UpdateSessionSandboxName(other.ID, "contract-sandbox"); err == nil {
+			t.Error("Expected error for duplicate sandbox name, got nil")
+		}
+		if err := store.UpdateSessionSandboxName(other.ID, "contract-pool-pod"); err != nil {
+			t.Fatalf("Failed to update sandbox name: %v", err)
+		}
+		found, _ = store.GetSessionByID(other.ID)
+		if found.SandboxName != "contract-pool-pod" {
+			t.Errorf("Expected sandbox name 'contract-pool-pod', got '%s'", found.SandboxName)
+		}
+		if found.ExtensionMinutes != 0 {
+			t.Errorf("Expected no extension, got %d minutes", found.ExtensionMinutes)
+		}
+		for i := 0; i < 2; i++ {
+			if err := store.ExtendSession(other.ID, 30); err != nil {
+				t.Fatalf("Failed to extend session: %v", err)
+			}
+		}
+		found, _ = store.GetSessionByThreadID("contract-thread-3")
+		if found.ExtensionMinutes != 60 {
+			t.Errorf("Expected extension of 60 minutes, got %d", found.ExtensionMinutes)
+		}
+		if err := store.UpdateSessionStatus(other.ID, "terminated"); err != nil {
+			t.Fatalf("Failed to terminate session: %v", err)
+		}
+
+		if err := store.UpdateSessionStatus(session.ID, "bogus"); err == nil {
+			t.Error("Expected error for invalid session status, got nil")
+		}
+
+		if err := store.UpdateSessionStatus(session.ID, "failed"); err != nil {
+			t.Fatalf("Failed to mark session failed: %v", err)
+		}
+		found, _ = store.GetSessionByThreadID("contract-thread")
+		if found.Status != "failed" || found.TerminatedAt.Valid {
+			t.Errorf("Expected failed session without TerminatedAt, got %+v", found)
+		}
+
+		if err := store.UpdateSessionStatus(session.ID, "terminated"); err != nil {
+			t.Fatalf("Failed to terminate session: %v", err)
+		}
+		found, _ = store.GetSessionByThreadID("contract-thread")
+		if !found.IsTerminated() || !found.TerminatedAt.Valid {
+			t.Errorf("Expected terminated session with TerminatedAt, got %+v", found)
+		}
+
+		assertCount(t, "active sessions by user", store.CountActiveSessionsByUserID, user.ID, 0)
+
+		// 終了したセッションと同じスレッドID（DMチャンネル）では新しいセッションを開始できる
+		next, err := store.CreateSession(user.ID, "contract-thread", "contract-sandbox-4")
+		if err != nil {
+			t.Fatalf("Failed to create session on reused thread: %v", err)
+		}
+		found, _ = store.GetSessionByThreadID("contract-thread")
+		if found == nil || found.ID != next.ID {
+			t.Errorf("Expected latest session %d for reused thread, got %+v", next.ID, found)
+		}
+		if err := store.UpdateSessionStatus(session.ID, "active"); err == nil {
+			t.Error("Expected error for second active session on the same thread, got nil")
+		}
+	})
+
+	t.Run("Sandboxes", func(t *testing.T) {
+		store := newStore(t)
+
+		user := mustCreateUser(t, store, "contract-user", "user")
+		session, err := store.CreateSession(user.ID, "contract-thread", "contract-sandbox")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+
+		sandbox, err := store.CreateSandbox(session.ID, "contract-pod", "disclaude")
+		if err != nil {
+			t.Fatalf("Failed to create sandbox: %v", err)
+		}
+		if !sandbox.IsPending() || sandbox.CPULimit == "" || sandbox.MemoryLimit == "" {
+			t.Errorf("Expected pending sandbox with default limits, got %+v", sandbox)
+		}
+
+		if _, err := store.CreateSandbox(session.ID, "contract-pod", "disclaude"); err == nil {
+			t.Error("Expected error for duplicate pod name, got nil")
+		}
+
+		if err := store.UpdateSandboxStatus(sandbox.ID, "running"); err != nil {
+			t.Fatalf("Failed to update sandbox status: %v", err)
+		}
+		if err := store.UpdateSandboxStatus(sandbox.ID, "bogus"); err == nil {
+			t.Error("Expected error for invalid sandbox status, got nil")
+		}
+
+		found, err := store.GetSandboxByPodName("contract-pod")
+		if err != nil {
+			t.Fatalf("Failed to get sandbox: %v", err)
+		}
+		if found == nil || !found.IsRunning() {
+			t.Errorf("Expected running sandbox, got %+v", found)
+		}
+
+		// 条件付きの更新は現在のステータスが一致する場合のみ成功する
+		transitioned, err := store.TransitionSandboxStatus(sandbox.ID, "running", "failed")
+		if err != nil || !transitioned {
+			t.Fatalf("Expected transition from running to failed, got %v (err: %v)", transitioned, err)
+		}
+		transitioned, err = store.TransitionSandboxStatus(sandbox.ID, "running", "terminated")
+		if err != nil || transitioned {
+			t.Errorf("Expected no transition from failed sandbox, got %v (err: %v)", transitioned, err)
+		}
+		if found, _ := store.GetSandboxByPodName("contract-pod"); found == nil || found.Status != "failed" {
+			t.Errorf("Expected failed sandbox, got %+v", found)
+		}
+
+		// ユーザーを削除しても、セッション・サンドボックス・会話履歴はレビューのために残り、所有者はNULLになる
+		if _, err := store.CreateMessage(&Message{SessionID: session.ID, UserID: sql.NullInt64{Int64: int64(user.ID), Valid: true}, Role: "user", Content: "ls"}); err != nil {
+			t.Fatalf("Failed to create message: %v", err)
+		}
+		if err := store.DeleteUser("", "contract-user"); err != nil {
+			t.Fatalf("Failed to delete user: %v", err)
+		}
+		found, err = store.GetSandboxByPodName("contract-pod")
+		if err != nil || found == nil {
+			t.Errorf("Expected sandbox to be kept, got %+v (%v)", found, err)
+		}
+		kept, err := store.GetSessionByID(session.ID)
+		if err != nil || kept == nil {
+			t.Fatalf("Expected session to be kept, got %+v (%v)", kept, err)
+		}
+		if kept.HasOwner() || !kept.InGuild("") {
+			t.Errorf("Expected session without owner in the same guild, got %+v", kept)
+		}
+		messages, err := store.GetMessagesBySessionID(session.ID)
+		if err != nil || len(messages) != 1 || messages[0].UserID.Valid {
+			t.Errorf("Expected message to be kept without author, got %+v (%v)", messages, err)
+		}
+	})
+
+	t.Run("SandboxUsage", func(t *testing.T) {
+		store := newStore(t)
+
+		usage, err := store.GetSandboxUsage()
+		if err != nil {
+			t.Fatalf("Failed to get sandbox usage: %v", err)
+		}
+		if usage.CurrentCount != 0 || !usage.CanCreateSandbox() {
+			t.Fatalf("Expected empty usage, got %+v", usage)
+		}
+
+		for i := 0; i < usage.MaxCount; i++ {
+			if err := store.IncrementSandboxUsage(); err != nil {
+				t.Fatalf("Failed to increment sandbox usage: %v", err)
+			}
+		}
+
+		full, _ := store.GetSandboxUsage()
+		if full.CanCreateSandbox() || full.RemainingCapacity() != 0 {
+			t.Errorf("Expected usage to be full, got %+v", full)
+		}
+
+		for i := 0; i < usage.MaxCount+1; i++ {
+			if err := store.DecrementSandboxUsage(); err != nil {
+				t.Fatalf("Failed to decrement sandbox usage: %v", err)
+			}
+		}
+
+		empty, _ := store.GetSandboxUsage()
+		if empty.CurrentCount != 0 {
+			t.Errorf("Expected usage not to go below 0, got %d", empty.CurrentCount)
+		}
+	})
+
+	t.Run("Usage", func(t *testing.T) {
+		store := newStore(t)
+
+		alice := mustCreateUser(t, store, "contract-alice", "user")
+		bob := mustCreateUser(t, store, "contract-bob", "user")
+		session, err := store.CreateSession(alice.ID, "contract-thread", "contract-sandbox")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+
+		// 他のギルドに登録された同じDiscordユーザーの使用量は含めない
+		if _, err := store.UpsertGuild("contract-guild-a", ""); err != nil {
+			t.Fatalf("Failed to upsert guild: %v", err)
+		}
+		guildAlice, err := store.CreateUser("contract-guild-a", "contract-alice", "alice", "user")
+		if err != nil {
+			t.Fatalf("Failed to create guild user: %v", err)
+		}
+
+		since := time.Now().Add(-time.Minute)
+		turns := []struct {
+			user *User
+			cost float64
+		}{
+			{alice, 0.5},
+			{alice, 0.25},
+			{bob, 1},
+			{guildAlice, 2},
+		}
+		for _, tt := range turns {
+			_, err := store.CreateClaudeTurn(&ClaudeTurn{
+				SessionID:    sql.NullInt64{Int64: int64(session.ID), Valid: true},
+				UserID:       sql.NullInt64{Int64: int64(tt.user.ID), Valid: true},
+				InputTokens:  100,
+				OutputTokens: 10,
+				CostUSD:      tt.cost,
+				DurationMS:   1000,
+				ExitStatus:   "success",
+			})
+			if err != nil {
+				t.Fatalf("Failed to create claude turn: %v", err)
+			}
+		}
+
+		sessionUsage, err := store.GetSessionUsage(session.ID)
+		if err != nil {
+			t.Fatalf("Failed to get session usage: %v", err)
+		}
+		if sessionUsage.Turns != 4 || sessionUsage.TotalTokens() != 440 || sessionUsage.CostUSD != 3.75 {
+			t.Errorf("Unexpected session usage: %+v", sessionUsage)
+		}
+
+		aliceUsage, err := store.GetUsageByUserID(alice.ID, since)
+		if err != nil {
+			t.Fatalf("Failed to get usage by user: %v", err)
+		}
+		if aliceUsage.Turns != 2 || aliceUsage.CostUSD != 0.75 {
+			t.Errorf("Unexpected usage for alice: %+v", aliceUsage)
+		}
+
+		future, err := store.GetUsageByUserID(alice.ID, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("Failed to get future usage: %v", err)
+		}
+		if future.Turns != 0 {
+			t.Errorf("Expected no usage in the future, got %+v", future)
+		}
+
+		usages, err := store.GetUserUsage(since, "", "")
+		if err != nil {
+			t.Fatalf("Failed to get user usage: %v", err)
+		}
+		if len(usages) != 2 || usages[0].DiscordID != "contract-bob" || usages[1].DiscordID != "contract-alice" {
+			t.Fatalf("Expected usage ordered by cost (bob, alice), got %+v", usages)
+		}
+
+		usages, err = store.GetUserUsage(since, "", "contract-alice")
+		if err != nil {
+			t.Fatalf("Failed to get user usage for alice: %v", err)
+		}
+		if len(usages) != 1 || usages[0].Turns != 2 || usages[0].CostUSD != 0.75 {
+			t.Errorf("Expected only alice's usage, got %+v", usages)
+		}
+
+		usages, err = store.GetUserUsage(since, "contract-guild-a", "")
+		if err != nil {
+			t.Fatalf("Failed to get user usage in guild: %v", err)
+		}
+		if len(usages) != 1 || usages[0].Username != "alice" || usages[0].Turns != 1 || usages[0].CostUSD != 2 {
+			t.Errorf("Expected only guild alice's usage, got %+v", usages)
+		}
+	})
+
+	t.Run("UserLimits", func(t *testing.T) {
+		store := newStore(t)
+
+		user := mustCreateUser(t, store, "contract-user", "user")
+
+		limits, err := store.GetUserLimits(user.ID)
+		if err != nil {
+			t.Fatalf("Failed to get user limits: %v", err)
+		}
+		if limits != nil {
+			t.Fatalf("Expected no limits, got %+v", limits)
+		}
+
+		err = store.UpsertUserLimits(&UserLimits{
+			UserID:       user.ID,
+			DailyCostUSD: sql.NullFloat64{Float64: 5, Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("Failed to insert user limits: %v", err)
+		}
+
+		err = store.UpsertUserLimits(&UserLimits{
+			UserID:      user.ID,
+			MaxSessions: sql.NullInt64{Int64: 2, Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("Failed to update user limits: %v", err)
+		}
+
+		limits, err = store.GetUserLimits(user.ID)
+		if err != nil {
+			t.Fatalf("Failed to get user limits: %v", err)
+		}
+		if limits == nil || limits.DailyCostUSD.Valid || limits.MaxSessions.Int64 != 2 {
+			t.Errorf("Expected limits to be replaced, got %+v", limits)
+		}
+	})
+
+	t.Run("Messages", func(t *testing.T) {
+		store := newStore(t)
+
+		user := mustCreateUser(t, store, "contract-user", "user")
+		session, err := store.CreateSession(user.ID, "contract-thread", "contract-sandbox")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+
+		for _, role := range []string{"user", "assistant"} {
+			_, err := store.CreateMessage(&Message{
+				SessionID: session.ID,
+				UserID:    sql.NullInt64{Int64: int64(user.ID), Valid: true},
+				Role:      role,
+				Content:   role + " message",
+			})
+			if err != nil {
+				t.Fatalf("Failed to create message: %v", err)
+			}
+		}
+
+		if _, err := store.CreateMessage(&Message{SessionID: session.ID, Role: "bogus"}); err == nil {
+			t.Error("Expected error for invalid message role, got nil")
+		}
+
+		messages, err := store.GetMessagesBySessionID(session.ID)
+		if err != nil {
+			t.Fatalf("Failed to get messages: %v", err)
+		}
+		if len(messages) != 2 || messages[0].Role != "user" || messages[1].Role != "assistant" {
+			t.Errorf("Expected messages in insertion order, got %+v", messages)
+		}
+
+		last, err := store.GetLastMessageBySessionID(session.ID)
+		if err != nil {
+			t.Fatalf("Failed to get last message: %v", err)
+		}
+		if last == nil || last.Role != "assistant" {
+			t.Errorf("Expected last message to be the assistant message, got %+v", last)
+		}
+
+		other, err := store.CreateSession(user.ID, "contract-thread-2", "contract-sandbox-2")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		if last, err := store.GetLastMessageBySessionID(other.ID); err != nil || last != nil {
+			t.Errorf("Expected nil for session without messages, got %+v (err: %v)", last, err)
+		}
+	})
+
+	t.Run("ListSessions", func(t *testing.T) {
+		store := newStore(t)
+
+		user := mustCreateUser(t, store, "contract-user", "user")
+		for i := 1; i <= 3; i++ {
+			if _, err := store.CreateSession(user.ID, fmt.Sprintf("contract-thread-%d", i), fmt.Sprintf("contract-sandbox-%d", i)); err != nil {
+				t.Fatalf("Failed to create session: %v", err)
+			}
+		}
+		first, err := store.GetSessionByThreadID("contract-thread-1")
+		if err != nil {
+			t.Fatalf("Failed to get session: %v", err)
+		}
+		if err := store.UpdateSessionStatus(first.ID, "terminated"); err != nil {
+			t.Fatalf("Failed to update session status: %v", err)
+		}
+
+		sessions, err := store.ListSessions("", 0)
+		if err != nil {
+			t.Fatalf("Failed to list sessions: %v", err)
+		}
+		if len(sessions) != 3 || sessions[0].ThreadID != "contract-thread-3" {
+			t.Errorf("Expected all sessions newest first, got %+v", sessions)
+		}
+
+		sessions, err = store.ListSessions("active", 1)
+		if err != nil {
+			t.Fatalf("Failed to list active sessions: %v", err)
+		}
+		if len(sessions) != 1 || sessions[0].ThreadID != "contract-thread-3" {
+			t.Errorf("Expected the newest active session, got %+v", sessions)
+		}
+
+		sessions, err = store.ListSessions("terminated", 0)
+		if err != nil {
+			t.Fatalf("Failed to list terminated sessions: %v", err)
+		}
+		if len(sessions) != 1 || sessions[0].ID != first.ID {
+			t.Errorf("Expected the terminated session, got %+v", sessions)
+		}
+
+		// ギルドごとの一覧は他のギルドのセッションを除いてから件数を制限する
+		if _, err := store.UpsertGuild("contract-guild-a", ""); err != nil {
+			t.Fatalf("Failed to upsert guild: %v", err)
+		}
+		guildUser, err := store.CreateUser("contract-guild-a", "contract-user", "contract-user-name", "user")
+		if err != nil {
+			t.Fatalf("Failed to create guild user: %v", err)
+		}
+		guildSession, err := store.CreateSession(guildUser.ID, "contract-thread-guild", "contract-sandbox-guild")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+
+		sessions, err = store.ListSessionsByGuild("contract-guild-a", "", 0)
+		if err != nil {
+			t.Fatalf("Failed to list sessions by guild: %v", err)
+		}
+		if len(sessions) != 1 || sessions[0].ID != guildSession.ID {
+			t.Errorf("Expected only the guild session, got %+v", sessions)
+		}
+
+		sessions, err = store.ListSessionsByGuild("", "active", 1)
+		if err != nil {
+			t.Fatalf("Failed to list unscoped sessions: %v", err)
+		}
+		if len(sessions) != 1 || sessions[0].ThreadID != "contract-thread-3" {
+			t.Errorf("Expected the newest active unscoped session, got %+v", sessions)
+		}
+	})
+
+	t.Run("APITokens", func(t *testing.T) {
+		store := newStore(t)
+
+		user := mustCreateUser(t, store, "contract-user", "owner")
+		token, err := store.CreateAPIToken(user.ID, "ci", "contract-hash")
+		if err != nil {
+			t.Fatalf("Failed to create api token: %v", err)
+		}
+		if token.Name != "ci" || token.UserID != user.ID || token.IsRevoked() || token.LastUsedAt.Valid {
+			t.Errorf("Unexpected api token: %+v", token)
+		}
+
+		if _, err := store.CreateAPIToken(user.ID, "duplicate", "contract-hash"); err == nil {
+			t.Error("Expected error for duplicate token hash, got nil")
+		}
+		if _, err := store.CreateAPIToken(user.ID+1000, "orphan", "contract-hash-2"); err == nil {
+			t.Error("Expected error for missing user, got nil")
+		}
+
+		if err := store.TouchAPIToken(token.ID); err != nil {
+			t.Fatalf("Failed to touch api token: %v", err)
+		}
+		found, err := store.GetAPITokenByHash("contract-hash")
+		if err != nil {
+			t.Fatalf("Failed to get api token: %v", err)
+		}
+		if found == nil || found.ID != token.ID || !found.LastUsedAt.Valid {
+			t.Errorf("Expected touched token, got %+v", found)
+		}
+
+		if err := store.RevokeAPIToken(token.ID); err != nil {
+			t.Fatalf("Failed to revoke api token: %v", err)
+		}
+		if err := store.RevokeAPIToken(token.ID); err == nil {
+			t.Error("Expected error when revoking twice, got nil")
+		}
+		found, err = store.GetAPITokenByHash("contract-hash")
+		if err != nil {
+			t.Fatalf("Failed to get api token: %v", err)
+		}
+		if found == nil || !found.IsRevoked() {
+			t.Errorf("Expected revoked token, got %+v", found)
+		}
+
+		if found, err := store.GetAPITokenByHash("contract-missing"); err != nil || found != nil {
+			t.Errorf("Expected nil for missing token, got %+v, %v", found, err)
+		}
+
+		// ユーザーの削除でトークンも削除される
+		if err := store.DeleteUser("", "contract-user"); err != nil {
+			t.Fatalf("Failed to delete user: %v", err)
+		}
+		tokens, err := store.ListAPITokens()
+		if err != nil {
+			t.Fatalf("Failed to list api tokens: %v", err)
+		}
+		if len(tokens) != 0 {
+			t.Errorf("Expected tokens to be deleted with the user, got %+v", tokens)
+		}
+	})
+
+	t.Run("RoleBindings", func(t *testing.T) {
+		store := newStore(t)
+
+		if _, err := store.UpsertRoleBinding("", "contract-role-1", "user"); err != nil {
+			t.Fatalf("Failed to create role binding: %v", err)
+		}
+		if _, err := store.UpsertRoleBinding("", "contract-role-2", "user"); err != nil {
+			t.Fatalf("Failed to create role binding: %v", err)
+		}
+		if _, err := store.UpsertRoleBinding("", "contract-role-3", "admin"); err == nil {
+			t.Error("Expected error for invalid role, got nil")
+		}
+
+		// 同じロールは上書きされる
+		updated, err := store.UpsertRoleBinding("", "contract-role-1", "owner")
+		if err != nil {
+			t.Fatalf("Failed to update role binding: %v", err)
+		}
+		if updated.Role != "owner" {
+			t.Errorf("Expected role 'owner', got '%s'", updated.Role)
+		}
+
+		bindings, err := store.ListRoleBindings()
+		if err != nil {
+			t.Fatalf("Failed to list role bindings: %v", err)
+		}
+		if len(bindings) != 2 || bindings[0].DiscordRoleID != "contract-role-1" || bindings[0].Role != "owner" || bindings[0].ID != updated.ID {
+			t.Errorf("Unexpected role bindings: %+v", bindings)
+		}
+
+		if err := store.DeleteRoleBinding("", "contract-role-1"); err != nil {
+			t.Fatalf("Failed to delete role binding: %v", err)
+		}
+		if err := store.DeleteRoleBinding("", "contract-role-1"); err == nil {
+			t.Error("Expected error when deleting missing role binding, got nil")
+		}
+		bindings, _ = store.ListRoleBindings()
+		if len(bindings) != 1 || bindings[0].DiscordRoleID != "contract-role-2" {
+			t.Errorf("Expected only contract-role-2, got %+v", bindings)
+		}
+	})
+
+	t.Run("Roles", func(t *testing.T) {
+		store := newStore(t)
+
+		// 組み込みロールはマイグレーションで作成される
+		owner, err := store.GetRoleByName("", "owner")
+		if err != nil {
+			t.Fatalf("Failed to get role: %v", err)
+		}
+		if owner == nil || !owner.Builtin || !owner.HasCapability("manage_users") {
+			t.Fatalf("Expected builtin owner role with manage_users, got %+v", owner)
+		}
+		user, _ := store.GetRoleByName("", "user")
+		if user == nil || !user.Builtin || user.HasCapability("manage_users") || !user.HasCapability("create_sandbox") {
+			t.Fatalf("Expected builtin user role with only create_sandbox, got %+v", user)
+		}
+
+		reviewer, err := store.CreateRole("", "contract-reviewer", "閲覧のみ", []string{"view_usage", "view_all_sessions", "view_usage"})
+		if err != nil {
+			t.Fatalf("Failed to create role: %v", err)
+		}
+		if reviewer.Builtin || len(reviewer.Capabilities) != 2 || reviewer.Capabilities[0] != "view_all_sessions" {
+			t.Errorf("Expected sorted unique capabilities, got %+v", reviewer)
+		}
+		if _, err := store.CreateRole("", "contract-reviewer", "", nil); err == nil {
+			t.Error("Expected error for duplicate role name, got nil")
+		}
+
+		if err := store.SetRoleCapabilities("", "contract-reviewer", []string{"view_audit"}); err != nil {
+			t.Fatalf("Failed to set role capabilities: %v", err)
+		}
+		if err := store.SetRoleCapabilities("", "contract-missing", []string{"view_audit"}); err == nil {
+			t.Error("Expected error when updating missing role, got nil")
+		}
+		found, err := store.GetRoleByName("", "contract-reviewer")
+		if err != nil {
+			t.Fatalf("Failed to get role: %v", err)
+		}
+		if found == nil || len(found.Capabilities) != 1 || !found.HasCapability("view_audit") || found.Description != "閲覧のみ" {
+			t.Errorf("Expected capabilities to be replaced, got %+v", found)
+		}
+
+		roles, err := store.ListRoles()
+		if err != nil {
+			t.Fatalf("Failed to list roles: %v", err)
+		}
+		if len(roles) != 3 || roles[0].Name != "owner" || roles[2].Name != "contract-reviewer" || !roles[2].HasCapability("view_audit") {
+			t.Errorf("Unexpected roles: %+v", roles)
+		}
+
+		// ユーザーやロール連携から参照されているロールは削除できない
+		mustCreateUser(t, store, "contract-reviewer-user", "contract-reviewer")
+		if err := store.DeleteRole("", "contract-reviewer"); err == nil {
+			t.Error("Expected error when deleting role in use, got nil")
+		}
+		if err := store.UpdateUserRole("", "contract-reviewer-user", "user"); err != nil {
+			t.Fatalf("Failed to update user role: %v", err)
+		}
+		if _, err := store.UpsertRoleBinding("", "contract-reviewer-role", "contract-reviewer"); err != nil {
+			t.Fatalf("Failed to bind custom role: %v", err)
+		}
+		if err := store.DeleteRole("", "contract-reviewer"); err == nil {
+			t.Error("Expected error when deleting bound role, got nil")
+		}
+		if err := store.DeleteRoleBinding("", "contract-reviewer-role"); err != nil {
+			t.Fatalf("Failed to delete role binding: %v", err)
+		}
+
+		if err := store.DeleteRole("", "contract-reviewer"); err != nil {
+			t.Fatalf("Failed to delete role: %v", err)
+		}
+		if err := store.DeleteRole("", "contract-reviewer"); err == nil {
+			t.Error("Expected error when deleting missing role, got nil")
+		}
+		if found, _ := store.GetRoleByName("", "contract-reviewer"); found != nil {
+			t.Errorf("Expected role to be deleted, got %+v", found)
+		}
+	})
+
+	t.Run("SessionMembers", func(t *testing.T) {
+		store := newStore(t)
+
+		owner := mustCreateUser(t, store, "contract-owner", "user")
+		guest := mustCreateUser(t, store, "contract-guest", "user")
+		session, err := store.CreateSession(owner.ID, "contract-thread", "contract-sandbox")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+
+		if member, err := store.GetSessionMember(session.ID, guest.ID); err != nil || member != nil {
+			t.Errorf("Expected no member before invitation, got %+v (err: %v)", member, err)
+		}
+
+		if _, err := store.UpsertSessionMember(session.ID, guest.ID, "viewer", owner.ID); err != nil {
+			t.Fatalf("Failed to invite session member: %v", err)
+		}
+		if _, err := store.UpsertSessionMember(session.ID, guest.ID, "admin", owner.ID); err == nil {
+			t.Error("Expected error for invalid member role, got nil")
+		}
+		if _, err := store.UpsertSessionMember(session.ID+1000, guest.ID, "viewer", owner.ID); err == nil {
+			t.Error("Expected error for missing session, got nil")
+		}
+
+		// 招待済みのユーザーはロールが更新される
+		updated, err := store.UpsertSessionMember(session.ID, guest.ID, "collaborator", owner.ID)
+		if err != nil {
+			t.Fatalf("Failed to update session member: %v", err)
+		}
+		if !updated.CanPrompt() || updated.InvitedBy.Int64 != int64(owner.ID) {
+			t.Errorf("Unexpected session member: %+v", updated)
+		}
+
+		members, err := store.ListSessionMembers(session.ID)
+		if err != nil {
+			t.Fatalf("Failed to list session members: %v", err)
+		}
+		if len(members) != 1 || members[0].UserID != guest.ID || members[0].Role != "collaborator" {
+			t.Errorf("Unexpected session members: %+v", members)
+		}
+
+		// 招待されたユーザーを削除すると招待も削除される
+		if err := store.DeleteUser("", "contract-guest"); err != nil {
+			t.Fatalf("Failed to delete user: %v", err)
+		}
+		if member, err := store.GetSessionMember(session.ID, guest.ID); err != nil || member != nil {
+			t.Errorf("Expected member to be deleted with user, got %+v (err: %v)", member, err)
+		}
+	})
+
+	t.Run("AuditEvents", func(t *testing.T) {
+		store := newStore(t)
+
+		promoted, err := store.CreateAuditEvent(&AuditEvent{
+			ActorDiscordID:  "contract-owner",
+			ActorUsername:   "owner",
+			Action:          "user_promote",
+			TargetDiscordID: sql.NullString{String: "contract-user", Valid: true},
+			TargetUsername:  sql.NullString{String: "user", Valid: true},
+			BeforeRole:      sql.NullString{String: "user", Valid: true},
+			AfterRole:       sql.NullString{String: "owner", Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create audit event: %v", err)
+		}
+		if promoted.ID == 0 || promoted.CreatedAt.IsZero() || promoted.AfterRole.String != "owner" {
+			t.Errorf("Unexpected audit event: %+v", promoted)
+		}
+
+		if _, err := store.CreateAuditEvent(&AuditEvent{
+			ActorDiscordID: "contract-other",
+			ActorUsername:  "other",
+			Action:         "session_start",
+			SessionID:      sql.NullInt64{Int64: 1, Valid: true},
+			ThreadID:       sql.NullString{String: "contract-thread", Valid: true},
+		}); err != nil {
+			t.Fatalf("Failed to create audit event: %v", err)
+		}
+
+		// 新しい順に取得できる
+		events, err := store.ListAuditEvents("", "", 0)
+		if err != nil {
+			t.Fatalf("Failed to list audit events: %v", err)
+		}
+		if len(events) != 2 || events[0].Action != "session_start" || events[1].ID != promoted.ID {
+			t.Errorf("Expected audit events newest first, got %+v", events)
+		}
+		if events[0].TargetDiscordID.Valid || events[0].ThreadID.String != "contract-thread" {
+			t.Errorf("Unexpected session audit event: %+v", events[0])
+		}
+
+		// 実行者または対象で絞り込める
+		for _, discordID := range []string{"contract-owner", "contract-user"} {
+			events, err := store.ListAuditEvents("", discordID, 0)
+			if err != nil {
+				t.Fatalf("Failed to list audit events: %v", err)
+			}
+			if len(events) != 1 || events[0].ID != promoted.ID {
+				t.Errorf("Expected only the promote event for %s, got %+v", discordID, events)
+			}
+		}
+
+		events, err = store.ListAuditEvents("", "", 1)
+		if err != nil {
+			t.Fatalf("Failed to list audit events: %v", err)
+		}
+		if len(events) != 1 || events[0].Action != "session_start" {
+			t.Errorf("Expected only the newest audit event, got %+v", events)
+		}
+	})
+
+	t.Run("Guilds", func(t *testing.T) {
+		store := newStore(t)
+
+		// 複数ギルドに対応する前のデータ（ギルドに属さない）
+		legacy := mustCreateUser(t, store, "contract-legacy", "user")
+		legacySession, err := store.CreateSession(legacy.ID, "contract-legacy-thread", "contract-legacy-sandbox")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		if _, err := store.CreateRole("", "contract-legacy-role", "", []string{"view_usage"}); err != nil {
+			t.Fatalf("Failed to create role: %v", err)
+		}
+		if _, err := store.CreateAuditEvent(&AuditEvent{ActorDiscordID: "contract-legacy", ActorUsername: "legacy", Action: "user_add"}); err != nil {
+			t.Fatalf("Failed to create audit event: %v", err)
+		}
+
+		if err := store.AssignUserToGuild("contract-legacy", "contract-guild-a"); err == nil {
+			t.Error("Expected error for unknown guild, got nil")
+		}
+
+		guild, err := store.UpsertGuild("contract-guild-a", "Team A")
+		if err != nil {
+			t.Fatalf("Failed to upsert guild: %v", err)
+		}
+		if guild.Name != "Team A" || guild.MaxSandboxes.Valid {
+			t.Errorf("Expected guild without settings, got %+v", guild)
+		}
+		// 空の名前では既存の名前を上書きしない
+		if guild, _ = store.UpsertGuild("contract-guild-a", ""); guild.Name != "Team A" {
+			t.Errorf("Expected name to be kept, got %q", guild.Name)
+		}
+		if _, err := store.UpsertGuild("contract-guild-b", "Team B"); err != nil {
+			t.Fatalf("Failed to upsert guild: %v", err)
+		}
+
+		guild.MaxSandboxes = sql.NullInt64{Int64: 2, Valid: true}
+		guild.AuditChannelID = sql.NullString{String: "contract-audit", Valid: true}
+		guild.DailyCostUSD = sql.NullFloat64{Float64: 1.5, Valid: true}
+		if err := store.UpdateGuildSettings(guild); err != nil {
+			t.Fatalf("Failed to update guild settings: %v", err)
+		}
+		if err := store.UpdateGuildSettings(&Guild{GuildID: "contract-missing"}); err == nil {
+			t.Error("Expected error when updating missing guild, got nil")
+		}
+		found, err := store.GetGuild("contract-guild-a")
+		if err != nil {
+			t.Fatalf("Failed to get guild: %v", err)
+		}
+		if found == nil || found.MaxSandboxes.Int64 != 2 || found.AuditChannelID.String != "contract-audit" || found.DailyCostUSD.Float64 != 1.5 || found.MonthlyCostUSD.Valid {
+			t.Errorf("Unexpected guild settings: %+v", found)
+		}
+		if missing, err := store.GetGuild("contract-missing"); err != nil || missing != nil {
+			t.Errorf("Expected nil for missing guild, got %+v (%v)", missing, err)
+		}
+		guilds, err := store.ListGuilds()
+		if err != nil {
+			t.Fatalf("Failed to list guilds: %v", err)
+		}
+		if len(guilds) != 2 {
+			t.Errorf("Expected 2 guilds, got %+v", guilds)
+		}
+
+		// ギルドに属さないデータをギルドに割り当てる
+		assigned, err := store.AssignUnscopedToGuild("contract-guild-a")
+		if err != nil {
+			t.Fatalf("Failed to assign unscoped records: %v", err)
+		}
+		if assigned != 1 {
+			t.Errorf("Expected 1 assigned user, got %d", assigned)
+		}
+		user, _ := store.GetUserByID(legacy.ID)
+		if !user.InGuild("contract-guild-a") {
+			t.Errorf("Expected legacy user to be assigned, got %+v", user.GuildID)
+		}
+		if session, _ := store.GetSessionByID(legacySession.ID); !session.InGuild("contract-guild-a") {
+			t.Errorf("Expected legacy session to be assigned with its user, got %+v", session.GuildID)
+		}
+		role, _ := store.GetRoleByName("contract-guild-a", "contract-legacy-role")
+		builtin, _ := store.GetRoleByName("", "owner")
+		if role.GuildID.String != "contract-guild-a" || builtin.GuildID.Valid {
+			t.Errorf("Expected only custom roles to be assigned, got %+v / %+v", role.GuildID, builtin.GuildID)
+		}
+		if events, _ := store.ListAuditEvents("contract-guild-a", "", 0); len(events) != 1 {
+			t.Errorf("Expected legacy audit event in the guild, got %+v", events)
+		}
+
+		// ギルドごとのアクティブなセッション数
+		other, err := store.CreateUser("contract-guild-b", "contract-other", "other", "user")
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		if _, err := store.CreateSession(legacy.ID, "contract-thread-a", "contract-sandbox-a"); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		otherSession, err := store.CreateSession(other.ID, "contract-thread-b", "contract-sandbox-b")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		if !otherSession.InGuild("contract-guild-b") {
+			t.Errorf("Expected session in the owner's guild, got %+v", otherSession.GuildID)
+		}
+		for guildID, expected := range map[string]int{"contract-guild-a": 2, "contract-guild-b": 1, "": 0} {
+			count, err := store.CountActiveSessionsByGuild(guildID)
+			if err != nil {
+				t.Fatalf("Failed to count active sessions by guild: %v", err)
+			}
+			if count != expected {
+				t.Errorf("Expected %d active sessions in guild %q, got %d", expected, guildID, count)
+			}
+		}
+
+		// セッションのギルドと、ギルドごとの作成中・実行中のサンドボックス数
+		if guild, err := store.GetSessionGuild(otherSession.ID); err != nil || guild == nil || guild.GuildID != "contract-guild-b" {
+			t.Errorf("Expected session guild contract-guild-b, got %+v (%v)", guild, err)
+		}
+		if guild, err := store.GetSessionGuild(999999); err != nil || guild != nil {
+			t.Errorf("Expected no guild for unknown session, got %+v (%v)", guild, err)
+		}
+		pending, err := store.CreateSandbox(otherSession.ID, "contract-sandbox-b", "default")
+		if err != nil {
+			t.Fatalf("Failed to create sandbox: %v", err)
+		}
+		if count, _ := store.CountActiveSandboxesByGuild("contract-guild-b"); count != 1 {
+			t.Errorf("Expected pending sandbox to be counted, got %d", count)
+		}
+		_ = store.UpdateSandboxStatus(pending.ID, "failed")
+		if count, _ := store.CountActiveSandboxesByGuild("contract-guild-b"); count != 0 {
+			t.Errorf("Expected failed sandbox not to be counted, got %d", count)
+		}
+
+		// ギルドに属さないユーザーのサンドボックスは、セッション数と同じく空文字列のギルドで数える
+		unscoped := mustCreateUser(t, store, "contract-unscoped", "user")
+		unscopedSession, err := store.CreateSession(unscoped.ID, "contract-thread-c", "contract-sandbox-c")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		if _, err := store.CreateSandbox(unscopedSession.ID, "contract-sandbox-c", "default"); err != nil {
+			t.Fatalf("Failed to create sandbox: %v", err)
+		}
+		sessions, _ := store.CountActiveSessionsByGuild("")
+		sandboxes, _ := store.CountActiveSandboxesByGuild("")
+		if sessions != 1 || sandboxes != 1 {
+			t.Errorf("Expected 1 unscoped session and sandbox, got %d sessions and %d sandboxes", sessions, sandboxes)
+		}
+
+		// ロール連携とロールはギルドに属する
+		binding, err := store.UpsertRoleBinding("contract-guild-b", "contract-role-b", "user")
+		if err != nil {
+			t.Fatalf("Failed to upsert role binding: %v", err)
+		}
+		if binding.GuildID.String != "contract-guild-b" {
+			t.Errorf("Expected binding in guild B, got %+v", binding)
+		}
+		created, err := store.CreateRole("contract-guild-b", "contract-b-role", "", nil)
+		if err != nil {
+			t.Fatalf("Failed to create role: %v", err)
+		}
+		if created.GuildID.String != "contract-guild-b" {
+			t.Errorf("Expected role in guild B, got %+v", created)
+		}
+		if _, err := store.CreateRole("contract-missing", "contract-missing-role", "", nil); err == nil {
+			t.Error("Expected error for role in unknown guild, got nil")
+		}
+
+		// 監査ログはギルドごとに取得する
+		if _, err := store.CreateAuditEvent(&AuditEvent{ActorDiscordID: "contract-other", ActorUsername: "other", Action: "user_add", GuildID: sql.NullString{String: "contract-guild-b", Valid: true}}); err != nil {
+			t.Fatalf("Failed to create audit event: %v", err)
+		}
+		events, err := store.ListAuditEvents("contract-guild-b", "", 0)
+		if err != nil {
+			t.Fatalf("Failed to list audit events: %v", err)
+		}
+		if len(events) != 1 || events[0].ActorDiscordID != "contract-other" || events[0].GuildID.String != "contract-guild-b" {
+			t.Errorf("Expected only guild B audit events, got %+v", events)
+		}
+		if events, _ := store.ListAuditEvents("", "", 0); len(events) != 0 {
+			t.Errorf("Expected no unscoped audit events, got %+v", events)
+		}
+	})
+
+	t.Run("GuildScopedKeys", func(t *testing.T) {
+		store := newStore(t)
+
+		for _, guildID := range []string{"contract-guild-a", "contract-guild-b"} {
+			if _, err := store.UpsertGuild(guildID, ""); err != nil {
+				t.Fatalf("Failed to upsert guild: %v", err)
+			}
+		}
+
+		// 同じDiscordユーザーをギルドごとに登録できる
+		userA, err := store.CreateUser("contract-guild-a", "contract-shared", "shared", "owner")
+		if err != nil {
+			t.Fatalf("Failed to create user in guild A: %v", err)
+		}
+		userB, err := store.CreateUser("contract-guild-b", "contract-shared", "shared", "user")
+		if err != nil {
+			t.Fatalf("Failed to create user in guild B: %v", err)
+		}
+		if _, err := store.CreateUser("contract-guild-b", "contract-shared", "duplicate", "user"); err == nil {
+			t.Error("Expected error for duplicate discord ID in the same guild, got nil")
+		}
+		if found, _ := store.GetUserByDiscordID("contract-guild-b", "contract-shared"); found == nil || found.ID != userB.ID || found.IsOwner() {
+			t.Errorf("Expected guild B user, got %+v", found)
+		}
+		if found, _ := store.GetUserByDiscordID("", "contract-shared"); found != nil {
+			t.Errorf("Expected no unscoped user, got %+v", found)
+		}
+		users, err := store.ListUsersByDiscordID("contract-shared")
+		if err != nil {
+			t.Fatalf("Failed to list users by discord ID: %v", err)
+		}
+		if len(users) != 2 || users[0].ID != userA.ID || users[1].ID != userB.ID {
+			t.Errorf("Expected users of both guilds, got %+v", users)
+		}
+
+		// 更新・削除は指定したギルドのユーザーのみに適用される
+		if err := store.SetUserAccess("contract-guild-b", "contract-shared", sql.NullTime{}, true); err != nil {
+			t.Fatalf("Failed to set user access: %v", err)
+		}
+		if found, _ := store.GetUserByID(userA.ID); found.Disabled {
+			t.Error("Expected guild A user to stay enabled")
+		}
+		if err := store.DeleteUser("contract-guild-b", "contract-shared"); err != nil {
+			t.Fatalf("Failed to delete user: %v", err)
+		}
+		if found, _ := store.GetUserByID(userA.ID); found == nil {
+			t.Error("Expected guild A user to remain")
+		}
+
+		// 同じ名前のロールをギルドごとに定義でき、他のギルドのロールは使用できない
+		if _, err := store.CreateRole("contract-guild-a", "reviewer", "", []string{"view_usage"}); err != nil {
+			t.Fatalf("Failed to create role in guild A: %v", err)
+		}
+		if _, err := store.CreateRole("contract-guild-b", "reviewer", "", []string{"view_audit"}); err != nil {
+			t.Fatalf("Failed to create role in guild B: %v", err)
+		}
+		if found, _ := store.GetRoleByName("contract-guild-b", "reviewer"); found == nil || !found.HasCapability("view_audit") {
+			t.Errorf("Expected guild B reviewer, got %+v", found)
+		}
+		if found, _ := store.GetRoleByName("", "reviewer"); found != nil {
+			t.Errorf("Expected reviewer not to be available outside the guilds, got %+v", found)
+		}
+		if found, _ := store.GetRoleByName("contract-guild-b", "owner"); found == nil || !found.Builtin {
+			t.Errorf("Expected builtin owner in guild B, got %+v", found)
+		}
+		if _, err := store.CreateRole("contract-guild-a", "reviewer", "", nil); err == nil {
+			t.Error("Expected error for duplicate role name in the same guild, got nil")
+		}
+		if err := store.SetRoleCapabilities("contract-guild-a", "reviewer", []string{"view_all_sessions"}); err != nil {
+			t.Fatalf("Failed to set role capabilities: %v", err)
+		}
+		if found, _ := store.GetRoleByName("contract-guild-b", "reviewer"); !found.HasCapability("view_audit") || found.HasCapability("view_all_sessions") {
+			t.Errorf("Expected guild B reviewer to be unchanged, got %+v", found)
+		}
+
+		if _, err := store.CreateUser("contract-guild-a", "contract-reviewer", "reviewer", "reviewer"); err != nil {
+			t.Fatalf("Failed to create user with guild role: %v", err)
+		}
+		if err := store.UpdateUserRole("contract-guild-a", "contract-shared", "contract-missing-role"); err == nil {
+			t.Error("Expected error for role unavailable in the guild, got nil")
+		}
+		if _, err := store.CreateRole("contract-guild-b", "contract-b-only", "", nil); err != nil {
+			t.Fatalf("Failed to create role: %v", err)
+		}
+		if err := store.UpdateUserRole("contract-guild-a", "contract-shared", "contract-b-only"); err == nil {
+			t.Error("Expected error for role of another guild, got nil")
+		}
+		if _, err := store.UpsertRoleBinding("contract-guild-a", "contract-role-a", "contract-b-only"); err == nil {
+			t.Error("Expected error for binding to a role of another guild, got nil")
+		}
+
+		// ロール連携はギルドごとに登録・削除され、他のギルドの連携を上書きしない
+		if _, err := store.UpsertRoleBinding("contract-guild-a", "contract-shared-role", "user"); err != nil {
+			t.Fatalf("Failed to upsert role binding in guild A: %v", err)
+		}
+		if _, err := store.UpsertRoleBinding("contract-guild-b", "contract-shared-role", "owner"); err != nil {
+			t.Fatalf("Failed to upsert role binding in guild B: %v", err)
+		}
+		if err := store.DeleteRoleBinding("contract-guild-b", "contract-shared-role"); err != nil {
+			t.Fatalf("Failed to delete role binding in guild B: %v", err)
+		}
+		if err := store.DeleteRoleBinding("contract-guild-b", "contract-shared-role"); err == nil {
+			t.Error("Expected guild B not to delete the binding of guild A, got nil")
+		}
+		bindings, _ := store.ListRoleBindings()
+		var shared []*RoleBinding
+		for _, binding := range bindings {
+			if binding.DiscordRoleID == "contract-shared-role" {
+				shared = append(shared, binding)
+			}
+		}
+		if len(shared) != 1 || !shared[0].GuildID.Valid || shared[0].GuildID.String != "contract-guild-a" || shared[0].Role != "user" {
+			t.Errorf("Expected guild A binding to be unchanged, got %+v", shared)
+		}
+
+		// 参照の確認は同じギルドのユーザーのみを対象にする
+		if err := store.DeleteRole("contract-guild-a", "reviewer"); err == nil {
+			t.Error("Expected error when deleting role in use, got nil")
+		}
+		if err := store.DeleteRole("contract-guild-b", "reviewer"); err != nil {
+			t.Fatalf("Failed to delete unused role in guild B: %v", err)
+		}
+		if found, _ := store.GetRoleByName("contract-guild-a", "reviewer"); found == nil {
+			t.Error("Expected guild A reviewer to remain")
+		}
+
+		// ギルドに属さないユーザーは、まだ登録されていないギルドにのみ所属させられる
+		sharedUser, err := store.CreateUser("", "contract-shared", "shared", "user")
+		if err != nil {
+			t.Fatalf("Failed to create unscoped user: %v", err)
+		}
+		sharedSession, err := store.CreateSession(sharedUser.ID, "contract-shared-thread", "contract-shared-sandbox")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		if err := store.AssignUserToGuild("contract-shared", "contract-guild-a"); err == nil {
+			t.Error("Expected error when the guild already has the user, got nil")
+		}
+		if err := store.AssignUserToGuild("contract-shared", "contract-guild-b"); err != nil {
+			t.Fatalf("Failed to assign user to guild: %v", err)
+		}
+		if found, _ := store.GetUserByDiscordID("contract-guild-b", "contract-shared"); found == nil {
+			t.Error("Expected user to be assigned to guild B")
+		}
+		if session, _ := store.GetSessionByID(sharedSession.ID); !session.InGuild("contract-guild-b") {
+			t.Errorf("Expected session to be assigned with its user, got %+v", session.GuildID)
+		}
+		if err := store.AssignUserToGuild("contract-shared", "contract-guild-b"); err == nil {
+			t.Error("Expected error when no unscoped user remains, got nil")
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		store := newStore(t)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := store.IncrementSandboxUsage(); err != nil {
+					t.Errorf("Failed to increment sandbox usage: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		usage, err := store.GetSandboxUsage()
+		if err != nil {
+			t.Fatalf("Failed to get sandbox usage: %v", err)
+		}
+		if usage.CurrentCount != 10 {
+			t.Errorf("Expected current count 10, got %d", usage.CurrentCount)
+		}
+	})
+}
+
+// mustCreateUser はテスト用ユーザーを作成する
+func mustCreateUser(t *testing.T, store Store, discordID, role string) *User {
+	t.Helper()
+
+	user, err := store.CreateUser("", discordID, discordID+"-name", role)
+	if err != nil {
+		t.Fatalf("Failed to create user %s: %v", discordID, err)
+	}
+
+	return user
+}
+
+// assertCount は件数を返す関数の結果を検証する
+func assertCount(t *testing.T, name string, count func(int) (int, error), id, expected int) {
+	t.Helper()
+
+	got, err := count(id)
+	if err != nil {
+		t.Fatalf("Failed to count %s: %v", name, err)
+	}
+	if got != expected {
+		t.Errorf("Expected %d %s, got %d", expected, name, got)
+	}
+}
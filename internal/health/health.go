@@ -0,0 +1,135 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// checkTimeout は1回のヘルスチェックに許容する時間
+const checkTimeout = 5 * time.Second
+
+// CheckFunc は依存先の状態を確認する関数
+type CheckFunc func(ctx context.Context) error
+
+// check は名前付きのヘルスチェック
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker はliveness/readinessの状態を管理する構造体
+type Checker struct {
+	ready atomic.Bool
+
+	mu        sync.RWMutex
+	liveness  []check
+	readiness []check
+}
+
+// response は /healthz, /readyz のレスポンス
+type response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// NewChecker は新しいCheckerを作成する（初期状態は未準備）
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// AddLivenessCheck はlivenessとreadinessの両方で評価するチェックを追加する
+func (c *Checker) AddLivenessCheck(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.liveness = append(c.liveness, check{name: name, fn: fn})
+}
+
+// AddReadinessCheck はreadinessでのみ評価するチェックを追加する
+func (c *Checker) AddReadinessCheck(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readiness = append(c.readiness, check{name: name, fn: fn})
+}
+
+// SetReady はトラフィックを受け付けられる状態かどうかを設定する
+// 起動中のマイグレーションやシャットダウン時のドレイン中はfalseにする
+func (c *Checker) SetReady(ready bool) {
+	c.ready.Store(ready)
+}
+
+// IsReady は準備完了状態かどうかを返す
+func (c *Checker) IsReady() bool {
+	return c.ready.Load()
+}
+
+// LivenessHandler は /healthz 用のハンドラーを返す
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.RLock()
+		checks := append([]check(nil), c.liveness...)
+		c.mu.RUnlock()
+
+		res, ok := runChecks(r.Context(), checks)
+		writeResponse(w, res, ok)
+	})
+}
+
+// ReadinessHandler は /readyz 用のハンドラーを返す
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.RLock()
+		checks := append(append([]check(nil), c.liveness...), c.readiness...)
+		c.mu.RUnlock()
+
+		res, ok := runChecks(r.Context(), checks)
+		if !c.IsReady() {
+			res.Checks["ready"] = "not ready"
+			ok = false
+		}
+		writeResponse(w, res, ok)
+	})
+}
+
+// runChecks はチェックを順に実行し、結果をまとめる
+func runChecks(ctx context.Context, checks []check) (*response, bool) {
+	res := &response{Checks: make(map[string]string)}
+	ok := true
+
+	for _, ch := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		err := ch.fn(checkCtx)
+		cancel()
+
+		if err != nil {
+			logrus.WithError(err).WithField("check", ch.name).Warn("Health check failed")
+			res.Checks[ch.name] = err.Error()
+			ok = false
+			continue
+		}
+		res.Checks[ch.name] = "ok"
+	}
+
+	return res, ok
+}
+
+// writeResponse はチェック結果をJSONで書き込む
+func writeResponse(w http.ResponseWriter, res *response, ok bool) {
+	status := http.StatusOK
+	res.Status = "ok"
+	if !ok {
+		status = http.StatusServiceUnavailable
+		res.Status = "unavailable"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logrus.WithError(err).Error("Failed to write health response")
+	}
+}
@@ -0,0 +1,69 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestReadinessHandler はreadinessの判定のテスト
+func TestReadinessHandler(t *testing.T) {
+	checker := NewChecker()
+	dbErr := error(nil)
+	checker.AddReadinessCheck("database", func(ctx context.Context) error { return dbErr })
+
+	// 起動直後は未準備
+	if code := serve(checker.ReadinessHandler()); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d before ready, got %d", http.StatusServiceUnavailable, code)
+	}
+
+	// 準備完了後は成功
+	checker.SetReady(true)
+	if code := serve(checker.ReadinessHandler()); code != http.StatusOK {
+		t.Errorf("Expected status %d when ready, got %d", http.StatusOK, code)
+	}
+
+	// 依存先のチェックが失敗した場合
+	dbErr = fmt.Errorf("connection refused")
+	if code := serve(checker.ReadinessHandler()); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d when database is down, got %d", http.StatusServiceUnavailable, code)
+	}
+
+	// readinessのみのチェックはlivenessに影響しない
+	if code := serve(checker.LivenessHandler()); code != http.StatusOK {
+		t.Errorf("Expected liveness status %d, got %d", http.StatusOK, code)
+	}
+}
+
+// TestLivenessHandler はlivenessの判定のテスト
+func TestLivenessHandler(t *testing.T) {
+	checker := NewChecker()
+
+	// チェック未登録の場合は成功
+	if code := serve(checker.LivenessHandler()); code != http.StatusOK {
+		t.Errorf("Expected status %d without checks, got %d", http.StatusOK, code)
+	}
+
+	checker.AddLivenessCheck("discord", func(ctx context.Context) error {
+		return fmt.Errorf("discord gateway is not connected")
+	})
+
+	if code := serve(checker.LivenessHandler()); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d when discord is disconnected, got %d", http.StatusServiceUnavailable, code)
+	}
+
+	// livenessのチェックはreadinessにも含まれる
+	checker.SetReady(true)
+	if code := serve(checker.ReadinessHandler()); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected readiness status %d, got %d", http.StatusServiceUnavailable, code)
+	}
+}
+
+// serve はハンドラーを呼び出してステータスコードを返す
+func serve(h http.Handler) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec.Code
+}
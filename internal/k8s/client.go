@@ -16,7 +16,7 @@ import (
 
 // Client はKubernetesクライアントを管理する構造体
 type Client struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 	config    *rest.Config
 	namespace string
 }
@@ -68,7 +68,7 @@ func getKubernetesConfig() (*rest.Config, error) {
 }
 
 // GetClientset はKubernetesクライアントセットを返す
-func (c *Client) GetClientset() *kubernetes.Clientset {
+func (c *Client) GetClientset() kubernetes.Interface {
 	return c.clientset
 }
 
@@ -77,6 +77,11 @@ func (c *Client) GetConfig() *rest.Config {
 	return c.config
 }
 
+// NewExecutor はこのクライアントの接続設定でPod内のコマンドを実行するExecutorを作成する
+func (c *Client) NewExecutor() Executor {
+	return NewSPDYExecutor(c.clientset, c.config)
+}
+
 // GetNamespace は名前空間を返す
 func (c *Client) GetNamespace() string {
 	return c.namespace
@@ -0,0 +1,143 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// Executor はPod内でコマンドを実行するインターフェース
+type Executor interface {
+	Exec(ctx context.Context, namespace, podName, container string, command []string, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+// spdyExecutor はKubernetes APIのexecサブリソース（SPDY）でコマンドを実行するExecutor
+type spdyExecutor struct {
+	clientset kubernetes.Interface
+	config    *rest.Config
+}
+
+// NewSPDYExecutor はKubernetes APIを経由してコマンドを実行するExecutorを作成する
+func NewSPDYExecutor(clientset kubernetes.Interface, config *rest.Config) Executor {
+	return &spdyExecutor{
+		clientset: clientset,
+		config:    config,
+	}
+}
+
+// Exec はPod内でコマンドを実行する
+func (e *spdyExecutor) Exec(ctx context.Context, namespace, podName, container string, command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	req := e.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     stdin != nil,
+			Stdout:    stdout != nil,
+			Stderr:    stderr != nil,
+			TTY:       false,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(e.config, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create executor: %w", err)
+	}
+
+	return exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+		Tty:    false,
+	})
+}
+
+// FakeExecResult はFakeExecutorが返す実行結果
+type FakeExecResult struct {
+	Stdout string
+	Stderr string
+	Err    error
+}
+
+// FakeExecCall はFakeExecutorが受け付けた実行要求
+type FakeExecCall struct {
+	Namespace string
+	PodName   string
+	Container string
+	Command   []string
+	Stdin     string
+}
+
+// FakeExecutor は事前に登録した結果を順番に返すテスト用のExecutor
+// Claude Codeの出力を再生し、実際のPodなしでサンドボックス内の実行をテストするために使用する
+type FakeExecutor struct {
+	mu      sync.Mutex
+	results []FakeExecResult
+	calls   []FakeExecCall
+}
+
+// NewFakeExecutor は新しいFakeExecutorを作成する
+func NewFakeExecutor(results ...FakeExecResult) *FakeExecutor {
+	return &FakeExecutor{
+		results: results,
+	}
+}
+
+// Push は返す実行結果を末尾に追加する
+func (f *FakeExecutor) Push(results ...FakeExecResult) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results = append(f.results, results...)
+}
+
+// Calls はこれまでに受け付けた実行要求を返す
+func (f *FakeExecutor) Calls() []FakeExecCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeExecCall(nil), f.calls...)
+}
+
+// Exec は実行要求を記録し、登録済みの結果を1件返す
+func (f *FakeExecutor) Exec(ctx context.Context, namespace, podName, container string, command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var input []byte
+	if stdin != nil {
+		var err error
+		if input, err = io.ReadAll(stdin); err != nil {
+			return fmt.Errorf("failed to read stdin: %w", err)
+		}
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, FakeExecCall{
+		Namespace: namespace,
+		PodName:   podName,
+		Container: container,
+		Command:   command,
+		Stdin:     string(input),
+	})
+	if len(f.results) == 0 {
+		f.mu.Unlock()
+		return fmt.Errorf("no scripted exec result for pod %s", podName)
+	}
+	result := f.results[0]
+	f.results = f.results[1:]
+	f.mu.Unlock()
+
+	if stdout != nil {
+		io.WriteString(stdout, result.Stdout)
+	}
+	if stderr != nil {
+		io.WriteString(stderr, result.Stderr)
+	}
+
+	return result.Err
+}
@@ -0,0 +1,173 @@
+package k8s
+
+import (
+	"context"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/db"
+	"github.com/hirano00o/disclaude/internal/metrics"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// failureCleanupTimeout は失敗したPodの削除に使うタイムアウト
+const failureCleanupTimeout = 30 * time.Second
+
+// recreateDeletionTimeout は再作成前に以前のPodの削除完了を待つ最大時間
+const recreateDeletionTimeout = 30 * time.Second
+
+// SandboxFailure はセッション中に実行中のサンドボックスが予期せず停止したことを表す
+type SandboxFailure struct {
+	// Sandbox は失敗状態に更新されたサンドボックス
+	Sandbox *db.Sandbox
+	// Progress は停止の理由（Evicted, OOMKilled, Deleted など）
+	Progress PodProgress
+}
+
+// SetFailureHandler は実行中のサンドボックスが予期せず停止したときに呼び出される関数を設定する
+// Startを呼び出す前に設定する必要がある。ハンドラーは別のゴルーチンで呼び出される
+func (s *SandboxManager) SetFailureHandler(handler func(SandboxFailure)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onFailure = handler
+}
+
+// setStarting はPodが準備完了待ちの段階にあるかを記録する
+func (s *SandboxManager) setStarting(podName string, starting bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if starting {
+		s.starting[podName] = true
+	} else {
+		delete(s.starting, podName)
+	}
+}
+
+// expectDeletion はBot自身が削除するPodを記録し、停止として検知しないようにする
+// キャッシュにPodがあればUIDも記録し、同名で再作成されたPodと区別する
+func (s *SandboxManager) expectDeletion(podName string) {
+	var uid types.UID
+	if pod, err := s.watcher.GetPod(podName); err == nil && pod != nil {
+		uid = pod.UID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expected[podName] = uid
+}
+
+// isExpectedDeletion はPodがBot自身によって削除されたものかを返す
+// 削除イベントを受け取った時点で記録を消す（ロック取得済みで呼び出す）
+func (s *SandboxManager) isExpectedDeletion(pod *corev1.Pod, deleted bool) bool {
+	uid, ok := s.expected[pod.Name]
+	if !ok || (uid != "" && uid != pod.UID) {
+		return false
+	}
+	if deleted {
+		delete(s.expected, pod.Name)
+	}
+	return true
+}
+
+// handlePodEvent はPodのイベントから実行中サンドボックスの予期しない停止を検知する
+func (s *SandboxManager) handlePodEvent(pod *corev1.Pod, deleted bool) {
+	// セッションに割り当てられていない待機Podの失敗は補充の処理で扱う
+	if pod.Labels[warmPoolLabel] != "" {
+		return
+	}
+
+	s.mu.Lock()
+	expected := s.isExpectedDeletion(pod, deleted)
+	starting := s.starting[pod.Name]
+	s.mu.Unlock()
+
+	// 自身による削除と、準備完了前の失敗（WaitForSandboxReadyの呼び出し元が処理する）は対象外
+	if expected || starting {
+		return
+	}
+
+	var progress PodProgress
+	if deleted {
+		progress = ClassifyPod(nil)
+	} else {
+		progress = ClassifyPod(pod)
+	}
+	if progress.State != PodStateFailed {
+		return
+	}
+
+	s.handleSandboxFailure(pod, progress)
+}
+
+// handleSandboxFailure は停止したサンドボックスを失敗状態にして枠を解放し、ハンドラーに通知する
+// インフォーマーのリスナーから呼び出されるため、Podの削除などAPIの呼び出しは別のゴルーチンで行う
+func (s *SandboxManager) handleSandboxFailure(pod *corev1.Pod, progress PodProgress) {
+	sandbox, err := s.db.GetSandboxByPodName(pod.Name)
+	if err != nil {
+		logrus.WithError(err).WithField("pod_name", pod.Name).Error("Failed to get sandbox for failed pod")
+		return
+	}
+
+	if sandbox == nil {
+		return
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"pod_name":   pod.Name,
+		"session_id": sandbox.SessionID,
+		"reason":     progress.Reason,
+		"message":    progress.Message,
+	})
+
+	// 実行中として記録されているサンドボックスのみ対象とする
+	// 削除（DeleteSandbox）や他のレプリカと競合しても、枠の解放が一度だけになるよう条件付きで更新する
+	failed, err := s.db.TransitionSandboxStatus(sandbox.ID, "running", "failed")
+	if err != nil {
+		logger.WithError(err).Error("Failed to mark sandbox as failed")
+		return
+	}
+	if !failed {
+		return
+	}
+	sandbox.Status = "failed"
+
+	logger.Warn("Sandbox pod terminated unexpectedly")
+	metrics.SandboxFailures.WithLabelValues(progress.Reason).Inc()
+
+	if err := s.db.DecrementSandboxUsage(); err != nil {
+		logger.WithError(err).Error("Failed to decrement sandbox usage")
+	}
+
+	// 失敗したPodが残っている場合は削除してノードのリソースを解放する
+	if progress.Reason != "Deleted" {
+		s.mu.Lock()
+		s.expected[pod.Name] = pod.UID
+		s.mu.Unlock()
+
+		go s.deleteFailedPod(pod.Name, logger)
+	}
+
+	s.mu.Lock()
+	handler := s.onFailure
+	s.mu.Unlock()
+
+	if handler != nil {
+		go handler(SandboxFailure{Sandbox: sandbox, Progress: progress})
+	}
+}
+
+// deleteFailedPod は失敗したサンドボックスのPodを猶予期間なしで削除する
+func (s *SandboxManager) deleteFailedPod(podName string, logger *logrus.Entry) {
+	ctx, cancel := context.WithTimeout(context.Background(), failureCleanupTimeout)
+	defer cancel()
+
+	gracePeriod := int64(0)
+	err := s.clientset.CoreV1().Pods(s.namespace).Delete(ctx, podName, metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod})
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.WithError(err).Error("Failed to delete failed sandbox pod")
+	}
+}
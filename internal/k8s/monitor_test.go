@@ -0,0 +1,204 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newMonitoredEnv は停止の通知をチャネルで受け取るテスト環境を作成する
+func newMonitoredEnv(t *testing.T) (*testEnv, <-chan SandboxFailure) {
+	t.Helper()
+
+	failures := make(chan SandboxFailure, 10)
+	env := newTestEnvWith(t, 3, func(manager *SandboxManager) {
+		manager.SetFailureHandler(func(failure SandboxFailure) {
+			failures <- failure
+		})
+	})
+
+	return env, failures
+}
+
+// startReadySandbox は準備完了したサンドボックスを作成する
+func (e *testEnv) startReadySandbox(t *testing.T, threadID string) string {
+	t.Helper()
+	ctx := context.Background()
+
+	session := e.newSession(t, threadID)
+	sandbox, err := e.manager.CreateSandbox(ctx, session.ID, threadID)
+	if err != nil {
+		t.Fatalf("Failed to create sandbox: %v", err)
+	}
+	e.setPodStatus(t, sandbox.PodName, runningStatus)
+	if err := e.manager.WaitForSandboxReady(ctx, sandbox.PodName, time.Second, nil); err != nil {
+		t.Fatalf("Failed to wait for sandbox: %v", err)
+	}
+
+	return sandbox.PodName
+}
+
+// expectFailure は停止の通知を待機する
+func expectFailure(t *testing.T, failures <-chan SandboxFailure) SandboxFailure {
+	t.Helper()
+
+	select {
+	case failure := <-failures:
+		return failure
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for sandbox failure")
+	}
+	return SandboxFailure{}
+}
+
+// expectNoFailure は停止が通知されないことを確認する
+func expectNoFailure(t *testing.T, failures <-chan SandboxFailure) {
+	t.Helper()
+
+	select {
+	case failure := <-failures:
+		t.Fatalf("Expected no sandbox failure, got %+v", failure)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// TestSandboxManagerDetectsFailure はセッション中のPodの停止を検知するテスト
+func TestSandboxManagerDetectsFailure(t *testing.T) {
+	env, failures := newMonitoredEnv(t)
+	podName := env.startReadySandbox(t, "thread1")
+	otherPodName := env.startReadySandbox(t, "thread2")
+
+	env.setPodStatus(t, podName, corev1.PodStatus{
+		Phase: corev1.PodFailed,
+		ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  sandboxContainerName,
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}},
+		}},
+	})
+
+	failure := expectFailure(t, failures)
+	if failure.Progress.Reason != "OOMKilled" {
+		t.Errorf("Expected OOMKilled, got %q", failure.Progress.Reason)
+	}
+	if failure.Sandbox.PodName != podName || failure.Sandbox.Status != "failed" {
+		t.Errorf("Unexpected sandbox in failure: %+v", failure.Sandbox)
+	}
+
+	env.assertSandboxStatus(t, podName, "failed")
+	env.assertUsage(t, 1)
+
+	// 失敗したPodは別のゴルーチンで削除され、その削除は停止として再通知されない
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, err := env.clientset.CoreV1().Pods(testNamespace).Get(context.Background(), podName, metav1.GetOptions{})
+		if err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected failed pod to be deleted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	expectNoFailure(t, failures)
+
+	// 停止を検知した後の `/claude close` による削除では、使用数を再度減算しない
+	if err := env.manager.DeleteSandbox(context.Background(), podName); err != nil {
+		t.Fatalf("Failed to delete sandbox: %v", err)
+	}
+	env.assertSandboxStatus(t, podName, "terminated")
+	env.assertUsage(t, 1)
+	env.assertSandboxStatus(t, otherPodName, "running")
+}
+
+// TestSandboxManagerDetectsExternalDeletion はPodが外部から削除された場合のテスト
+func TestSandboxManagerDetectsExternalDeletion(t *testing.T) {
+	env, failures := newMonitoredEnv(t)
+	podName := env.startReadySandbox(t, "thread1")
+
+	if err := env.clientset.CoreV1().Pods(testNamespace).Delete(context.Background(), podName, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("Failed to delete pod: %v", err)
+	}
+
+	failure := expectFailure(t, failures)
+	if failure.Progress.Reason != "Deleted" {
+		t.Errorf("Expected Deleted, got %q", failure.Progress.Reason)
+	}
+	env.assertUsage(t, 0)
+}
+
+// TestSandboxManagerIgnoresExpectedTermination はBot自身による削除や準備中の失敗を通知しないことのテスト
+func TestSandboxManagerIgnoresExpectedTermination(t *testing.T) {
+	env, failures := newMonitoredEnv(t)
+	ctx := context.Background()
+
+	// DeleteSandboxによる削除
+	podName := env.startReadySandbox(t, "thread1")
+	if err := env.manager.DeleteSandbox(ctx, podName); err != nil {
+		t.Fatalf("Failed to delete sandbox: %v", err)
+	}
+	expectNoFailure(t, failures)
+
+	// 準備完了前の失敗は WaitForSandboxReady の呼び出し元が処理する
+	session := env.newSession(t, "thread2")
+	sandbox, err := env.manager.CreateSandbox(ctx, session.ID, "thread2")
+	if err != nil {
+		t.Fatalf("Failed to create sandbox: %v", err)
+	}
+	env.setPodStatus(t, sandbox.PodName, waitingStatus("ImagePullBackOff", ""))
+	expectNoFailure(t, failures)
+
+	if err := env.manager.WaitForSandboxReady(ctx, sandbox.PodName, time.Second, nil); err == nil {
+		t.Fatal("Expected readiness to fail")
+	}
+	env.setPodStatus(t, sandbox.PodName, waitingStatus("ImagePullBackOff", "retrying"))
+	expectNoFailure(t, failures)
+
+	if err := env.manager.DeleteSandbox(ctx, sandbox.PodName); err != nil {
+		t.Fatalf("Failed to delete sandbox: %v", err)
+	}
+	expectNoFailure(t, failures)
+	env.assertUsage(t, 0)
+}
+
+// TestSandboxManagerRecreateSandbox は停止したサンドボックスの再作成のテスト
+func TestSandboxManagerRecreateSandbox(t *testing.T) {
+	env, failures := newMonitoredEnv(t)
+	ctx := context.Background()
+	podName := env.startReadySandbox(t, "thread1")
+	session, err := env.store.GetSessionByThreadID("thread1")
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+
+	if _, err := env.manager.RecreateSandbox(ctx, session.ID, podName, "thread1"); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("Expected error for running sandbox, got %v", err)
+	}
+
+	env.setPodStatus(t, podName, corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted"})
+	expectFailure(t, failures)
+
+	sandbox, err := env.manager.RecreateSandbox(ctx, session.ID, podName, "thread1")
+	if err != nil {
+		t.Fatalf("Failed to recreate sandbox: %v", err)
+	}
+	if sandbox.PodName != podName || !sandbox.IsRunning() {
+		t.Errorf("Unexpected recreated sandbox: %+v", sandbox)
+	}
+	env.assertSandboxStatus(t, podName, "running")
+	env.assertUsage(t, 1)
+
+	env.setPodStatus(t, podName, runningStatus)
+	if err := env.manager.WaitForSandboxReady(ctx, podName, time.Second, nil); err != nil {
+		t.Fatalf("Failed to wait for recreated sandbox: %v", err)
+	}
+
+	// 再作成したPodの停止も検知する
+	env.setPodStatus(t, podName, corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted"})
+	if failure := expectFailure(t, failures); failure.Progress.Reason != "Evicted" {
+		t.Errorf("Expected Evicted, got %q", failure.Progress.Reason)
+	}
+}
@@ -0,0 +1,387 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/config"
+	"github.com/hirano00o/disclaude/internal/db"
+	"github.com/hirano00o/disclaude/internal/metrics"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+)
+
+const (
+	// profileLabel はサンドボックスPodのプロファイル（Pod仕様の種類）を表すラベル
+	profileLabel = "disclaude/profile"
+	// defaultProfile は既定のプロファイル名（現在はこのプロファイルのみ）
+	defaultProfile = "default"
+	// warmPoolLabel はセッションに割り当てられていない待機Podに付与するラベル
+	warmPoolLabel = "disclaude/pool"
+	// warmPoolLabelValue は待機Podのラベルの値
+	warmPoolLabelValue = "warm"
+)
+
+// warmPoolResync は待機Podの数を定期的に確認する間隔
+const warmPoolResync = 30 * time.Second
+
+// warmPoolPendingTimeout は作成した待機Podがキャッシュに反映されるまで作成中として数える最大時間
+const warmPoolPendingTimeout = time.Minute
+
+// warmPool はプロファイルごとに事前に起動しておく待機サンドボックスPodの管理情報
+type warmPool struct {
+	profile string
+	size    int
+	// separateBudget がtrueの場合、待機PodをMaxSandboxesの枠外で数える
+	separateBudget bool
+
+	mu sync.Mutex
+	// pending は作成したがまだキャッシュに反映されていない待機Podと作成時刻
+	pending map[string]time.Time
+	// claimed はセッションへの割り当て（または削除）を開始した待機Pod
+	claimed map[string]bool
+	// reserved は使用数に加算される前の作成・割り当て中のサンドボックス数
+	reserved int
+	trigger  chan struct{}
+}
+
+// newWarmPool は設定から待機Podの管理情報を作成する（無効な場合はnil）
+func newWarmPool(cfg *config.Config) *warmPool {
+	if cfg.Kubernetes.WarmPoolSize <= 0 {
+		return nil
+	}
+
+	return &warmPool{
+		profile:        defaultProfile,
+		size:           cfg.Kubernetes.WarmPoolSize,
+		separateBudget: cfg.Kubernetes.WarmPoolSeparateBudget,
+		pending:        make(map[string]time.Time),
+		claimed:        make(map[string]bool),
+		trigger:        make(chan struct{}, 1),
+	}
+}
+
+// sandboxPodLabels はすべてのサンドボックスPodに付与するラベルを返す
+func sandboxPodLabels(profile string) map[string]string {
+	return map[string]string{
+		"app":        "claude-sandbox",
+		"component":  "disclaude",
+		profileLabel: profile,
+	}
+}
+
+// triggerWarmPool は待機Podの補充を要求する
+func (s *SandboxManager) triggerWarmPool() {
+	if s.pool == nil {
+		return
+	}
+	select {
+	case s.pool.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// handleWarmPoolEvent は待機Podの変化や枠の解放を補充のきっかけにする
+func (s *SandboxManager) handleWarmPoolEvent(pod *corev1.Pod, deleted bool) {
+	if deleted || pod.Labels[warmPoolLabel] != "" {
+		s.triggerWarmPool()
+	}
+}
+
+// runWarmPool は待機Podを設定された数に保つ
+// ctxが終了すると停止する。待機Podは削除せず、次回の起動時に再利用する
+func (s *SandboxManager) runWarmPool(ctx context.Context) {
+	ticker := time.NewTicker(warmPoolResync)
+	defer ticker.Stop()
+
+	logrus.WithFields(logrus.Fields{
+		"profile":         s.pool.profile,
+		"size":            s.pool.size,
+		"separate_budget": s.pool.separateBudget,
+	}).Info("Warm pool started")
+
+	for {
+		s.replenishWarmPool(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.pool.trigger:
+		case <-ticker.C:
+		}
+	}
+}
+
+// idleWarmPodsLocked はキャッシュから割り当て可能な待機Podを取得する（pool.muを取得済みで呼び出す）
+// キャッシュに反映された作成中・割り当て済みの記録はここで片付ける
+func (s *SandboxManager) idleWarmPodsLocked() ([]*corev1.Pod, error) {
+	selector := labels.SelectorFromSet(labels.Set{
+		warmPoolLabel: warmPoolLabelValue,
+		profileLabel:  s.pool.profile,
+	})
+	pods, err := s.watcher.ListPods(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := make(map[string]bool, len(pods))
+	idle := make([]*corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		listed[pod.Name] = true
+		if s.pool.claimed[pod.Name] || pod.DeletionTimestamp != nil {
+			continue
+		}
+		idle = append(idle, pod)
+	}
+
+	// 割り当て済みのPodは待機ラベルが外れた時点で一覧から消える
+	for name := range s.pool.claimed {
+		if !listed[name] {
+			delete(s.pool.claimed, name)
+		}
+	}
+	for name, createdAt := range s.pool.pending {
+		if listed[name] || time.Since(createdAt) > warmPoolPendingTimeout {
+			delete(s.pool.pending, name)
+		}
+	}
+
+	// 準備完了したPodを優先し、同じ状態なら古いものから使う
+	sort.SliceStable(idle, func(i, j int) bool {
+		iReady := ClassifyPod(idle[i]).State == PodStateReady
+		jReady := ClassifyPod(idle[j]).State == PodStateReady
+		if iReady != jReady {
+			return iReady
+		}
+		return idle[i].CreationTimestamp.Before(&idle[j].CreationTimestamp)
+	})
+
+	return idle, nil
+}
+
+// replenishWarmPool は失敗した待機Podを削除し、不足分を作成する
+// 枠を共有する場合は、実行中のサンドボックスと待機Podの合計がMaxSandboxesを超えないようにする
+func (s *SandboxManager) replenishWarmPool(ctx context.Context) {
+	pool := s.pool
+	logger := logrus.WithField("profile", pool.profile)
+
+	pool.mu.Lock()
+	idle, err := s.idleWarmPodsLocked()
+	if err != nil {
+		pool.mu.Unlock()
+		logger.WithError(err).Error("Failed to list warm pool pods")
+		return
+	}
+
+	var failed, healthy []*corev1.Pod
+	for _, pod := range idle {
+		if ClassifyPod(pod).State == PodStateFailed {
+			failed = append(failed, pod)
+		} else {
+			healthy = append(healthy, pod)
+		}
+	}
+
+	count := len(healthy) + len(pool.pending)
+	need := pool.size - count
+	if !pool.separateBudget {
+		usage, err := s.db.GetSandboxUsage()
+		if err != nil {
+			pool.mu.Unlock()
+			logger.WithError(err).Error("Failed to get sandbox usage for warm pool")
+			return
+		}
+		need = min(need, usage.MaxCount-usage.CurrentCount-pool.reserved-count)
+	}
+
+	// 余分な待機Podは準備が遅れているものから削除する
+	var surplus []*corev1.Pod
+	for i := len(healthy) - 1; i >= 0 && need < 0; i-- {
+		surplus = append(surplus, healthy[i])
+		need++
+	}
+
+	var remove []*corev1.Pod
+	for _, pod := range append(failed, surplus...) {
+		pool.claimed[pod.Name] = true
+		remove = append(remove, pod)
+	}
+
+	var create []string
+	for i := 0; i < need; i++ {
+		podName := fmt.Sprintf("claude-pool-%s", rand.String(8))
+		pool.pending[podName] = time.Now()
+		create = append(create, podName)
+	}
+	metrics.WarmPoolPods.Set(float64(count - len(surplus) + len(create)))
+	pool.mu.Unlock()
+
+	podClient := s.clientset.CoreV1().Pods(s.namespace)
+	for _, pod := range remove {
+		gracePeriod := int64(0)
+		err := podClient.Delete(ctx, pod.Name, metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod})
+		if err != nil && !apierrors.IsNotFound(err) {
+			logger.WithError(err).WithField("pod_name", pod.Name).Error("Failed to delete warm pool pod")
+			continue
+		}
+		logger.WithFields(logrus.Fields{
+			"pod_name": pod.Name,
+			"reason":   ClassifyPod(pod).Reason,
+		}).Info("Warm pool pod removed")
+	}
+
+	for _, podName := range create {
+		podLabels := sandboxPodLabels(pool.profile)
+		podLabels[warmPoolLabel] = warmPoolLabelValue
+
+		start := time.Now()
+		_, err := podClient.Create(ctx, s.createPodSpec(podName, podLabels), metav1.CreateOptions{})
+		metrics.SandboxCreateDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			pool.mu.Lock()
+			delete(pool.pending, podName)
+			pool.mu.Unlock()
+			logger.WithError(err).WithField("pod_name", podName).Error("Failed to create warm pool pod")
+			continue
+		}
+		logger.WithField("pod_name", podName).Info("Warm pool pod created")
+	}
+}
+
+// claimWarmPod は待機Podをセッションに割り当てる
+// スレッドIDのラベルを付けて待機ラベルを外し、データベースに実行中として記録する
+// 割り当てられる待機Podがない場合はnilを返す
+func (s *SandboxManager) claimWarmPod(ctx context.Context, sessionID int, threadID string) (*db.Sandbox, error) {
+	pool := s.pool
+
+	pool.mu.Lock()
+	idle, err := s.idleWarmPodsLocked()
+	if err != nil {
+		pool.mu.Unlock()
+		logrus.WithError(err).Error("Failed to list warm pool pods")
+		metrics.WarmPoolClaims.WithLabelValues("miss").Inc()
+		return nil, nil
+	}
+
+	var pod *corev1.Pod
+	for _, candidate := range idle {
+		if ClassifyPod(candidate).State != PodStateFailed {
+			pod = candidate
+			break
+		}
+	}
+	if pod == nil {
+		pool.mu.Unlock()
+		metrics.WarmPoolClaims.WithLabelValues("miss").Inc()
+		return nil, nil
+	}
+	pool.claimed[pod.Name] = true
+	// 使用数に加算されるまでの間に、補充で上限を超えないよう枠を確保しておく
+	pool.reserved++
+	pool.mu.Unlock()
+	defer func() {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		pool.reserved--
+	}()
+
+	logger := logrus.WithFields(logrus.Fields{
+		"pod_name":   pod.Name,
+		"session_id": sessionID,
+		"thread_id":  threadID,
+	})
+
+	// 準備完了前の失敗はWaitForSandboxReadyの呼び出し元が処理する
+	s.setStarting(pod.Name, true)
+
+	patch := []byte(fmt.Sprintf(`{"metadata":{"labels":{"thread-id":%q,%q:null}}}`, threadID, warmPoolLabel))
+	podClient := s.clientset.CoreV1().Pods(s.namespace)
+	if _, err := podClient.Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		// 他の処理で削除された場合などは、待機Podを使わずに作成する
+		s.setStarting(pod.Name, false)
+		pool.mu.Lock()
+		delete(pool.claimed, pod.Name)
+		pool.mu.Unlock()
+		logger.WithError(err).Warn("Failed to claim warm pool pod")
+		metrics.WarmPoolClaims.WithLabelValues("miss").Inc()
+		return nil, nil
+	}
+	s.triggerWarmPool()
+
+	// 割り当てたPodを記録できない場合は、上限を超えて残らないよう削除する
+	rollback := func() {
+		s.expectDeletion(pod.Name)
+		if err := podClient.Delete(ctx, pod.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			logger.WithError(err).Error("Failed to delete claimed pod during rollback")
+		}
+		s.setStarting(pod.Name, false)
+		metrics.SandboxCreations.WithLabelValues("failure").Inc()
+	}
+
+	sandbox, err := s.db.CreateSandbox(sessionID, pod.Name, s.namespace)
+	if err != nil {
+		rollback()
+		return nil, fmt.Errorf("failed to create sandbox record: %w", err)
+	}
+
+	if err := s.db.IncrementSandboxUsage(); err != nil {
+		rollback()
+		s.markSandboxFailed(sandbox)
+		return nil, fmt.Errorf("failed to increment sandbox usage: %w", err)
+	}
+	metrics.SandboxCreations.WithLabelValues("success").Inc()
+	metrics.WarmPoolClaims.WithLabelValues("hit").Inc()
+
+	if err := s.db.UpdateSandboxStatus(sandbox.ID, "running"); err != nil {
+		logger.WithError(err).Error("Failed to update sandbox status")
+	}
+	sandbox.Status = "running"
+
+	logger.Info("Warm pool pod claimed")
+	return sandbox, nil
+}
+
+// reserveColdStart は待機Podを使わずにサンドボックスを作成する枠を確保する
+// 枠を共有する場合は待機Podも上限に含めて確認する。返される関数で確保を解除する
+func (s *SandboxManager) reserveColdStart() (func(), error) {
+	if s.pool == nil || s.pool.separateBudget {
+		return func() {}, nil
+	}
+
+	pool := s.pool
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	idle, err := s.idleWarmPodsLocked()
+	if err != nil {
+		metrics.SandboxCreations.WithLabelValues("failure").Inc()
+		return nil, err
+	}
+	usage, err := s.db.GetSandboxUsage()
+	if err != nil {
+		metrics.SandboxCreations.WithLabelValues("failure").Inc()
+		return nil, fmt.Errorf("failed to get sandbox usage: %w", err)
+	}
+
+	used := usage.CurrentCount + pool.reserved + len(idle) + len(pool.pending)
+	if used >= usage.MaxCount {
+		metrics.SandboxCreations.WithLabelValues("failure").Inc()
+		return nil, fmt.Errorf("サンドボックスの上限に達しています（待機中を含めて%d/%d）", used, usage.MaxCount)
+	}
+
+	pool.reserved++
+	return func() {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		pool.reserved--
+	}, nil
+}
@@ -0,0 +1,262 @@
+package k8s
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/config"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newPoolEnv は待機サンドボックスを有効にしたテスト環境を作成する
+func newPoolEnv(t *testing.T, maxSandboxes, poolSize int, separateBudget bool) (*testEnv, <-chan SandboxFailure) {
+	t.Helper()
+
+	failures := make(chan SandboxFailure, 10)
+	env := newTestEnvFromConfig(t, maxSandboxes, config.KubernetesConfig{
+		WarmPoolSize:           poolSize,
+		WarmPoolSeparateBudget: separateBudget,
+	}, func(manager *SandboxManager) {
+		manager.SetFailureHandler(func(failure SandboxFailure) {
+			failures <- failure
+		})
+	})
+
+	return env, failures
+}
+
+// listWarmPods はAPIサーバー上の待機Podの名前を取得する
+func (e *testEnv) listWarmPods(t *testing.T) []string {
+	t.Helper()
+
+	pods, err := e.clientset.CoreV1().Pods(testNamespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: warmPoolLabel + "=" + warmPoolLabelValue,
+	})
+	if err != nil {
+		t.Fatalf("Failed to list warm pods: %v", err)
+	}
+
+	names := make([]string, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		names = append(names, pod.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// waitForWarmPods は待機Podが指定数になるまで待機し、その数が維持されることを確認する
+func (e *testEnv) waitForWarmPods(t *testing.T, expected int) []string {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		names := e.listWarmPods(t)
+		if len(names) == expected {
+			// 補充が上限を超えて作成しないことを確認する
+			time.Sleep(100 * time.Millisecond)
+			if names = e.listWarmPods(t); len(names) == expected {
+				return names
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d warm pods, got %v", expected, names)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForCachedWarmPods は待機Podがインフォーマーのキャッシュに反映されるまで待機する
+func (e *testEnv) waitForCachedWarmPods(t *testing.T, names []string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for _, name := range names {
+		for {
+			pod, err := e.manager.watcher.GetPod(name)
+			if err != nil {
+				t.Fatalf("Failed to get pod from cache: %v", err)
+			}
+			if pod != nil && pod.Labels[warmPoolLabel] != "" {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for warm pod %s in cache", name)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// TestWarmPoolClaim は待機Podのセッションへの割り当てと補充のテスト
+func TestWarmPoolClaim(t *testing.T) {
+	env, failures := newPoolEnv(t, 3, 2, false)
+	ctx := context.Background()
+
+	warm := env.waitForWarmPods(t, 2)
+	env.setPodStatus(t, warm[1], runningStatus)
+	env.waitForCachedWarmPods(t, warm)
+	if err := env.manager.WaitForSandboxReady(ctx, warm[1], time.Second, nil); err != nil {
+		t.Fatalf("Failed to wait for warm pod: %v", err)
+	}
+	env.assertUsage(t, 0)
+
+	// 準備完了した待機Podが優先して割り当てられる
+	session := env.newSession(t, "thread1")
+	sandbox, err := env.manager.CreateSandbox(ctx, session.ID, "thread1")
+	if err != nil {
+		t.Fatalf("Failed to create sandbox: %v", err)
+	}
+	if sandbox.PodName != warm[1] || !sandbox.IsRunning() {
+		t.Errorf("Expected warm pod %s to be claimed, got %+v", warm[1], sandbox)
+	}
+	env.assertSandboxStatus(t, sandbox.PodName, "running")
+	env.assertUsage(t, 1)
+
+	pod, err := env.clientset.CoreV1().Pods(testNamespace).Get(ctx, sandbox.PodName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get claimed pod: %v", err)
+	}
+	if pod.Labels["thread-id"] != "thread1" {
+		t.Errorf("Expected thread-id label, got %v", pod.Labels)
+	}
+	if _, ok := pod.Labels[warmPoolLabel]; ok {
+		t.Errorf("Expected warm pool label to be removed, got %v", pod.Labels)
+	}
+
+	if err := env.manager.WaitForSandboxReady(ctx, sandbox.PodName, time.Second, nil); err != nil {
+		t.Fatalf("Failed to wait for claimed sandbox: %v", err)
+	}
+
+	// 実行中1 + 待機2 = 上限3
+	refilled := env.waitForWarmPods(t, 2)
+	if slices.Contains(refilled, sandbox.PodName) {
+		t.Errorf("Claimed pod should not remain in the pool: %v", refilled)
+	}
+
+	// セッション外の一覧には待機Podを含めない
+	sandboxes, err := env.manager.ListSandboxes(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list sandboxes: %v", err)
+	}
+	if len(sandboxes) != 1 || sandboxes[0].Name != sandbox.PodName {
+		t.Errorf("Expected only the claimed sandbox to be listed, got %d pods", len(sandboxes))
+	}
+
+	// 割り当てたPodの停止も検知する
+	env.setPodStatus(t, sandbox.PodName, corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted"})
+	if failure := expectFailure(t, failures); failure.Sandbox.PodName != sandbox.PodName {
+		t.Errorf("Unexpected failure: %+v", failure.Sandbox)
+	}
+	env.assertUsage(t, 0)
+}
+
+// TestWarmPoolSharedBudget は待機PodがMaxSandboxesの枠を共有する場合のテスト
+func TestWarmPoolSharedBudget(t *testing.T) {
+	env, _ := newPoolEnv(t, 2, 2, false)
+	ctx := context.Background()
+
+	var claimed []string
+	for i, threadID := range []string{"thread1", "thread2"} {
+		env.waitForCachedWarmPods(t, env.waitForWarmPods(t, 2-i))
+
+		session := env.newSession(t, threadID)
+		sandbox, err := env.manager.CreateSandbox(ctx, session.ID, threadID)
+		if err != nil {
+			t.Fatalf("Failed to create sandbox %d: %v", i, err)
+		}
+		if sandbox.PodName == "claude-sandbox-"+threadID {
+			t.Errorf("Expected a warm pod to be claimed for %s", threadID)
+		}
+		claimed = append(claimed, sandbox.PodName)
+	}
+
+	// 実行中のサンドボックスが上限に達したため補充しない
+	env.waitForWarmPods(t, 0)
+	env.assertUsage(t, 2)
+
+	session := env.newSession(t, "thread3")
+	if _, err := env.manager.CreateSandbox(ctx, session.ID, "thread3"); err == nil {
+		t.Error("Expected capacity error")
+	}
+
+	// 終了すると枠が空いた分を補充する
+	if err := env.manager.DeleteSandbox(ctx, claimed[0]); err != nil {
+		t.Fatalf("Failed to delete sandbox: %v", err)
+	}
+	env.waitForWarmPods(t, 1)
+	env.assertUsage(t, 1)
+}
+
+// TestWarmPoolGuildCapacity は待機Podの割り当てにもギルドごとのサンドボックス数の上限を適用するテスト
+func TestWarmPoolGuildCapacity(t *testing.T) {
+	env, _ := newPoolEnv(t, 5, 2, false)
+	ctx := context.Background()
+
+	env.waitForCachedWarmPods(t, env.waitForWarmPods(t, 2))
+
+	first := env.newGuildSession(t, "guild1", 1, "thread1")
+	if _, err := env.manager.CreateSandbox(ctx, first.ID, "thread1"); err != nil {
+		t.Fatalf("Failed to create sandbox: %v", err)
+	}
+
+	// 待機Podが残っていても、ギルドの上限に達していれば割り当てない
+	env.waitForCachedWarmPods(t, env.waitForWarmPods(t, 2))
+	second := env.newGuildSession(t, "guild1", 1, "thread2")
+	if _, err := env.manager.CreateSandbox(ctx, second.ID, "thread2"); err == nil {
+		t.Error("Expected guild capacity error")
+	}
+	env.waitForWarmPods(t, 2)
+	env.assertUsage(t, 1)
+}
+
+// TestWarmPoolSeparateBudget は待機PodをMaxSandboxesの枠外で数える場合のテスト
+func TestWarmPoolSeparateBudget(t *testing.T) {
+	env, _ := newPoolEnv(t, 1, 2, true)
+	ctx := context.Background()
+
+	env.waitForCachedWarmPods(t, env.waitForWarmPods(t, 2))
+
+	session := env.newSession(t, "thread1")
+	if _, err := env.manager.CreateSandbox(ctx, session.ID, "thread1"); err != nil {
+		t.Fatalf("Failed to create sandbox: %v", err)
+	}
+	env.assertUsage(t, 1)
+
+	// 実行中のサンドボックスが上限でも待機Podは補充される
+	env.waitForWarmPods(t, 2)
+
+	// 待機Podがあっても実行中のサンドボックスの上限は守る
+	session = env.newSession(t, "thread2")
+	if _, err := env.manager.CreateSandbox(ctx, session.ID, "thread2"); err == nil {
+		t.Error("Expected capacity error")
+	}
+	env.assertUsage(t, 1)
+}
+
+// TestWarmPoolReplacesFailedPods は失敗した待機Podを削除して作り直すテスト
+func TestWarmPoolReplacesFailedPods(t *testing.T) {
+	env, failures := newPoolEnv(t, 3, 1, false)
+
+	warm := env.waitForWarmPods(t, 1)
+	env.setPodStatus(t, warm[0], waitingStatus("ImagePullBackOff", "back-off pulling image"))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		names := env.listWarmPods(t)
+		if len(names) == 1 && names[0] != warm[0] {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected failed warm pod to be replaced, got %v", names)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// セッションに割り当てられていないPodの失敗は通知しない
+	expectNoFailure(t, failures)
+	env.assertUsage(t, 0)
+}
@@ -0,0 +1,141 @@
+package k8s
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PodState はサンドボックスPodの準備状況の段階
+type PodState string
+
+const (
+	// PodStateScheduling はノードへの割り当てを待機している状態
+	PodStateScheduling PodState = "scheduling"
+	// PodStateUnschedulable は割り当て可能なノードがない状態（リソースが空けば回復しうる）
+	PodStateUnschedulable PodState = "unschedulable"
+	// PodStateStarting はイメージの取得やコンテナの起動中の状態
+	PodStateStarting PodState = "starting"
+	// PodStateReady はすべてのコンテナが準備完了した状態
+	PodStateReady PodState = "ready"
+	// PodStateFailed は回復の見込みがない失敗状態
+	PodStateFailed PodState = "failed"
+)
+
+// fatalWaitingReasons はコンテナが待機中でも回復の見込みがないと判断する理由
+// ErrImagePull と CreateContainerError はレジストリやボリュームの一時的な問題でも発生し、kubeletが再試行するため含めない
+var fatalWaitingReasons = map[string]bool{
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CrashLoopBackOff":           true,
+	"CreateContainerConfigError": true,
+}
+
+// PodProgress はサンドボックスPodの準備状況
+type PodProgress struct {
+	State PodState
+	// Reason はKubernetesが報告した理由（Unschedulable, ImagePullBackOff, OOMKilled など）
+	Reason string
+	// Message はスケジューラーやkubeletが報告した詳細メッセージ
+	Message string
+}
+
+// PodFailedError はサンドボックスPodが失敗状態になったことを表すエラー
+type PodFailedError struct {
+	Progress PodProgress
+}
+
+// Error はエラーメッセージを返す
+func (e *PodFailedError) Error() string {
+	if e.Progress.Message != "" {
+		return fmt.Sprintf("pod failed to start: %s: %s", e.Progress.Reason, e.Progress.Message)
+	}
+	return fmt.Sprintf("pod failed to start: %s", e.Progress.Reason)
+}
+
+// ClassifyPod はPodのステータスから準備状況を判定する
+// podがnilの場合は削除されたものとして失敗を返す
+func ClassifyPod(pod *corev1.Pod) PodProgress {
+	if pod == nil {
+		return PodProgress{State: PodStateFailed, Reason: "Deleted", Message: "pod was deleted"}
+	}
+
+	if pod.DeletionTimestamp != nil {
+		return PodProgress{State: PodStateFailed, Reason: "Terminating", Message: "pod is being deleted"}
+	}
+
+	// 終了したコンテナ（OOMKilledなど）を優先して報告する
+	for _, status := range pod.Status.ContainerStatuses {
+		for _, terminated := range []*corev1.ContainerStateTerminated{status.State.Terminated, status.LastTerminationState.Terminated} {
+			if terminated != nil && terminated.Reason == "OOMKilled" {
+				return PodProgress{
+					State:   PodStateFailed,
+					Reason:  "OOMKilled",
+					Message: fmt.Sprintf("container %s was killed (exit code %d)", status.Name, terminated.ExitCode),
+				}
+			}
+		}
+
+		if waiting := status.State.Waiting; waiting != nil && fatalWaitingReasons[waiting.Reason] {
+			return PodProgress{State: PodStateFailed, Reason: waiting.Reason, Message: waiting.Message}
+		}
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodFailed, corev1.PodSucceeded:
+		return terminatedProgress(pod)
+	case corev1.PodRunning:
+		// すべてのコンテナが準備完了かチェック
+		allReady := true
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			if !containerStatus.Ready {
+				allReady = false
+				break
+			}
+		}
+		if allReady {
+			return PodProgress{State: PodStateReady}
+		}
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse && condition.Reason == corev1.PodReasonUnschedulable {
+			return PodProgress{State: PodStateUnschedulable, Reason: condition.Reason, Message: condition.Message}
+		}
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if waiting := status.State.Waiting; waiting != nil && waiting.Reason != "" {
+			return PodProgress{State: PodStateStarting, Reason: waiting.Reason, Message: waiting.Message}
+		}
+	}
+
+	if pod.Spec.NodeName == "" && (pod.Status.Phase == corev1.PodPending || pod.Status.Phase == "") {
+		return PodProgress{State: PodStateScheduling}
+	}
+
+	return PodProgress{State: PodStateStarting}
+}
+
+// terminatedProgress は終了したPodの失敗理由を返す
+func terminatedProgress(pod *corev1.Pod) PodProgress {
+	for _, status := range pod.Status.ContainerStatuses {
+		if terminated := status.State.Terminated; terminated != nil {
+			reason := terminated.Reason
+			if reason == "" {
+				reason = "Error"
+			}
+			message := terminated.Message
+			if message == "" {
+				message = fmt.Sprintf("container %s exited with code %d", status.Name, terminated.ExitCode)
+			}
+			return PodProgress{State: PodStateFailed, Reason: reason, Message: message}
+		}
+	}
+
+	reason := pod.Status.Reason
+	if reason == "" {
+		reason = string(pod.Status.Phase)
+	}
+	return PodProgress{State: PodStateFailed, Reason: reason, Message: pod.Status.Message}
+}
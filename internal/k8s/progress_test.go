@@ -0,0 +1,136 @@
+package k8s
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestClassifyPod はPodステータスから準備状況を判定するテスト
+func TestClassifyPod(t *testing.T) {
+	now := metav1.Now()
+
+	tests := []struct {
+		name         string
+		pod          *corev1.Pod
+		expectState  PodState
+		expectReason string
+	}{
+		{
+			name:         "deleted",
+			pod:          nil,
+			expectState:  PodStateFailed,
+			expectReason: "Deleted",
+		},
+		{
+			name:         "terminating",
+			pod:          &corev1.Pod{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now}, Status: runningStatus},
+			expectState:  PodStateFailed,
+			expectReason: "Terminating",
+		},
+		{
+			name:        "pending without node",
+			pod:         &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending}},
+			expectState: PodStateScheduling,
+		},
+		{
+			name:         "unschedulable",
+			pod:          &corev1.Pod{Status: unschedulableStatus},
+			expectState:  PodStateUnschedulable,
+			expectReason: "Unschedulable",
+		},
+		{
+			name:         "container creating",
+			pod:          &corev1.Pod{Spec: corev1.PodSpec{NodeName: "node1"}, Status: waitingStatus("ContainerCreating", "")},
+			expectState:  PodStateStarting,
+			expectReason: "ContainerCreating",
+		},
+		{
+			name:         "err image pull",
+			pod:          &corev1.Pod{Spec: corev1.PodSpec{NodeName: "node1"}, Status: waitingStatus("ErrImagePull", "i/o timeout")},
+			expectState:  PodStateStarting,
+			expectReason: "ErrImagePull",
+		},
+		{
+			name:         "create container error",
+			pod:          &corev1.Pod{Spec: corev1.PodSpec{NodeName: "node1"}, Status: waitingStatus("CreateContainerError", "context deadline exceeded")},
+			expectState:  PodStateStarting,
+			expectReason: "CreateContainerError",
+		},
+		{
+			name:         "invalid image name",
+			pod:          &corev1.Pod{Status: waitingStatus("InvalidImageName", "invalid reference format")},
+			expectState:  PodStateFailed,
+			expectReason: "InvalidImageName",
+		},
+		{
+			name:         "image pull back off",
+			pod:          &corev1.Pod{Status: waitingStatus("ImagePullBackOff", "Back-off pulling image")},
+			expectState:  PodStateFailed,
+			expectReason: "ImagePullBackOff",
+		},
+		{
+			name: "crash loop back off after oom",
+			pod: &corev1.Pod{Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:                 sandboxContainerName,
+					State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+					LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}},
+				}},
+			}},
+			expectState:  PodStateFailed,
+			expectReason: "OOMKilled",
+		},
+		{
+			name:         "crash loop back off",
+			pod:          &corev1.Pod{Status: waitingStatus("CrashLoopBackOff", "back-off 10s restarting failed container")},
+			expectState:  PodStateFailed,
+			expectReason: "CrashLoopBackOff",
+		},
+		{
+			name: "container exited",
+			pod: &corev1.Pod{Status: corev1.PodStatus{
+				Phase: corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:  sandboxContainerName,
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}},
+				}},
+			}},
+			expectState:  PodStateFailed,
+			expectReason: "Error",
+		},
+		{
+			name:         "evicted",
+			pod:          &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted", Message: "low on memory"}},
+			expectState:  PodStateFailed,
+			expectReason: "Evicted",
+		},
+		{
+			name: "running but not ready",
+			pod: &corev1.Pod{Spec: corev1.PodSpec{NodeName: "node1"}, Status: corev1.PodStatus{
+				Phase:             corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{Name: sandboxContainerName, Ready: false}},
+			}},
+			expectState: PodStateStarting,
+		},
+		{
+			name:        "ready",
+			pod:         &corev1.Pod{Status: runningStatus},
+			expectState: PodStateReady,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress := ClassifyPod(tt.pod)
+			if progress.State != tt.expectState {
+				t.Errorf("Expected state %s, got %s", tt.expectState, progress.State)
+			}
+			if progress.Reason != tt.expectReason {
+				t.Errorf("Expected reason %q, got %q", tt.expectReason, progress.Reason)
+			}
+		})
+	}
+}
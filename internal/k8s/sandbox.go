@@ -5,103 +5,314 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hirano00o/disclaude/internal/config"
 	"github.com/hirano00o/disclaude/internal/db"
+	"github.com/hirano00o/disclaude/internal/metrics"
 
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
 )
 
+// sandboxContainerName はサンドボックスPod内のClaude Codeコンテナ名
+const sandboxContainerName = "claude-code"
+
 // SandboxManager はサンドボックスの管理を行う
 type SandboxManager struct {
-	client *Client
-	db     *db.DB
-	config *config.Config
+	clientset kubernetes.Interface
+	executor  Executor
+	namespace string
+	db        db.SandboxStore
+	config    *config.Config
+	watcher   *PodWatcher
+
+	mu sync.Mutex
+	// starting は作成されてから準備完了待ちが終わるまでのPod名
+	starting map[string]bool
+	// expected はBot自身が削除したPod名とそのUID（不明な場合は空）
+	expected  map[string]types.UID
+	onFailure func(SandboxFailure)
+
+	// pool は待機サンドボックスの管理情報（無効な場合はnil）
+	pool *warmPool
+
+	guildMu sync.Mutex
+	// guildReserved はギルドごとの、記録される前の作成・割り当て中のサンドボックス数
+	guildReserved map[string]int
 }
 
 // NewSandboxManager は新しいSandboxManagerを作成する
-func NewSandboxManager(client *Client, database *db.DB, cfg *config.Config) *SandboxManager {
-	return &SandboxManager{
-		client: client,
-		db:     database,
-		config: cfg,
+// clientsetとexecutorを差し替えることで、実際のクラスターなしでテストできる
+func NewSandboxManager(clientset kubernetes.Interface, executor Executor, namespace string, database db.SandboxStore, cfg *config.Config) *SandboxManager {
+	s := &SandboxManager{
+		clientset: clientset,
+		executor:  executor,
+		namespace: namespace,
+		db:        database,
+		config:    cfg,
+		watcher:   NewPodWatcher(clientset, namespace),
+		starting:  make(map[string]bool),
+		expected:  make(map[string]types.UID),
+		pool:      newWarmPool(cfg),
+
+		guildReserved: make(map[string]int),
+	}
+	s.watcher.AddListener(s.handlePodEvent)
+	if s.pool != nil {
+		s.watcher.AddListener(s.handleWarmPoolEvent)
+	}
+
+	return s
+}
+
+// Start はサンドボックスPodの監視を開始する
+// WaitForSandboxReadyを呼び出す前に一度だけ呼び出す必要がある
+// 待機サンドボックスが有効な場合は、バックグラウンドで補充を開始する
+func (s *SandboxManager) Start(ctx context.Context) error {
+	if err := s.watcher.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start pod watcher: %w", err)
 	}
+	if s.pool != nil {
+		go s.runWarmPool(ctx)
+	}
+	return nil
 }
 
 // CreateSandbox はサンドボックス（Pod）を作成する
+// 待機サンドボックスがあればそれを割り当てるため、返されるPod名はセッション作成時の名前と異なる場合がある
 func (s *SandboxManager) CreateSandbox(ctx context.Context, sessionID int, threadID string) (*db.Sandbox, error) {
-	// サンドボックス使用状況の確認
-	usage, err := s.db.GetSandboxUsage()
+	if err := s.checkCapacity(); err != nil {
+		return nil, err
+	}
+	releaseGuild, err := s.reserveGuild(sessionID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get sandbox usage: %w", err)
+		return nil, err
 	}
+	defer releaseGuild()
 
-	if !usage.CanCreateSandbox() {
-		return nil, fmt.Errorf("サンドボックスの上限に達しています（%d/%d）", usage.CurrentCount, usage.MaxCount)
+	if s.pool != nil {
+		sandbox, err := s.claimWarmPod(ctx, sessionID, threadID)
+		if err != nil {
+			return nil, err
+		}
+		if sandbox != nil {
+			return sandbox, nil
+		}
+	}
+
+	release, err := s.reserveColdStart()
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
 	// Pod名の生成
 	podName := fmt.Sprintf("claude-sandbox-%s", strings.ReplaceAll(threadID, "_", "-"))
 
 	// データベースにサンドボックス情報を記録
-	sandbox, err := s.db.CreateSandbox(sessionID, podName, s.client.namespace)
+	sandbox, err := s.db.CreateSandbox(sessionID, podName, s.namespace)
 	if err != nil {
+		metrics.SandboxCreations.WithLabelValues("failure").Inc()
 		return nil, fmt.Errorf("failed to create sandbox record: %w", err)
 	}
 
+	if err := s.startPod(ctx, sandbox, threadID); err != nil {
+		return nil, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"pod_name":   sandbox.PodName,
+		"namespace":  s.namespace,
+		"session_id": sessionID,
+		"thread_id":  threadID,
+	}).Info("Sandbox created successfully")
+
+	return sandbox, nil
+}
+
+// RecreateSandbox は停止したセッションのサンドボックス（Pod）を同じ名前で作り直す
+// 以前のPodの削除が完了していない場合はエラーを返す
+func (s *SandboxManager) RecreateSandbox(ctx context.Context, sessionID int, podName, threadID string) (*db.Sandbox, error) {
+	sandbox, err := s.db.GetSandboxByPodName(podName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sandbox: %w", err)
+	}
+	if sandbox == nil || sandbox.SessionID != sessionID {
+		return nil, fmt.Errorf("sandbox %s not found for session %d", podName, sessionID)
+	}
+	if sandbox.IsRunning() {
+		return nil, fmt.Errorf("sandbox %s is already running", podName)
+	}
+
+	if err := s.checkCapacity(); err != nil {
+		return nil, err
+	}
+	releaseGuild, err := s.reserveGuild(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseGuild()
+	release, err := s.reserveColdStart()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// 以前のPodの削除が完了するまで待機する
+	deletionCtx, cancel := context.WithTimeout(ctx, recreateDeletionTimeout)
+	defer cancel()
+	if err := s.watcher.WaitForDeletion(deletionCtx, podName); err != nil {
+		return nil, fmt.Errorf("以前のサンドボックスを削除中です。しばらくしてから再度お試しください")
+	}
+
+	if err := s.db.UpdateSandboxStatus(sandbox.ID, "pending"); err != nil {
+		return nil, fmt.Errorf("failed to reset sandbox status: %w", err)
+	}
+
+	if err := s.startPod(ctx, sandbox, threadID); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return nil, fmt.Errorf("以前のサンドボックスを削除中です。しばらくしてから再度お試しください")
+		}
+		return nil, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"pod_name":   sandbox.PodName,
+		"namespace":  s.namespace,
+		"session_id": sessionID,
+		"thread_id":  threadID,
+	}).Info("Sandbox recreated successfully")
+
+	return sandbox, nil
+}
+
+// checkCapacity はサンドボックスを作成できる空きがあるかを確認する
+func (s *SandboxManager) checkCapacity() error {
+	usage, err := s.db.GetSandboxUsage()
+	if err != nil {
+		metrics.SandboxCreations.WithLabelValues("failure").Inc()
+		return fmt.Errorf("failed to get sandbox usage: %w", err)
+	}
+
+	if !usage.CanCreateSandbox() {
+		metrics.SandboxCreations.WithLabelValues("failure").Inc()
+		return fmt.Errorf("サンドボックスの上限に達しています（%d/%d）", usage.CurrentCount, usage.MaxCount)
+	}
+
+	return nil
+}
+
+// reserveGuild はセッションの所有者が所属するギルドのサンドボックス数の上限（max_sandboxes）の枠を確保する
+// 待機Podの割り当てと新規作成の両方で、同じギルドの作成・割り当て中のサンドボックスも上限に含めて確認する
+// 返される関数で確保を解除する（サンドボックスが記録された後は記録から数える）
+func (s *SandboxManager) reserveGuild(sessionID int) (func(), error) {
+	s.guildMu.Lock()
+	defer s.guildMu.Unlock()
+
+	guild, err := s.db.GetSessionGuild(sessionID)
+	if err != nil {
+		metrics.SandboxCreations.WithLabelValues("failure").Inc()
+		return nil, fmt.Errorf("failed to get session guild: %w", err)
+	}
+	if guild == nil || !guild.MaxSandboxes.Valid || guild.MaxSandboxes.Int64 <= 0 {
+		return func() {}, nil
+	}
+
+	count, err := s.db.CountActiveSandboxesByGuild(guild.GuildID)
+	if err != nil {
+		metrics.SandboxCreations.WithLabelValues("failure").Inc()
+		return nil, fmt.Errorf("failed to count active sandboxes in guild: %w", err)
+	}
+	if int64(count+s.guildReserved[guild.GuildID]) >= guild.MaxSandboxes.Int64 {
+		metrics.SandboxCreations.WithLabelValues("failure").Inc()
+		return nil, fmt.Errorf("このサーバーで同時に利用できるサンドボックス数の上限（%d）に達しています。しばらく待ってから再度お試しください", guild.MaxSandboxes.Int64)
+	}
+
+	guildID := guild.GuildID
+	s.guildReserved[guildID]++
+	return func() {
+		s.guildMu.Lock()
+		defer s.guildMu.Unlock()
+		s.guildReserved[guildID]--
+		if s.guildReserved[guildID] == 0 {
+			delete(s.guildReserved, guildID)
+		}
+	}, nil
+}
+
+// startPod はサンドボックスのPodを作成し、使用数を加算して実行中にする
+// 失敗した場合はサンドボックスを失敗状態にする
+func (s *SandboxManager) startPod(ctx context.Context, sandbox *db.Sandbox, threadID string) error {
 	// Pod仕様の作成
-	pod := s.createPodSpec(podName, threadID)
+	labels := sandboxPodLabels(defaultProfile)
+	labels["thread-id"] = threadID
+	pod := s.createPodSpec(sandbox.PodName, labels)
+
+	// 準備完了待ちが始まる前に失敗しても、セッション中の停止として扱わないようにする
+	s.setStarting(sandbox.PodName, true)
 
 	// Podの作成
-	podClient := s.client.clientset.CoreV1().Pods(s.client.namespace)
-	createdPod, err := podClient.Create(ctx, pod, metav1.CreateOptions{})
+	podClient := s.clientset.CoreV1().Pods(s.namespace)
+	start := time.Now()
+	_, err := podClient.Create(ctx, pod, metav1.CreateOptions{})
+	metrics.SandboxCreateDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
-		// 失敗時はデータベースからも削除
-		s.db.UpdateSandboxStatus(sandbox.ID, "failed")
-		return nil, fmt.Errorf("failed to create pod: %w", err)
+		// 失敗時はサンドボックスを失敗状態にする
+		s.setStarting(sandbox.PodName, false)
+		s.markSandboxFailed(sandbox)
+		metrics.SandboxCreations.WithLabelValues("failure").Inc()
+		return fmt.Errorf("failed to create pod: %w", err)
 	}
 
 	// サンドボックス使用数を増加
+	// 記録できない場合は上限を超えて作成されないよう、Podを削除してロールバックする
 	if err := s.db.IncrementSandboxUsage(); err != nil {
-		logrus.WithError(err).Error("Failed to increment sandbox usage")
+		s.expectDeletion(sandbox.PodName)
+		if deleteErr := podClient.Delete(ctx, sandbox.PodName, metav1.DeleteOptions{}); deleteErr != nil {
+			logrus.WithError(deleteErr).WithField("pod_name", sandbox.PodName).Error("Failed to delete pod during rollback")
+		}
+		s.setStarting(sandbox.PodName, false)
+		s.markSandboxFailed(sandbox)
+		metrics.SandboxCreations.WithLabelValues("failure").Inc()
+		return fmt.Errorf("failed to increment sandbox usage: %w", err)
 	}
+	metrics.SandboxCreations.WithLabelValues("success").Inc()
 
 	// サンドボックスステータスを更新
 	if err := s.db.UpdateSandboxStatus(sandbox.ID, "running"); err != nil {
 		logrus.WithError(err).Error("Failed to update sandbox status")
 	}
+	sandbox.Status = "running"
 
-	logrus.WithFields(logrus.Fields{
-		"pod_name":   createdPod.Name,
-		"namespace":  createdPod.Namespace,
-		"session_id": sessionID,
-		"thread_id":  threadID,
-	}).Info("Sandbox created successfully")
+	return nil
+}
 
-	return sandbox, nil
+// markSandboxFailed はサンドボックスを失敗状態にする
+func (s *SandboxManager) markSandboxFailed(sandbox *db.Sandbox) {
+	if err := s.db.UpdateSandboxStatus(sandbox.ID, "failed"); err != nil {
+		logrus.WithError(err).WithField("pod_name", sandbox.PodName).Error("Failed to mark sandbox as failed")
+	}
 }
 
 // createPodSpec はPod仕様を作成する
-func (s *SandboxManager) createPodSpec(podName, threadID string) *corev1.Pod {
+func (s *SandboxManager) createPodSpec(podName string, labels map[string]string) *corev1.Pod {
 	return &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      podName,
-			Namespace: s.client.namespace,
-			Labels: map[string]string{
-				"app":       "claude-sandbox",
-				"thread-id": threadID,
-				"component": "disclaude",
-			},
+			Namespace: s.namespace,
+			Labels:    labels,
 		},
 		Spec: corev1.PodSpec{
 			Containers: []corev1.Container{
 				{
-					Name:  "claude-code",
+					Name:  sandboxContainerName,
 					Image: "anthropic/claude-code:latest",
 					Resources: corev1.ResourceRequirements{
 						Requests: corev1.ResourceList{
@@ -166,40 +377,56 @@ func (s *SandboxManager) createPodSpec(podName, threadID string) *corev1.Pod {
 
 // DeleteSandbox はサンドボックス（Pod）を削除する
 func (s *SandboxManager) DeleteSandbox(ctx context.Context, podName string) error {
-	podClient := s.client.clientset.CoreV1().Pods(s.client.namespace)
+	podClient := s.clientset.CoreV1().Pods(s.namespace)
 
-	// Podの削除
+	// Podの削除（既に存在しない場合は削除済みとして扱う）
+	s.expectDeletion(podName)
 	err := podClient.Delete(ctx, podName, metav1.DeleteOptions{})
-	if err != nil {
+	if err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("failed to delete pod: %w", err)
 	}
+	s.setStarting(podName, false)
 
 	// データベースの更新
 	sandbox, err := s.db.GetSandboxByPodName(podName)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to get sandbox for cleanup")
-	} else if sandbox != nil {
-		if err := s.db.UpdateSandboxStatus(sandbox.ID, "terminated"); err != nil {
-			logrus.WithError(err).Error("Failed to update sandbox status")
-		}
+		return nil
+	}
+
+	if sandbox == nil {
+		return nil
 	}
 
 	// サンドボックス使用数を減少
-	if err := s.db.DecrementSandboxUsage(); err != nil {
-		logrus.WithError(err).Error("Failed to decrement sandbox usage")
+	// 使用数は実行中になった時点で加算しているため、実行中からの削除でのみ減算する
+	// 停止の検知（handleSandboxFailure）と競合しても減算が一度だけになるよう条件付きで更新する
+	running, err := s.db.TransitionSandboxStatus(sandbox.ID, "running", "terminated")
+	if err != nil {
+		logrus.WithError(err).Error("Failed to update sandbox status")
+	} else if running {
+		if err := s.db.DecrementSandboxUsage(); err != nil {
+			logrus.WithError(err).Error("Failed to decrement sandbox usage")
+		}
+	} else if err := s.db.UpdateSandboxStatus(sandbox.ID, "terminated"); err != nil {
+		logrus.WithError(err).Error("Failed to update sandbox status")
 	}
 
 	logrus.WithFields(logrus.Fields{
 		"pod_name":  podName,
-		"namespace": s.client.namespace,
+		"namespace": s.namespace,
 	}).Info("Sandbox deleted successfully")
 
 	return nil
 }
 
+// StderrSeparator は ExecuteCommand の出力で標準出力と標準エラー出力を区切る文字列
+const StderrSeparator = "\nSTDERR:\n"
+
 // ExecuteCommand はサンドボックス内でコマンドを実行する
+// 標準エラー出力がある場合は StderrSeparator に続けて標準出力の後ろに付加する
 func (s *SandboxManager) ExecuteCommand(ctx context.Context, podName, command string) (string, error) {
-	podClient := s.client.clientset.CoreV1().Pods(s.client.namespace)
+	podClient := s.clientset.CoreV1().Pods(s.namespace)
 
 	// Podの存在確認
 	pod, err := podClient.Get(ctx, podName, metav1.GetOptions{})
@@ -211,45 +438,21 @@ func (s *SandboxManager) ExecuteCommand(ctx context.Context, podName, command st
 		return "", fmt.Errorf("pod is not running: %s", pod.Status.Phase)
 	}
 
-	// コマンド実行の準備
-	req := s.client.clientset.CoreV1().RESTClient().Post().
-		Resource("pods").
-		Name(podName).
-		Namespace(s.client.namespace).
-		SubResource("exec").
-		Param("container", "claude-code").
-		Param("command", "/bin/sh").
-		Param("stdin", "true").
-		Param("stdout", "true").
-		Param("stderr", "true").
-		Param("tty", "false")
-
-	// リモートコマンド実行の設定
-	exec, err := remotecommand.NewSPDYExecutor(s.client.config, "POST", req.URL())
-	if err != nil {
-		return "", fmt.Errorf("failed to create executor: %w", err)
-	}
-
 	// 入出力の準備
 	var stdout, stderr bytes.Buffer
 	stdin := strings.NewReader(command + "\nexit\n")
 
 	// コマンド実行
-	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
-		Stdin:  stdin,
-		Stdout: &stdout,
-		Stderr: &stderr,
-		Tty:    false,
-	})
-
+	err = s.executor.Exec(ctx, s.namespace, podName, sandboxContainerName, []string{"/bin/sh"}, stdin, &stdout, &stderr)
 	if err != nil {
+		metrics.ExecErrors.Inc()
 		return "", fmt.Errorf("failed to execute command: %w", err)
 	}
 
 	// 結果の結合
 	result := stdout.String()
 	if stderr.Len() > 0 {
-		result += "\nSTDERR:\n" + stderr.String()
+		result += StderrSeparator + stderr.String()
 	}
 
 	return result, nil
@@ -257,7 +460,7 @@ func (s *SandboxManager) ExecuteCommand(ctx context.Context, podName, command st
 
 // GetSandboxStatus はサンドボックスのステータスを取得する
 func (s *SandboxManager) GetSandboxStatus(ctx context.Context, podName string) (string, error) {
-	podClient := s.client.clientset.CoreV1().Pods(s.client.namespace)
+	podClient := s.clientset.CoreV1().Pods(s.namespace)
 
 	pod, err := podClient.Get(ctx, podName, metav1.GetOptions{})
 	if err != nil {
@@ -267,53 +470,93 @@ func (s *SandboxManager) GetSandboxStatus(ctx context.Context, podName string) (
 	return string(pod.Status.Phase), nil
 }
 
-// WaitForSandboxReady はサンドボックスが準備完了になるまで待機する
-func (s *SandboxManager) WaitForSandboxReady(ctx context.Context, podName string, timeout time.Duration) error {
-	podClient := s.client.clientset.CoreV1().Pods(s.client.namespace)
+// GetPodPhase はインフォーマーのキャッシュからサンドボックスPodのフェーズを取得する
+// Podが存在しない場合は空文字を返す
+func (s *SandboxManager) GetPodPhase(podName string) (string, error) {
+	pod, err := s.watcher.GetPod(podName)
+	if err != nil {
+		return "", err
+	}
+	if pod == nil {
+		return "", nil
+	}
+
+	return string(pod.Status.Phase), nil
+}
 
+// WaitForSandboxReady はサンドボックスが準備完了になるまで待機する
+// Podの状態はインフォーマーで監視し、準備状況が変化するたびにonProgressを呼び出す（nil可）
+// Podが回復の見込みのない状態になった場合は *PodFailedError を返す
+func (s *SandboxManager) WaitForSandboxReady(ctx context.Context, podName string, timeout time.Duration, onProgress func(PodProgress)) error {
 	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	start := time.Now()
+	observe := func(result string) {
+		metrics.SandboxReadyDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	}
+
+	updates, unsubscribe := s.watcher.Subscribe(podName)
+	defer unsubscribe()
+
+	// 準備待ち中の失敗は呼び出し元が処理するため、準備完了するまで停止の検知対象から外す
+	// 準備に失敗した場合は、呼び出し元がDeleteSandboxで削除するまで対象外のままにする
+	s.setStarting(podName, true)
+
+	var last PodProgress
+	seen := false
 	for {
-		select {
-		case <-timeoutCtx.Done():
-			return fmt.Errorf("timeout waiting for pod to be ready")
-		default:
-			pod, err := podClient.Get(timeoutCtx, podName, metav1.GetOptions{})
-			if err != nil {
-				return fmt.Errorf("failed to get pod: %w", err)
-			}
+		pod, err := s.watcher.GetPod(podName)
+		if err != nil {
+			observe("failed")
+			return err
+		}
 
-			if pod.Status.Phase == corev1.PodRunning {
-				// すべてのコンテナが準備完了かチェック
-				allReady := true
-				for _, containerStatus := range pod.Status.ContainerStatuses {
-					if !containerStatus.Ready {
-						allReady = false
-						break
-					}
-				}
-
-				if allReady {
-					return nil
-				}
-			}
+		// 作成直後はキャッシュに反映されていないことがあるため、一度観測するまでは削除とみなさない
+		progress := PodProgress{State: PodStateScheduling}
+		if pod != nil || seen {
+			seen = true
+			progress = ClassifyPod(pod)
+		}
 
-			if pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded {
-				return fmt.Errorf("pod failed to start: %s", pod.Status.Phase)
+		if progress != last {
+			last = progress
+			if onProgress != nil {
+				onProgress(progress)
 			}
+		}
+
+		switch progress.State {
+		case PodStateReady:
+			s.setStarting(podName, false)
+			observe("ready")
+			return nil
+		case PodStateFailed:
+			observe("failed")
+			return &PodFailedError{Progress: progress}
+		}
 
-			time.Sleep(2 * time.Second)
+		select {
+		case <-updates:
+		case <-s.watcher.Stopped():
+			observe("failed")
+			return fmt.Errorf("pod watcher stopped while waiting for pod to be ready")
+		case <-timeoutCtx.Done():
+			observe("timeout")
+			if last.Reason != "" {
+				return fmt.Errorf("timeout waiting for pod to be ready: %s", last.Reason)
+			}
+			return fmt.Errorf("timeout waiting for pod to be ready")
 		}
 	}
 }
 
-// ListSandboxes はサンドボックス一覧を取得する
+// ListSandboxes はサンドボックス一覧を取得する（セッションに割り当てられていない待機Podは除く）
 func (s *SandboxManager) ListSandboxes(ctx context.Context) ([]corev1.Pod, error) {
-	podClient := s.client.clientset.CoreV1().Pods(s.client.namespace)
+	podClient := s.clientset.CoreV1().Pods(s.namespace)
 
 	listOptions := metav1.ListOptions{
-		LabelSelector: "app=claude-sandbox",
+		LabelSelector: sandboxLabelSelector + ",!" + warmPoolLabel,
 	}
 
 	podList, err := podClient.List(ctx, listOptions)
@@ -0,0 +1,609 @@
+package k8s
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hirano00o/disclaude/internal/config"
+	"github.com/hirano00o/disclaude/internal/db"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testNamespace = "disclaude-test"
+
+// testEnv はSandboxManagerのテスト環境
+type testEnv struct {
+	manager   *SandboxManager
+	clientset *fake.Clientset
+	store     *db.MemoryStore
+	executor  *FakeExecutor
+}
+
+// newTestEnv はfakeのクライアントセットとインメモリストアでSandboxManagerを作成する
+func newTestEnv(t *testing.T, maxSandboxes int) *testEnv {
+	t.Helper()
+	return newTestEnvWith(t, maxSandboxes, nil)
+}
+
+// newTestEnvWith はStart前にSandboxManagerを設定できるnewTestEnv
+func newTestEnvWith(t *testing.T, maxSandboxes int, configure func(*SandboxManager)) *testEnv {
+	t.Helper()
+	return newTestEnvFromConfig(t, maxSandboxes, config.KubernetesConfig{}, configure)
+}
+
+// newTestEnvFromConfig はKubernetes関連の設定を指定してテスト環境を作成する
+func newTestEnvFromConfig(t *testing.T, maxSandboxes int, kubernetes config.KubernetesConfig, configure func(*SandboxManager)) *testEnv {
+	t.Helper()
+
+	env := &testEnv{
+		clientset: fake.NewSimpleClientset(),
+		store:     db.NewMemoryStore(maxSandboxes),
+		executor:  NewFakeExecutor(),
+	}
+	kubernetes.MaxSandboxes = maxSandboxes
+	cfg := &config.Config{
+		Kubernetes: kubernetes,
+		Claude:     config.ClaudeConfig{ConfigPath: "/home/user/.claude"},
+	}
+	env.manager = NewSandboxManager(env.clientset, env.executor, testNamespace, env.store, cfg)
+	if configure != nil {
+		configure(env.manager)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := env.manager.Start(ctx); err != nil {
+		t.Fatalf("Failed to start sandbox manager: %v", err)
+	}
+
+	return env
+}
+
+// newSession はテスト用のユーザーとセッションを作成する
+func (e *testEnv) newSession(t *testing.T, threadID string) *db.Session {
+	t.Helper()
+
+	user, err := e.store.GetUserByDiscordID("", "user123")
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if user == nil {
+		if user, err = e.store.CreateUser("", "user123", "user", "user"); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+
+	session, err := e.store.CreateSession(user.ID, threadID, "claude-sandbox-"+threadID)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	return session
+}
+
+// newGuildSession はguildIDのギルドに所属するテスト用のユーザーとセッションを作成する
+// maxSandboxesが0より大きい場合は、ギルドのサンドボックス数の上限として設定する
+func (e *testEnv) newGuildSession(t *testing.T, guildID string, maxSandboxes int64, threadID string) *db.Session {
+	t.Helper()
+
+	guild, err := e.store.UpsertGuild(guildID, guildID)
+	if err != nil {
+		t.Fatalf("Failed to upsert guild: %v", err)
+	}
+	if maxSandboxes > 0 {
+		guild.MaxSandboxes = sql.NullInt64{Int64: maxSandboxes, Valid: true}
+		if err := e.store.UpdateGuildSettings(guild); err != nil {
+			t.Fatalf("Failed to update guild settings: %v", err)
+		}
+	}
+
+	user, err := e.store.GetUserByDiscordID(guildID, "user123")
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if user == nil {
+		if user, err = e.store.CreateUser(guildID, "user123", "user", "user"); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+
+	session, err := e.store.CreateSession(user.ID, threadID, "claude-sandbox-"+threadID)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	return session
+}
+
+// setPodStatus はPodのステータスを更新する
+func (e *testEnv) setPodStatus(t *testing.T, podName string, status corev1.PodStatus) {
+	t.Helper()
+
+	pods := e.clientset.CoreV1().Pods(testNamespace)
+	pod, err := pods.Get(context.Background(), podName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get pod: %v", err)
+	}
+
+	pod.Status = status
+	if _, err := pods.UpdateStatus(context.Background(), pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Failed to update pod status: %v", err)
+	}
+}
+
+// assertUsage はサンドボックスの使用数を検証する
+func (e *testEnv) assertUsage(t *testing.T, expected int) {
+	t.Helper()
+
+	usage, err := e.store.GetSandboxUsage()
+	if err != nil {
+		t.Fatalf("Failed to get sandbox usage: %v", err)
+	}
+	if usage.CurrentCount != expected {
+		t.Errorf("Expected sandbox usage %d, got %d", expected, usage.CurrentCount)
+	}
+}
+
+// assertSandboxStatus はサンドボックスのステータスを検証する
+func (e *testEnv) assertSandboxStatus(t *testing.T, podName, expected string) {
+	t.Helper()
+
+	sandbox, err := e.store.GetSandboxByPodName(podName)
+	if err != nil {
+		t.Fatalf("Failed to get sandbox: %v", err)
+	}
+	if sandbox == nil {
+		t.Fatalf("Expected sandbox %s to exist", podName)
+	}
+	if sandbox.Status != expected {
+		t.Errorf("Expected sandbox status '%s', got '%s'", expected, sandbox.Status)
+	}
+}
+
+// runningStatus は準備完了のPodステータス
+var runningStatus = corev1.PodStatus{
+	Phase: corev1.PodRunning,
+	ContainerStatuses: []corev1.ContainerStatus{
+		{Name: sandboxContainerName, Ready: true},
+	},
+}
+
+// unschedulableStatus はスケジュールできないPodステータス
+var unschedulableStatus = corev1.PodStatus{
+	Phase: corev1.PodPending,
+	Conditions: []corev1.PodCondition{{
+		Type:    corev1.PodScheduled,
+		Status:  corev1.ConditionFalse,
+		Reason:  corev1.PodReasonUnschedulable,
+		Message: "0/3 nodes are available: 3 Insufficient memory.",
+	}},
+}
+
+// waitingStatus はコンテナが指定理由で待機中のPodステータスを返す
+func waitingStatus(reason, message string) corev1.PodStatus {
+	return corev1.PodStatus{
+		Phase: corev1.PodPending,
+		ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  sandboxContainerName,
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: message}},
+		}},
+	}
+}
+
+// TestSandboxManagerLifecycle はサンドボックスの作成・一覧・削除のテスト
+func TestSandboxManagerLifecycle(t *testing.T) {
+	env := newTestEnv(t, 3)
+	ctx := context.Background()
+
+	first := env.newSession(t, "thread1")
+	second := env.newSession(t, "thread2")
+
+	sandbox, err := env.manager.CreateSandbox(ctx, first.ID, "thread1")
+	if err != nil {
+		t.Fatalf("Failed to create sandbox: %v", err)
+	}
+	if sandbox.PodName != "claude-sandbox-thread1" || !sandbox.IsRunning() {
+		t.Errorf("Unexpected sandbox: %+v", sandbox)
+	}
+
+	pod, err := env.clientset.CoreV1().Pods(testNamespace).Get(ctx, sandbox.PodName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected pod to be created: %v", err)
+	}
+	if pod.Labels["app"] != "claude-sandbox" || pod.Labels["thread-id"] != "thread1" {
+		t.Errorf("Unexpected pod labels: %v", pod.Labels)
+	}
+
+	if _, err := env.manager.CreateSandbox(ctx, second.ID, "thread2"); err != nil {
+		t.Fatalf("Failed to create second sandbox: %v", err)
+	}
+	env.assertUsage(t, 2)
+
+	pods, err := env.manager.ListSandboxes(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list sandboxes: %v", err)
+	}
+	if len(pods) != 2 {
+		t.Errorf("Expected 2 sandboxes, got %d", len(pods))
+	}
+
+	if err := env.manager.DeleteSandbox(ctx, sandbox.PodName); err != nil {
+		t.Fatalf("Failed to delete sandbox: %v", err)
+	}
+	env.assertSandboxStatus(t, sandbox.PodName, "terminated")
+	env.assertUsage(t, 1)
+
+	// 削除済みのサンドボックスを再度削除しても使用数は減らない
+	if err := env.manager.DeleteSandbox(ctx, sandbox.PodName); err != nil {
+		t.Fatalf("Failed to delete sandbox twice: %v", err)
+	}
+	env.assertUsage(t, 1)
+
+	pods, err = env.manager.ListSandboxes(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list sandboxes: %v", err)
+	}
+	if len(pods) != 1 || pods[0].Name != "claude-sandbox-thread2" {
+		t.Errorf("Expected only claude-sandbox-thread2 to remain, got %d pods", len(pods))
+	}
+}
+
+// TestSandboxManagerCapacity はサンドボックス上限のテスト
+func TestSandboxManagerCapacity(t *testing.T) {
+	env := newTestEnv(t, 1)
+	ctx := context.Background()
+
+	first := env.newSession(t, "thread1")
+	second := env.newSession(t, "thread2")
+
+	if _, err := env.manager.CreateSandbox(ctx, first.ID, "thread1"); err != nil {
+		t.Fatalf("Failed to create sandbox: %v", err)
+	}
+
+	if _, err := env.manager.CreateSandbox(ctx, second.ID, "thread2"); err == nil {
+		t.Fatal("Expected error when capacity is exhausted, got nil")
+	}
+
+	if _, err := env.clientset.CoreV1().Pods(testNamespace).Get(ctx, "claude-sandbox-thread2", metav1.GetOptions{}); err == nil {
+		t.Error("Expected no pod to be created over capacity")
+	}
+	env.assertUsage(t, 1)
+}
+
+// TestSandboxManagerGuildCapacity はギルドごとのサンドボックス数の上限のテスト
+func TestSandboxManagerGuildCapacity(t *testing.T) {
+	env := newTestEnv(t, 5)
+	ctx := context.Background()
+
+	first := env.newGuildSession(t, "guild1", 1, "thread1")
+	second := env.newGuildSession(t, "guild1", 1, "thread2")
+	other := env.newGuildSession(t, "guild2", 0, "thread3")
+
+	if _, err := env.manager.CreateSandbox(ctx, first.ID, "thread1"); err != nil {
+		t.Fatalf("Failed to create sandbox: %v", err)
+	}
+	if _, err := env.manager.CreateSandbox(ctx, second.ID, "thread2"); err == nil || !strings.Contains(err.Error(), "このサーバーで同時に利用できるサンドボックス数の上限（1）") {
+		t.Errorf("Expected guild capacity error, got %v", err)
+	}
+	if _, err := env.clientset.CoreV1().Pods(testNamespace).Get(ctx, "claude-sandbox-thread2", metav1.GetOptions{}); err == nil {
+		t.Error("Expected no pod to be created over guild capacity")
+	}
+
+	// 他のギルドは上限を共有しない
+	if _, err := env.manager.CreateSandbox(ctx, other.ID, "thread3"); err != nil {
+		t.Fatalf("Failed to create sandbox in another guild: %v", err)
+	}
+	env.assertUsage(t, 2)
+
+	// 記録される前の作成中のサンドボックスも上限に含める
+	if err := env.manager.DeleteSandbox(ctx, "claude-sandbox-thread1"); err != nil {
+		t.Fatalf("Failed to delete sandbox: %v", err)
+	}
+	release, err := env.manager.reserveGuild(first.ID)
+	if err != nil {
+		t.Fatalf("Failed to reserve guild slot: %v", err)
+	}
+	if _, err := env.manager.reserveGuild(second.ID); err == nil {
+		t.Error("Expected in-flight reservation to count toward the guild limit")
+	}
+	release()
+	if _, err := env.manager.CreateSandbox(ctx, second.ID, "thread2"); err != nil {
+		t.Errorf("Expected released slot to be available, got %v", err)
+	}
+}
+
+// TestSandboxManagerCreatePodFailure はPod作成失敗時のロールバックのテスト
+func TestSandboxManagerCreatePodFailure(t *testing.T) {
+	env := newTestEnv(t, 3)
+	ctx := context.Background()
+
+	env.clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("quota exceeded")
+	})
+
+	session := env.newSession(t, "thread1")
+	if _, err := env.manager.CreateSandbox(ctx, session.ID, "thread1"); err == nil {
+		t.Fatal("Expected error when pod creation fails, got nil")
+	}
+
+	env.assertSandboxStatus(t, "claude-sandbox-thread1", "failed")
+	env.assertUsage(t, 0)
+
+	// 失敗したサンドボックスの削除でも使用数は減らない
+	if err := env.manager.DeleteSandbox(ctx, "claude-sandbox-thread1"); err != nil {
+		t.Fatalf("Failed to delete failed sandbox: %v", err)
+	}
+	env.assertUsage(t, 0)
+}
+
+// failingUsageStore は使用数の加算に失敗するストア
+type failingUsageStore struct {
+	*db.MemoryStore
+}
+
+// IncrementSandboxUsage は常に失敗する
+func (s *failingUsageStore) IncrementSandboxUsage() error {
+	return errors.New("connection reset")
+}
+
+// TestSandboxManagerUsageFailure は使用数の記録失敗時にPodを削除するロールバックのテスト
+func TestSandboxManagerUsageFailure(t *testing.T) {
+	env := newTestEnv(t, 3)
+	ctx := context.Background()
+
+	env.manager.db = &failingUsageStore{MemoryStore: env.store}
+
+	session := env.newSession(t, "thread1")
+	if _, err := env.manager.CreateSandbox(ctx, session.ID, "thread1"); err == nil {
+		t.Fatal("Expected error when usage cannot be recorded, got nil")
+	}
+
+	if _, err := env.clientset.CoreV1().Pods(testNamespace).Get(ctx, "claude-sandbox-thread1", metav1.GetOptions{}); err == nil {
+		t.Error("Expected pod to be deleted during rollback")
+	}
+	env.assertSandboxStatus(t, "claude-sandbox-thread1", "failed")
+}
+
+// TestSandboxManagerWaitForSandboxReady はサンドボックスの準備完了待ちのテスト
+func TestSandboxManagerWaitForSandboxReady(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       corev1.PodStatus
+		expectErr    string
+		expectReason string
+	}{
+		{
+			name:   "ready",
+			status: runningStatus,
+		},
+		{
+			name:         "failed",
+			status:       corev1.PodStatus{Phase: corev1.PodFailed},
+			expectErr:    "pod failed to start",
+			expectReason: "Failed",
+		},
+		{
+			name:         "image pull back off",
+			status:       waitingStatus("ImagePullBackOff", "Back-off pulling image"),
+			expectErr:    "pod failed to start",
+			expectReason: "ImagePullBackOff",
+		},
+		{
+			name: "oom killed",
+			status: corev1.PodStatus{
+				Phase: corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:  sandboxContainerName,
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}},
+				}},
+			},
+			expectErr:    "pod failed to start",
+			expectReason: "OOMKilled",
+		},
+		{
+			name: "container not ready",
+			status: corev1.PodStatus{
+				Phase:             corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{Name: sandboxContainerName, Ready: false}},
+			},
+			expectErr: "timeout",
+		},
+		{
+			name:         "unschedulable",
+			status:       unschedulableStatus,
+			expectErr:    "timeout waiting for pod to be ready: Unschedulable",
+			expectReason: "Unschedulable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, 3)
+			ctx := context.Background()
+
+			session := env.newSession(t, "thread1")
+			sandbox, err := env.manager.CreateSandbox(ctx, session.ID, "thread1")
+			if err != nil {
+				t.Fatalf("Failed to create sandbox: %v", err)
+			}
+			env.setPodStatus(t, sandbox.PodName, tt.status)
+
+			var reasons []string
+			err = env.manager.WaitForSandboxReady(ctx, sandbox.PodName, 200*time.Millisecond, func(progress PodProgress) {
+				reasons = append(reasons, progress.Reason)
+			})
+			if tt.expectErr == "" {
+				if err != nil {
+					t.Errorf("Expected sandbox to be ready, got %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectErr, err)
+			}
+
+			var failed *PodFailedError
+			if errors.As(err, &failed) && failed.Progress.Reason != tt.expectReason {
+				t.Errorf("Expected failure reason %q, got %q", tt.expectReason, failed.Progress.Reason)
+			}
+			if tt.expectReason != "" && !slices.Contains(reasons, tt.expectReason) {
+				t.Errorf("Expected progress with reason %q, got %v", tt.expectReason, reasons)
+			}
+		})
+	}
+}
+
+// TestSandboxManagerWaitForSandboxReadyProgress はPodの状態変化が順に通知されることのテスト
+func TestSandboxManagerWaitForSandboxReadyProgress(t *testing.T) {
+	env := newTestEnv(t, 3)
+	ctx := context.Background()
+
+	session := env.newSession(t, "thread1")
+	sandbox, err := env.manager.CreateSandbox(ctx, session.ID, "thread1")
+	if err != nil {
+		t.Fatalf("Failed to create sandbox: %v", err)
+	}
+
+	progressCh := make(chan PodProgress, 10)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- env.manager.WaitForSandboxReady(ctx, sandbox.PodName, 5*time.Second, func(progress PodProgress) {
+			progressCh <- progress
+		})
+	}()
+
+	expectState := func(state PodState) PodProgress {
+		t.Helper()
+		select {
+		case progress := <-progressCh:
+			if progress.State != state {
+				t.Fatalf("Expected progress state %s, got %+v", state, progress)
+			}
+			return progress
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for progress state %s", state)
+		}
+		return PodProgress{}
+	}
+
+	expectState(PodStateScheduling)
+
+	env.setPodStatus(t, sandbox.PodName, unschedulableStatus)
+	if progress := expectState(PodStateUnschedulable); !strings.Contains(progress.Message, "Insufficient memory") {
+		t.Errorf("Expected scheduler message, got %q", progress.Message)
+	}
+
+	env.setPodStatus(t, sandbox.PodName, waitingStatus("ContainerCreating", ""))
+	if progress := expectState(PodStateStarting); progress.Reason != "ContainerCreating" {
+		t.Errorf("Expected ContainerCreating, got %q", progress.Reason)
+	}
+
+	env.setPodStatus(t, sandbox.PodName, runningStatus)
+	expectState(PodStateReady)
+
+	if err := <-errCh; err != nil {
+		t.Errorf("Expected sandbox to be ready, got %v", err)
+	}
+}
+
+// TestSandboxManagerWaitForSandboxReadyDeleted は待機中にPodが削除された場合のテスト
+func TestSandboxManagerWaitForSandboxReadyDeleted(t *testing.T) {
+	env := newTestEnv(t, 3)
+	ctx := context.Background()
+
+	session := env.newSession(t, "thread1")
+	sandbox, err := env.manager.CreateSandbox(ctx, session.ID, "thread1")
+	if err != nil {
+		t.Fatalf("Failed to create sandbox: %v", err)
+	}
+	env.setPodStatus(t, sandbox.PodName, waitingStatus("ContainerCreating", ""))
+
+	err = env.manager.WaitForSandboxReady(ctx, sandbox.PodName, 5*time.Second, func(progress PodProgress) {
+		if progress.State == PodStateStarting {
+			if err := env.clientset.CoreV1().Pods(testNamespace).Delete(ctx, sandbox.PodName, metav1.DeleteOptions{}); err != nil {
+				t.Errorf("Failed to delete pod: %v", err)
+			}
+		}
+	})
+
+	var failed *PodFailedError
+	if !errors.As(err, &failed) || failed.Progress.Reason != "Deleted" {
+		t.Errorf("Expected deleted failure, got %v", err)
+	}
+}
+
+// TestSandboxManagerExecuteCommand はサンドボックス内のコマンド実行のテスト
+func TestSandboxManagerExecuteCommand(t *testing.T) {
+	env := newTestEnv(t, 3)
+	ctx := context.Background()
+
+	session := env.newSession(t, "thread1")
+	sandbox, err := env.manager.CreateSandbox(ctx, session.ID, "thread1")
+	if err != nil {
+		t.Fatalf("Failed to create sandbox: %v", err)
+	}
+
+	// 実行中でないPodではコマンドを実行しない
+	if _, err := env.manager.ExecuteCommand(ctx, sandbox.PodName, "claude --version"); err == nil {
+		t.Fatal("Expected error for pod that is not running, got nil")
+	}
+	if len(env.executor.Calls()) != 0 {
+		t.Fatalf("Expected no exec calls, got %d", len(env.executor.Calls()))
+	}
+
+	env.setPodStatus(t, sandbox.PodName, runningStatus)
+
+	claudeOutput := strings.Join([]string{
+		`{"type":"system","subtype":"init","session_id":"abc"}`,
+		`{"type":"assistant","message":{"content":[{"type":"text","text":"Hello"}]}}`,
+		`{"type":"result","subtype":"success","result":"Hello","total_cost_usd":0.01,"usage":{"input_tokens":10,"output_tokens":2}}`,
+	}, "\n")
+	env.executor.Push(
+		FakeExecResult{Stdout: claudeOutput},
+		FakeExecResult{Stdout: "partial", Stderr: "warning: low disk"},
+		FakeExecResult{Err: errors.New("stream closed")},
+	)
+
+	output, err := env.manager.ExecuteCommand(ctx, sandbox.PodName, "echo 'hi' | claude -p --output-format stream-json --verbose")
+	if err != nil {
+		t.Fatalf("Failed to execute command: %v", err)
+	}
+	if output != claudeOutput {
+		t.Errorf("Expected replayed Claude output, got %q", output)
+	}
+
+	calls := env.executor.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 exec call, got %d", len(calls))
+	}
+	if calls[0].Namespace != testNamespace || calls[0].PodName != sandbox.PodName || calls[0].Container != sandboxContainerName {
+		t.Errorf("Unexpected exec target: %+v", calls[0])
+	}
+	if !strings.HasPrefix(calls[0].Stdin, "echo 'hi' | claude -p") || !strings.HasSuffix(calls[0].Stdin, "\nexit\n") {
+		t.Errorf("Unexpected stdin: %q", calls[0].Stdin)
+	}
+
+	output, err = env.manager.ExecuteCommand(ctx, sandbox.PodName, "df -h")
+	if err != nil {
+		t.Fatalf("Failed to execute command: %v", err)
+	}
+	if output != "partial\nSTDERR:\nwarning: low disk" {
+		t.Errorf("Expected stderr to be appended, got %q", output)
+	}
+
+	if _, err := env.manager.ExecuteCommand(ctx, sandbox.PodName, "ls"); err == nil {
+		t.Error("Expected exec error to be returned, got nil")
+	}
+}
@@ -0,0 +1,199 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// sandboxLabelSelector はサンドボックスPodを選択するラベルセレクター
+const sandboxLabelSelector = "app=claude-sandbox"
+
+// podWatcherResync はインフォーマーの再同期間隔
+const podWatcherResync = 10 * time.Minute
+
+// PodWatcher はサンドボックスPodの変更をインフォーマーで監視する
+// 変更はPod名ごとの購読者に通知される
+type PodWatcher struct {
+	factory informers.SharedInformerFactory
+	lister  listersv1.PodNamespaceLister
+
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]struct{}
+	listeners   []PodListener
+	stopped     chan struct{}
+}
+
+// PodListener はPodの追加・更新・削除時に呼び出される関数
+// 削除時はdeletedがtrueになり、podには最後に観測した状態が渡される
+type PodListener func(pod *corev1.Pod, deleted bool)
+
+// NewPodWatcher は指定名前空間のサンドボックスPodを監視するPodWatcherを作成する
+func NewPodWatcher(clientset kubernetes.Interface, namespace string) *PodWatcher {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, podWatcherResync,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = sandboxLabelSelector
+		}),
+	)
+	podInformer := factory.Core().V1().Pods()
+
+	w := &PodWatcher{
+		factory:     factory,
+		lister:      podInformer.Lister().Pods(namespace),
+		subscribers: make(map[string]map[chan struct{}]struct{}),
+		stopped:     make(chan struct{}),
+	}
+
+	_, err := podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { w.handleEvent(obj, false) },
+		UpdateFunc: func(_, obj interface{}) { w.handleEvent(obj, false) },
+		DeleteFunc: func(obj interface{}) { w.handleEvent(obj, true) },
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to register pod event handler")
+	}
+
+	return w
+}
+
+// Start はインフォーマーを開始し、キャッシュの同期を待機する
+// ctxが終了するとインフォーマーは停止し、待機中の購読者に通知される
+func (w *PodWatcher) Start(ctx context.Context) error {
+	w.factory.Start(ctx.Done())
+
+	for informerType, synced := range w.factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("failed to sync informer cache for %v", informerType)
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		w.factory.Shutdown()
+		close(w.stopped)
+	}()
+
+	logrus.Info("Sandbox pod watcher started")
+	return nil
+}
+
+// Stopped はインフォーマーの停止時にクローズされるチャネルを返す
+func (w *PodWatcher) Stopped() <-chan struct{} {
+	return w.stopped
+}
+
+// GetPod はキャッシュからPodを取得する
+// キャッシュに存在しない場合はnilを返す
+func (w *PodWatcher) GetPod(podName string) (*corev1.Pod, error) {
+	pod, err := w.lister.Get(podName)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get pod from cache: %w", err)
+	}
+	return pod, nil
+}
+
+// ListPods はキャッシュからセレクターに一致するPodを取得する
+func (w *PodWatcher) ListPods(selector labels.Selector) ([]*corev1.Pod, error) {
+	pods, err := w.lister.List(selector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods from cache: %w", err)
+	}
+	return pods, nil
+}
+
+// WaitForDeletion は指定Podがキャッシュからなくなるまで待機する
+func (w *PodWatcher) WaitForDeletion(ctx context.Context, podName string) error {
+	updates, unsubscribe := w.Subscribe(podName)
+	defer unsubscribe()
+
+	for {
+		pod, err := w.GetPod(podName)
+		if err != nil {
+			return err
+		}
+		if pod == nil {
+			return nil
+		}
+
+		select {
+		case <-updates:
+		case <-w.stopped:
+			return fmt.Errorf("pod watcher stopped while waiting for pod deletion")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Subscribe は指定Podの変更通知を受け取るチャネルを返す
+// 通知は合体されるため、受信後はGetPodで最新の状態を取得すること
+// 返される関数で購読を解除する
+func (w *PodWatcher) Subscribe(podName string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	w.mu.Lock()
+	if w.subscribers[podName] == nil {
+		w.subscribers[podName] = make(map[chan struct{}]struct{})
+	}
+	w.subscribers[podName][ch] = struct{}{}
+	w.mu.Unlock()
+
+	unsubscribe := func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subscribers[podName], ch)
+		if len(w.subscribers[podName]) == 0 {
+			delete(w.subscribers, podName)
+		}
+	}
+
+	return ch, unsubscribe
+}
+
+// AddListener はすべてのサンドボックスPodのイベントを受け取るリスナーを登録する
+// リスナーはインフォーマーのイベント処理中に順に呼び出されるため、長時間ブロックしないこと
+func (w *PodWatcher) AddListener(listener PodListener) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listeners = append(w.listeners, listener)
+}
+
+// handleEvent はPodのイベントを購読者とリスナーに通知する
+func (w *PodWatcher) handleEvent(obj interface{}, deleted bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+
+	w.mu.Lock()
+	for ch := range w.subscribers[pod.Name] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	listeners := append([]PodListener(nil), w.listeners...)
+	w.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(pod, deleted)
+	}
+}
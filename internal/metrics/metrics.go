@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/hirano00o/disclaude/internal/db"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+const namespace = "disclaude"
+
+var (
+	// SandboxCreations はサンドボックス作成の試行回数（result: success / failure）
+	SandboxCreations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sandbox_creations_total",
+		Help:      "Number of sandbox creation attempts partitioned by result.",
+	}, []string{"result"})
+
+	// SandboxCreateDuration はサンドボックス（Pod）作成APIの所要時間
+	SandboxCreateDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sandbox_create_duration_seconds",
+		Help:      "Time spent creating a sandbox pod.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// SandboxReadyDuration はサンドボックスが準備完了になるまでの待機時間（result: ready / failed / timeout）
+	SandboxReadyDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sandbox_ready_duration_seconds",
+		Help:      "Time spent waiting for a sandbox pod to become ready.",
+		Buckets:   []float64{1, 2, 5, 10, 20, 30, 60, 90, 120, 180, 300},
+	}, []string{"result"})
+
+	// SandboxFailures はセッション中にサンドボックスが予期せず停止した回数（reason: OOMKilled / Evicted / Deleted など）
+	SandboxFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sandbox_failures_total",
+		Help:      "Number of running sandboxes that terminated unexpectedly partitioned by reason.",
+	}, []string{"reason"})
+
+	// WarmPoolPods は待機中のサンドボックスPod数（起動中を含む）
+	WarmPoolPods = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "warm_pool_pods",
+		Help:      "Number of idle pre-started sandbox pods in the warm pool.",
+	})
+
+	// WarmPoolClaims はセッション開始時の待機サンドボックスの割り当て結果（result: hit / miss）
+	WarmPoolClaims = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "warm_pool_claims_total",
+		Help:      "Number of sandbox creations partitioned by whether a warm pool pod was handed out.",
+	}, []string{"result"})
+
+	// ClaudeTurnDuration はClaude Codeの1ターンの応答時間（result: success / failure）
+	ClaudeTurnDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "claude_turn_duration_seconds",
+		Help:      "Latency of a single Claude Code turn.",
+		Buckets:   []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"result"})
+
+	// ClaudeResponseBytes はClaude Codeの応答サイズ
+	ClaudeResponseBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "claude_response_bytes",
+		Help:      "Size of Claude Code responses in bytes.",
+		Buckets:   prometheus.ExponentialBuckets(64, 2, 12),
+	})
+
+	// ClaudeTokens はClaude Codeが消費したトークン数（direction: input / output）
+	ClaudeTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "claude_tokens_total",
+		Help:      "Number of tokens consumed by Claude Code partitioned by direction.",
+	}, []string{"direction"})
+
+	// ClaudeCostUSD はClaude Codeの累計コスト（USD）
+	ClaudeCostUSD = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "claude_cost_usd_total",
+		Help:      "Total cost of Claude Code turns in USD.",
+	})
+
+	// ExecErrors はサンドボックス内コマンド実行の失敗回数
+	ExecErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "exec_errors_total",
+		Help:      "Number of failed command executions inside sandboxes.",
+	})
+
+	// DiscordSendFailures はDiscordへのメッセージ送信失敗回数
+	DiscordSendFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discord_send_failures_total",
+		Help:      "Number of failed Discord message sends.",
+	})
+
+	// QueuedRequests はClaude Codeの応答待ちになっているリクエスト数
+	QueuedRequests = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queued_requests",
+		Help:      "Number of thread messages waiting for a Claude Code response.",
+	})
+)
+
+// StateSource はスクレイプ時に参照する状態の取得元
+type StateSource interface {
+	GetSandboxUsage() (*db.SandboxUsage, error)
+	CountActiveSessions() (int, error)
+}
+
+// stateCollector はスクレイプ時にデータベースから状態を読み出すコレクター
+type stateCollector struct {
+	source       StateSource
+	maxSandboxes int
+
+	activeSessions *prometheus.Desc
+	capacityUsed   *prometheus.Desc
+	capacityMax    *prometheus.Desc
+}
+
+// NewStateCollector はセッション数と容量を公開するコレクターを作成する
+func NewStateCollector(source StateSource, maxSandboxes int) prometheus.Collector {
+	return &stateCollector{
+		source:       source,
+		maxSandboxes: maxSandboxes,
+		activeSessions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "active_sessions"),
+			"Number of active Claude Code sessions.",
+			nil, nil,
+		),
+		capacityUsed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "sandbox", "capacity_used"),
+			"Number of sandbox slots currently in use.",
+			nil, nil,
+		),
+		capacityMax: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "sandbox", "capacity_max"),
+			"Maximum number of concurrent sandboxes (MAX_SANDBOXES).",
+			nil, nil,
+		),
+	}
+}
+
+// Describe はprometheus.Collectorを実装する
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.activeSessions
+	ch <- c.capacityUsed
+	ch <- c.capacityMax
+}
+
+// Collect はprometheus.Collectorを実装する
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.capacityMax, prometheus.GaugeValue, float64(c.maxSandboxes))
+
+	if count, err := c.source.CountActiveSessions(); err != nil {
+		logrus.WithError(err).Warn("Failed to collect active sessions metric")
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.activeSessions, prometheus.GaugeValue, float64(count))
+	}
+
+	if usage, err := c.source.GetSandboxUsage(); err != nil {
+		logrus.WithError(err).Warn("Failed to collect sandbox usage metric")
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.capacityUsed, prometheus.GaugeValue, float64(usage.CurrentCount))
+	}
+}
+
+// Handler は /metrics 用のHTTPハンドラーを返す
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,152 @@
+// Package render はBotがDiscordに送信するメッセージ（埋め込みとボタン）を組み立てる
+package render
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// 埋め込みの色
+const (
+	ColorSuccess = 0x2ecc71
+	ColorError   = 0xe74c3c
+	ColorInfo    = 0x3498db
+)
+
+// セッション操作のボタンのカスタムIDの接頭辞（後ろにセッションIDが続く）
+const (
+	CloseSessionButtonPrefix      = "close_session:"
+	ExtendSessionButtonPrefix     = "extend_session:"
+	DownloadWorkspaceButtonPrefix = "download_workspace:"
+	ViewDiffButtonPrefix          = "view_diff:"
+)
+
+// Discordの埋め込みの文字数の上限
+const (
+	maxDescriptionLength = 4096
+	maxFieldValueLength  = 1024
+)
+
+// Success は成功を示す埋め込みを作成する
+func Success(title, description string, fields ...*discordgo.MessageEmbedField) *discordgo.MessageEmbed {
+	return embed(ColorSuccess, "✅ "+title, description, fields)
+}
+
+// Info は情報を示す埋め込みを作成する
+func Info(title, description string, fields ...*discordgo.MessageEmbedField) *discordgo.MessageEmbed {
+	return embed(ColorInfo, title, description, fields)
+}
+
+// Error はエラーを示すメッセージを作成する
+func Error(message string) *discordgo.MessageSend {
+	return Message(embed(ColorError, "❌ エラー", message, nil))
+}
+
+// Message は埋め込みとボタンの行からメッセージを作成する
+func Message(embed *discordgo.MessageEmbed, rows ...discordgo.MessageComponent) *discordgo.MessageSend {
+	return &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{embed},
+		Components: rows,
+	}
+}
+
+// Field は埋め込みのフィールドを作成する（値が空の場合は「なし」と表示する）
+func Field(name string, inline bool, lines ...string) *discordgo.MessageEmbedField {
+	value := strings.Join(lines, "\n")
+	if value == "" {
+		value = "なし"
+	}
+
+	return &discordgo.MessageEmbedField{
+		Name:   name,
+		Value:  truncate(value, maxFieldValueLength),
+		Inline: inline,
+	}
+}
+
+// Bullets は各行を箇条書きにする
+func Bullets(lines ...string) []string {
+	bullets := make([]string, len(lines))
+	for i, line := range lines {
+		bullets[i] = "• " + line
+	}
+	return bullets
+}
+
+// SessionActions はセッションの操作ボタンの行を作成する
+// extendは延長ボタンのラベルに表示する延長時間（0の場合は延長ボタンを表示しない）
+func SessionActions(sessionID int, extend time.Duration) discordgo.ActionsRow {
+	buttons := []discordgo.MessageComponent{
+		discordgo.Button{
+			Label:    "セッションを終了",
+			Style:    discordgo.DangerButton,
+			CustomID: fmt.Sprintf("%s%d", CloseSessionButtonPrefix, sessionID),
+			Emoji:    discordgo.ComponentEmoji{Name: "🛑"},
+		},
+	}
+
+	if extend > 0 {
+		buttons = append(buttons, discordgo.Button{
+			Label:    fmt.Sprintf("延長（+%s）", FormatDuration(extend)),
+			Style:    discordgo.SecondaryButton,
+			CustomID: fmt.Sprintf("%s%d", ExtendSessionButtonPrefix, sessionID),
+			Emoji:    discordgo.ComponentEmoji{Name: "⏱️"},
+		})
+	}
+
+	buttons = append(buttons,
+		discordgo.Button{
+			Label:    "ワークスペースをダウンロード",
+			Style:    discordgo.SecondaryButton,
+			CustomID: fmt.Sprintf("%s%d", DownloadWorkspaceButtonPrefix, sessionID),
+			Emoji:    discordgo.ComponentEmoji{Name: "📦"},
+		},
+		discordgo.Button{
+			Label:    "差分を表示",
+			Style:    discordgo.SecondaryButton,
+			CustomID: fmt.Sprintf("%s%d", ViewDiffButtonPrefix, sessionID),
+			Emoji:    discordgo.ComponentEmoji{Name: "📝"},
+		},
+	)
+
+	return discordgo.ActionsRow{Components: buttons}
+}
+
+// FormatDuration は時間を秒単位に丸めて表示用に整形する
+func FormatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+
+	// 分・時間ちょうどの場合は末尾の0秒を省く（30m0s → 30m）
+	formatted := d.String()
+	if d >= time.Minute && d%time.Minute == 0 {
+		formatted = strings.TrimSuffix(formatted, "0s")
+	}
+	if d >= time.Hour && d%time.Hour == 0 {
+		formatted = strings.TrimSuffix(formatted, "0m")
+	}
+	return formatted
+}
+
+// embed は色・タイトル・説明・フィールドから埋め込みを作成する
+func embed(color int, title, description string, fields []*discordgo.MessageEmbedField) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       title,
+		Description: truncate(description, maxDescriptionLength),
+		Color:       color,
+		Fields:      fields,
+	}
+}
+
+// truncate は文字数の上限を超える文字列を切り詰める
+func truncate(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+
+	runes := []rune(s)
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,222 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// update はゴールデンファイルを現在の出力で更新する（go test ./internal/render -update）
+var update = flag.Bool("update", false, "update golden files")
+
+// TestGolden はメッセージの組み立て結果をゴールデンファイルと比較するテスト
+func TestGolden(t *testing.T) {
+	activeSession := &SessionStatus{
+		ID:          7,
+		SandboxName: "claude-sandbox-200000000000000001",
+		Elapsed:     95*time.Second + 400*time.Millisecond,
+		Usage:       &SessionUsage{Turns: 3, InputTokens: 1200, OutputTokens: 340, CostUSD: 0.0123},
+	}
+
+	manySandboxes := make([]string, 12)
+	for i := range manySandboxes {
+		manySandboxes[i] = "claude-sandbox-" + string(rune('a'+i)) + " (Running)"
+	}
+
+	tests := []struct {
+		name    string
+		message *discordgo.MessageSend
+	}{
+		{
+			name: "session_started",
+			message: SessionStarted(SessionView{
+				ID:          7,
+				SandboxName: "claude-sandbox-200000000000000001",
+				Owner:       "alice",
+				Location:    "このスレッド",
+				Extend:      30 * time.Minute,
+			}),
+		},
+		{
+			name: "session_started_without_extend",
+			message: SessionStarted(SessionView{
+				ID:          8,
+				SandboxName: "claude-sandbox-dm-1",
+				Owner:       "alice",
+				Location:    "このDM",
+			}),
+		},
+		{
+			name:    "session_closed",
+			message: SessionClosed(ClosedSessionView{ID: 7, SandboxName: "claude-sandbox-200000000000000001", Elapsed: time.Hour + 2*time.Minute + 3*time.Second}),
+		},
+		{
+			name: "status_active",
+			message: Status(StatusView{
+				Username:          "owner",
+				Role:              "owner",
+				Expiry:            "無期限",
+				SandboxesInUse:    1,
+				MaxSandboxes:      3,
+				RemainingCapacity: 2,
+				GuildUsage:        "このサーバー: 1/2",
+				Session:           activeSession,
+				Sandboxes:         []string{"claude-sandbox-200000000000000001 (Running)"},
+				RoleName:          "owner",
+				Capabilities:      []string{"create_sandbox", "manage_users"},
+				AdminCommands:     []string{"`/claude add user <ID>` - ユーザー追加"},
+				Extend:            30 * time.Minute,
+			}),
+		},
+		{
+			name: "status_idle",
+			message: Status(StatusView{
+				Username:          "alice",
+				Role:              "user",
+				Expiry:            "2026-10-20 12:00",
+				MaxSandboxes:      3,
+				RemainingCapacity: 3,
+				Sandboxes:         manySandboxes,
+				RoleName:          "viewer",
+			}),
+		},
+		{
+			name:    "user_added",
+			message: UserAdded(UserView{Name: "alice", ID: "300000000000000002", Expiry: "無期限", Actor: "owner"}),
+		},
+		{
+			name:    "owner_promoted",
+			message: OwnerPromoted(UserView{Name: "alice", ID: "300000000000000002", Actor: "owner"}),
+		},
+		{
+			name:    "user_removed",
+			message: UserRemoved(UserView{Name: "alice", ID: "300000000000000002", Actor: "owner"}, 2),
+		},
+		{
+			name:    "owner_demoted",
+			message: OwnerDemoted(UserView{Name: "alice", ID: "300000000000000002", Actor: "owner"}),
+		},
+		{
+			name:    "session_extended",
+			message: SessionExtended(7, "owner", 30*time.Minute),
+		},
+		{
+			name:    "workspace_archive",
+			message: WorkspaceArchive(7, "alice", bytes.Repeat([]byte{0x1f}, 2048)),
+		},
+		{
+			name:    "workspace_diff_clean",
+			message: WorkspaceDiff(7, "", ""),
+		},
+		{
+			name:    "workspace_diff_inline",
+			message: WorkspaceDiff(7, " M main.go\n?? notes.txt", "--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-package foo\n+package main"),
+		},
+		{
+			name:    "workspace_diff_file",
+			message: WorkspaceDiff(7, " M main.go", strings.Repeat("+line\n", 1000)),
+		},
+		{
+			name:    "error",
+			message: Error("このセッションを終了する権限がありません"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.MarshalIndent(newGoldenMessage(t, tt.message), "", "  ")
+			if err != nil {
+				t.Fatalf("Failed to marshal message: %v", err)
+			}
+			got = append(got, '\n')
+
+			path := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read golden file: %v", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("Message does not match %s (run with -update to regenerate):\n%s", path, got)
+			}
+		})
+	}
+}
+
+// goldenMessage はゴールデンファイルに記録するメッセージ（JSONに含まれない添付ファイルの情報を加える）
+type goldenMessage struct {
+	*discordgo.MessageSend
+	Files []goldenFile `json:"files,omitempty"`
+}
+
+// goldenFile はゴールデンファイルに記録する添付ファイルの情報
+type goldenFile struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+}
+
+// newGoldenMessage はメッセージと添付ファイルの情報からgoldenMessageを作成する
+func newGoldenMessage(t *testing.T, message *discordgo.MessageSend) goldenMessage {
+	t.Helper()
+
+	golden := goldenMessage{MessageSend: message}
+	for _, file := range message.Files {
+		content, err := io.ReadAll(file.Reader)
+		if err != nil {
+			t.Fatalf("Failed to read file %s: %v", file.Name, err)
+		}
+		golden.Files = append(golden.Files, goldenFile{Name: file.Name, ContentType: file.ContentType, Size: len(content)})
+	}
+	return golden
+}
+
+// TestFormatDuration は時間の表示形式のテスト
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		expected string
+	}{
+		{30 * time.Minute, "30m"},
+		{2 * time.Hour, "2h"},
+		{90 * time.Minute, "1h30m"},
+		{95*time.Second + 400*time.Millisecond, "1m35s"},
+		{1500 * time.Millisecond, "2s"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatDuration(tt.duration); got != tt.expected {
+			t.Errorf("FormatDuration(%s) = %q, expected %q", tt.duration, got, tt.expected)
+		}
+	}
+}
+
+// TestFieldTruncate はフィールドの値が上限を超える場合に切り詰めるテスト
+func TestFieldTruncate(t *testing.T) {
+	long := make([]rune, maxFieldValueLength+10)
+	for i := range long {
+		long[i] = 'あ'
+	}
+
+	field := Field("long", false, string(long))
+	if got := len([]rune(field.Value)); got != maxFieldValueLength {
+		t.Errorf("Expected value truncated to %d runes, got %d", maxFieldValueLength, got)
+	}
+
+	if empty := Field("empty", false); empty.Value != "なし" {
+		t.Errorf("Expected empty field to show なし, got %q", empty.Value)
+	}
+}
@@ -0,0 +1,193 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxListedSandboxes はステータスに表示するサンドボックスの最大数
+const maxListedSandboxes = 10
+
+// SessionView は開始したセッションの表示内容
+type SessionView struct {
+	ID          int
+	SandboxName string
+	Owner       string
+	// Location はセッションの会話場所（「このスレッド」または「このDM」）
+	Location string
+	// Extend は延長ボタン1回で延ばす時間（0の場合は延長ボタンを表示しない）
+	Extend time.Duration
+}
+
+// ClosedSessionView は終了したセッションの表示内容
+type ClosedSessionView struct {
+	ID          int
+	SandboxName string
+	Elapsed     time.Duration
+}
+
+// StatusView は `/claude status` の表示内容
+type StatusView struct {
+	Username string
+	Role     string
+	Expiry   string
+
+	SandboxesInUse    int
+	MaxSandboxes      int
+	RemainingCapacity int
+	// GuildUsage はサーバーごとのサンドボックス数の上限を設定している場合の使用状況（設定していない場合は空文字列）
+	GuildUsage string
+
+	// Session は実行したチャンネルのアクティブなセッション（ない場合はnil）
+	Session *SessionStatus
+	// Sandboxes は稼働中のサンドボックスの名前とフェーズ
+	Sandboxes []string
+
+	// RoleName は解決したロールの名前（解決できなかった場合は空文字列）
+	RoleName      string
+	Capabilities  []string
+	AdminCommands []string
+
+	// Extend は延長ボタン1回で延ばす時間（0の場合は延長ボタンを表示しない）
+	Extend time.Duration
+}
+
+// SessionStatus はステータスに表示するセッションの状況
+type SessionStatus struct {
+	ID          int
+	SandboxName string
+	Elapsed     time.Duration
+	// Usage はセッションの使用量（取得できなかった場合はnil）
+	Usage *SessionUsage
+}
+
+// SessionUsage はセッションの使用量
+type SessionUsage struct {
+	Turns        int
+	InputTokens  int64
+	OutputTokens int64
+	CostUSD      float64
+}
+
+// SessionStarted はセッションの準備完了を通知するメッセージを作成する
+func SessionStarted(view SessionView) *discordgo.MessageSend {
+	embed := Success("Claude Codeサンドボックスが準備完了しました！",
+		fmt.Sprintf("%s内でClaude Codeと自由に会話できます。\nセッション終了時は `/claude close` を実行するか、下のボタンを使用してください。", view.Location),
+		Field("🏷️ セッション情報", false, Bullets(
+			fmt.Sprintf("セッションID: %d", view.ID),
+			"サンドボックス名: "+view.SandboxName,
+			"作成者: "+view.Owner,
+			"CPU: 1GB, メモリ: 2GB",
+		)...),
+		Field("🔧 利用可能な機能", true, Bullets(
+			"ファイル作成・編集",
+			"コード実行とテスト",
+			"プロジェクト管理",
+			"Git操作",
+		)...),
+		Field("⚠️ 注意事項", true, Bullets(
+			"ファイルは一時的なものです",
+			"セッション終了時にすべてのデータが削除されます",
+		)...),
+	)
+
+	return Message(embed, SessionActions(view.ID, view.Extend))
+}
+
+// SessionClosed はセッションの終了を通知するメッセージを作成する
+func SessionClosed(view ClosedSessionView) *discordgo.MessageSend {
+	embed := Success("セッションが正常に終了しました",
+		"このセッションで作成されたファイルやデータはすべて削除されました。\n新しいセッションを開始するには `/claude start` を実行してください。",
+		Field("🏷️ 終了したセッション", false, Bullets(
+			fmt.Sprintf("セッションID: %d", view.ID),
+			"サンドボックス名: "+view.SandboxName,
+			"実行時間: "+FormatDuration(view.Elapsed),
+		)...),
+	)
+
+	return Message(embed)
+}
+
+// Status はシステムと現在のチャンネルのステータスのメッセージを作成する
+// アクティブなセッションがある場合はセッションの操作ボタンを付ける
+func Status(view StatusView) *discordgo.MessageSend {
+	usage := []string{
+		fmt.Sprintf("使用中: %d/%d", view.SandboxesInUse, view.MaxSandboxes),
+		fmt.Sprintf("利用可能: %d", view.RemainingCapacity),
+	}
+	if view.GuildUsage != "" {
+		usage = append(usage, view.GuildUsage)
+	}
+
+	fields := []*discordgo.MessageEmbedField{
+		Field("👤 ユーザー情報", true, Bullets(
+			"名前: "+view.Username,
+			"権限: "+view.Role,
+			"有効期限: "+view.Expiry,
+		)...),
+		Field("🏗️ サンドボックス使用状況", true, Bullets(usage...)...),
+		Field("📍 現在のチャンネル", false, Bullets(sessionStatusLines(view.Session)...)...),
+	}
+
+	if len(view.Sandboxes) > 0 {
+		sandboxes := view.Sandboxes
+		if len(sandboxes) > maxListedSandboxes {
+			sandboxes = append(sandboxes[:maxListedSandboxes:maxListedSandboxes], fmt.Sprintf("... 他 %d 個", len(view.Sandboxes)-maxListedSandboxes))
+		}
+		fields = append(fields, Field("🔧 アクティブなサンドボックス一覧", false, Bullets(sandboxes...)...))
+	}
+
+	if view.RoleName != "" {
+		fields = append(fields, Field("🔑 ロール", false, fmt.Sprintf("%s（権限: %s）", view.RoleName, joinOrNone(view.Capabilities))))
+	}
+
+	if len(view.AdminCommands) > 0 {
+		fields = append(fields, Field("👑 利用可能な管理コマンド", false, Bullets(view.AdminCommands...)...))
+	}
+
+	message := Message(Info("📊 Discord Claude システム ステータス", "", fields...))
+	if view.Session != nil {
+		message.Components = []discordgo.MessageComponent{SessionActions(view.Session.ID, view.Extend)}
+	}
+	return message
+}
+
+// sessionStatusLines は現在のチャンネルのセッションの状況を行ごとに返す
+func sessionStatusLines(session *SessionStatus) []string {
+	if session == nil {
+		return []string{"セッション: なし ⭕"}
+	}
+
+	lines := []string{
+		"セッション: アクティブ ✅",
+		fmt.Sprintf("セッションID: %d", session.ID),
+		"実行時間: " + FormatDuration(session.Elapsed),
+		"サンドボックス: " + session.SandboxName,
+	}
+	if session.Usage != nil {
+		lines = append(lines,
+			fmt.Sprintf("ターン数: %d", session.Usage.Turns),
+			fmt.Sprintf("トークン: 入力 %d / 出力 %d", session.Usage.InputTokens, session.Usage.OutputTokens),
+			fmt.Sprintf("コスト: $%.4f", session.Usage.CostUSD),
+		)
+	}
+	return lines
+}
+
+// joinOrNone は要素をカンマ区切りで連結する（空の場合は「なし」）
+func joinOrNone(items []string) string {
+	if len(items) == 0 {
+		return "なし"
+	}
+
+	return strings.Join(items, ", ")
+}
+
+// SessionExtended はセッションの最大利用時間の延長を通知するメッセージを作成する
+func SessionExtended(sessionID int, actor string, extension time.Duration) *discordgo.MessageSend {
+	return Message(Success("セッションを延長しました",
+		fmt.Sprintf("%sさんがセッション `#%d` の最大利用時間を %s 延長しました。", actor, sessionID, FormatDuration(extension))))
+}
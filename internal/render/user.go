@@ -0,0 +1,81 @@
+package render
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// UserView はユーザー管理の操作対象と実行者の表示内容
+type UserView struct {
+	Name string
+	ID   string
+	// Expiry はアクセスの有効期限（ユーザーの追加時のみ表示する）
+	Expiry string
+	Actor  string
+}
+
+// generalUserCapabilities は一般ユーザーの権限の説明
+var generalUserCapabilities = Bullets(
+	"Claude Codeサンドボックスの作成・使用",
+	"自分のセッションの管理",
+)
+
+// UserAdded はユーザーの追加を通知するメッセージを作成する
+func UserAdded(view UserView) *discordgo.MessageSend {
+	return Message(Success("ユーザーを追加しました", "",
+		Field("👤 追加されたユーザー", true, Bullets(
+			"名前: "+view.Name,
+			"ID: "+view.ID,
+			"権限: 一般ユーザー",
+			"有効期限: "+view.Expiry,
+			"追加者: "+view.Actor,
+		)...),
+		Field("🎯 権限", true, generalUserCapabilities...),
+	))
+}
+
+// OwnerPromoted はオーナーへの昇格を通知するメッセージを作成する
+func OwnerPromoted(view UserView) *discordgo.MessageSend {
+	return Message(Success("ユーザーをオーナーに昇格しました", "",
+		Field("👑 昇格されたオーナー", true, Bullets(
+			"名前: "+view.Name,
+			"ID: "+view.ID,
+			"権限: オーナー",
+			"昇格者: "+view.Actor,
+		)...),
+		Field("🎯 オーナー権限", true, Bullets(
+			"Claude Codeサンドボックスの作成・使用",
+			"全セッションの管理",
+			"ユーザー管理（追加・削除・権限変更）",
+		)...),
+	))
+}
+
+// UserRemoved はユーザーの削除と、終了したセッションの数を通知するメッセージを作成する
+func UserRemoved(view UserView, terminated int) *discordgo.MessageSend {
+	return Message(Success("ユーザーを削除しました", "",
+		Field("👤 削除されたユーザー", true, Bullets(
+			"名前: "+view.Name,
+			"ID: "+view.ID,
+			"削除者: "+view.Actor,
+		)...),
+		Field("🛑 終了したセッション", true,
+			fmt.Sprintf("%d 件", terminated),
+			"サンドボックスを削除し、各スレッドに終了を通知しました。",
+		),
+	))
+}
+
+// OwnerDemoted はオーナーから一般ユーザーへの降格を通知するメッセージを作成する
+func OwnerDemoted(view UserView) *discordgo.MessageSend {
+	return Message(Success("オーナーを一般ユーザーに降格しました", "",
+		Field("👤 降格されたユーザー", true, Bullets(
+			"名前: "+view.Name,
+			"ID: "+view.ID,
+			"新しい権限: 一般ユーザー",
+			"実行者: "+view.Actor,
+		)...),
+		Field("🎯 現在の権限", true, generalUserCapabilities...),
+	))
+}
@@ -0,0 +1,66 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxInlineDiffLength は埋め込みに直接表示する差分の最大文字数（超える場合はファイルで添付する）
+const maxInlineDiffLength = 3800
+
+// WorkspaceArchive はワークスペースのアーカイブ（tar.gz）を添付したメッセージを作成する
+func WorkspaceArchive(sessionID int, requester string, archive []byte) *discordgo.MessageSend {
+	message := Message(Info("📦 ワークスペース",
+		fmt.Sprintf("%sさんの要求により、セッション `#%d` の `/workspace` をアーカイブしました（%s）。", requester, sessionID, formatBytes(len(archive)))))
+	message.Files = []*discordgo.File{{
+		Name:        fmt.Sprintf("workspace-%d.tar.gz", sessionID),
+		ContentType: "application/gzip",
+		Reader:      bytes.NewReader(archive),
+	}}
+	return message
+}
+
+// WorkspaceDiff はワークスペースのGitの差分を表示するメッセージを作成する
+// statusは `git status --short` の出力、diffは `git diff` の出力で、差分が長い場合はファイルで添付する
+func WorkspaceDiff(sessionID int, status, diff string) *discordgo.MessageSend {
+	title := fmt.Sprintf("📝 セッション `#%d` の差分", sessionID)
+	if status == "" && diff == "" {
+		return Message(Info(title, "コミットされていない変更はありません。"))
+	}
+
+	fields := []*discordgo.MessageEmbedField{Field("変更されたファイル", false, "```\n"+truncate(status, maxFieldValueLength-8)+"\n```")}
+	if status == "" {
+		fields = nil
+	}
+
+	if diff == "" {
+		return Message(Info(title, "追跡されていないファイルのみ変更されています。", fields...))
+	}
+
+	if utf8.RuneCountInString(diff) <= maxInlineDiffLength {
+		return Message(Info(title, "```diff\n"+diff+"\n```", fields...))
+	}
+
+	message := Message(Info(title, "差分が長いため、ファイルで添付します。", fields...))
+	message.Files = []*discordgo.File{{
+		Name:        fmt.Sprintf("workspace-%d.diff", sessionID),
+		ContentType: "text/x-diff",
+		Reader:      bytes.NewReader([]byte(diff)),
+	}}
+	return message
+}
+
+// formatBytes はバイト数を表示用に整形する
+func formatBytes(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}